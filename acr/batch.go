@@ -0,0 +1,168 @@
+package acr
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Function reconstructing the ancestral states of one character on a tree
+// (e.g. a call to ParsimonyAcrNodes, or the joint states of MLAcr or SankoffAcr).
+// It returns the possible state(s) of each internal node ("*" if all states
+// are possible).
+type AcrFunc func(t *tree.Tree, tipCharacters map[string]string) (map[*tree.Node][]string, error)
+
+// Change of state of a character along a branch
+type StateChange struct {
+	Parent *tree.Node
+	Child  *tree.Node
+	From   []string // State(s) of the parent
+	To     []string // State(s) of the child
+}
+
+// Ancestral reconstruction of one character of a batch
+type CharacterAcr struct {
+	Name    string                        // Name of the character
+	States  []string                      // States of the character (alphabetical order)
+	Nodes   map[*tree.Node][]string       // Reconstructed state(s) of each node
+	Changes []*StateChange                // Branches along which the state changes
+	Counts  map[string]map[string]float64 // Number of transitions from a state to another
+}
+
+// Reconstructs the ancestral states of several characters on the tree, using the
+// given reconstruction function for each character.
+//
+// characters: names of the characters
+// traits: mapping between tipnames and the states of all the characters (in the order of characters)
+//
+// The state of a character changes along a branch if the parent and child have no
+// common possible state. The transition counts of each change are distributed
+// equally among all the pairs of possible states of the parent and the child
+// (e.g. a change from A|B to C counts as 0.5 A>C and 0.5 B>C).
+//
+// Nodes are annotated with the states of all the characters in their comment
+// field (&trait1=A,trait2=B|C). Comments of the branches are kept.
+//
+// Returns the reconstruction of each character, in the order of characters.
+func BatchAcr(t *tree.Tree, characters []string, traits map[string][]string, fn AcrFunc) ([]*CharacterAcr, error) {
+	var nodestates map[*tree.Node][]string
+	var err error
+
+	edgecomments := make(map[*tree.Edge][]string)
+	for _, e := range t.Edges() {
+		edgecomments[e] = append([]string(nil), e.Comments()...)
+	}
+
+	results := make([]*CharacterAcr, len(characters))
+	for c, name := range characters {
+		tipCharacters := make(map[string]string)
+		for tip, states := range traits {
+			if len(states) != len(characters) {
+				return nil, fmt.Errorf("Tip %s has %d states and there are %d characters", tip, len(states), len(characters))
+			}
+			tipCharacters[tip] = states[c]
+		}
+		if nodestates, err = fn(t, tipCharacters); err != nil {
+			return nil, fmt.Errorf("Character %s: %v", name, err)
+		}
+		res := &CharacterAcr{Name: name, Nodes: make(map[*tree.Node][]string)}
+		seen := make(map[string]bool)
+		for _, n := range t.Nodes() {
+			var states []string
+			if n.Tip() {
+				states = []string{tipCharacters[n.Name()]}
+			} else if states = nodestates[n]; len(states) == 0 {
+				return nil, fmt.Errorf("Character %s: internal node %d has no reconstructed state", name, n.Id())
+			}
+			res.Nodes[n] = states
+			for _, s := range states {
+				if s != "*" && !seen[s] {
+					res.States = append(res.States, s)
+					seen[s] = true
+				}
+			}
+		}
+		sort.Strings(res.States)
+		// All states are possible
+		for n, states := range res.Nodes {
+			if len(states) == 1 && states[0] == "*" {
+				res.Nodes[n] = res.States
+			}
+		}
+		res.Changes = StateChanges(t, res.Nodes)
+		res.Counts = TransitionCounts(res.Changes)
+		results[c] = res
+	}
+
+	for e, comments := range edgecomments {
+		e.ClearComments()
+		for _, c := range comments {
+			e.AddComment(c)
+		}
+	}
+	assignBatchStatesToTree(t, results)
+	return results, nil
+}
+
+// Returns the branches along which the state of a character changes, i.e. whose
+// parent and child have no common possible state, in the preorder traversal of the tree
+func StateChanges(t *tree.Tree, states map[*tree.Node][]string) []*StateChange {
+	changes := make([]*StateChange, 0)
+	t.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		if prev == nil {
+			return true
+		}
+		for _, from := range states[prev] {
+			for _, to := range states[cur] {
+				if from == to {
+					return true
+				}
+			}
+		}
+		changes = append(changes, &StateChange{Parent: prev, Child: cur, From: states[prev], To: states[cur]})
+		return true
+	})
+	return changes
+}
+
+// Returns the number of transitions from each state to each other state: the count
+// of each change is distributed equally among all the pairs of possible states of
+// the parent and the child
+func TransitionCounts(changes []*StateChange) map[string]map[string]float64 {
+	counts := make(map[string]map[string]float64)
+	for _, c := range changes {
+		w := 1.0 / float64(len(c.From)*len(c.To))
+		for _, from := range c.From {
+			if _, ok := counts[from]; !ok {
+				counts[from] = make(map[string]float64)
+			}
+			for _, to := range c.To {
+				counts[from][to] += w
+			}
+		}
+	}
+	return counts
+}
+
+// Annotates nodes with the states of all the characters
+func assignBatchStatesToTree(t *tree.Tree, results []*CharacterAcr) {
+	var buffer bytes.Buffer
+
+	for _, n := range t.Nodes() {
+		buffer.Reset()
+		buffer.WriteRune('&')
+		for i, res := range results {
+			if i > 0 {
+				buffer.WriteRune(',')
+			}
+			buffer.WriteString(res.Name)
+			buffer.WriteRune('=')
+			buffer.WriteString(strings.Join(res.Nodes[n], "|"))
+		}
+		n.ClearComments()
+		n.AddComment(buffer.String())
+	}
+}
@@ -0,0 +1,113 @@
+package acr
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+func TestBatchAcr(t *testing.T) {
+	tr, _ := newick.NewParser(strings.NewReader("((A,B)n1:1[c1],(C,D)n2,E)root;")).Parse()
+	characters := []string{"loc", "host"}
+	traits := map[string][]string{
+		"A": {"X", "h1"},
+		"B": {"X", "h2"},
+		"C": {"Y", "h1"},
+		"D": {"Y", "h1"},
+		"E": {"X", "h2"},
+	}
+	// Fixed reconstructions, with ambiguous states
+	fixed := map[string]map[string]string{
+		"X":  {"root": "X", "n1": "X", "n2": "Y"},
+		"h1": {"root": "h2", "n1": "h1,h2", "n2": "h1"},
+	}
+	fn := func(t *tree.Tree, tipCharacters map[string]string) (map[*tree.Node][]string, error) {
+		nodestates := make(map[*tree.Node][]string)
+		for _, n := range t.Nodes() {
+			if !n.Tip() {
+				nodestates[n] = strings.Split(fixed[tipCharacters["A"]][n.Name()], ",")
+			}
+		}
+		return nodestates, nil
+	}
+	batch, err := BatchAcr(tr, characters, traits, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch) != 2 || batch[0].Name != "loc" || batch[1].Name != "host" {
+		t.Fatalf("There should be 2 reconstructions (loc, host)")
+	}
+
+	// loc: one change X>Y on the branch to n2
+	if len(batch[0].Changes) != 1 || batch[0].Changes[0].Child.Name() != "n2" || batch[0].Counts["X"]["Y"] != 1 {
+		t.Errorf("loc should change once from X to Y on the branch to n2")
+	}
+	// host: root(h2)>n1(h1|h2) and n1>A(h1) are not changes (common state),
+	// root(h2)>n2(h1) is a change
+	changes := make([]string, 0)
+	for _, c := range batch[1].Changes {
+		changes = append(changes, c.Child.Name()+":"+strings.Join(c.From, "|")+">"+strings.Join(c.To, "|"))
+	}
+	if strings.Join(changes, " ") != "n2:h2>h1" {
+		t.Errorf("host should change on branch to n2, and changes are %v", changes)
+	}
+	if math.Abs(batch[1].Counts["h2"]["h1"]-1) > 1e-10 || len(batch[1].States) != 2 {
+		t.Errorf("host should have 1 transition h2>h1 and 2 states, and has %f transitions and %v states", batch[1].Counts["h2"]["h1"], batch[1].States)
+	}
+
+	exptree := "((A[&loc=X,host=h1],B[&loc=X,host=h2])n1[&loc=X,host=h1|h2]:1[c1],(C[&loc=Y,host=h1],D[&loc=Y,host=h1])n2[&loc=Y,host=h1],E[&loc=X,host=h2])root[&loc=X,host=h2];"
+	if tr.Newick() != exptree {
+		t.Errorf("Annotated tree should be %s and is %s", exptree, tr.Newick())
+	}
+
+	// Ambiguous changes
+	counts := TransitionCounts([]*StateChange{{From: []string{"A", "B"}, To: []string{"C"}}})
+	if counts["A"]["C"] != 0.5 || counts["B"]["C"] != 0.5 {
+		t.Errorf("A|B>C should count 0.5 A>C and 0.5 B>C")
+	}
+
+	// Same states as single character parsimony reconstructions
+	tr, _ = newick.NewParser(strings.NewReader("((A,B)n1,(C,D)n2,E)root;")).Parse()
+	fn = func(t *tree.Tree, tipCharacters map[string]string) (map[*tree.Node][]string, error) {
+		return ParsimonyAcrNodes(t, tipCharacters, ALGO_ACCTRAN, false)
+	}
+	if batch, err = BatchAcr(tr, characters, traits, fn); err != nil {
+		t.Fatal(err)
+	}
+	for c, name := range characters {
+		tips := make(map[string]string)
+		for tip, states := range traits {
+			tips[tip] = states[c]
+		}
+		single, _ := newick.NewParser(strings.NewReader("((A,B)n1,(C,D)n2,E)root;")).Parse()
+		statemap, _ := ParsimonyAcr(single, tips, ALGO_ACCTRAN, false)
+		for _, n := range tr.Nodes() {
+			if !n.Tip() && strings.Join(batch[c].Nodes[n], ",") != statemap[n.Name()] {
+				t.Errorf("State of %s for %s should be %s and is %v", n.Name(), name, statemap[n.Name()], batch[c].Nodes[n])
+			}
+		}
+	}
+
+	// Internal nodes sharing the same name
+	tr, _ = newick.NewParser(strings.NewReader("((A,B)n,(C,D)n,E)root;")).Parse()
+	if batch, err = BatchAcr(tr, characters, traits, fn); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range tr.Nodes() {
+		if n.Name() == "n" {
+			exp := map[string]string{"A": "X", "C": "Y"}[n.Neigh()[1].Name()]
+			if strings.Join(batch[0].Nodes[n], ",") != exp {
+				t.Errorf("State of node n above %s for loc should be %s and is %v", n.Neigh()[1].Name(), exp, batch[0].Nodes[n])
+			}
+		}
+	}
+
+	// Wrong number of states
+	traits["E"] = []string{"X"}
+	if _, err = BatchAcr(tr, characters, traits, fn); err == nil {
+		t.Errorf("Tip with a wrong number of states should return an error")
+	}
+}
@@ -0,0 +1,285 @@
+package acr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Quantile of the standard normal distribution for 95% confidence intervals
+const normalQuantile95 = 1.959963984540054
+
+// Result of the ancestral reconstruction of a continuous trait
+type ContinuousAcrResult struct {
+	Traits         []string                 // Names of the dimensions of the trait
+	Values         map[*tree.Node][]float64 // Reconstructed values of each node, for each dimension
+	Lower          map[*tree.Node][]float64 // Lower bounds of the 95% confidence intervals (ALGO_BM only)
+	Upper          map[*tree.Node][]float64 // Upper bounds of the 95% confidence intervals (ALGO_BM only)
+	Sigma2         []float64                // Maximum likelihood rate of the Brownian motion of each dimension (ALGO_BM only)
+	LogLikelihood  []float64                // Maximum log-likelihood of each dimension (ALGO_BM only)
+	SquaredChanges []float64                // Sum of the squared changes along the branches, for each dimension
+}
+
+// Estimate of the value of a node from a part of the tree, with its variance
+// (relative to the rate of the Brownian motion)
+type contMessage struct {
+	mean float64
+	vari float64
+}
+
+// Data of the continuous ACR of one dimension
+type contAcr struct {
+	values  map[*tree.Node]float64
+	length  func(e *tree.Edge) float64
+	down    map[*tree.Node]contMessage // Estimate of each node from its subtree
+	full    map[*tree.Node]contMessage // Estimate of each node from all the tips
+	sumsq   float64                    // Sum of the squared standardized contrasts
+	logdet  float64                    // Sum of the log of the variances of the contrasts
+	zerovar bool                       // True if two tips are separated by a null variance
+}
+
+// Reconstructs the ancestral values of a continuous trait, with one or several
+// dimensions (e.g. latitude and longitude), each dimension being reconstructed
+// independently:
+//   - ALGO_BM: Maximum likelihood under a Brownian motion model. Node values are
+//     estimated as the root value of the tree rerooted at each node (contrast
+//     algorithm, Felsenstein 1985), and 95% confidence intervals are computed
+//     from their variance, given the maximum likelihood rate of the Brownian
+//     motion (sigma2). All branches must have a length;
+//   - ALGO_SCP: Squared-change parsimony (all branches having the same weight,
+//     branch lengths are not used): minimizes the sum of the squared changes along
+//     the branches.
+//
+// The reconstructed values do not depend on the root, but the log-likelihood does.
+// Longitudes are not handled specifically (e.g. around the 180th meridian).
+//
+// traits: names of the dimensions
+// tipValues: mapping between tipnames and the values of all dimensions (in the order of traits)
+//
+// Tree nodes are annotated with their values (and confidence intervals for
+// ALGO_BM) in their comment field (&lat=12.3,lat_CI={10.1,14.5}).
+func ContinuousAcr(t *tree.Tree, tipValues map[string][]float64, traits []string, algo int) (*ContinuousAcrResult, error) {
+	var length func(e *tree.Edge) float64
+	nodes := t.Nodes()
+
+	switch algo {
+	case ALGO_BM:
+		if t.Root().Tip() {
+			return nil, errors.New("The root of the tree must not be a tip")
+		}
+		for _, e := range t.Edges() {
+			if e.Length() == tree.NIL_LENGTH {
+				return nil, errors.New("Some branches have no length")
+			}
+		}
+		length = func(e *tree.Edge) float64 { return e.Length() }
+	case ALGO_SCP:
+		length = func(e *tree.Edge) float64 { return 1.0 }
+	default:
+		return nil, fmt.Errorf("Continuous ACR algorithm %d unkown", algo)
+	}
+	if len(traits) == 0 {
+		return nil, errors.New("The trait must have at least one dimension")
+	}
+
+	ntips := 0
+	for i, n := range nodes {
+		n.SetId(i)
+		if n.Tip() {
+			ntips++
+			v, ok := tipValues[n.Name()]
+			if !ok {
+				return nil, fmt.Errorf("Tip %s does not exist in the tip/value mapping file", n.Name())
+			}
+			if len(v) != len(traits) {
+				return nil, fmt.Errorf("Tip %s has %d values and the trait has %d dimensions", n.Name(), len(v), len(traits))
+			}
+		}
+	}
+
+	res := &ContinuousAcrResult{
+		Traits:         traits,
+		Values:         make(map[*tree.Node][]float64),
+		SquaredChanges: make([]float64, len(traits)),
+	}
+	if algo == ALGO_BM {
+		res.Lower = make(map[*tree.Node][]float64)
+		res.Upper = make(map[*tree.Node][]float64)
+		res.Sigma2 = make([]float64, len(traits))
+		res.LogLikelihood = make([]float64, len(traits))
+	}
+	for _, n := range nodes {
+		res.Values[n] = make([]float64, len(traits))
+		if algo == ALGO_BM {
+			res.Lower[n] = make([]float64, len(traits))
+			res.Upper[n] = make([]float64, len(traits))
+		}
+	}
+
+	for d := range traits {
+		a := &contAcr{
+			values: make(map[*tree.Node]float64),
+			length: length,
+			down:   make(map[*tree.Node]contMessage),
+			full:   make(map[*tree.Node]contMessage),
+		}
+		for _, n := range nodes {
+			if n.Tip() {
+				a.values[n] = tipValues[n.Name()][d]
+			}
+		}
+		a.downRec(t.Root(), nil)
+		if a.zerovar {
+			return nil, errors.New("Some tips are separated by branches of length 0")
+		}
+		a.full[t.Root()] = a.down[t.Root()]
+		a.upRec(t.Root(), nil, contMessage{})
+
+		for _, n := range nodes {
+			res.Values[n][d] = a.full[n].mean
+		}
+		t.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+			if prev != nil {
+				diff := res.Values[prev][d] - res.Values[cur][d]
+				res.SquaredChanges[d] += diff * diff
+			}
+			return true
+		})
+		if algo == ALGO_BM {
+			sigma2 := a.sumsq / float64(ntips)
+			res.Sigma2[d] = sigma2
+			res.LogLikelihood[d] = -0.5 * (float64(ntips)*math.Log(2*math.Pi*sigma2) + a.logdet + math.Log(a.down[t.Root()].vari) + float64(ntips))
+			for _, n := range nodes {
+				half := normalQuantile95 * math.Sqrt(sigma2*a.full[n].vari)
+				res.Lower[n][d] = a.full[n].mean - half
+				res.Upper[n][d] = a.full[n].mean + half
+			}
+		}
+	}
+	assignContinuousValuesToTree(t, res)
+	return res, nil
+}
+
+// Merges two independent estimates of the value of a node, and accumulates
+// the squared standardized contrast between them
+func (a *contAcr) merge(m1, m2 contMessage) contMessage {
+	// No information on one side
+	if math.IsInf(m1.vari, 1) {
+		return m2
+	}
+	if math.IsInf(m2.vari, 1) {
+		return m1
+	}
+	s := m1.vari + m2.vari
+	if s == 0 {
+		a.zerovar = true
+		return contMessage{mean: m1.mean, vari: 0}
+	}
+	diff := m1.mean - m2.mean
+	a.sumsq += diff * diff / s
+	a.logdet += math.Log(s)
+	return contMessage{mean: (m1.mean*m2.vari + m2.mean*m1.vari) / s, vari: m1.vari * m2.vari / s}
+}
+
+// Merges independent estimates without accumulating contrasts
+func combine(messages []contMessage) contMessage {
+	a := &contAcr{}
+	res := messages[0]
+	for _, m := range messages[1:] {
+		res = a.merge(res, m)
+	}
+	return res
+}
+
+// Computes the estimate of each node from its subtree
+func (a *contAcr) downRec(cur, prev *tree.Node) {
+	var res contMessage
+	first := true
+	if cur.Tip() {
+		res = contMessage{mean: a.values[cur], vari: 0}
+		first = false
+	}
+	for i, child := range cur.Neigh() {
+		if child == prev {
+			continue
+		}
+		a.downRec(child, cur)
+		m := a.down[child]
+		m.vari += a.length(cur.Edges()[i])
+		if first {
+			res = m
+			first = false
+		} else {
+			res = a.merge(res, m)
+		}
+	}
+	a.down[cur] = res
+}
+
+// Computes the estimate of each node from all the tips, given the estimate of
+// cur from the rest of the tree (from its parent side, branch included)
+func (a *contAcr) upRec(cur, prev *tree.Node, up contMessage) {
+	for i, child := range cur.Neigh() {
+		if child == prev {
+			continue
+		}
+		messages := make([]contMessage, 0, len(cur.Neigh()))
+		if prev != nil {
+			messages = append(messages, up)
+		}
+		if cur.Tip() {
+			messages = append(messages, contMessage{mean: a.values[cur], vari: 0})
+		}
+		for j, other := range cur.Neigh() {
+			if other != prev && other != child {
+				m := a.down[other]
+				m.vari += a.length(cur.Edges()[j])
+				messages = append(messages, m)
+			}
+		}
+		childup := contMessage{vari: math.Inf(1)}
+		if len(messages) > 0 {
+			childup = combine(messages)
+		}
+		childup.vari += a.length(cur.Edges()[i])
+		if child.Tip() {
+			a.full[child] = contMessage{mean: a.values[child], vari: 0}
+		} else {
+			a.full[child] = combine([]contMessage{a.down[child], childup})
+		}
+		a.upRec(child, cur, childup)
+	}
+}
+
+// Annotates nodes with their reconstructed values (and confidence intervals)
+func assignContinuousValuesToTree(t *tree.Tree, res *ContinuousAcrResult) {
+	var buffer bytes.Buffer
+
+	for _, n := range t.Nodes() {
+		buffer.Reset()
+		buffer.WriteRune('&')
+		for d, trait := range res.Traits {
+			if d > 0 {
+				buffer.WriteRune(',')
+			}
+			buffer.WriteString(trait)
+			buffer.WriteRune('=')
+			buffer.WriteString(strconv.FormatFloat(res.Values[n][d], 'g', 6, 64))
+			if res.Lower != nil {
+				buffer.WriteString(",")
+				buffer.WriteString(trait)
+				buffer.WriteString("_CI={")
+				buffer.WriteString(strconv.FormatFloat(res.Lower[n][d], 'g', 6, 64))
+				buffer.WriteRune(',')
+				buffer.WriteString(strconv.FormatFloat(res.Upper[n][d], 'g', 6, 64))
+				buffer.WriteRune('}')
+			}
+		}
+		n.ClearComments()
+		n.AddComment(buffer.String())
+	}
+}
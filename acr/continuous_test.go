@@ -0,0 +1,162 @@
+package acr
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Log-density of the multivariate normal distribution N(mean, cov) at x
+func mvnLogDensity(x []float64, mean float64, cov [][]float64) float64 {
+	n := len(x)
+	// Gaussian elimination of [cov | x-mean]
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = append(append([]float64(nil), cov[i]...), x[i]-mean)
+	}
+	logdet := 0.0
+	for i := 0; i < n; i++ {
+		logdet += math.Log(m[i][i])
+		for j := i + 1; j < n; j++ {
+			f := m[j][i] / m[i][i]
+			for k := i; k <= n; k++ {
+				m[j][k] -= f * m[i][k]
+			}
+		}
+	}
+	// Back substitution: y = cov^-1 (x-mean)
+	y := make([]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		y[i] = m[i][n]
+		for k := i + 1; k < n; k++ {
+			y[i] -= m[i][k] * y[k]
+		}
+		y[i] /= m[i][i]
+	}
+	q := 0.0
+	for i := range x {
+		q += (x[i] - mean) * y[i]
+	}
+	return -0.5 * (float64(n)*math.Log(2*math.Pi) + logdet + q)
+}
+
+func TestContinuousAcrBM(t *testing.T) {
+	tr, _ := newick.NewParser(strings.NewReader("((A:1,B:1)n1:1,C:2)root;")).Parse()
+	values := map[string][]float64{"A": {0, 10}, "B": {2, 10}, "C": {4, 10}}
+	res, err := ContinuousAcr(tr, values, []string{"x", "y"}, ALGO_BM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := make(map[string]*tree.Node)
+	for _, n := range tr.Nodes() {
+		nodes[n.Name()] = n
+	}
+	root, n1 := nodes["root"], nodes["n1"]
+	if math.Abs(res.Values[n1][0]-5/3.5) > 1e-10 || math.Abs(res.Values[root][0]-8/3.5) > 1e-10 {
+		t.Errorf("Values of n1 and root should be %f and %f and are %f and %f", 5/3.5, 8/3.5, res.Values[n1][0], res.Values[root][0])
+	}
+	sigma2 := (2 + 9/3.5) / 3
+	if math.Abs(res.Sigma2[0]-sigma2) > 1e-10 {
+		t.Errorf("Sigma2 should be %f and is %f", sigma2, res.Sigma2[0])
+	}
+	half := normalQuantile95 * math.Sqrt(sigma2*3/3.5)
+	if math.Abs(res.Lower[root][0]-(8/3.5-half)) > 1e-10 || math.Abs(res.Upper[root][0]-(8/3.5+half)) > 1e-10 {
+		t.Errorf("CI of the root should be [%f,%f] and is [%f,%f]", 8/3.5-half, 8/3.5+half, res.Lower[root][0], res.Upper[root][0])
+	}
+	// Tip covariances (shared path lengths from the root)
+	cov := [][]float64{{2, 1, 0}, {1, 2, 0}, {0, 0, 2}}
+	for i := range cov {
+		for j := range cov[i] {
+			cov[i][j] *= sigma2
+		}
+	}
+	lnl := mvnLogDensity([]float64{0, 2, 4}, 8/3.5, cov)
+	if math.Abs(res.LogLikelihood[0]-lnl) > 1e-10 {
+		t.Errorf("Log-likelihood should be %f and is %f", lnl, res.LogLikelihood[0])
+	}
+	// Constant dimension
+	if res.Values[root][1] != 10 || res.Values[n1][1] != 10 || res.Sigma2[1] != 0 {
+		t.Errorf("Constant dimension should be reconstructed as constant")
+	}
+	exptree := "((A[&x=0,x_CI={0,0},y=10,y_CI={10,10}]:1,B[&x=2,x_CI={2,2},y=10,y_CI={10,10}]:1)n1[&x=1.42857,x_CI={-0.155319,3.01246},y=10,y_CI={10,10}]:1," +
+		"C[&x=4,x_CI={4,4},y=10,y_CI={10,10}]:2)root[&x=2.28571,x_CI={0.0457554,4.52567},y=10,y_CI={10,10}];"
+	if tr.Newick() != exptree {
+		t.Errorf("Annotated tree should be %s and is %s", exptree, tr.Newick())
+	}
+
+	// Errors
+	tr, _ = newick.NewParser(strings.NewReader("((A,B)n1:1,C:2)root;")).Parse()
+	if _, err = ContinuousAcr(tr, values, []string{"x", "y"}, ALGO_BM); err == nil {
+		t.Errorf("Branches without length should return an error")
+	}
+	tr, _ = newick.NewParser(strings.NewReader("((A:1,D:1)n1:1,C:2)root;")).Parse()
+	if _, err = ContinuousAcr(tr, values, []string{"x", "y"}, ALGO_BM); err == nil {
+		t.Errorf("Tip without value should return an error")
+	}
+}
+
+// Compares the reconstructions with the minimization of the weighted sum of
+// squared changes by Gauss-Seidel iterations (each internal node value being the
+// weighted mean of its neighbors)
+func TestContinuousAcrSquaredChanges(t *testing.T) {
+	rand.Seed(10)
+	tr, _ := newick.NewParser(strings.NewReader("((T1:0.1,T2:0.3,T3:0.2)n1:0.5,((T4:0.1,T5:0.4)n3:0.2,T6:0.7)n2:0.1,T7:0.3)root;")).Parse()
+	values := make(map[string][]float64)
+	for _, n := range tr.Tips() {
+		values[n.Name()] = []float64{rand.NormFloat64(), 45 + 10*rand.NormFloat64()}
+	}
+	for _, algo := range []int{ALGO_BM, ALGO_SCP} {
+		res, err := ContinuousAcr(tr, values, []string{"lat", "long"}, algo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for d := 0; d < 2; d++ {
+			x := make(map[*tree.Node]float64)
+			for _, n := range tr.Nodes() {
+				if n.Tip() {
+					x[n] = values[n.Name()][d]
+				}
+			}
+			for it := 0; it < 10000; it++ {
+				for _, n := range tr.Nodes() {
+					if n.Tip() {
+						continue
+					}
+					sum, sumw := 0.0, 0.0
+					for i, m := range n.Neigh() {
+						w := 1.0
+						if algo == ALGO_BM {
+							w = 1.0 / n.Edges()[i].Length()
+						}
+						sum += w * x[m]
+						sumw += w
+					}
+					x[n] = sum / sumw
+				}
+			}
+			sq := 0.0
+			for _, e := range tr.Edges() {
+				diff := x[e.Left()] - x[e.Right()]
+				sq += diff * diff
+			}
+			for n, v := range x {
+				if math.Abs(res.Values[n][d]-v) > 1e-8 {
+					t.Errorf("Value of node %s should be %f and is %f", n.Name(), v, res.Values[n][d])
+				}
+				if algo == ALGO_BM && (res.Lower[n][d] > v || res.Upper[n][d] < v) {
+					t.Errorf("Value of node %s should be in its confidence interval", n.Name())
+				}
+			}
+			if math.Abs(res.SquaredChanges[d]-sq) > 1e-8 {
+				t.Errorf("Sum of squared changes should be %f and is %f", sq, res.SquaredChanges[d])
+			}
+		}
+		if algo == ALGO_SCP && (res.Lower != nil || res.Sigma2 != nil) {
+			t.Errorf("Squared-change parsimony should not give confidence intervals")
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package acr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/evolbioinfo/gotree/models"
+	"github.com/evolbioinfo/gotree/mutils"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Mk models for maximum likelihood ACR
+const (
+	MODEL_ER  = iota // Equal rates: all transition rates are equal
+	MODEL_SYM        // Symmetric: rate i->j == rate j->i
+	MODEL_ARD        // All rates different
+)
+
+// Result of the maximum likelihood ancestral character reconstruction
+type MLAcrResult struct {
+	States        []string                 // States of the model (alphabetical order)
+	Model         int                      // Mk model (MODEL_ER, MODEL_SYM or MODEL_ARD)
+	Rates         [][]float64              // Estimated rates: Rates[i][j] is the rate from state i to state j
+	LogLikelihood float64                  // Maximum log-likelihood
+	NbParams      int                      // Number of estimated rates
+	Marginals     map[*tree.Node][]float64 // Marginal posterior probabilities of each state, for each node
+	Joint         map[*tree.Node]int       // Most likely joint assignment of states (index in States)
+}
+
+// Data of the maximum likelihood ACR
+type mlAcr struct {
+	t      *tree.Tree
+	tips   [][]float64 // Indicator vector of the state of each tip, by node id (nil for internal nodes)
+	prior  []float64   // Prior probabilities of root states
+	nstate int
+}
+
+// Returns the code of the Mk model given its name (er, sym or ard).
+// Returns -1 if the model does not exist.
+func MkModelStringToInt(model string) int {
+	switch model {
+	case "er":
+		return MODEL_ER
+	case "sym":
+		return MODEL_SYM
+	case "ard":
+		return MODEL_ARD
+	default:
+		return -1
+	}
+}
+
+// Reconstructs ancestral characters by maximum likelihood, under a Mk model
+// (MODEL_ER, MODEL_SYM or MODEL_ARD) whose rates are estimated by maximum
+// likelihood. The root (pseudo root for unrooted trees) has uniform prior state
+// probabilities. All branches must have a length.
+//
+// tipCharacters: mapping between tipnames and character state
+//
+// Tree nodes are annotated with the joint most likely state and the marginal
+// posterior probabilities of each state, in their comment field
+// (&state=A,prob={A:0.9,B:0.1}).
+//
+// Returns the result of the reconstruction, and a map with the joint states of
+// all internal nodes. If a node has a name, key is its name, if a node has no name,
+// the key will be its id in the deep first traversal of the tree.
+func MLAcr(t *tree.Tree, tipCharacters map[string]string, model int) (*MLAcrResult, map[string]string, error) {
+	var a *mlAcr
+	var m *models.DiscreteModel
+	var err error
+
+	alphabet := make([]string, 0, 10)
+	seenState := make(map[string]bool)
+	for _, state := range tipCharacters {
+		if _, ok := seenState[state]; !ok {
+			alphabet = append(alphabet, state)
+		}
+		seenState[state] = true
+	}
+	sort.Strings(alphabet)
+	if model != MODEL_ER && model != MODEL_SYM && model != MODEL_ARD {
+		return nil, nil, fmt.Errorf("Unknown Mk model: %d", model)
+	}
+	if len(alphabet) < 2 {
+		return nil, nil, errors.New("Maximum likelihood ACR needs at least 2 states")
+	}
+	if a, err = newMLAcr(t, tipCharacters, alphabet); err != nil {
+		return nil, nil, err
+	}
+
+	res := &MLAcrResult{States: alphabet, Model: model}
+	if m, res.LogLikelihood, res.NbParams, err = a.optimize(model); err != nil {
+		return nil, nil, err
+	}
+	if math.IsInf(res.LogLikelihood, -1) {
+		return nil, nil, errors.New("Likelihood is 0: some branches of length 0 separate different states")
+	}
+	res.Rates = m.Q()
+	res.Marginals = a.marginals(m)
+	res.Joint = a.joint(m)
+
+	assignMLStatesToTree(t, res)
+	nametostates := make(map[string]string)
+	for _, n := range t.Nodes() {
+		if !n.Tip() {
+			id := fmt.Sprintf("%d", n.Id())
+			if n.Name() != "" {
+				id = n.Name()
+			}
+			nametostates[id] = alphabet[res.Joint[n]]
+		}
+	}
+	return res, nametostates, nil
+}
+
+func newMLAcr(t *tree.Tree, tipCharacters map[string]string, alphabet []string) (*mlAcr, error) {
+	stateIndices := AncestralStateIndices(alphabet)
+	nodes := t.Nodes()
+	a := &mlAcr{t: t, tips: make([][]float64, len(nodes)), prior: make([]float64, len(alphabet)), nstate: len(alphabet)}
+	for i := range a.prior {
+		a.prior[i] = 1.0 / float64(len(alphabet))
+	}
+	for i, n := range nodes {
+		n.SetId(i)
+		if n.Tip() {
+			state, ok := tipCharacters[n.Name()]
+			if !ok {
+				return nil, fmt.Errorf("Tip %s does not exist in the tip/state mapping file", n.Name())
+			}
+			a.tips[i] = make([]float64, len(alphabet))
+			a.tips[i][stateIndices[state]] = 1
+		}
+	}
+	for _, e := range t.Edges() {
+		if e.Length() == tree.NIL_LENGTH {
+			return nil, errors.New("Some branches have no length")
+		}
+	}
+	return a, nil
+}
+
+// Estimates the rates of the model by maximum likelihood. ER rate is optimized
+// first (Brent), and is the starting point of SYM and ARD optimizations (Nelder-Mead).
+func (a *mlAcr) optimize(model int) (m *models.DiscreteModel, lnl float64, nbparams int, err error) {
+	treelen := 0.0
+	for _, e := range a.t.Edges() {
+		treelen += e.Length()
+	}
+	if treelen <= 0 {
+		return nil, 0, 0, errors.New("Tree length must be > 0")
+	}
+	// Rates are optimized on a log scale, around one change along the tree
+	lr0 := math.Log(1.0 / treelen)
+	lo, hi := lr0-10, lr0+10
+
+	objective := func(model int, params []float64) float64 {
+		var mod *models.DiscreteModel
+		var err2 error
+		if mod, err2 = a.model(model, params, lo, hi); err2 != nil {
+			return math.Inf(1)
+		}
+		l, _ := a.down(mod)
+		if math.IsNaN(l) {
+			return math.Inf(1)
+		}
+		return -l
+	}
+
+	er, _ := mutils.BrentMinimize(func(x float64) float64 {
+		return objective(MODEL_ER, []float64{x})
+	}, lo, hi, 1e-8)
+
+	params := []float64{er}
+	if model != MODEL_ER {
+		nb := a.nstate * (a.nstate - 1)
+		if model == MODEL_SYM {
+			nb /= 2
+		}
+		params = make([]float64, nb)
+		for i := range params {
+			params[i] = er
+		}
+		// Two successive runs to avoid premature convergence
+		for run := 0; run < 2; run++ {
+			params, _ = mutils.NelderMead(func(x []float64) float64 {
+				return objective(model, x)
+			}, params, 1.0, 1e-8, 1000*len(params))
+		}
+	}
+	if m, err = a.model(model, params, lo, hi); err != nil {
+		return
+	}
+	lnl, _ = a.down(m)
+	nbparams = len(params)
+	return
+}
+
+// Builds the Mk model given its log rates, bounded to [lo,hi]
+func (a *mlAcr) model(model int, params []float64, lo, hi float64) (*models.DiscreteModel, error) {
+	q := make([][]float64, a.nstate)
+	for i := range q {
+		q[i] = make([]float64, a.nstate)
+	}
+	rate := func(k int) float64 {
+		return math.Exp(math.Max(lo, math.Min(hi, params[k])))
+	}
+	k := 0
+	for i := 0; i < a.nstate; i++ {
+		for j := 0; j < a.nstate; j++ {
+			switch {
+			case i == j:
+			case model == MODEL_ER:
+				q[i][j] = rate(0)
+			case model == MODEL_SYM && j > i:
+				q[i][j] = rate(k)
+				q[j][i] = q[i][j]
+				k++
+			case model == MODEL_ARD:
+				q[i][j] = rate(k)
+				k++
+			}
+		}
+	}
+	states := make([]string, a.nstate)
+	for i := range states {
+		states[i] = strconv.Itoa(i)
+	}
+	return models.NewDiscreteModel(states, q)
+}
+
+// Computes the conditional likelihoods of each subtree (normalized, by node id)
+// and returns the log-likelihood of the tree
+func (a *mlAcr) down(m *models.DiscreteModel) (float64, [][]float64) {
+	down := make([][]float64, len(a.tips))
+	scale := a.downRec(a.t.Root(), nil, m, down)
+	root := a.t.Root()
+	sum := 0.0
+	for i, p := range a.prior {
+		sum += p * down[root.Id()][i]
+	}
+	return scale + math.Log(sum), down
+}
+
+func (a *mlAcr) downRec(cur, prev *tree.Node, m *models.DiscreteModel, down [][]float64) float64 {
+	scale := 0.0
+	d := a.initVector(cur)
+	for i, child := range cur.Neigh() {
+		if child != prev {
+			scale += a.downRec(child, cur, m, down)
+			msg := propagateMk(m.Pij(cur.Edges()[i].Length()), down[child.Id()])
+			for s := range d {
+				d[s] *= msg[s]
+			}
+		}
+	}
+	if prev != nil {
+		sum := 0.0
+		for _, v := range d {
+			sum += v
+		}
+		if sum > 0 {
+			for s := range d {
+				d[s] /= sum
+			}
+		}
+		scale += math.Log(sum)
+	}
+	down[cur.Id()] = d
+	return scale
+}
+
+// Indicator vector of tips, vector of 1 for internal nodes
+func (a *mlAcr) initVector(n *tree.Node) []float64 {
+	v := make([]float64, a.nstate)
+	for s := range v {
+		if a.tips[n.Id()] != nil {
+			v[s] = a.tips[n.Id()][s]
+		} else {
+			v[s] = 1
+		}
+	}
+	return v
+}
+
+// Computes the marginal posterior probabilities of the states of each node
+func (a *mlAcr) marginals(m *models.DiscreteModel) map[*tree.Node][]float64 {
+	_, down := a.down(m)
+	marginals := make(map[*tree.Node][]float64)
+	a.upRec(a.t.Root(), nil, append([]float64(nil), a.prior...), m, down, marginals)
+	return marginals
+}
+
+// up: probability of the data outside the subtree of cur, and of each state of cur
+func (a *mlAcr) upRec(cur, prev *tree.Node, up []float64, m *models.DiscreteModel, down [][]float64, marginals map[*tree.Node][]float64) {
+	marg := make([]float64, a.nstate)
+	for s := range marg {
+		marg[s] = up[s] * down[cur.Id()][s]
+	}
+	marginals[cur] = normalizeVector(marg)
+
+	// Messages from the children
+	msgs := make([][]float64, len(cur.Neigh()))
+	for i, child := range cur.Neigh() {
+		if child != prev {
+			msgs[i] = propagateMk(m.Pij(cur.Edges()[i].Length()), down[child.Id()])
+		}
+	}
+	for i, child := range cur.Neigh() {
+		if child == prev {
+			continue
+		}
+		// Rest of the tree at cur
+		rest := a.initVector(cur)
+		for s := range rest {
+			rest[s] *= up[s]
+			for j := range msgs {
+				if j != i && msgs[j] != nil {
+					rest[s] *= msgs[j][s]
+				}
+			}
+		}
+		p := m.Pij(cur.Edges()[i].Length())
+		childup := make([]float64, a.nstate)
+		for j := range childup {
+			for s := range rest {
+				childup[j] += rest[s] * p[s][j]
+			}
+		}
+		a.upRec(child, cur, normalizeVector(childup), m, down, marginals)
+	}
+}
+
+// Divides the values of the vector by their sum
+func normalizeVector(v []float64) []float64 {
+	sum := 0.0
+	for _, x := range v {
+		sum += x
+	}
+	if sum > 0 {
+		for i := range v {
+			v[i] /= sum
+		}
+	}
+	return v
+}
+
+// Computes the most likely joint assignment of states (Pupko et al. 2000)
+func (a *mlAcr) joint(m *models.DiscreteModel) map[*tree.Node]int {
+	// best[id][i]: best state of node id given state i of its parent
+	best := make([][]int, len(a.tips))
+	root := a.t.Root()
+	rootlik := a.jointRec(root, nil, nil, m, best)
+	states := make(map[*tree.Node]int)
+	max := math.Inf(-1)
+	for s, l := range rootlik {
+		if v := l + math.Log(a.prior[s]); v > max {
+			max = v
+			states[root] = s
+		}
+	}
+	a.t.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		if prev != nil {
+			states[cur] = best[cur.Id()][states[prev]]
+		}
+		return true
+	})
+	return states
+}
+
+// Returns the log-likelihood of the subtree of cur given each state of cur (C in
+// Pupko et al.). If e is not nil, fills the best state of cur given each state of
+// its parent.
+func (a *mlAcr) jointRec(cur, prev *tree.Node, e *tree.Edge, m *models.DiscreteModel, best [][]int) []float64 {
+	c := a.initVector(cur)
+	for s := range c {
+		c[s] = math.Log(c[s])
+	}
+	for i, child := range cur.Neigh() {
+		if child == prev {
+			continue
+		}
+		e2 := cur.Edges()[i]
+		cc := a.jointRec(child, cur, e2, m, best)
+		p := m.Pij(e2.Length())
+		best[child.Id()] = make([]int, a.nstate)
+		for s := range c {
+			max := math.Inf(-1)
+			for j := range cc {
+				if v := math.Log(p[s][j]) + cc[j]; v > max {
+					max = v
+					best[child.Id()][s] = j
+				}
+			}
+			c[s] += max
+		}
+	}
+	return c
+}
+
+// Propagates conditional likelihoods along a branch: out[i] = sum_j P[i][j] in[j]
+func propagateMk(p [][]float64, in []float64) []float64 {
+	out := make([]float64, len(in))
+	for i := range out {
+		for j, v := range in {
+			out[i] += p[i][j] * v
+		}
+	}
+	return out
+}
+
+// Annotates the nodes of the tree with the joint state and marginal probabilities
+func assignMLStatesToTree(t *tree.Tree, res *MLAcrResult) {
+	var buffer bytes.Buffer
+
+	for _, n := range t.Nodes() {
+		buffer.Reset()
+		buffer.WriteString("&state=")
+		buffer.WriteString(res.States[res.Joint[n]])
+		buffer.WriteString(",prob={")
+		for i, p := range res.Marginals[n] {
+			if i > 0 {
+				buffer.WriteRune(',')
+			}
+			buffer.WriteString(res.States[i])
+			buffer.WriteRune(':')
+			buffer.WriteString(strconv.FormatFloat(p, 'g', 6, 64))
+		}
+		buffer.WriteRune('}')
+		n.ClearComments()
+		n.AddComment(buffer.String())
+	}
+}
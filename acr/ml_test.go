@@ -0,0 +1,146 @@
+package acr
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/models"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Brute force: enumerates all the assignments of states to internal nodes
+func bruteForceMk(tr *tree.Tree, a *mlAcr, m *models.DiscreteModel) (lnl float64, marginals map[*tree.Node][]float64, joint map[*tree.Node]int) {
+	var internals []*tree.Node
+	for _, n := range tr.Nodes() {
+		if !n.Tip() {
+			internals = append(internals, n)
+		}
+	}
+	marginals = make(map[*tree.Node][]float64)
+	for _, n := range internals {
+		marginals[n] = make([]float64, a.nstate)
+	}
+	states := make(map[*tree.Node]int)
+	for _, n := range tr.Tips() {
+		for s, v := range a.tips[n.Id()] {
+			if v > 0 {
+				states[n] = s
+			}
+		}
+	}
+	total, best := 0.0, -1.0
+	nb := int(math.Pow(float64(a.nstate), float64(len(internals))))
+	for k := 0; k < nb; k++ {
+		c := k
+		for _, n := range internals {
+			states[n] = c % a.nstate
+			c /= a.nstate
+		}
+		p := a.prior[states[tr.Root()]]
+		for _, e := range tr.Edges() {
+			p *= m.Pij(e.Length())[states[e.Left()]][states[e.Right()]]
+		}
+		total += p
+		for _, n := range internals {
+			marginals[n][states[n]] += p
+		}
+		if p > best {
+			best = p
+			joint = make(map[*tree.Node]int)
+			for n, s := range states {
+				joint[n] = s
+			}
+		}
+	}
+	for _, n := range internals {
+		for s := range marginals[n] {
+			marginals[n][s] /= total
+		}
+	}
+	return math.Log(total), marginals, joint
+}
+
+func TestMLAcrBruteForce(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((t1:0.1,t2:0.3):0.2,(t3:0.2,(t4:0.1,t5:0.4):0.1):0.3,t6:0.5);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tipstates := map[string]string{"t1": "A", "t2": "A", "t3": "B", "t4": "C", "t5": "B", "t6": "A"}
+	a, err := newMLAcr(tr, tipstates, []string{"A", "B", "C"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := models.NewDiscreteModel([]string{"A", "B", "C"}, [][]float64{{0, 1, 0.5}, {2, 0, 1}, {0.2, 3, 0}})
+
+	explnl, expmarg, expjoint := bruteForceMk(tr, a, m)
+	lnl, _ := a.down(m)
+	if math.Abs(lnl-explnl) > 1e-10 {
+		t.Errorf("Log-likelihood should be %f and is %f", explnl, lnl)
+	}
+	marg := a.marginals(m)
+	for n, exp := range expmarg {
+		for s := range exp {
+			if math.Abs(marg[n][s]-exp[s]) > 1e-10 {
+				t.Errorf("Marginal probability of state %d at node %d should be %f and is %f", s, n.Id(), exp[s], marg[n][s])
+			}
+		}
+	}
+	joint := a.joint(m)
+	for n, s := range expjoint {
+		if joint[n] != s {
+			t.Errorf("Joint state of node %d should be %d and is %d", n.Id(), s, joint[n])
+		}
+	}
+}
+
+func TestMLAcr(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("(((t1:0.1,t2:0.1)n1:0.5,(t3:0.1,t4:0.1)n2:0.5)n3:0.1,((t5:0.1,t6:0.1)n4:0.5,t7:0.6)n5:0.1)root;")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tipstates := map[string]string{"t1": "A", "t2": "A", "t3": "A", "t4": "A", "t5": "B", "t6": "B", "t7": "C"}
+
+	lnls := make([]float64, 3)
+	for model := MODEL_ER; model <= MODEL_ARD; model++ {
+		res, statemap, err := MLAcr(tr, tipstates, model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lnls[model] = res.LogLikelihood
+		if statemap["n1"] != "A" || statemap["n4"] != "B" {
+			t.Errorf("Model %d: states of n1 and n4 should be A and B, and are %s and %s", model, statemap["n1"], statemap["n4"])
+		}
+		for n, p := range res.Marginals {
+			sum := 0.0
+			for _, v := range p {
+				sum += v
+			}
+			if math.Abs(sum-1) > 1e-8 {
+				t.Errorf("Model %d: marginal probabilities of node %s should sum to 1 and sum to %f", model, n.Name(), sum)
+			}
+		}
+		if !strings.HasPrefix(tr.Root().Comments()[0], "&state=") {
+			t.Errorf("Model %d: root should be annotated with its state, and is %v", model, tr.Root().Comments())
+		}
+	}
+	nbparams := []int{1, 3, 6}
+	for model := MODEL_SYM; model <= MODEL_ARD; model++ {
+		if lnls[model] < lnls[model-1]-1e-4 {
+			t.Errorf("Log-likelihood of model %d (%f) should be >= log-likelihood of model %d (%f)", model, lnls[model], model-1, lnls[model-1])
+		}
+	}
+	res, _, _ := MLAcr(tr, tipstates, MODEL_ARD)
+	if res.NbParams != nbparams[MODEL_ARD] {
+		t.Errorf("ARD model should have %d parameters and has %d", nbparams[MODEL_ARD], res.NbParams)
+	}
+
+	if _, _, err = MLAcr(tr, map[string]string{"t1": "A"}, MODEL_ER); err == nil {
+		t.Errorf("Missing tip states should return an error")
+	}
+	tr, _ = newick.NewParser(strings.NewReader("((t1,t2),t3);")).Parse()
+	if _, _, err = MLAcr(tr, map[string]string{"t1": "A", "t2": "B", "t3": "A"}, MODEL_ER); err == nil {
+		t.Errorf("Tree without branch lengths should return an error")
+	}
+}
@@ -16,6 +16,10 @@ const (
 	ALGO_ACCTRAN
 	ALGO_DOWNPASS
 	ALGO_NONE
+	ALGO_ML      // Maximum likelihood (see MLAcr)
+	ALGO_SANKOFF // Sankoff parsimony with a cost matrix (see SankoffAcr)
+	ALGO_BM      // Continuous traits: Brownian motion maximum likelihood (see ContinuousAcr)
+	ALGO_SCP     // Continuous traits: Squared-change parsimony (see ContinuousAcr)
 )
 
 // Will annotate the tree nodes with ancestral characters
@@ -31,6 +35,31 @@ const (
 // the key will be its id in the deep first traversal of the tree.
 // if randomResolve is true, then in the second pass, each ambiguities will be resolved randomly
 func ParsimonyAcr(t *tree.Tree, tipCharacters map[string]string, algo int, randomResolve bool) (map[string]string, error) {
+	states, alphabet, err := parsimonyAcr(t, tipCharacters, algo, randomResolve)
+	if err != nil {
+		return nil, err
+	}
+	nametostates := buildInternalNamesToStatesMap(t, states, alphabet)
+	assignStatesToTree(t, states, alphabet)
+	return nametostates, nil
+}
+
+// Same as ParsimonyAcr, but returns the states of all the internal nodes by node
+// (sorted, "*" if all states are possible), so that nodes sharing the same name
+// are not confused.
+func ParsimonyAcrNodes(t *tree.Tree, tipCharacters map[string]string, algo int, randomResolve bool) (map[*tree.Node][]string, error) {
+	states, alphabet, err := parsimonyAcr(t, tipCharacters, algo, randomResolve)
+	if err != nil {
+		return nil, err
+	}
+	nodestates := buildInternalNodesToStatesMap(t, states, alphabet)
+	assignStatesToTree(t, states, alphabet)
+	return nodestates, nil
+}
+
+// Reconstructs the states of all nodes (see ParsimonyAcr), indexed by node id, and
+// returns them with the alphabet
+func parsimonyAcr(t *tree.Tree, tipCharacters map[string]string, algo int, randomResolve bool) ([]AncestralState, []string, error) {
 	var err error
 	var nodes []*tree.Node = t.Nodes()
 	var states []AncestralState = make([]AncestralState, len(nodes))   // Downside states of each node
@@ -56,7 +85,7 @@ func ParsimonyAcr(t *tree.Tree, tipCharacters map[string]string, algo int, rando
 
 	err = parsimonyUPPASS(t.Root(), nil, tipCharacters, states, stateIndices)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	switch algo {
@@ -70,12 +99,9 @@ func ParsimonyAcr(t *tree.Tree, tipCharacters map[string]string, algo int, rando
 	case ALGO_NONE:
 		// No pass after uppass
 	default:
-		return nil, fmt.Errorf("Parsimony algorithm %d unkown", algo)
+		return nil, nil, fmt.Errorf("Parsimony algorithm %d unkown", algo)
 	}
-
-	nametostates := buildInternalNamesToStatesMap(t, states, alphabet)
-	assignStatesToTree(t, states, alphabet)
-	return nametostates, nil
+	return states, alphabet, nil
 }
 
 // First step of the parsimony computatation: From tips to root
@@ -365,30 +391,37 @@ func assignStatesToTree(t *tree.Tree, states []AncestralState, alphabet []string
 // Returns a map with keys: Internal nodes identifier (id or name if any), and value: list of possible states, comma separated
 func buildInternalNamesToStatesMap(t *tree.Tree, states []AncestralState, alphabet []string) map[string]string {
 	outmap := make(map[string]string)
-	st := make([]string, 0, 10)
+	nodestates := buildInternalNodesToStatesMap(t, states, alphabet)
+	for _, n := range t.Nodes() {
+		if !n.Tip() {
+			id := fmt.Sprintf("%d", n.Id())
+			if n.Name() != "" {
+				id = n.Name()
+			}
+			outmap[id] = strings.Join(nodestates[n], ",")
+		}
+	}
+	return outmap
+}
 
+// Returns a map with keys: Internal nodes, and value: list of possible states (sorted, "*" if all states are possible)
+func buildInternalNodesToStatesMap(t *tree.Tree, states []AncestralState, alphabet []string) map[*tree.Node][]string {
+	outmap := make(map[*tree.Node][]string)
 	for _, n := range t.Nodes() {
 		if !n.Tip() {
-			nb := 0
-			st = st[:0]
+			st := make([]string, 0, len(alphabet))
 			for i, c := range states[n.Id()] {
 				if c > 0 {
 					st = append(st, alphabet[i])
-					nb++
 				}
 			}
 			// If no state has a count> 0 : All are possible
 			// *
-			if nb == 0 {
+			if len(st) == 0 {
 				st = append(st, "*")
 			}
-
-			id := fmt.Sprintf("%d", n.Id())
-			if n.Name() != "" {
-				id = n.Name()
-			}
 			sort.Strings(st)
-			outmap[id] = strings.Join(st, ",")
+			outmap[n] = st
 		}
 	}
 	return outmap
@@ -0,0 +1,387 @@
+package acr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Tolerance used to compare parsimony costs
+const sankoffTolerance = 1e-9
+
+// Maximum number of observed states for which the minimum possible cost
+// on any tree (and thus CI and RI) is computed
+const sankoffMaxObservedStates = 16
+
+// Result of the Sankoff parsimony ancestral character reconstruction
+type SankoffAcrResult struct {
+	States     []string             // States of the cost matrix
+	Costs      [][]float64          // Costs[i][j] is the cost of a change from state i (parent) to state j (child)
+	Cost       float64              // Minimum total cost of the tree
+	MinCost    float64              // Minimum possible cost on any tree (M)
+	MaxCost    float64              // Maximum possible cost on any tree (G, cost on the star tree)
+	CI         float64              // Consistency index (M/S, NaN if not defined)
+	RI         float64              // Retention index ((G-S)/(G-M), NaN if not defined)
+	NodeStates map[*tree.Node][]int // States of each node in at least one most parsimonious reconstruction (indices in States)
+	Joint      map[*tree.Node]int   // One most parsimonious reconstruction (index in States)
+	MinChanges map[*tree.Node]int   // Minimum number of changes on the branch above each node, over all most parsimonious reconstructions
+	MaxChanges map[*tree.Node]int   // Maximum number of changes on the branch above each node, over all most parsimonious reconstructions
+}
+
+// Data of the Sankoff parsimony ACR
+type sankoffAcr struct {
+	costs [][]float64
+	down  [][]float64 // Minimum cost of the subtree of each node, given its state (by node id)
+	up    [][]float64 // Minimum cost of the rest of the tree, given the state of each node (by node id)
+}
+
+// Reconstructs ancestral characters using Sankoff parsimony with a user-given
+// cost matrix: costs[i][j] is the cost of a change from state states[i] (parent)
+// to state states[j] (child). Costs must be non-negative, with a null diagonal,
+// and may be asymmetric (e.g. migrations between locations), in which case the
+// reconstruction depends on the root of the tree (pseudo root for unrooted trees).
+// States of the matrix that are not observed at the tips may be assigned to
+// internal nodes (e.g. intermediate states of ordered characters).
+// Should work on multifurcated trees.
+//
+// tipCharacters: mapping between tipnames and character state
+//
+// Tree nodes are annotated with their state in one most parsimonious
+// reconstruction, and with all their states in the most parsimonious
+// reconstructions, in their comment field (&state=A,states={A,B}). The branch
+// above each node is annotated with its minimum and maximum numbers of changes
+// over all the most parsimonious reconstructions (&minchanges=0,maxchanges=1).
+// If randomResolve is true, then the reconstruction resolves ties randomly,
+// otherwise the first state (in the order of the matrix) is chosen.
+//
+// The consistency (CI=M/S) and retention (RI=(G-S)/(G-M)) indices are computed
+// with S the cost of the tree, G the cost of the star tree, and M the cost of the
+// minimum directed Steiner tree connecting the observed states in the cost
+// matrix (lower bound of the minimum possible cost if the costs do not satisfy
+// the triangle inequality). M is not computed (CI and RI are NaN) if there are
+// more than 16 observed states.
+//
+// Returns the result of the reconstruction, and a map with the states of all
+// internal nodes. If a node has a name, key is its name, if a node has no name,
+// the key will be its id in the deep first traversal of the tree.
+func SankoffAcr(t *tree.Tree, tipCharacters map[string]string, states []string, costs [][]float64, randomResolve bool) (*SankoffAcrResult, map[string]string, error) {
+	var nodes []*tree.Node = t.Nodes()
+	var err error
+
+	if err = checkCostMatrix(states, costs); err != nil {
+		return nil, nil, err
+	}
+	stateIndices := AncestralStateIndices(states)
+	a := &sankoffAcr{costs: costs, down: make([][]float64, len(nodes)), up: make([][]float64, len(nodes))}
+	tipstates := make([]int, 0, len(nodes))
+	for i, n := range nodes {
+		n.SetId(i)
+		a.down[i] = make([]float64, len(states))
+		a.up[i] = make([]float64, len(states))
+		if n.Tip() {
+			state, ok := tipCharacters[n.Name()]
+			if !ok {
+				return nil, nil, fmt.Errorf("Tip %s does not exist in the tip/state mapping file", n.Name())
+			}
+			index, ok := stateIndices[state]
+			if !ok {
+				return nil, nil, fmt.Errorf("State %s of tip %s does not exist in the cost matrix", state, n.Name())
+			}
+			for s := range a.down[i] {
+				if s != index {
+					a.down[i][s] = math.Inf(1)
+				}
+			}
+			tipstates = append(tipstates, index)
+		}
+	}
+
+	root := t.Root()
+	a.downRec(root, nil)
+	res := &SankoffAcrResult{
+		States:     states,
+		Costs:      costs,
+		NodeStates: make(map[*tree.Node][]int),
+		Joint:      make(map[*tree.Node]int),
+		MinChanges: make(map[*tree.Node]int),
+		MaxChanges: make(map[*tree.Node]int),
+	}
+	res.Cost = minVector(a.down[root.Id()])
+	a.upRec(root, nil, res)
+	a.jointRec(root, nil, -1, res, randomResolve)
+
+	res.MinCost = minSteinerCost(costs, tipstates)
+	res.MaxCost = starCost(costs, tipstates)
+	res.CI, res.RI = math.NaN(), math.NaN()
+	if res.Cost > sankoffTolerance && !math.IsNaN(res.MinCost) {
+		res.CI = res.MinCost / res.Cost
+	}
+	if res.MaxCost-res.MinCost > sankoffTolerance {
+		res.RI = (res.MaxCost - res.Cost) / (res.MaxCost - res.MinCost)
+	}
+
+	assignSankoffStatesToTree(t, res)
+	nametostates := make(map[string]string)
+	for _, n := range nodes {
+		if !n.Tip() {
+			id := fmt.Sprintf("%d", n.Id())
+			if n.Name() != "" {
+				id = n.Name()
+			}
+			nametostates[id] = states[res.Joint[n]]
+		}
+	}
+	return res, nametostates, nil
+}
+
+// Checks that the cost matrix is square, non-negative, with a null diagonal,
+// and that states are unique
+func checkCostMatrix(states []string, costs [][]float64) error {
+	if len(states) < 2 {
+		return errors.New("Cost matrix must have at least 2 states")
+	}
+	if len(costs) != len(states) {
+		return fmt.Errorf("Cost matrix has %d rows and %d states", len(costs), len(states))
+	}
+	seen := make(map[string]bool)
+	for i, s := range states {
+		if seen[s] {
+			return fmt.Errorf("State %s is duplicated in the cost matrix", s)
+		}
+		seen[s] = true
+		if len(costs[i]) != len(states) {
+			return fmt.Errorf("Row %s of the cost matrix has %d columns and there are %d states", s, len(costs[i]), len(states))
+		}
+		for j, c := range costs[i] {
+			if c < 0 || math.IsNaN(c) || math.IsInf(c, 0) {
+				return fmt.Errorf("Cost %s>%s must be a non-negative number", s, states[j])
+			}
+			if i == j && c != 0 {
+				return fmt.Errorf("Cost %s>%s must be 0", s, s)
+			}
+		}
+	}
+	return nil
+}
+
+// Computes the minimum costs of the subtree of each node given its state
+func (a *sankoffAcr) downRec(cur, prev *tree.Node) {
+	for _, child := range cur.Neigh() {
+		if child == prev {
+			continue
+		}
+		a.downRec(child, cur)
+		for i := range a.down[cur.Id()] {
+			a.down[cur.Id()][i] += a.childCost(child, i)
+		}
+	}
+}
+
+// Minimum cost of the subtree of child (and of its branch), given the state i of its parent
+func (a *sankoffAcr) childCost(child *tree.Node, i int) float64 {
+	min := math.Inf(1)
+	for j, c := range a.down[child.Id()] {
+		if v := a.costs[i][j] + c; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// Computes the minimum costs of the rest of the tree given the state of each node,
+// the most parsimonious states of each node, and the minimum and maximum
+// numbers of changes of each branch
+func (a *sankoffAcr) upRec(cur, prev *tree.Node, res *SankoffAcrResult) {
+	nstates := len(a.costs)
+	res.NodeStates[cur] = make([]int, 0, 1)
+	for i := 0; i < nstates; i++ {
+		if a.down[cur.Id()][i]+a.up[cur.Id()][i] <= res.Cost+sankoffTolerance {
+			res.NodeStates[cur] = append(res.NodeStates[cur], i)
+		}
+	}
+	// Minimum cost of the tree without the subtree of child, given the state of cur
+	excl := make([]float64, nstates)
+	for _, child := range cur.Neigh() {
+		if child == prev {
+			continue
+		}
+		for i := range excl {
+			excl[i] = a.up[cur.Id()][i] + a.down[cur.Id()][i] - a.childCost(child, i)
+		}
+		minchanges, maxchanges := 1, 0
+		for j := 0; j < nstates; j++ {
+			up := math.Inf(1)
+			for i := 0; i < nstates; i++ {
+				v := excl[i] + a.costs[i][j]
+				if v < up {
+					up = v
+				}
+				if v+a.down[child.Id()][j] <= res.Cost+sankoffTolerance {
+					if i == j {
+						minchanges = 0
+					} else {
+						maxchanges = 1
+					}
+				}
+			}
+			a.up[child.Id()][j] = up
+		}
+		res.MinChanges[child] = minchanges
+		res.MaxChanges[child] = maxchanges
+		a.upRec(child, cur, res)
+	}
+}
+
+// Builds one most parsimonious reconstruction from the root to the tips,
+// given the state of the parent (-1 for the root)
+func (a *sankoffAcr) jointRec(cur, prev *tree.Node, parentstate int, res *SankoffAcrResult, randomResolve bool) {
+	best := math.Inf(1)
+	ties := make([]int, 0, 1)
+	for j, c := range a.down[cur.Id()] {
+		v := c
+		if parentstate >= 0 {
+			v += a.costs[parentstate][j]
+		}
+		if v < best-sankoffTolerance {
+			best = v
+			ties = ties[:0]
+			ties = append(ties, j)
+		} else if v <= best+sankoffTolerance {
+			ties = append(ties, j)
+		}
+	}
+	res.Joint[cur] = ties[0]
+	if randomResolve {
+		res.Joint[cur] = ties[rand.Intn(len(ties))]
+	}
+	for _, child := range cur.Neigh() {
+		if child != prev {
+			a.jointRec(child, cur, res.Joint[cur], res, randomResolve)
+		}
+	}
+}
+
+// Returns the cost of the star tree: minimum over the states of the center of
+// the sum of the costs to the tip states
+func starCost(costs [][]float64, tipstates []int) float64 {
+	sums := make([]float64, len(costs))
+	for i := range costs {
+		for _, s := range tipstates {
+			sums[i] += costs[i][s]
+		}
+	}
+	return minVector(sums)
+}
+
+// Returns the cost of the minimum directed Steiner tree connecting the observed
+// tip states in the complete graph of the states, weighted by the shortest path
+// costs (Dreyfus-Wagner algorithm). Returns NaN if there are more than
+// sankoffMaxObservedStates observed states.
+func minSteinerCost(costs [][]float64, tipstates []int) float64 {
+	n := len(costs)
+	terminals := make([]int, 0, n)
+	seen := make(map[int]bool)
+	for _, s := range tipstates {
+		if !seen[s] {
+			terminals = append(terminals, s)
+			seen[s] = true
+		}
+	}
+	if len(terminals) > sankoffMaxObservedStates {
+		return math.NaN()
+	}
+
+	// Shortest path costs (Floyd-Warshall)
+	dist := make([][]float64, n)
+	for i := range dist {
+		dist[i] = append([]float64(nil), costs[i]...)
+	}
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				if v := dist[i][k] + dist[k][j]; v < dist[i][j] {
+					dist[i][j] = v
+				}
+			}
+		}
+	}
+
+	// dp[mask][v]: minimum cost of a tree rooted at state v, connecting the terminals of mask
+	full := 1<<uint(len(terminals)) - 1
+	dp := make([][]float64, full+1)
+	tmp := make([]float64, n)
+	for mask := 1; mask <= full; mask++ {
+		dp[mask] = make([]float64, n)
+		if mask&(mask-1) == 0 {
+			for t := range terminals {
+				if mask == 1<<uint(t) {
+					for v := 0; v < n; v++ {
+						dp[mask][v] = dist[v][terminals[t]]
+					}
+				}
+			}
+			continue
+		}
+		for u := 0; u < n; u++ {
+			tmp[u] = math.Inf(1)
+			for sub := (mask - 1) & mask; sub > 0; sub = (sub - 1) & mask {
+				if v := dp[sub][u] + dp[mask^sub][u]; v < tmp[u] {
+					tmp[u] = v
+				}
+			}
+		}
+		for v := 0; v < n; v++ {
+			dp[mask][v] = math.Inf(1)
+			for u := 0; u < n; u++ {
+				if c := dist[v][u] + tmp[u]; c < dp[mask][v] {
+					dp[mask][v] = c
+				}
+			}
+		}
+	}
+	return minVector(dp[full])
+}
+
+func minVector(v []float64) float64 {
+	min := math.Inf(1)
+	for _, x := range v {
+		if x < min {
+			min = x
+		}
+	}
+	return min
+}
+
+// Annotates nodes with their reconstructed states, and branches with
+// their minimum and maximum numbers of changes
+func assignSankoffStatesToTree(t *tree.Tree, res *SankoffAcrResult) {
+	var buffer bytes.Buffer
+
+	for _, n := range t.Nodes() {
+		buffer.Reset()
+		buffer.WriteString("&state=")
+		buffer.WriteString(res.States[res.Joint[n]])
+		buffer.WriteString(",states={")
+		for i, s := range res.NodeStates[n] {
+			if i > 0 {
+				buffer.WriteRune(',')
+			}
+			buffer.WriteString(res.States[s])
+		}
+		buffer.WriteRune('}')
+		n.ClearComments()
+		n.AddComment(buffer.String())
+	}
+	t.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		if e != nil {
+			e.ClearComments()
+			e.AddComment("&minchanges=" + strconv.Itoa(res.MinChanges[cur]) + ",maxchanges=" + strconv.Itoa(res.MaxChanges[cur]))
+		}
+		return true
+	})
+}
@@ -0,0 +1,167 @@
+package acr
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+func TestSankoffAcrOrdered(t *testing.T) {
+	tr, _ := newick.NewParser(strings.NewReader("((A,B)n1,(C,D)n2)root;")).Parse()
+	tips := map[string]string{"A": "0", "B": "0", "C": "2", "D": "2"}
+	states := []string{"0", "1", "2"}
+	costs := [][]float64{{0, 1, 2}, {1, 0, 1}, {2, 1, 0}}
+
+	res, statemap, err := SankoffAcr(tr, tips, states, costs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Cost != 2 || res.MinCost != 2 || res.MaxCost != 4 || res.CI != 1 || res.RI != 1 {
+		t.Errorf("Cost, M, G, CI and RI should be 2, 2, 4, 1 and 1, and are %f, %f, %f, %f and %f", res.Cost, res.MinCost, res.MaxCost, res.CI, res.RI)
+	}
+	expmap := map[string]string{"root": "0", "n1": "0", "n2": "2"}
+	for k, v := range expmap {
+		if statemap[k] != v {
+			t.Errorf("State of %s should be %s and is %s", k, v, statemap[k])
+		}
+	}
+	exptree := "((A[&state=0,states={0}][&minchanges=0,maxchanges=0],B[&state=0,states={0}][&minchanges=0,maxchanges=0])n1[&state=0,states={0}][&minchanges=0,maxchanges=1]," +
+		"(C[&state=2,states={2}][&minchanges=0,maxchanges=0],D[&state=2,states={2}][&minchanges=0,maxchanges=0])n2[&state=2,states={2}][&minchanges=0,maxchanges=1])root[&state=0,states={0,1,2}];"
+	if tr.Newick() != exptree {
+		t.Errorf("Annotated tree should be %s and is %s", exptree, tr.Newick())
+	}
+
+	// Asymmetric costs: B>A is very costly
+	tr, _ = newick.NewParser(strings.NewReader("((A1,B1)n1,(A2,A3)n2)root;")).Parse()
+	tips = map[string]string{"A1": "A", "B1": "B", "A2": "A", "A3": "A"}
+	res, statemap, err = SankoffAcr(tr, tips, []string{"A", "B"}, [][]float64{{0, 1}, {10, 0}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Cost != 1 || statemap["root"] != "A" || statemap["n1"] != "A" || !math.IsNaN(res.RI) || res.CI != 1 {
+		t.Errorf("Cost should be 1 with all internal nodes in state A (CI=1, RI=NaN), and is %f (root: %s, n1: %s, CI=%f, RI=%f)", res.Cost, statemap["root"], statemap["n1"], res.CI, res.RI)
+	}
+
+	// Errors
+	if _, _, err = SankoffAcr(tr, tips, []string{"A", "B"}, [][]float64{{0, 1}, {1, 1}}, false); err == nil {
+		t.Errorf("Non null diagonal should return an error")
+	}
+	if _, _, err = SankoffAcr(tr, tips, []string{"A", "C"}, [][]float64{{0, 1}, {1, 0}}, false); err == nil {
+		t.Errorf("Tip state absent from the cost matrix should return an error")
+	}
+}
+
+// Compares Sankoff ACR with the enumeration of all the assignments of states to
+// internal nodes, on a multifurcated tree with random asymmetric costs
+func TestSankoffAcrBruteForce(t *testing.T) {
+	rand.Seed(10)
+	states := []string{"A", "B", "C", "D"}
+	for rep := 0; rep < 10; rep++ {
+		tr, _ := newick.NewParser(strings.NewReader("((T1,T2,T3)n1,((T4,T5)n3,T6)n2,T7)root;")).Parse()
+		tips := make(map[string]string)
+		for _, n := range tr.Tips() {
+			tips[n.Name()] = states[rand.Intn(3)]
+		}
+		costs := make([][]float64, len(states))
+		for i := range costs {
+			costs[i] = make([]float64, len(states))
+			for j := range costs[i] {
+				if i != j {
+					costs[i][j] = float64(1 + rand.Intn(4))
+				}
+			}
+		}
+		res, _, err := SankoffAcr(tr, tips, states, costs, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var internals []*tree.Node
+		assign := make(map[*tree.Node]int)
+		for _, n := range tr.Nodes() {
+			if n.Tip() {
+				assign[n] = AncestralStateIndices(states)[tips[n.Name()]]
+			} else {
+				internals = append(internals, n)
+			}
+		}
+		cost := func() (c float64) {
+			for _, e := range tr.Edges() {
+				c += costs[assign[e.Left()]][assign[e.Right()]]
+			}
+			return
+		}
+		for n, s := range res.Joint {
+			assign[n] = s
+		}
+		if c := cost(); math.Abs(c-res.Cost) > 1e-10 {
+			t.Errorf("Cost of the reconstruction (%f) should be the total cost (%f)", c, res.Cost)
+		}
+
+		best := math.Inf(1)
+		nb := int(math.Pow(float64(len(states)), float64(len(internals))))
+		optimal := make([]map[*tree.Node]int, 0)
+		for k := 0; k < nb; k++ {
+			c := k
+			for _, n := range internals {
+				assign[n] = c % len(states)
+				c /= len(states)
+			}
+			v := cost()
+			if v < best-1e-10 {
+				best = v
+				optimal = optimal[:0]
+			}
+			if v <= best+1e-10 {
+				o := make(map[*tree.Node]int)
+				for n, s := range assign {
+					o[n] = s
+				}
+				optimal = append(optimal, o)
+			}
+		}
+		if math.Abs(best-res.Cost) > 1e-10 {
+			t.Errorf("Total cost should be %f and is %f", best, res.Cost)
+		}
+		for _, n := range internals {
+			expstates := make([]int, 0)
+			for s := range states {
+				for _, o := range optimal {
+					if o[n] == s {
+						expstates = append(expstates, s)
+						break
+					}
+				}
+			}
+			if len(expstates) != len(res.NodeStates[n]) {
+				t.Errorf("Node %s should have states %v and has %v", n.Name(), expstates, res.NodeStates[n])
+				continue
+			}
+			for i, s := range expstates {
+				if res.NodeStates[n][i] != s {
+					t.Errorf("Node %s should have states %v and has %v", n.Name(), expstates, res.NodeStates[n])
+				}
+			}
+		}
+		for _, e := range tr.Edges() {
+			min, max := 1, 0
+			for _, o := range optimal {
+				if o[e.Left()] == o[e.Right()] {
+					min = 0
+				} else {
+					max = 1
+				}
+			}
+			if res.MinChanges[e.Right()] != min || res.MaxChanges[e.Right()] != max {
+				t.Errorf("Branch to %s should have %d-%d changes and has %d-%d", e.Right().Name(), min, max, res.MinChanges[e.Right()], res.MaxChanges[e.Right()])
+			}
+		}
+		if res.CI <= 0 || res.CI > 1 || (!math.IsNaN(res.RI) && (res.RI < 0 || res.RI > 1)) {
+			t.Errorf("CI (%f) and RI (%f) should be in [0,1]", res.CI, res.RI)
+		}
+	}
+}
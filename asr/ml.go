@@ -0,0 +1,79 @@
+package asr
+
+import (
+	"bytes"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/gotree/models"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Probabilities closer than this are considered as equal
+const tieTolerance = 1e-9
+
+// Will annotate the tree nodes with ancestral sequences
+// Computed using maximum likelihood (marginal reconstruction),
+// given the branch lengths of the tree and the substitution model.
+// Sequences will be located in the comment field of each node
+// at the first index: for internal nodes, the most probable state
+// of each site ({AC} if several states are equally probable), for
+// tips, their sequence in the alignment.
+//
+// Returns the marginal posterior probabilities of the states of each
+// site of each internal node ([site][state], states being in the order
+// of m.Characters()). Node ids are set to their index in t.Nodes().
+func MLAsr(t *tree.Tree, a align.Alignment, m *models.Model) (map[*tree.Node][][]float64, error) {
+	var buffer bytes.Buffer
+
+	probas, err := models.AncestralProbabilities(t, a, m)
+	if err != nil {
+		return nil, err
+	}
+	chars := m.Characters()
+	for i, n := range t.Nodes() {
+		n.SetId(i)
+		buffer.Reset()
+		if n.Tip() {
+			seq, _ := a.GetSequence(n.Name())
+			buffer.WriteString(seq)
+		} else {
+			for _, p := range probas[n] {
+				writeMostProbableStates(&buffer, p, chars)
+			}
+		}
+		n.ClearComments()
+		n.AddComment(buffer.String())
+	}
+	return probas, nil
+}
+
+// Returns the index of the most probable state, and its probability.
+// In case of ties, the first state is returned.
+func MostProbableState(probas []float64) (state int, proba float64) {
+	for i, p := range probas {
+		if p > proba {
+			state = i
+			proba = p
+		}
+	}
+	return
+}
+
+// Writes the most probable state of a site, or the set of
+// equally most probable states, in the form {AC}
+func writeMostProbableStates(buffer *bytes.Buffer, probas []float64, chars []rune) {
+	_, max := MostProbableState(probas)
+	var states []rune
+	for i, p := range probas {
+		if max-p < tieTolerance {
+			states = append(states, chars[i])
+		}
+	}
+	if len(states) > 1 {
+		buffer.WriteRune('{')
+	}
+	buffer.WriteString(string(states))
+	if len(states) > 1 {
+		buffer.WriteRune('}')
+	}
+}
@@ -16,6 +16,7 @@ const (
 	ALGO_ACCTRAN
 	ALGO_DOWNPASS
 	ALGO_NONE
+	ALGO_ML // Maximum likelihood (see MLAsr)
 )
 
 // Will annotate the tree nodes with ancestral sequences
@@ -77,42 +78,78 @@ func parsimonyUPPASS(cur, prev *tree.Node, a align.Alignment, seqs []*AncestralS
 		if !ok {
 			return errors.New(fmt.Sprintf("Sequence %s does not exist in the alignment", cur.Name()))
 		}
-		for j, c := range seq {
-			charindex, ok := charToIndex[c]
-			if ok {
-				seqs[cur.Id()].seq[j].counts[charindex] = 1
-			} else {
-				io.LogWarning(errors.New(fmt.Sprintf("Character %c does not exist in the alphabet, ignoring the state", c)))
-			}
-		}
+		tipStates(seq, charToIndex, seqs[cur.Id()])
 	} else {
+		children := make([]*AncestralSequence, 0, len(cur.Neigh()))
 		for _, child := range cur.Neigh() {
 			if child != prev {
 				if err := parsimonyUPPASS(child, cur, a, seqs, charToIndex); err != nil {
 					return err
 				}
+				children = append(children, seqs[child.Id()])
 			}
 		}
-		// As we are manipulating trees with multifurcations
-		// For each character we count the number of children having it
-		// and then we take character(s) with the maximum number of children
-		// And that for each site of the alignment
-		for j, ances := range seqs[cur.Id()].seq {
-			nchild := 0
-			for _, child := range cur.Neigh() {
-				if child != prev {
-					counts := seqs[child.Id()].seq[j].counts
-					for k, c := range counts {
-						ances.counts[k] += c
-					}
-					nchild++
-				}
+		neighborStates(children, seqs[cur.Id()])
+	}
+	return nil
+}
+
+// Initializes the states of a tip with its sequence
+func tipStates(seq []rune, charToIndex map[rune]int, states *AncestralSequence) {
+	for j, c := range seq {
+		charindex, ok := charToIndex[c]
+		if ok {
+			states.seq[j].counts[charindex] = 1
+		} else {
+			io.LogWarning(errors.New(fmt.Sprintf("Character %c does not exist in the alphabet, ignoring the state", c)))
+		}
+	}
+}
+
+// Computes the states of a node from the states of its neighbors.
+//
+// As we are manipulating trees with multifurcations
+// For each character we count the number of neighbors having it
+// and then we take character(s) with the maximum number of neighbors
+// And that for each site of the alignment
+func neighborStates(neighbors []*AncestralSequence, states *AncestralSequence) {
+	for j, ances := range states.seq {
+		state := AncestralState{make([]float64, len(ances.counts))}
+		for _, n := range neighbors {
+			for k, c := range n.seq[j].counts {
+				state.counts[k] += c
 			}
+		}
+		computeParsimony(state, ances, len(neighbors))
+	}
+}
 
-			computeParsimony(ances, ances, nchild)
+// Sets the states of out to the intersection of the states of in and of other
+// if it is not empty, and to the states of in otherwise, for each site
+func intersectStates(in, other, out *AncestralSequence) {
+	for j, ances := range in.seq {
+		state := AncestralState{make([]float64, len(ances.counts))}
+		// Compute the intersection
+		nullIntersection := true
+		for k, c := range ances.counts {
+			state.counts[k] += c
+		}
+		for k, c := range other.seq[j].counts {
+			state.counts[k] += c
+			if state.counts[k] > 1 {
+				nullIntersection = false
+			}
+		}
+		for k, c := range state.counts {
+			if nullIntersection {
+				out.seq[j].counts[k] = ances.counts[k]
+			} else if c > 1 {
+				out.seq[j].counts[k] = 1
+			} else {
+				out.seq[j].counts[k] = 0
+			}
 		}
 	}
-	return nil
 }
 
 // Second step of the parsimony computatation: From root to tips
@@ -126,54 +163,32 @@ func parsimonyDOWNPASS(cur, prev *tree.Node, a align.Alignment,
 		// i.e. the parsimony from the upside of the tree
 		for _, child := range cur.Neigh() {
 			if child != prev {
-				for j, _ := range seqs[cur.Id()].seq {
-					state := AncestralState{make([]float64, len(charToIndex))}
-					nchild := 0
-					// already computed up state of the current node
-					if prev != nil { // Not the root
-						nchild++
-						for k, c := range upseqs[cur.Id()].seq[j].counts {
-							state.counts[k] += c
-						}
-					}
-					// already computed down states of children of current node
-					// except current child _child_
-					for _, child2 := range cur.Neigh() {
-						if child2 != prev && child2 != child {
-							for k, c := range seqs[child2.Id()].seq[j].counts {
-								state.counts[k] += c
-							}
-							nchild++
-						}
+				neighbors := make([]*AncestralSequence, 0, len(cur.Neigh()))
+				// already computed up state of the current node
+				if prev != nil { // Not the root
+					neighbors = append(neighbors, upseqs[cur.Id()])
+				}
+				// already computed down states of children of current node
+				// except current child _child_
+				for _, child2 := range cur.Neigh() {
+					if child2 != prev && child2 != child {
+						neighbors = append(neighbors, seqs[child2.Id()])
 					}
-					// Compute the up state now
-					computeParsimony(state, upseqs[child.Id()].seq[j], nchild)
 				}
+				// Compute the up state now
+				neighborStates(neighbors, upseqs[child.Id()])
 			}
 		}
 
 		if prev != nil {
-			// As we are manipulating trees with multifurcations
-			// For each character we count the number of children having it
-			// and then we take character(s) with the maximum number of children
-			// And that for each site of the alignment
-			for j, _ := range seqs[cur.Id()].seq {
-				state := AncestralState{make([]float64, len(charToIndex))}
-				// With Parent using its upseq
-				nchild := 1
-				for k, c := range upseqs[cur.Id()].seq[j].counts {
-					state.counts[k] += c
-				}
-				for _, child := range cur.Neigh() {
-					if child != prev {
-						for k, c := range seqs[child.Id()].seq[j].counts {
-							state.counts[k] += c
-						}
-						nchild++
-					}
+			// With Parent using its upseq
+			neighbors := []*AncestralSequence{upseqs[cur.Id()]}
+			for _, child := range cur.Neigh() {
+				if child != prev {
+					neighbors = append(neighbors, seqs[child.Id()])
 				}
-				computeParsimony(state, seqs[cur.Id()].seq[j], nchild)
 			}
+			neighborStates(neighbors, seqs[cur.Id()])
 		}
 
 		// We randomly resolve ambiguities
@@ -223,31 +238,8 @@ func parsimonyDELTRAN(cur, prev *tree.Node, a align.Alignment, seqs []*Ancestral
 	if !cur.Tip() {
 		// If it is not the root
 		if prev != nil {
-			for j, ances := range seqs[cur.Id()].seq {
-				state := AncestralState{make([]float64, len(charToIndex))}
-				// Compute the intersection with Parent
-				nullIntersection := true
-				for k, c := range ances.counts {
-					state.counts[k] += c
-				}
-				for k, c := range seqs[prev.Id()].seq[j].counts {
-					state.counts[k] += c
-					if state.counts[k] > 1 {
-						nullIntersection = false
-					}
-				}
-
-				// If non null intersection, then current node's state is the intersection
-				if !nullIntersection {
-					for k, c := range state.counts {
-						if c > 1 {
-							ances.counts[k] = 1
-						} else {
-							ances.counts[k] = 0
-						}
-					}
-				}
-			}
+			// If non null intersection with Parent, then current node's state is the intersection
+			intersectStates(seqs[cur.Id()], seqs[prev.Id()], seqs[cur.Id()])
 		}
 
 		// We resolve ambiguities if randomResolve
@@ -277,30 +269,8 @@ func parsimonyACCTRAN(cur, prev *tree.Node, a align.Alignment, seqs []*Ancestral
 		// We Analyze each direct child
 		for _, child := range cur.Neigh() {
 			if child != prev {
-				for j, ances := range seqs[cur.Id()].seq {
-					state := AncestralState{make([]float64, len(charToIndex))}
-					// Compute the intersection with Parent
-					nullIntersection := true
-					for k, c := range seqs[child.Id()].seq[j].counts {
-						state.counts[k] += c
-					}
-					for k, c := range ances.counts {
-						state.counts[k] += c
-						if state.counts[k] > 1 {
-							nullIntersection = false
-						}
-					}
-					// If non null intersection, then child node's state is the intersection
-					if !nullIntersection {
-						for k, c := range state.counts {
-							if c > 1 {
-								seqs[child.Id()].seq[j].counts[k] = 1
-							} else {
-								seqs[child.Id()].seq[j].counts[k] = 0
-							}
-						}
-					}
-				}
+				// If non null intersection with Parent, then child node's state is the intersection
+				intersectStates(seqs[child.Id()], seqs[cur.Id()], seqs[child.Id()])
 			}
 		}
 		// We go down in the tree
@@ -0,0 +1,353 @@
+package asr
+
+import (
+	"fmt"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Placement of a new sample on a branch of the tree
+type Placement struct {
+	Name   string       // Name of the placed sample
+	Node   *tree.Node   // Lower node of the branch on which the sample has been grafted
+	Score  int          // Parsimony score added by the sample
+	Ties   []*tree.Node // Lower nodes of all the equally parsimonious branches (Node included)
+	Parent *tree.Node   // New internal node created by the graft
+	edge   *tree.Edge   // Branch above Node
+}
+
+// Places each sequence of the query alignment onto the tree, whose tips are
+// the sequences of the reference alignment (same length, same alphabet).
+//
+// Samples are placed sequentially, in the order of the query alignment: for each
+// sample, ancestral sequences of the current tree are reconstructed by parsimony
+// (see ParsimonyAsr, algo being ALGO_ACCTRAN, ALGO_DELTRAN or ALGO_DOWNPASS), and
+// the sample is grafted (see tree.GraftTipOnEdge) onto the branch that minimizes the
+// added parsimony score. At each site, placing the sample on a branch costs 1 if its
+// state(s) intersect neither the states of the upper node nor the states of the lower
+// node of the branch, and 0 otherwise (missing data has no cost). In case of ties,
+// the first branch in the pre-order traversal of the tree is chosen.
+//
+// Ancestral sequences are reconstructed once on the reference tree, and then
+// updated locally after each graft: from the new tip to the root, and from the
+// root down to the nodes whose states change.
+//
+// If the tree has branch lengths, the grafted branch is divided in two, and the
+// new tip branch has a length of score/length of the alignment. Otherwise, new
+// branches have no length.
+//
+// Node comments (ancestral sequences) are cleared at the end, and node ids are set
+// to their index in t.Nodes().
+func ParsimonyPlacement(t *tree.Tree, ref, query align.Alignment, algo int) ([]*Placement, error) {
+	var err error
+	var sets *placementSets
+
+	if ref.Alphabet() != query.Alphabet() {
+		return nil, fmt.Errorf("Reference and query alignments do not have the same alphabet")
+	}
+	if ref.Length() != query.Length() {
+		return nil, fmt.Errorf("Reference (%d) and query (%d) alignments do not have the same length", ref.Length(), query.Length())
+	}
+	switch algo {
+	case ALGO_ACCTRAN, ALGO_DELTRAN, ALGO_DOWNPASS:
+	default:
+		return nil, fmt.Errorf("Parsimony algorithm %d unkown", algo)
+	}
+	// States of the reference tree, updated locally after each graft
+	if sets, err = newPlacementSets(t, ref, algo); err != nil {
+		return nil, err
+	}
+	alphabet := ref.AlphabetCharacters()
+	tips := make(map[string]bool)
+	for _, tip := range t.Tips() {
+		tips[tip.Name()] = true
+	}
+
+	placements := make([]*Placement, 0, query.NbSequences())
+	for i := 0; i < query.NbSequences(); i++ {
+		var qsets [][]bool
+		var p *Placement
+		var tip *tree.Node
+
+		name, _ := query.GetSequenceNameById(i)
+		seq, _ := query.GetSequenceCharById(i)
+		if _, ok := ref.GetSequenceChar(name); ok || tips[name] {
+			return nil, fmt.Errorf("Sample %s is already in the tree", name)
+		}
+		if qsets, err = parseStateSets(string(seq), alphabet, ref.Alphabet()); err != nil {
+			return nil, err
+		}
+		if p, err = bestPlacement(t, sets.sets, qsets); err != nil {
+			return nil, err
+		}
+		p.Name = name
+		if tip, err = graftPlacement(t, p, float64(p.Score)/float64(ref.Length())); err != nil {
+			return nil, err
+		}
+		if err = sets.graft(t, tip, seq); err != nil {
+			return nil, err
+		}
+		tips[name] = true
+		placements = append(placements, p)
+	}
+	t.ClearNodeComments()
+	t.ReinitIndexes()
+	for i, n := range t.Nodes() {
+		n.SetId(i)
+	}
+	return placements, nil
+}
+
+// Returns the placement of the sample (given its sets of states) that minimizes
+// the added parsimony score, and all the equally parsimonious placements
+func bestPlacement(t *tree.Tree, sets map[*tree.Node][][]bool, qsets [][]bool) (*Placement, error) {
+	var best *Placement
+
+	t.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		if prev == nil {
+			return true
+		}
+		score := 0
+		for site, q := range qsets {
+			shared := false
+			for s, ok := range q {
+				shared = shared || (ok && (sets[cur][site][s] || sets[prev][site][s]))
+			}
+			if !shared {
+				score++
+			}
+		}
+		if best == nil || score < best.Score {
+			best = &Placement{Node: cur, Score: score, Ties: []*tree.Node{cur}, edge: e}
+		} else if score == best.Score {
+			best.Ties = append(best.Ties, cur)
+		}
+		return true
+	})
+	if best == nil {
+		return nil, fmt.Errorf("The tree has no branch to place the sample on")
+	}
+	return best, nil
+}
+
+// Grafts a new tip named p.Name on the branch above p.Node, with the given tip
+// branch length (if the tree has branch lengths), and returns it
+func graftPlacement(t *tree.Tree, p *Placement, length float64) (*tree.Node, error) {
+	e := p.edge
+	brlen := e.Length()
+	tip := t.NewNode()
+	tip.SetName(p.Name)
+	tipedge, lower, parent, err := t.GraftTipOnEdge(tip, e)
+	if err != nil {
+		return nil, err
+	}
+	if brlen == tree.NIL_LENGTH {
+		e.SetLength(tree.NIL_LENGTH)
+		lower.SetLength(tree.NIL_LENGTH)
+		tipedge.SetLength(tree.NIL_LENGTH)
+	} else {
+		tipedge.SetLength(length)
+	}
+	p.Parent = parent
+	return tip, nil
+}
+
+// Parsimony states of the nodes of a tree (see ParsimonyAsr), that are updated
+// locally when a tip is grafted
+type placementSets struct {
+	algo        int
+	length      int
+	charToIndex map[rune]int
+	seqs        map[*tree.Node]*AncestralSequence // States of the subtrees (first pass)
+	upseqs      map[*tree.Node]*AncestralSequence // States of the rest of the tree (DOWNPASS & DELTRAN)
+	final       map[*tree.Node]*AncestralSequence // Reconstructed states
+	sets        map[*tree.Node][][]bool           // Reconstructed states, as sets (empty: all states)
+}
+
+// Reconstructs the states of all the nodes of the tree, given the alignment of its tips
+func newPlacementSets(t *tree.Tree, a align.Alignment, algo int) (*placementSets, error) {
+	s := &placementSets{
+		algo:        algo,
+		length:      a.Length(),
+		charToIndex: make(map[rune]int),
+		seqs:        make(map[*tree.Node]*AncestralSequence),
+		upseqs:      make(map[*tree.Node]*AncestralSequence),
+		final:       make(map[*tree.Node]*AncestralSequence),
+		sets:        make(map[*tree.Node][][]bool),
+	}
+	for i, c := range a.AlphabetCharacters() {
+		s.charToIndex[c] = i
+	}
+	if err := s.upRec(t.Root(), nil, a); err != nil {
+		return nil, err
+	}
+	s.update(t.Root(), nil, nil)
+	s.downRec(t.Root(), nil, nil)
+	return s, nil
+}
+
+// Computes the states of the subtree rooted at cur, from the tips
+func (s *placementSets) upRec(cur, prev *tree.Node, a align.Alignment) error {
+	if cur.Tip() {
+		seq, ok := a.GetSequenceChar(cur.Name())
+		if !ok {
+			return fmt.Errorf("Sequence %s does not exist in the alignment", cur.Name())
+		}
+		return s.tip(cur, seq)
+	}
+	for _, child := range cur.Neigh() {
+		if child != prev {
+			if err := s.upRec(child, cur, a); err != nil {
+				return err
+			}
+		}
+	}
+	return s.subtree(cur, prev)
+}
+
+// Initializes the states of the tip n with its sequence
+func (s *placementSets) tip(n *tree.Node, seq []rune) (err error) {
+	if s.seqs[n], err = NewAncestralSequence(s.length, len(s.charToIndex)); err != nil {
+		return
+	}
+	tipStates(seq, s.charToIndex, s.seqs[n])
+	return
+}
+
+// Computes the states of the subtree rooted at cur from the states of its children
+func (s *placementSets) subtree(cur, prev *tree.Node) (err error) {
+	children := make([]*AncestralSequence, 0, len(cur.Neigh()))
+	for _, child := range cur.Neigh() {
+		if child != prev {
+			children = append(children, s.seqs[child])
+		}
+	}
+	if s.seqs[cur], err = NewAncestralSequence(s.length, len(s.charToIndex)); err != nil {
+		return
+	}
+	neighborStates(children, s.seqs[cur])
+	return
+}
+
+// Recomputes the reconstructed states of cur, given the states of its parent
+// (and of the parent of its parent), as the second step(s) of ParsimonyAsr would
+// do. Returns true if they have changed.
+func (s *placementSets) update(cur, parent, grandparent *tree.Node) bool {
+	var upseq *AncestralSequence
+	final := s.seqs[cur]
+
+	if parent != nil && s.algo == ALGO_ACCTRAN {
+		final, _ = NewAncestralSequence(s.length, len(s.charToIndex))
+		intersectStates(s.seqs[cur], s.final[parent], final)
+	} else if parent != nil {
+		// Up states of cur: from the up states of its parent and the states of its siblings
+		upseq, _ = NewAncestralSequence(s.length, len(s.charToIndex))
+		neighbors := make([]*AncestralSequence, 0, len(parent.Neigh()))
+		if grandparent != nil {
+			neighbors = append(neighbors, s.upseqs[parent])
+		}
+		for _, sibling := range parent.Neigh() {
+			if sibling != cur && sibling != grandparent {
+				neighbors = append(neighbors, s.seqs[sibling])
+			}
+		}
+		neighborStates(neighbors, upseq)
+		if !cur.Tip() {
+			final, _ = NewAncestralSequence(s.length, len(s.charToIndex))
+			neighbors = []*AncestralSequence{upseq}
+			for _, child := range cur.Neigh() {
+				if child != parent {
+					neighbors = append(neighbors, s.seqs[child])
+				}
+			}
+			neighborStates(neighbors, final)
+			if s.algo == ALGO_DELTRAN {
+				intersectStates(final, s.final[parent], final)
+			}
+		}
+	}
+	changed := !sameStates(final, s.final[cur]) || !sameStates(upseq, s.upseqs[cur])
+	s.final[cur] = final
+	s.upseqs[cur] = upseq
+	if changed {
+		s.sets[cur] = statesToSets(final)
+	}
+	return changed
+}
+
+// Updates the reconstructed states of the subtree rooted at cur (prev being its
+// parent), whose states are up to date. Goes down only into the children whose
+// states have changed, or whose subtree contains a node of path. If path is nil,
+// goes down the whole subtree.
+func (s *placementSets) downRec(cur, prev *tree.Node, path map[*tree.Node]bool) {
+	for _, child := range cur.Neigh() {
+		if child != prev {
+			if s.update(child, cur, prev) || path == nil || path[child] {
+				s.downRec(child, cur, path)
+			}
+		}
+	}
+}
+
+// Updates the states after the graft of the tip n (see graftPlacement), given
+// its sequence: states of the subtrees are updated from n to the root, and
+// reconstructed states from the root, only where they change.
+func (s *placementSets) graft(t *tree.Tree, n *tree.Node, seq []rune) (err error) {
+	path := map[*tree.Node]bool{n: true}
+	if err = s.tip(n, seq); err != nil {
+		return
+	}
+	for cur := n; cur != t.Root(); {
+		var prev *tree.Node
+		if cur, err = cur.Parent(); err != nil {
+			return
+		}
+		if cur != t.Root() {
+			if prev, err = cur.Parent(); err != nil {
+				return
+			}
+		}
+		if err = s.subtree(cur, prev); err != nil {
+			return
+		}
+		path[cur] = true
+	}
+	s.update(t.Root(), nil, nil)
+	s.downRec(t.Root(), nil, path)
+	return
+}
+
+// Returns true if both sequences have the same states (nil being different from any sequence)
+func sameStates(a, b *AncestralSequence) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	for j, ances := range a.seq {
+		for k, c := range ances.counts {
+			if c != b.seq[j].counts[k] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Returns the sets of states of each site of the sequence (all states if no state is possible)
+func statesToSets(seq *AncestralSequence) [][]bool {
+	sets := make([][]bool, len(seq.seq))
+	for j, ances := range seq.seq {
+		sets[j] = make([]bool, len(ances.counts))
+		empty := true
+		for k, c := range ances.counts {
+			sets[j][k] = c > 0
+			empty = empty && c <= 0
+		}
+		if empty {
+			for k := range sets[j] {
+				sets[j][k] = true
+			}
+		}
+	}
+	return sets
+}
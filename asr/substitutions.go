@@ -0,0 +1,258 @@
+package asr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// A substitution inferred on a branch of the tree, from the
+// ancestral sequences of its two extremities.
+type Substitution struct {
+	Parent    *tree.Node // Upper node of the branch
+	Child     *tree.Node // Lower node of the branch
+	Edge      *tree.Edge // Branch
+	Position  int        // Position in the alignment (starting at 0)
+	Ancestral rune       // State of the parent (IUPAC code if ambiguous)
+	Derived   rune       // State of the child (IUPAC code if ambiguous)
+}
+
+// Returns the substitution in the form A12T (position starting at 1)
+func (s *Substitution) String() string {
+	return fmt.Sprintf("%c%d%c", s.Ancestral, s.Position+1, s.Derived)
+}
+
+// Ambiguity codes of nucleotides and amino acids: sets of states
+var nucleotideAmbiguities = map[rune]string{
+	'U': "T", 'R': "AG", 'Y': "CT", 'S': "CG", 'W': "AT", 'K': "GT", 'M': "AC",
+	'B': "CGT", 'D': "AGT", 'H': "ACT", 'V': "ACG",
+}
+var aminoAcidAmbiguities = map[rune]string{
+	'B': "DN", 'Z': "EQ", 'J': "IL",
+}
+
+// Returns the name of the node in the ancestral alignment:
+// its name, or its id if it has no name
+func nodeSequenceName(n *tree.Node) string {
+	if n.Name() != "" {
+		return n.Name()
+	}
+	return strconv.Itoa(n.Id())
+}
+
+// Returns the ancestral sequence of a node, as written in its
+// first comment by ParsimonyAsr or MLAsr
+func nodeSequence(n *tree.Node) (string, error) {
+	if len(n.Comments()) == 0 {
+		return "", fmt.Errorf("Node %s has no ancestral sequence", nodeSequenceName(n))
+	}
+	return n.Comments()[0], nil
+}
+
+// Parses an ancestral sequence into sets of possible states for each site.
+// Sets of states may be given between braces ({AC}) or by ambiguity codes.
+// Gaps and unknown characters are considered as all states.
+func parseStateSets(seq string, alphabet []rune, alphabetType int) ([][]bool, error) {
+	var ambiguities map[rune]string = aminoAcidAmbiguities
+	var sets [][]bool
+	var cur []bool
+
+	if alphabetType == align.NUCLEOTIDS {
+		ambiguities = nucleotideAmbiguities
+	}
+
+	index := make(map[rune]int)
+	for i, c := range alphabet {
+		index[c] = i
+	}
+
+	inset := false
+	for _, c := range strings.ToUpper(seq) {
+		switch {
+		case c == '{':
+			if inset {
+				return nil, fmt.Errorf("Malformed ancestral sequence %s: nested '{'", seq)
+			}
+			inset = true
+			cur = make([]bool, len(alphabet))
+		case c == '}':
+			if !inset {
+				return nil, fmt.Errorf("Malformed ancestral sequence %s: unexpected '}'", seq)
+			}
+			inset = false
+			sets = append(sets, cur)
+		case inset:
+			if i, ok := index[c]; ok {
+				cur[i] = true
+			}
+		default:
+			set := make([]bool, len(alphabet))
+			if i, ok := index[c]; ok {
+				set[i] = true
+			} else if states, ok := ambiguities[c]; ok {
+				for _, s := range states {
+					set[index[s]] = true
+				}
+			} else {
+				for i := range set {
+					set[i] = true
+				}
+			}
+			sets = append(sets, set)
+		}
+	}
+	if inset {
+		return nil, fmt.Errorf("Malformed ancestral sequence %s: missing '}'", seq)
+	}
+	return sets, nil
+}
+
+// Returns the character coding the given set of states: the state itself if
+// only one state is possible, the IUPAC code of the set for nucleotides
+// (B, Z or J if possible for amino acids), and N (X for amino acids) otherwise.
+func ambiguityCode(set []bool, alphabet []rune, alphabetType int) rune {
+	var ambiguities map[rune]string = aminoAcidAmbiguities
+	var all rune = align.ALL_AMINO
+	var state rune
+	nb := 0
+
+	if alphabetType == align.NUCLEOTIDS {
+		ambiguities = nucleotideAmbiguities
+		all = align.ALL_NUCLE
+	}
+	for i, ok := range set {
+		if ok {
+			state = alphabet[i]
+			nb++
+		}
+	}
+	if nb == 1 {
+		return state
+	}
+	// Codes whose states are exactly the states of the set,
+	// whatever the order of the alphabet
+	for c, states := range ambiguities {
+		same := len(states) == nb
+		for i, ok := range set {
+			if ok && !strings.ContainsRune(states, alphabet[i]) {
+				same = false
+			}
+		}
+		if same {
+			return c
+		}
+	}
+	return all
+}
+
+// Returns the states of all the nodes of the tree, after ParsimonyAsr or MLAsr
+func stateSets(t *tree.Tree, alphabet []rune, alphabetType int) (map[*tree.Node][][]bool, error) {
+	sets := make(map[*tree.Node][][]bool)
+	length := -1
+	for _, n := range t.Nodes() {
+		seq, err := nodeSequence(n)
+		if err != nil {
+			return nil, err
+		}
+		if sets[n], err = parseStateSets(seq, alphabet, alphabetType); err != nil {
+			return nil, err
+		}
+		if length >= 0 && len(sets[n]) != length {
+			return nil, fmt.Errorf("Ancestral sequence of node %s does not have the same length as the others", nodeSequenceName(n))
+		}
+		length = len(sets[n])
+	}
+	return sets, nil
+}
+
+// Returns the alignment of the sequences of all the nodes of the tree (tips and
+// internal nodes), as reconstructed by ParsimonyAsr or MLAsr from the alignment al.
+//
+// Sequences of the tips are the sequences of al (gaps included), and sites of
+// internal nodes having several possible states are coded with IUPAC ambiguity
+// codes. Nodes without name are named by their id.
+func AncestralAlignment(t *tree.Tree, al align.Alignment) (align.Alignment, error) {
+	anc := align.NewAlign(al.Alphabet())
+	alphabet := anc.AlphabetCharacters()
+	sets, err := stateSets(t, alphabet, al.Alphabet())
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range t.Nodes() {
+		if n.Tip() {
+			tipseq, ok := al.GetSequence(n.Name())
+			if !ok {
+				return nil, fmt.Errorf("Tip %s is not in the alignment", n.Name())
+			}
+			if err = anc.AddSequence(n.Name(), tipseq, ""); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		seq := make([]rune, len(sets[n]))
+		for i, set := range sets[n] {
+			seq[i] = ambiguityCode(set, alphabet, al.Alphabet())
+		}
+		if err = anc.AddSequenceChar(nodeSequenceName(n), seq, ""); err != nil {
+			return nil, err
+		}
+	}
+	return anc, nil
+}
+
+// Returns the substitutions inferred on each branch of the tree, from the ancestral
+// sequences reconstructed by ParsimonyAsr or MLAsr (given the alphabet of the
+// input alignment: align.NUCLEOTIDS or align.AMINOACIDS).
+//
+// A substitution is inferred at a site of a branch when the sets of possible states
+// of the parent and of the child do not intersect. Missing data (gaps, N) is thus
+// never considered as a substitution. Substitutions are given in the pre-order
+// traversal of the tree, and by position for each branch.
+func Substitutions(t *tree.Tree, alphabetType int) ([]*Substitution, error) {
+	alphabet := align.NewAlign(alphabetType).AlphabetCharacters()
+	sets, err := stateSets(t, alphabet, alphabetType)
+	if err != nil {
+		return nil, err
+	}
+	subs := make([]*Substitution, 0)
+	t.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		if prev == nil {
+			return true
+		}
+		for pos, childset := range sets[cur] {
+			parentset := sets[prev][pos]
+			common := false
+			for i := range childset {
+				common = common || (childset[i] && parentset[i])
+			}
+			if !common {
+				subs = append(subs, &Substitution{
+					Parent:    prev,
+					Child:     cur,
+					Edge:      e,
+					Position:  pos,
+					Ancestral: ambiguityCode(parentset, alphabet, alphabetType),
+					Derived:   ambiguityCode(childset, alphabet, alphabetType),
+				})
+			}
+		}
+		return true
+	})
+	return subs, nil
+}
+
+// Annotates each branch of the tree with its substitutions and their number,
+// in the form [&nmut=2,mutations={A12T,C30G}] (edge comments are replaced).
+func AnnotateMutations(t *tree.Tree, subs []*Substitution) {
+	var mutations map[*tree.Edge][]string = make(map[*tree.Edge][]string)
+	for _, s := range subs {
+		mutations[s.Edge] = append(mutations[s.Edge], s.String())
+	}
+	for _, e := range t.Edges() {
+		e.ClearComments()
+		e.AddComment(fmt.Sprintf("&nmut=%d,mutations={%s}", len(mutations[e]), strings.Join(mutations[e], ",")))
+	}
+}
@@ -6,26 +6,39 @@ import (
 	"errors"
 	"fmt"
 	goio "io"
+	"math"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/evolbioinfo/gotree/acr"
 	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/io/utils"
 	"github.com/evolbioinfo/gotree/tree"
 	"github.com/spf13/cobra"
 )
 
 var acrstates string
 var acrrandomresolve bool // Resolve ambiguities randomly in the downpass/deltran/acctran algo
+var acrmodel string
+var acroutprobas string
+var acroutmodel string
+var acrcosts string
+var acroutcost string
+var acroutchanges string
+var acrtraits string
+var acrouttable string
+var acrouttransitions string
+var acroutbranchchanges string
 
 // acrCmd represents the acr command
 var acrCmd = &cobra.Command{
 	Use:   "acr",
-	Short: "Reconstructs most parsimonious ancestral characters",
-	Long: `Reconstructs most parsimonious ancestral characters.
+	Short: "Reconstructs ancestral characters (parsimony or maximum likelihood)",
+	Long: `Reconstructs ancestral characters (parsimony or maximum likelihood).
 
-Depending on the chosen algorithm, it will run:
+For parsimony, depending on the chosen algorithm, it will run:
 1) UP-PASS and
 2) Either
    a) DOWN-PASS or
@@ -38,6 +51,95 @@ Should work on multifurcated trees.
 If --random-resolve is given then, during the last pass, each time 
 a node with several possible states still exists, one state is chosen 
 randomly before going deeper in the tree.
+
+If --algo ml is given, ancestral characters are reconstructed by maximum
+likelihood, under a Mk model (--model) whose rates are estimated by maximum
+likelihood:
+- er  : Equal rates between all states;
+- sym : Symmetric rates (rate i->j == rate j->i);
+- ard : All rates different.
+Trees must have branch lengths, and the root (pseudo root for unrooted trees) has
+uniform prior state probabilities. Each node of the output tree is annotated with
+its state in the most likely joint reconstruction, and with the marginal posterior
+probabilities of each state: [&state=A,prob={A:0.9,B:0.1}]. --out-states gives
+the joint states of internal nodes.
+
+With --algo ml, --out-probas gives the marginal posterior probabilities of the
+states of each node (tab separated, one column per state), and --out-model
+gives, for each tree (tab separated):
+1) Tree id
+2) Model
+3) Log-likelihood
+4) Number of estimated rates
+5) Estimated rates, comma separated (from>to:rate)
+
+If --algo sankoff is given, ancestral characters are reconstructed by Sankoff
+parsimony, with the state-to-state cost matrix given with --costs (tab separated,
+first line: states, next lines: costs of the changes from each state to the states
+of the first line, optionally starting with the state, otherwise in the order of
+the first line; "-" or "*" stand for 0), e.g. for an ordered character:
+	0	1	2
+0	0	1	2
+1	1	0	1
+2	2	1	0
+Costs must be non-negative, with a null diagonal, and may be asymmetric, in which
+case the reconstruction depends on the root of the tree. Each node of the output
+tree is annotated with its state in one most parsimonious reconstruction, and with
+all its most parsimonious states ([&state=A,states={A,B}]). Each branch is
+annotated with its minimum and maximum numbers of changes over all the most
+parsimonious reconstructions ([&minchanges=0,maxchanges=1]). --out-cost gives,
+for each tree (tab separated):
+1) Tree id
+2) Total cost
+3) Consistency index (CI=M/S)
+4) Retention index (RI=(G-S)/(G-M))
+M being the cost of the minimum Steiner tree connecting the observed states in the
+cost matrix, G the cost of the star tree, and S the total cost (NA if not defined).
+--out-changes gives the minimum and maximum numbers of changes of each branch
+(tab separated: tree, parent, child, minchanges, maxchanges), nodes being
+identified by their name, or by their id if they have no name.
+
+Several characters can be reconstructed in one run with --traits (instead of
+--states): tab separated file whose first line gives the character names
+(first column: tip names), and each following line gives a tip name followed by
+its states. Each character is reconstructed independently with the chosen
+algorithm, and each node of the output tree is annotated with the states of all
+the characters ([&trait1=A,trait2=B|C]). The state of a character changes along a
+branch if its parent and child have no common possible state. With --traits:
+- --out-table gives the state(s) of each node (rows) for each character (columns);
+- --out-transitions gives the number of transitions from each state to each
+  other state, for each character (tab separated: tree, character, from, to,
+  count). Counts of changes between ambiguous states are distributed equally
+  among all the pairs of possible states;
+- --out-branch-changes gives the branches along which each character changes
+  (tab separated: tree, character, parent, child, from, to).
+Nodes are identified by their name, or by their id if they have no name.
+--out-states, --out-probas, --out-model, --out-cost and --out-changes are not
+available with --traits.
+
+If --algo bm or --algo scp is given, the trait is continuous, and the tip state
+file (--states) gives the values of each tip (tab separated: tipname, then one
+column per dimension, e.g. latitude and longitude). A header line (tip name, then
+dimension names) may be given, otherwise dimensions are named value1, value2, etc.
+Each dimension is reconstructed independently:
+- bm : Maximum likelihood under a Brownian motion model, with 95% confidence
+       intervals. Trees must have branch lengths;
+- scp: Squared-change parsimony (branch lengths are not used).
+Each node of the output tree is annotated with its values and confidence
+intervals: [&lat=12.3,lat_CI={10.1,14.5},long=...]. --out-states gives the values
+(and confidence intervals) of internal nodes (tab separated: tree, node, then the
+value, lower and upper bounds of each dimension), --out-model gives the rate
+(sigma2) and log-likelihood of the Brownian motion (bm, tab separated: tree,
+dimension, sigma2, loglik), and --out-cost gives the sum of squared changes
+(scp, tab separated: tree, dimension, cost). Longitudes are not handled
+specifically (e.g. around the 180th meridian).
+
+Example:
+
+gotree acr -i tree.nw --states latlong.txt --algo bm --out-states values.txt -o annotated.nw
+gotree acr -i tree.nw --traits traits.txt --algo acctran --out-table table.txt --out-transitions transitions.txt -o annotated.nw
+gotree acr -i tree.nw --states states.txt --algo sankoff --costs costs.txt --out-cost cost.txt -o annotated.nw
+gotree acr -i tree.nw --states states.txt --algo ml --model ard --out-probas probas.txt --out-model model.txt -o annotated.nw
 `,
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
 		var algo int
@@ -46,7 +148,21 @@ randomly before going deeper in the tree.
 		var resfile *os.File
 		var treefile goio.Closer
 		var treechan <-chan tree.Trees
-		var f *os.File
+		var f, probasfile, modelfile *os.File
+		var model int
+		var res *acr.MLAcrResult
+		var sres *acr.SankoffAcrResult
+		var coststates []string
+		var costs [][]float64
+		var costfile, changesfile *os.File
+		var characters []string
+		var traits map[string][]string
+		var batch []*acr.CharacterAcr
+		var tablefile, transitionsfile, branchchangesfile *os.File
+		var continuous bool
+		var dimensions []string
+		var tipvalues map[string][]float64
+		var cres *acr.ContinuousAcrResult
 
 		switch strings.ToLower(parsimonyAlgo) {
 		case "acctran":
@@ -57,12 +173,56 @@ randomly before going deeper in the tree.
 			algo = acr.ALGO_DOWNPASS
 		case "none":
 			algo = acr.ALGO_NONE
+		case "ml":
+			algo = acr.ALGO_ML
+			if model = acr.MkModelStringToInt(strings.ToLower(acrmodel)); model < 0 {
+				err = fmt.Errorf("Unknown Mk model: %s", acrmodel)
+				io.LogError(err)
+				return
+			}
+		case "sankoff":
+			algo = acr.ALGO_SANKOFF
+			if acrcosts == "none" {
+				err = errors.New("A cost matrix must be given with --costs")
+				io.LogError(err)
+				return
+			}
+			if coststates, costs, err = readStateMatrix(acrcosts); err != nil {
+				io.LogError(err)
+				return
+			}
+		case "bm":
+			algo = acr.ALGO_BM
+			continuous = true
+		case "scp":
+			algo = acr.ALGO_SCP
+			continuous = true
 		default:
 			io.LogError(fmt.Errorf("Unkown parsimony algorithm: %s", parsimonyAlgo))
 			return
 		}
 		// Reading tip state in an input file
-		if tipstates, err = parseTipStates(acrstates); err != nil {
+		if continuous {
+			if acrtraits != "none" {
+				err = errors.New("--traits is not available for continuous traits")
+				io.LogError(err)
+				return
+			}
+			if dimensions, tipvalues, err = parseTipValues(acrstates); err != nil {
+				io.LogError(err)
+				return
+			}
+		} else if acrtraits != "none" {
+			if outresfile != "none" || acroutprobas != "none" || acroutmodel != "none" || acroutcost != "none" || acroutchanges != "none" {
+				err = errors.New("--out-states, --out-probas, --out-model, --out-cost and --out-changes are not available with --traits")
+				io.LogError(err)
+				return
+			}
+			if characters, traits, err = parseTraits(acrtraits); err != nil {
+				io.LogError(err)
+				return
+			}
+		} else if tipstates, err = parseTipStates(acrstates); err != nil {
 			io.LogError(err)
 			return
 		}
@@ -87,13 +247,171 @@ randomly before going deeper in the tree.
 				return
 			}
 			defer closeWriteFile(resfile, outresfile)
+			if continuous {
+				writeAcrValuesHeader(resfile, algo, dimensions)
+			}
 		}
-		for t := range treechan {
-			statemap, err = acr.ParsimonyAcr(t.Tree, tipstates, algo, acrrandomresolve)
-			if err != nil {
+		if algo == acr.ALGO_ML && acroutprobas != "none" {
+			if probasfile, err = openWriteFile(acroutprobas); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(probasfile, acroutprobas)
+		}
+		if algo == acr.ALGO_ML && acroutmodel != "none" {
+			if modelfile, err = openWriteFile(acroutmodel); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(modelfile, acroutmodel)
+			modelfile.WriteString("tree\tmodel\tloglik\tnparams\trates\n")
+		}
+		if algo == acr.ALGO_BM && acroutmodel != "none" {
+			if modelfile, err = openWriteFile(acroutmodel); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(modelfile, acroutmodel)
+			modelfile.WriteString("tree\tdimension\tsigma2\tloglik\n")
+		}
+		if algo == acr.ALGO_SCP && acroutcost != "none" {
+			if costfile, err = openWriteFile(acroutcost); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(costfile, acroutcost)
+			costfile.WriteString("tree\tdimension\tcost\n")
+		}
+		if algo == acr.ALGO_SANKOFF && acroutcost != "none" {
+			if costfile, err = openWriteFile(acroutcost); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(costfile, acroutcost)
+			costfile.WriteString("tree\tcost\tci\tri\n")
+		}
+		if algo == acr.ALGO_SANKOFF && acroutchanges != "none" {
+			if changesfile, err = openWriteFile(acroutchanges); err != nil {
 				io.LogError(err)
 				return
 			}
+			defer closeWriteFile(changesfile, acroutchanges)
+			changesfile.WriteString("tree\tparent\tchild\tminchanges\tmaxchanges\n")
+		}
+		if acrtraits != "none" {
+			if acrouttable != "none" {
+				if tablefile, err = openWriteFile(acrouttable); err != nil {
+					io.LogError(err)
+					return
+				}
+				defer closeWriteFile(tablefile, acrouttable)
+			}
+			if acrouttransitions != "none" {
+				if transitionsfile, err = openWriteFile(acrouttransitions); err != nil {
+					io.LogError(err)
+					return
+				}
+				defer closeWriteFile(transitionsfile, acrouttransitions)
+				transitionsfile.WriteString("tree\tcharacter\tfrom\tto\tcount\n")
+			}
+			if acroutbranchchanges != "none" {
+				if branchchangesfile, err = openWriteFile(acroutbranchchanges); err != nil {
+					io.LogError(err)
+					return
+				}
+				defer closeWriteFile(branchchangesfile, acroutbranchchanges)
+				branchchangesfile.WriteString("tree\tcharacter\tparent\tchild\tfrom\tto\n")
+			}
+		}
+		// Reconstruction of one character
+		reconstruct := func(t *tree.Tree, tipstates map[string]string) (nodestates map[*tree.Node][]string, err error) {
+			var mlres *acr.MLAcrResult
+			var sankoffres *acr.SankoffAcrResult
+			switch algo {
+			case acr.ALGO_ML:
+				if mlres, _, err = acr.MLAcr(t, tipstates, model); err == nil {
+					nodestates = jointAcrStates(mlres.Joint, mlres.States)
+				}
+			case acr.ALGO_SANKOFF:
+				if sankoffres, _, err = acr.SankoffAcr(t, tipstates, coststates, costs, acrrandomresolve); err == nil {
+					nodestates = jointAcrStates(sankoffres.Joint, sankoffres.States)
+				}
+			default:
+				nodestates, err = acr.ParsimonyAcrNodes(t, tipstates, algo, acrrandomresolve)
+			}
+			return
+		}
+		for t := range treechan {
+			if t.Err != nil {
+				io.LogError(t.Err)
+				return t.Err
+			}
+			if continuous {
+				if cres, err = acr.ContinuousAcr(t.Tree, tipvalues, dimensions, algo); err != nil {
+					io.LogError(err)
+					return
+				}
+				if resfile != nil {
+					writeAcrValues(resfile, t.Id, t.Tree, cres)
+				}
+				for d, dim := range cres.Traits {
+					if modelfile != nil {
+						fmt.Fprintf(modelfile, "%d\t%s\t%g\t%g\n", t.Id, dim, cres.Sigma2[d], cres.LogLikelihood[d])
+					}
+					if costfile != nil {
+						fmt.Fprintf(costfile, "%d\t%s\t%g\n", t.Id, dim, cres.SquaredChanges[d])
+					}
+				}
+				f.WriteString(t.Tree.Newick() + "\n")
+				continue
+			}
+			if acrtraits != "none" {
+				if batch, err = acr.BatchAcr(t.Tree, characters, traits, reconstruct); err != nil {
+					io.LogError(err)
+					return
+				}
+				if tablefile != nil {
+					writeAcrTable(tablefile, t.Tree, batch)
+				}
+				if transitionsfile != nil {
+					writeAcrTransitions(transitionsfile, t.Id, batch)
+				}
+				if branchchangesfile != nil {
+					writeAcrBranchChanges(branchchangesfile, t.Id, batch)
+				}
+				f.WriteString(t.Tree.Newick() + "\n")
+				continue
+			}
+			if algo == acr.ALGO_ML {
+				if res, statemap, err = acr.MLAcr(t.Tree, tipstates, model); err != nil {
+					io.LogError(err)
+					return
+				}
+				if probasfile != nil {
+					writeAcrProbas(probasfile, t.Tree, res)
+				}
+				if modelfile != nil {
+					writeAcrModel(modelfile, t.Id, strings.ToLower(acrmodel), res)
+				}
+			} else if algo == acr.ALGO_SANKOFF {
+				if sres, statemap, err = acr.SankoffAcr(t.Tree, tipstates, coststates, costs, acrrandomresolve); err != nil {
+					io.LogError(err)
+					return
+				}
+				if costfile != nil {
+					fmt.Fprintf(costfile, "%d\t%g\t%s\t%s\n", t.Id, sres.Cost,
+						likParamString(!math.IsNaN(sres.CI), sres.CI), likParamString(!math.IsNaN(sres.RI), sres.RI))
+				}
+				if changesfile != nil {
+					writeAcrChanges(changesfile, t.Id, t.Tree, sres)
+				}
+			} else {
+				statemap, err = acr.ParsimonyAcr(t.Tree, tipstates, algo, acrrandomresolve)
+				if err != nil {
+					io.LogError(err)
+					return
+				}
+			}
 			f.WriteString(t.Tree.Newick() + "\n")
 			if outresfile != "none" {
 				for k, v := range statemap {
@@ -111,8 +429,236 @@ func init() {
 	acrCmd.PersistentFlags().StringVarP(&intreefile, "input", "i", "stdin", "Input tree")
 	acrCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Output file")
 	acrCmd.PersistentFlags().StringVar(&outresfile, "out-states", "none", "Output mapping file between node names and states")
-	acrCmd.PersistentFlags().StringVar(&parsimonyAlgo, "algo", "acctran", "Parsimony algorithm for resolving ambiguities: acctran, deltran, or downpass")
-	acrCmd.PersistentFlags().BoolVar(&acrrandomresolve, "random-resolve", false, "Random resolve states when several possibilities in: acctran, deltran, or downpass")
+	acrCmd.PersistentFlags().StringVar(&parsimonyAlgo, "algo", "acctran", "Algorithm: acctran, deltran, or downpass (parsimony), sankoff (parsimony with a cost matrix), or ml (maximum likelihood), or, for continuous traits, bm (brownian motion maximum likelihood) or scp (squared-change parsimony)")
+	acrCmd.PersistentFlags().BoolVar(&acrrandomresolve, "random-resolve", false, "Random resolve states when several possibilities in: acctran, deltran, downpass, or sankoff")
+	acrCmd.PersistentFlags().StringVar(&acrmodel, "model", "er", "Mk model (ml): er, sym, or ard")
+	acrCmd.PersistentFlags().StringVar(&acroutprobas, "out-probas", "none", "Output file of the marginal posterior probabilities of the states of each node (ml)")
+	acrCmd.PersistentFlags().StringVar(&acroutmodel, "out-model", "none", "Output file of the estimated model parameters and log-likelihood (ml, bm)")
+	acrCmd.PersistentFlags().StringVar(&acrcosts, "costs", "none", "State-to-state cost matrix file (sankoff)")
+	acrCmd.PersistentFlags().StringVar(&acroutcost, "out-cost", "none", "Output file of the total cost, CI and RI of each tree (sankoff), or of the sum of squared changes (scp)")
+	acrCmd.PersistentFlags().StringVar(&acrtraits, "traits", "none", "Tip trait file with several characters (tab separated: header line with character names, then one line per tip: tipname\\tstate1\\tstate2...)")
+	acrCmd.PersistentFlags().StringVar(&acrouttable, "out-table", "none", "Output file of the states of each node for each character (traits)")
+	acrCmd.PersistentFlags().StringVar(&acrouttransitions, "out-transitions", "none", "Output file of the number of transitions between states for each character (traits)")
+	acrCmd.PersistentFlags().StringVar(&acroutbranchchanges, "out-branch-changes", "none", "Output file of the branches along which each character changes (traits)")
+	acrCmd.PersistentFlags().StringVar(&acroutchanges, "out-changes", "none", "Output file of the minimum and maximum numbers of changes of each branch (sankoff)")
+}
+
+// Writes the marginal posterior probabilities of the states of each node,
+// nodes being identified by their name, or by their id if they have no name
+func writeAcrProbas(f goio.Writer, t *tree.Tree, res *acr.MLAcrResult) {
+	fmt.Fprintf(f, "node\t%s\n", strings.Join(res.States, "\t"))
+	t.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		id := fmt.Sprintf("%d", cur.Id())
+		if cur.Name() != "" {
+			id = cur.Name()
+		}
+		fmt.Fprint(f, id)
+		for _, p := range res.Marginals[cur] {
+			fmt.Fprintf(f, "\t%g", p)
+		}
+		fmt.Fprintln(f)
+		return true
+	})
+}
+
+// Writes the estimated Mk model
+func writeAcrModel(f goio.Writer, id int, model string, res *acr.MLAcrResult) {
+	rates := make([]string, 0, len(res.States)*len(res.States))
+	for i, from := range res.States {
+		for j, to := range res.States {
+			if i != j {
+				rates = append(rates, fmt.Sprintf("%s>%s:%g", from, to, res.Rates[i][j]))
+			}
+		}
+	}
+	fmt.Fprintf(f, "%d\t%s\t%g\t%d\t%s\n", id, model, res.LogLikelihood, res.NbParams, strings.Join(rates, ","))
+}
+
+// Writes the minimum and maximum numbers of changes of each branch
+func writeAcrChanges(f goio.Writer, id int, t *tree.Tree, res *acr.SankoffAcrResult) {
+	t.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		if prev != nil {
+			fmt.Fprintf(f, "%d\t%s\t%s\t%d\t%d\n", id, asrNodeName(prev), asrNodeName(cur), res.MinChanges[cur], res.MaxChanges[cur])
+		}
+		return true
+	})
+}
+
+// Returns the joint state of each internal node, given the indices of the states
+func jointAcrStates(joint map[*tree.Node]int, states []string) map[*tree.Node][]string {
+	nodestates := make(map[*tree.Node][]string)
+	for n, s := range joint {
+		if !n.Tip() {
+			nodestates[n] = []string{states[s]}
+		}
+	}
+	return nodestates
+}
+
+// Writes the header of the continuous values output file
+func writeAcrValuesHeader(f goio.Writer, algo int, dimensions []string) {
+	fmt.Fprint(f, "tree\tnode")
+	for _, d := range dimensions {
+		fmt.Fprintf(f, "\t%s", d)
+		if algo == acr.ALGO_BM {
+			fmt.Fprintf(f, "\t%s_lower\t%s_upper", d, d)
+		}
+	}
+	fmt.Fprintln(f)
+}
+
+// Writes the reconstructed values (and confidence intervals) of internal nodes
+func writeAcrValues(f goio.Writer, id int, t *tree.Tree, res *acr.ContinuousAcrResult) {
+	t.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		if cur.Tip() {
+			return true
+		}
+		fmt.Fprintf(f, "%d\t%s", id, asrNodeName(cur))
+		for d := range res.Traits {
+			fmt.Fprintf(f, "\t%g", res.Values[cur][d])
+			if res.Lower != nil {
+				fmt.Fprintf(f, "\t%g\t%g", res.Lower[cur][d], res.Upper[cur][d])
+			}
+		}
+		fmt.Fprintln(f)
+		return true
+	})
+}
+
+// Writes the state(s) of each node (rows) for each character (columns)
+func writeAcrTable(f goio.Writer, t *tree.Tree, batch []*acr.CharacterAcr) {
+	fmt.Fprint(f, "node")
+	for _, c := range batch {
+		fmt.Fprintf(f, "\t%s", c.Name)
+	}
+	fmt.Fprintln(f)
+	t.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		fmt.Fprint(f, asrNodeName(cur))
+		for _, c := range batch {
+			fmt.Fprintf(f, "\t%s", strings.Join(c.Nodes[cur], "|"))
+		}
+		fmt.Fprintln(f)
+		return true
+	})
+}
+
+// Writes the number of transitions between each pair of states of each character
+func writeAcrTransitions(f goio.Writer, id int, batch []*acr.CharacterAcr) {
+	for _, c := range batch {
+		for _, from := range c.States {
+			for _, to := range c.States {
+				if from != to {
+					fmt.Fprintf(f, "%d\t%s\t%s\t%s\t%g\n", id, c.Name, from, to, c.Counts[from][to])
+				}
+			}
+		}
+	}
+}
+
+// Writes the branches along which each character changes
+func writeAcrBranchChanges(f goio.Writer, id int, batch []*acr.CharacterAcr) {
+	for _, c := range batch {
+		for _, ch := range c.Changes {
+			fmt.Fprintf(f, "%d\t%s\t%s\t%s\t%s\t%s\n", id, c.Name, asrNodeName(ch.Parent), asrNodeName(ch.Child), strings.Join(ch.From, "|"), strings.Join(ch.To, "|"))
+		}
+	}
+}
+
+// Parses a tip trait file with several characters: tab separated, first line
+// gives the character names (after the tip name column), and each following line
+// gives a tip name followed by its states
+func parseTraits(file string) (characters []string, traits map[string][]string, err error) {
+	var f goio.Closer
+	var r *bufio.Reader
+
+	if f, r, err = utils.GetReader(file); err != nil {
+		return
+	}
+	defer f.Close()
+	l, e := Readln(r)
+	if e != nil {
+		err = errors.New("Bad format for tip traits: empty file")
+		return
+	}
+	header := strings.Split(strings.TrimRight(l, "\r"), "\t")
+	if len(header) < 2 {
+		err = errors.New("Bad format for tip traits: No character in the header")
+		return
+	}
+	characters = header[1:]
+	traits = make(map[string][]string)
+	for l, e = Readln(r); e == nil; l, e = Readln(r) {
+		l = strings.TrimRight(l, "\r")
+		if l == "" {
+			continue
+		}
+		cols := strings.Split(l, "\t")
+		if len(cols) != len(header) {
+			err = fmt.Errorf("Bad format for tip traits: Wrong number of columns for tip %s", cols[0])
+			return
+		}
+		if _, ok := traits[cols[0]]; ok {
+			err = fmt.Errorf("Bad format for tip traits: Tip %s is given several times", cols[0])
+			return
+		}
+		traits[cols[0]] = cols[1:]
+	}
+	return
+}
+
+// Parses a tip value file of a continuous trait: tab separated, one line per tip
+// with its name followed by its values (one column per dimension). The first line
+// is a header if its values are not numbers (dimension names)
+func parseTipValues(file string) (dimensions []string, values map[string][]float64, err error) {
+	var f goio.Closer
+	var r *bufio.Reader
+	var v float64
+
+	if f, r, err = utils.GetReader(file); err != nil {
+		return
+	}
+	defer f.Close()
+	values = make(map[string][]float64)
+	first := true
+	for l, e := Readln(r); e == nil; l, e = Readln(r) {
+		l = strings.TrimRight(l, "\r")
+		if l == "" {
+			continue
+		}
+		cols := strings.Split(l, "\t")
+		if len(cols) < 2 {
+			err = errors.New("Bad format for tip values: Wrong number of columns")
+			return
+		}
+		if first {
+			first = false
+			dimensions = make([]string, len(cols)-1)
+			if _, e := strconv.ParseFloat(cols[1], 64); e != nil {
+				copy(dimensions, cols[1:])
+				continue
+			}
+			for i := range dimensions {
+				dimensions[i] = fmt.Sprintf("value%d", i+1)
+			}
+		}
+		if len(cols) != len(dimensions)+1 {
+			err = fmt.Errorf("Bad format for tip values: Wrong number of columns for tip %s", cols[0])
+			return
+		}
+		if _, ok := values[cols[0]]; ok {
+			err = fmt.Errorf("Bad format for tip values: Tip %s is given several times", cols[0])
+			return
+		}
+		values[cols[0]] = make([]float64, len(dimensions))
+		for i, c := range cols[1:] {
+			if v, err = strconv.ParseFloat(c, 64); err != nil {
+				err = fmt.Errorf("Bad format for tip values: Value %s of tip %s is not a number", c, cols[0])
+				return
+			}
+			values[cols[0]][i] = v
+		}
+	}
+	return
 }
 
 func parseTipStates(file string) (states map[string]string, err error) {
@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"bufio"
 	"fmt"
 	goio "io"
 	"os"
@@ -12,7 +11,7 @@ import (
 	"github.com/evolbioinfo/goalign/io/phylip"
 	"github.com/evolbioinfo/gotree/asr"
 	"github.com/evolbioinfo/gotree/io"
-	"github.com/evolbioinfo/gotree/io/utils"
+	"github.com/evolbioinfo/gotree/models"
 	"github.com/evolbioinfo/gotree/tree"
 	"github.com/spf13/cobra"
 )
@@ -21,14 +20,29 @@ var asralign string
 var asrphylip bool
 var asrinputstrict bool
 var asrrandomresolve bool // Resolve ambiguities randomly in the downpass/deltran/acctran algo
+var asrmodel string
+var asrkappa float64
+var asrgtrrates string
+var asrfreqs string
+var asralpha float64
+var asrnbcat int
+var asrpinv float64
+var asroptbrlen bool
+var asroptmodel bool
+var asroutprobas string
+var asrfullprobas bool
+var asroutalign string
+var asroutphylip bool
+var asroutsubs string
+var asrmutations bool
 
 // asrCmd represents the asr command
 var asrCmd = &cobra.Command{
 	Use:   "asr",
-	Short: "Reconstructs most parsimonious ancestral sequences",
-	Long: `Reconstructs most parsimonious ancestral sequences.
+	Short: "Reconstructs ancestral sequences (parsimony or maximum likelihood)",
+	Long: `Reconstructs ancestral sequences (parsimony or maximum likelihood).
 
-Depending on the chosen algorithm, it will run:
+For parsimony, depending on the chosen algorithm, it will run:
 1) UP-PASS and
 2) Either
    a) DOWN-PASS or
@@ -41,15 +55,62 @@ Should work on multifurcated trees
 If --random-resolve is given then, during the last pass, each time 
 a node with several possible states still exists, one state is chosen 
 randomly before going deeper in the tree.
+
+If --algo ml is given, ancestral sequences are reconstructed by maximum
+likelihood (marginal reconstruction), given the branch lengths of the tree and
+the substitution model (--model):
+- Nucleotides: jc69, k80 (--kappa), hky (--kappa, --freqs), gtr (--rates, --freqs);
+- Amino acids: lg, wag, jtt.
+with optional gamma distributed rates (--alpha > 0, --ncat) and invariant sites
+(--pinv). --freqs may be "empirical". Branch lengths (--opt-brlen) and model
+parameters (--opt-model) may first be optimized by maximum likelihood (see gotree
+compute likelihood). Each internal node is annotated with the most probable state
+of each site.
+
+With --algo ml, --out-probas gives, for each internal node and each site
+(tab separated):
+1) Node name (or id if the node has no name)
+2) Site (starting at 1)
+3) Most probable state
+4) Its marginal posterior probability
+And, if --full-probas is given, one column per state of the alphabet, with the
+marginal posterior probabilities of all the states.
+
+--out-align writes the sequences of all the nodes (tips and internal nodes) as an
+alignment (Fasta, or Phylip with --out-phylip), one alignment per input tree. Tips
+keep their input sequences (gaps included), and sites of internal nodes having several
+equally parsimonious (or probable) states are coded with IUPAC ambiguity codes (B, Z,
+J or X for amino acids). Internal nodes without name are named by their id.
+
+--out-subs writes the substitutions inferred on each branch (tab separated):
+1) Tree id
+2) Parent node
+3) Child node
+4) Position (starting at 1)
+5) Ancestral state
+6) Derived state
+A substitution is inferred when the sets of possible states of both extremities of the
+branch do not intersect (missing data is never considered as a substitution).
+
+If --annotate-mutations is given, each branch of the output tree is annotated with its
+number of substitutions and their list (mutation-annotated tree), in the form:
+[&nmut=2,mutations={A12T,C30G}].
+
+Example:
+
+gotree asr -i tree.nw -a align.phy -p --algo ml --model gtr --freqs empirical --alpha 1 --opt-model --out-probas probas.txt -o annotated.nw
+gotree asr -i tree.nw -a align.fa --algo acctran --out-align ancestral.fa --out-subs substitutions.txt --annotate-mutations -o mutations.nw
 `,
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var ancestral align.Alignment
 		var align align.Alignment
-		var fi goio.Closer
-		var r *bufio.Reader
 		var algo int
 		var treefile goio.Closer
 		var treechan <-chan tree.Trees
-		var f *os.File
+		var f, probasfile, alignfile, subsfile *os.File
+		var subs []*asr.Substitution
+		var m, opt *models.Model
+		var probas map[*tree.Node][][]float64
 
 		switch strings.ToLower(parsimonyAlgo) {
 		case "acctran":
@@ -60,6 +121,8 @@ randomly before going deeper in the tree.
 			algo = asr.ALGO_DOWNPASS
 		case "none":
 			algo = asr.ALGO_NONE
+		case "ml":
+			algo = asr.ALGO_ML
 		default:
 			err = fmt.Errorf("Unkown parsimony algorithm: %s", parsimonyAlgo)
 			io.LogError(err)
@@ -67,25 +130,31 @@ randomly before going deeper in the tree.
 		}
 
 		// Reading the alignment
-		fi, r, err = utils.GetReader(asralign)
-		if err != nil {
+		if align, err = readAlignment(asralign, asrphylip, asrinputstrict); err != nil {
 			io.LogError(err)
 			return
 		}
-		if asrphylip {
-			align, err = phylip.NewParser(r, asrinputstrict).Parse()
-			if err != nil {
+
+		if algo == asr.ALGO_ML {
+			if m, err = substitutionModel(asrmodel, asrkappa, asrgtrrates, asrfreqs, align, asralpha, asrnbcat, asrpinv); err != nil {
 				io.LogError(err)
 				return
 			}
-		} else {
-			align, err = fasta.NewParser(r).Parse()
-			if err != nil {
-				io.LogError(err)
-				return
+			if asroutprobas != "none" {
+				if probasfile, err = openWriteFile(asroutprobas); err != nil {
+					io.LogError(err)
+					return
+				}
+				defer closeWriteFile(probasfile, asroutprobas)
+				probasfile.WriteString("node\tsite\tstate\tproba")
+				if asrfullprobas {
+					for _, c := range m.Characters() {
+						probasfile.WriteString("\t" + string(c))
+					}
+				}
+				probasfile.WriteString("\n")
 			}
 		}
-		fi.Close()
 
 		// Reading the trees
 		if treefile, treechan, err = readTrees(intreefile); err != nil {
@@ -94,19 +163,82 @@ randomly before going deeper in the tree.
 		}
 		defer treefile.Close()
 
-		// Computing parsimony ASR and writing each trees
+		// Computing ASR and writing each trees
 		if f, err = openWriteFile(outtreefile); err != nil {
 			io.LogError(err)
 			return
 		}
 		defer closeWriteFile(f, outtreefile)
 
-		for t := range treechan {
-			err = asr.ParsimonyAsr(t.Tree, align, algo, asrrandomresolve)
-			if err != nil {
+		if asroutalign != "none" {
+			if alignfile, err = openWriteFile(asroutalign); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(alignfile, asroutalign)
+		}
+		if asroutsubs != "none" {
+			if subsfile, err = openWriteFile(asroutsubs); err != nil {
 				io.LogError(err)
 				return
 			}
+			defer closeWriteFile(subsfile, asroutsubs)
+			subsfile.WriteString("tree\tparent\tchild\tposition\tancestral\tderived\n")
+		}
+
+		for t := range treechan {
+			if t.Err != nil {
+				io.LogError(t.Err)
+				return t.Err
+			}
+			if algo == asr.ALGO_ML {
+				opt = m
+				if asroptbrlen || asroptmodel {
+					if opt, _, err = models.OptimizeLikelihood(t.Tree, align, m, asroptbrlen, asroptmodel); err != nil {
+						io.LogError(err)
+						return
+					}
+				}
+				if probas, err = asr.MLAsr(t.Tree, align, opt); err != nil {
+					io.LogError(err)
+					return
+				}
+				if probasfile != nil {
+					writeAsrProbas(probasfile, t.Tree, opt.Characters(), probas, asrfullprobas)
+				}
+			} else {
+				err = asr.ParsimonyAsr(t.Tree, align, algo, asrrandomresolve)
+				if err != nil {
+					io.LogError(err)
+					return
+				}
+			}
+			if alignfile != nil {
+				if ancestral, err = asr.AncestralAlignment(t.Tree, align); err != nil {
+					io.LogError(err)
+					return
+				}
+				if asroutphylip {
+					alignfile.WriteString(phylip.WriteAlignment(ancestral, false, false, false))
+				} else {
+					alignfile.WriteString(fasta.WriteAlignment(ancestral))
+				}
+			}
+			if subsfile != nil || asrmutations {
+				if subs, err = asr.Substitutions(t.Tree, align.Alphabet()); err != nil {
+					io.LogError(err)
+					return
+				}
+				if subsfile != nil {
+					for _, sub := range subs {
+						fmt.Fprintf(subsfile, "%d\t%s\t%s\t%d\t%c\t%c\n", t.Id, asrNodeName(sub.Parent), asrNodeName(sub.Child),
+							sub.Position+1, sub.Ancestral, sub.Derived)
+					}
+				}
+				if asrmutations {
+					asr.AnnotateMutations(t.Tree, subs)
+				}
+			}
 			f.WriteString(t.Tree.Newick() + "\n")
 		}
 		return
@@ -120,6 +252,52 @@ func init() {
 	asrCmd.PersistentFlags().BoolVar(&asrinputstrict, "input-strict", false, "Strict phylip input format (only used with -p)")
 	asrCmd.PersistentFlags().StringVarP(&intreefile, "input", "i", "stdin", "Input tree")
 	asrCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Output file")
-	asrCmd.PersistentFlags().StringVar(&parsimonyAlgo, "algo", "acctran", "Parsimony algorithm for resolving ambiguities: acctran, deltran, or downpass")
+	asrCmd.PersistentFlags().StringVar(&parsimonyAlgo, "algo", "acctran", "Algorithm: acctran, deltran, or downpass (parsimony), or ml (maximum likelihood)")
 	asrCmd.PersistentFlags().BoolVar(&asrrandomresolve, "random-resolve", false, "Random resolve states when several possibilities in: acctran, deltran, or downpass")
+	asrCmd.PersistentFlags().StringVar(&asrmodel, "model", "jc69", "Substitution model (ml): jc69, k80, hky, gtr, lg, wag, or jtt")
+	asrCmd.PersistentFlags().Float64Var(&asrkappa, "kappa", 2.0, "Transition/transversion rate ratio (ml: k80, hky)")
+	asrCmd.PersistentFlags().StringVar(&asrgtrrates, "rates", "none", "Relative rates AC,AG,AT,CG,CT,GT, comma separated (ml: gtr; none: all equal)")
+	asrCmd.PersistentFlags().StringVar(&asrfreqs, "freqs", "none", "Equilibrium frequencies of A,C,G,T, comma separated, or empirical (ml: hky, gtr; none: all equal)")
+	asrCmd.PersistentFlags().Float64Var(&asralpha, "alpha", 0.0, "Shape of the gamma distribution of site rates (ml; 0: no gamma)")
+	asrCmd.PersistentFlags().IntVar(&asrnbcat, "ncat", 4, "Number of discrete gamma categories (ml)")
+	asrCmd.PersistentFlags().Float64Var(&asrpinv, "pinv", 0.0, "Proportion of invariant sites (ml)")
+	asrCmd.PersistentFlags().BoolVar(&asroptbrlen, "opt-brlen", false, "Optimizes branch lengths before the reconstruction (ml)")
+	asrCmd.PersistentFlags().BoolVar(&asroptmodel, "opt-model", false, "Optimizes model parameters before the reconstruction (ml)")
+	asrCmd.PersistentFlags().StringVar(&asroutprobas, "out-probas", "none", "Output file of the most probable state of each site of each internal node (ml)")
+	asrCmd.PersistentFlags().BoolVar(&asrfullprobas, "full-probas", false, "Also writes the probabilities of all the states in --out-probas (ml)")
+	asrCmd.PersistentFlags().StringVar(&asroutalign, "out-align", "none", "Output alignment file of the sequences of all the nodes (tips and internal nodes)")
+	asrCmd.PersistentFlags().BoolVar(&asroutphylip, "out-phylip", false, "Writes --out-align in Phylip format (default: Fasta)")
+	asrCmd.PersistentFlags().StringVar(&asroutsubs, "out-subs", "none", "Output file of the substitutions inferred on each branch")
+	asrCmd.PersistentFlags().BoolVar(&asrmutations, "annotate-mutations", false, "Annotates each branch with its substitutions and their number")
+}
+
+// Writes the most probable state of each site of each internal node, and its
+// probability, nodes being identified by their name, or by their id if they have
+// no name. If full, writes the probabilities of all the states.
+func writeAsrProbas(f goio.Writer, t *tree.Tree, chars []rune, probas map[*tree.Node][][]float64, full bool) {
+	t.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		if cur.Tip() {
+			return true
+		}
+		id := asrNodeName(cur)
+		for site, p := range probas[cur] {
+			state, proba := asr.MostProbableState(p)
+			fmt.Fprintf(f, "%s\t%d\t%c\t%g", id, site+1, chars[state], proba)
+			if full {
+				for _, v := range p {
+					fmt.Fprintf(f, "\t%g", v)
+				}
+			}
+			fmt.Fprintln(f)
+		}
+		return true
+	})
+}
+
+// Returns the name of the node, or its id if it has no name
+func asrNodeName(n *tree.Node) string {
+	if n.Name() != "" {
+		return n.Name()
+	}
+	return fmt.Sprintf("%d", n.Id())
 }
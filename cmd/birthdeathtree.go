@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var generateBirth float64
+var generateDeath float64
+var generateTime float64
+var generateSampling float64
+var generateComplete bool
+
+func birthDeathTree(nbtrees int, nbtips int, output string, rooted bool) error {
+	var f *os.File
+	var err error
+	var t *tree.Tree
+
+	if output != "stdout" && output != "-" {
+		f, err = os.Create(output)
+		defer f.Close()
+	} else {
+		f = os.Stdout
+	}
+	if err != nil {
+		return err
+	}
+
+	if generateTime > 0 {
+		nbtips = 0
+	}
+	for i := 0; i < nbtrees; i++ {
+		t, err = tree.RandomBirthDeathTree(nbtips, generateTime, generateBirth, generateDeath, generateSampling, generateComplete, rooted)
+		if err != nil {
+			return err
+		}
+		f.WriteString(t.Newick() + "\n")
+	}
+
+	return nil
+}
+
+// birthdeathtreeCmd represents the birthdeathtree command
+var birthdeathtreeCmd = &cobra.Command{
+	Use:   "birthdeathtree",
+	Short: "Generates a random birth-death tree",
+	Long: `Generates a random birth-death tree.
+
+The tree is simulated forward in time under a constant rate birth-death process
+(--birth, --death), starting with two lineages (crown). The process stops:
+- When the number of extant lineages reaches l/sampling (just before the next event),
+  and l of them are sampled;
+- Or, if --time is given, at the given time (-l is then ignored), and each extant
+  lineage is sampled with probability --sampling.
+
+By default, the reconstructed tree is generated: only sampled lineages are kept, and
+branch lengths are durations. With --complete, the complete tree is generated, with
+extinct tips (ExtinctTip<i>) and unsampled extant tips (UnsampledTip<i>).
+
+Simulations with less than 2 sampled lineages are discarded.
+
+Example:
+
+gotree generate birthdeathtree -r -n 100 -l 50 --birth 1 --death 0.5 --sampling 0.5
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := birthDeathTree(generateNbTrees, generateNbTips, generateOutputfile, generateRooted); err != nil {
+			io.LogError(err)
+			return
+		}
+	},
+}
+
+func init() {
+	generateCmd.AddCommand(birthdeathtreeCmd)
+	birthdeathtreeCmd.PersistentFlags().IntVarP(&generateNbTips, "nbtips", "l", 10, "Number of sampled tips of the tree to generate")
+	birthdeathtreeCmd.PersistentFlags().Float64Var(&generateTime, "time", -1, "Duration of the process (if > 0, -l is ignored)")
+	birthdeathtreeCmd.PersistentFlags().Float64Var(&generateBirth, "birth", 1.0, "Birth (speciation) rate")
+	birthdeathtreeCmd.PersistentFlags().Float64Var(&generateDeath, "death", 0.0, "Death (extinction) rate")
+	birthdeathtreeCmd.PersistentFlags().Float64Var(&generateSampling, "sampling", 1.0, "Sampling fraction of extant lineages")
+	birthdeathtreeCmd.PersistentFlags().BoolVar(&generateComplete, "complete", false, "Generates the complete tree, with extinct and unsampled lineages")
+}
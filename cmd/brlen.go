@@ -9,7 +9,8 @@ var brlenCmd = &cobra.Command{
 	Use:   "brlen",
 	Short: "Modify branch lengths",
 	Long: `Commands to modify lengths of branches:
-Set a minimum branch length, or set random branch lengths, or multiply branch lengths by a factor.
+Set a minimum branch length, or set random branch lengths, or multiply branch lengths by a factor,
+apply a molecular clock model, or transform lengths with models of comparative methods.
 `,
 }
 
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	goio "io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var clockModel string
+var clockRate float64
+var clockSigma float64
+
+// clockCmd represents the clock command
+var clockCmd = &cobra.Command{
+	Use:   "clock",
+	Short: "Transforms time trees into substitution trees using a molecular clock model",
+	Long: `Transforms time trees into substitution trees using a molecular clock model.
+
+Each branch length (in time units) is multiplied by a substitution rate drawn
+according to the clock model (--model):
+- strict : All the branches have the same rate (--rate);
+- ucln   : Uncorrelated lognormal relaxed clock: rates are drawn independently from a
+           lognormal distribution of mean --rate and of standard deviation --sigma
+           on the log scale;
+- uced   : Uncorrelated exponential relaxed clock: rates are drawn independently
+           from an exponential distribution of mean --rate;
+- acln   : Autocorrelated lognormal relaxed clock: the root has rate --rate, and the
+           rate of each node is drawn from a lognormal distribution whose mean is the
+           rate of its parent, and whose log variance is sigma^2*t (t being the length
+           of the branch). The rate of a branch is the mean of the rates of its two
+           nodes. Input trees should be rooted.
+
+The rate of each branch is stored in the branch comment: [&rate=X].
+
+Example:
+
+gotree generate birthdeathtree -r -l 50 --seed 10 | gotree brlen clock --model ucln --rate 0.001 --sigma 0.5
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f *os.File
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var model int
+		var rates map[*tree.Edge]float64
+
+		switch strings.ToLower(clockModel) {
+		case "strict":
+			model = tree.CLOCK_STRICT
+		case "ucln":
+			model = tree.CLOCK_UCLN
+		case "uced":
+			model = tree.CLOCK_UCED
+		case "acln":
+			model = tree.CLOCK_ACLN
+		default:
+			err = fmt.Errorf("Unknown clock model: %s", clockModel)
+			io.LogError(err)
+			return
+		}
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if treefile, treechan, err = readTrees(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer treefile.Close()
+
+		for tr := range treechan {
+			if tr.Err != nil {
+				io.LogError(tr.Err)
+				return tr.Err
+			}
+			if rates, err = tr.Tree.SimulateClock(model, clockRate, clockSigma); err != nil {
+				io.LogError(err)
+				return
+			}
+			for e, r := range rates {
+				e.AddComment("&rate=" + strconv.FormatFloat(r, 'f', -1, 64))
+			}
+			f.WriteString(tr.Tree.Newick() + "\n")
+		}
+		return
+	},
+}
+
+func init() {
+	brlenCmd.AddCommand(clockCmd)
+	clockCmd.PersistentFlags().StringVar(&clockModel, "model", "strict", "Clock model: strict, ucln, uced, or acln")
+	clockCmd.PersistentFlags().Float64Var(&clockRate, "rate", 1.0, "Mean substitution rate")
+	clockCmd.PersistentFlags().Float64Var(&clockSigma, "sigma", 0.1, "Standard deviation of log rates (ucln), or autocorrelation parameter (acln)")
+	clockCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Substitution tree output file")
+}
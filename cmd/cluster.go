@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	goio "io"
+	"os"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var clusterMethod string
+var clusterThreshold float64
+var clusterSupport float64
+var clusterOutStats string
+
+// clusterCmd represents the cluster command
+var clusterCmd = &cobra.Command{
+	Use:   "cluster",
+	Short: "Clusters the tips of input trees given their patristic distances",
+	Long: `Clusters the tips of input trees given their patristic distances.
+
+As TreeCluster or Cluster Picker (e.g. for transmission cluster detection), tips
+are clustered given their pairwise patristic distances (sum of branch lengths), the
+tree being considered rooted at its root node (the pseudo root for unrooted trees).
+All branches must have a length. Clustering methods (--method) are:
+- max    : Clusters are the largest clades whose maximum pairwise distance between
+           tips is <= --threshold;
+- avg    : Clusters are the largest clades whose average pairwise distance between
+           tips is <= --threshold;
+- single : Single-linkage: two tips are in the same cluster if they are linked by a
+           chain of tips whose successive distances are <= --threshold (clusters are
+           not necessarily clades).
+
+With --min-support, a clade may be a cluster only if the support of its branch is
+>= the given support (max and avg), and tips are not linked through branches having
+a lower support (single). Branches without support are not considered as
+unsupported.
+
+Output (-o) is tab separated, with one line per tree and per tip:
+1) Tree id
+2) Tip name
+3) Cluster id (starting at 1, -1 for tips that are in no cluster of at least 2 tips)
+
+--out-stats gives, for each tree and each cluster (tab separated):
+1) Tree id
+2) Cluster id
+3) Number of tips
+4) Maximum pairwise distance between tips
+5) Average pairwise distance between tips
+6) Support of the branch of the clade (NA for single-linkage clusters, for the
+   whole tree, or for branches without support)
+7) Tips, comma separated
+
+Example:
+
+gotree cluster -i tree.nw --method max --threshold 0.045 --min-support 0.9 --out-stats stats.txt
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f, fstats *os.File
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var method int
+		var clusters []*tree.TipCluster
+
+		switch strings.ToLower(clusterMethod) {
+		case "max":
+			method = tree.CLUSTER_MAX_CLADE
+		case "avg":
+			method = tree.CLUSTER_AVG_CLADE
+		case "single":
+			method = tree.CLUSTER_SINGLE_LINKAGE
+		default:
+			err = fmt.Errorf("Unknown clustering method: %s", clusterMethod)
+			io.LogError(err)
+			return
+		}
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if clusterOutStats != "none" {
+			if fstats, err = openWriteFile(clusterOutStats); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(fstats, clusterOutStats)
+			fstats.WriteString("tree\tcluster\tntips\tmaxdist\tmeandist\tsupport\ttips\n")
+		}
+
+		if treefile, treechan, err = readTrees(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer treefile.Close()
+
+		f.WriteString("tree\ttip\tcluster\n")
+		for t := range treechan {
+			if t.Err != nil {
+				io.LogError(t.Err)
+				return t.Err
+			}
+			if clusters, err = t.Tree.ClusterTips(method, clusterThreshold, clusterSupport); err != nil {
+				io.LogError(err)
+				return
+			}
+			ids := make(map[*tree.Node]int)
+			for _, c := range clusters {
+				names := make([]string, len(c.Tips))
+				for i, tip := range c.Tips {
+					ids[tip] = c.Id
+					names[i] = tip.Name()
+				}
+				if fstats != nil {
+					support := "NA"
+					if c.Edge != nil && c.Edge.Support() != tree.NIL_SUPPORT {
+						support = c.Edge.SupportString()
+					}
+					fstats.WriteString(fmt.Sprintf("%d\t%d\t%d\t%g\t%g\t%s\t%s\n", t.Id, c.Id, len(c.Tips),
+						c.MaxDist, c.MeanDist, support, strings.Join(names, ",")))
+				}
+			}
+			for _, tip := range t.Tree.Tips() {
+				id, ok := ids[tip]
+				if !ok {
+					id = -1
+				}
+				f.WriteString(fmt.Sprintf("%d\t%s\t%d\n", t.Id, tip.Name(), id))
+			}
+		}
+		return
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(clusterCmd)
+	clusterCmd.PersistentFlags().StringVarP(&intreefile, "input", "i", "stdin", "Input tree(s)")
+	clusterCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Output tip/cluster file")
+	clusterCmd.PersistentFlags().StringVar(&clusterMethod, "method", "max", "Clustering method: max, avg, or single")
+	clusterCmd.PersistentFlags().Float64Var(&clusterThreshold, "threshold", 0.045, "Distance threshold")
+	clusterCmd.PersistentFlags().Float64Var(&clusterSupport, "min-support", 0, "Minimum support of the branches of clusters")
+	clusterCmd.PersistentFlags().StringVar(&clusterOutStats, "out-stats", "none", "Output cluster statistics file")
+}
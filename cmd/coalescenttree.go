@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/io/dates"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var generatePopSize float64
+var generateGrowth float64
+var generatePopSizeChanges string
+var generateSamplingFile string
+var generateDateFormats string
+
+// Parses the population size options
+func coalescentPopSize() (tree.PopulationSize, error) {
+	if generatePopSize <= 0 {
+		return nil, errors.New("Population size must be > 0")
+	}
+	if generatePopSizeChanges != "none" {
+		if generateGrowth != 0 {
+			return nil, errors.New("Population size changes and growth rate can not be given together")
+		}
+		p := &tree.PiecewisePopSize{Sizes: []float64{generatePopSize}}
+		for _, change := range strings.Split(generatePopSizeChanges, ",") {
+			cols := strings.Split(change, ":")
+			if len(cols) != 2 {
+				return nil, fmt.Errorf("Population size change %s is not of the form time:size", change)
+			}
+			t, err := strconv.ParseFloat(cols[0], 64)
+			if err != nil {
+				return nil, err
+			}
+			n, err := strconv.ParseFloat(cols[1], 64)
+			if err != nil {
+				return nil, err
+			}
+			if n <= 0 || (len(p.Times) > 0 && t <= p.Times[len(p.Times)-1]) || t <= 0 {
+				return nil, fmt.Errorf("Population size change %s is not valid (sizes must be > 0 and times must be increasing)", change)
+			}
+			p.Times = append(p.Times, t)
+			p.Sizes = append(p.Sizes, n)
+		}
+		return p, nil
+	}
+	if generateGrowth != 0 {
+		return &tree.ExponentialPopSize{N0: generatePopSize, Growth: generateGrowth}, nil
+	}
+	return &tree.ConstantPopSize{N: generatePopSize}, nil
+}
+
+// Returns tip names and sampling times (backward) from the sampling file,
+// or nbtips tip names sampled at time 0 if no file is given
+func coalescentSamples(nbtips int) (names []string, heights []float64, err error) {
+	var sampling map[string]dates.Date
+
+	if generateSamplingFile == "none" {
+		names = make([]string, nbtips)
+		for i := range names {
+			names[i] = "Tip" + strconv.Itoa(i)
+		}
+		return
+	}
+	if sampling, err = dates.ReadDateFile(generateSamplingFile, strings.Split(generateDateFormats, ",")); err != nil {
+		return
+	}
+	max := 0.0
+	for name, d := range sampling {
+		names = append(names, name)
+		if len(names) == 1 || d.Value > max {
+			max = d.Value
+		}
+	}
+	sort.Strings(names)
+	heights = make([]float64, len(names))
+	for i, name := range names {
+		heights[i] = max - sampling[name].Value
+	}
+	return
+}
+
+func coalescentTree(nbtrees int, nbtips int, output string, rooted bool) error {
+	var f *os.File
+	var err error
+	var t *tree.Tree
+	var popsize tree.PopulationSize
+	var names []string
+	var heights []float64
+
+	if popsize, err = coalescentPopSize(); err != nil {
+		return err
+	}
+	if names, heights, err = coalescentSamples(nbtips); err != nil {
+		return err
+	}
+
+	if output != "stdout" && output != "-" {
+		f, err = os.Create(output)
+		defer f.Close()
+	} else {
+		f = os.Stdout
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < nbtrees; i++ {
+		t, err = tree.RandomCoalescentTree(names, heights, popsize, rooted)
+		if err != nil {
+			return err
+		}
+		f.WriteString(t.Newick() + "\n")
+	}
+
+	return nil
+}
+
+// coalescenttreeCmd represents the coalescenttree command
+var coalescenttreeCmd = &cobra.Command{
+	Use:   "coalescenttree",
+	Short: "Generates a random coalescent tree",
+	Long: `Generates a random coalescent tree (Kingman coalescent).
+
+Backward in time, with k lineages at time t, two random lineages coalesce at rate
+k(k-1)/2/N(t), N(t) being the population size at time t (0 being the present).
+Branch lengths are in time units (generations if N is the effective population size).
+
+The population size may be:
+- Constant: --popsize N;
+- Exponentially growing: --popsize N0 --growth g, with N(t) = N0*exp(-g*t);
+- Piecewise constant: --popsize N0 --popsize-changes "t1:N1,t2:N2,...", the population
+  size being N0 between 0 and t1, N1 between t1 and t2, etc.
+
+By default, -l tips are sampled at time 0 (ultrametric tree). With --sampling-file, tips
+and their sampling dates are given in a tab separated file (tipname<tab>date, dates being
+parsed with --date-format, as gotree rtt), and the tree is serially sampled (the most
+recent tip being sampled at time 0, and -l is ignored).
+
+Example:
+
+gotree generate coalescenttree -r -n 10 -l 50 --popsize 100 --growth 0.1
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := coalescentTree(generateNbTrees, generateNbTips, generateOutputfile, generateRooted); err != nil {
+			io.LogError(err)
+			return
+		}
+	},
+}
+
+func init() {
+	generateCmd.AddCommand(coalescenttreeCmd)
+	coalescenttreeCmd.PersistentFlags().IntVarP(&generateNbTips, "nbtips", "l", 10, "Number of tips of the tree to generate")
+	coalescenttreeCmd.PersistentFlags().Float64Var(&generatePopSize, "popsize", 1.0, "Present population size")
+	coalescenttreeCmd.PersistentFlags().Float64Var(&generateGrowth, "growth", 0.0, "Exponential growth rate of the population (forward in time)")
+	coalescenttreeCmd.PersistentFlags().StringVar(&generatePopSizeChanges, "popsize-changes", "none", "Piecewise constant population size: comma separated time:size changes (backward in time)")
+	coalescenttreeCmd.PersistentFlags().StringVar(&generateSamplingFile, "sampling-file", "none", "Tab separated file with tip names and sampling dates (heterochronous sampling)")
+	coalescenttreeCmd.PersistentFlags().StringVar(&generateDateFormats, "date-format", strings.Join(dates.DefaultFormats, ","), "Date formats of the sampling file, comma separated, tried in this order (yyyy, mm, dd, or decimal)")
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	goio "io"
+	"os"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var compareRunsBurnin float64
+var compareRunsMinFreq float64
+var compareRunsSplitsOut string
+var compareRunsWindow int
+var compareRunsWindowStep int
+var compareRunsWindowOut string
+
+// compareRunsCmd represents the compare runs command
+var compareRunsCmd = &cobra.Command{
+	Use:   "runs [flags] run1.trees run2.trees [run3.trees...]",
+	Short: "Compares split frequencies of several MCMC runs",
+	Long: `Compares split frequencies of several MCMC runs (convergence diagnostic).
+
+Each tree file given in argument is considered as a run (MrBayes, BEAST, etc.).
+For each run, the first trees are discarded (--burnin):
+  - If burnin < 1 : it is the fraction of trees to discard
+  - Otherwise     : it is the number of trees to discard
+
+Then, the frequency of each split (internal branch) is computed in each run, as well
+as the standard deviation of split frequencies between runs. Only splits having a
+frequency >= --min-freq in at least one run are considered to compute the average
+(ASDSF) and maximum (MSDSF) standard deviations of split frequencies.
+
+The output is tab separated with:
+1) Number of runs
+2) Number of trees kept per run (comma separated)
+3) Number of considered splits
+4) ASDSF
+5) MSDSF
+
+If --out-splits is given, a per-split table is written, tab separated, with:
+1) Split id
+2) Number of tips in the light side of the split
+3) Tips in the light side of the split (comma separated)
+4) Frequency of the split in each run (one column per run)
+5) Mean frequency
+6) Standard deviation of the frequencies
+
+If --window is given (>0), the ASDSF is also computed on a window of --window trees
+(after burnin) sliding by --window-step trees, and written into --out-window file.
+Windows are given in numbers of trees: with regularly sampled trees, they correspond
+to windows of generations. Columns are:
+1) Window id
+2) Index of the first tree of the window (after burnin)
+3) Index of the last tree of the window (after burnin)
+4) ASDSF
+5) MSDSF
+
+Trees of all runs must have the same tip names.
+
+Example:
+
+gotree compare runs --burnin 0.25 run1.t run2.t --out-splits splits.txt
+
+`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f, splitsf, windowf *os.File
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var freqs []*tree.SplitFrequency
+
+		splitruns := tree.NewSplitRuns(len(args))
+		for r, runfile := range args {
+			if treefile, treechan, err = readTrees(runfile); err != nil {
+				io.LogError(err)
+				return
+			}
+			for t := range treechan {
+				if t.Err != nil {
+					io.LogError(t.Err)
+					treefile.Close()
+					return t.Err
+				}
+				if err = splitruns.AddTree(r, t.Tree); err != nil {
+					io.LogError(err)
+					treefile.Close()
+					return
+				}
+			}
+			treefile.Close()
+		}
+
+		start := make([]int, len(args))
+		end := make([]int, len(args))
+		kept := make([]string, len(args))
+		minkept := -1
+		for r := range args {
+			ntrees := splitruns.NbTrees(r)
+			if compareRunsBurnin < 1 {
+				start[r] = int(compareRunsBurnin * float64(ntrees))
+			} else {
+				start[r] = int(compareRunsBurnin)
+			}
+			end[r] = ntrees
+			if start[r] >= end[r] {
+				err = fmt.Errorf("No tree remaining in run %d after burnin", r)
+				io.LogError(err)
+				return
+			}
+			kept[r] = fmt.Sprintf("%d", end[r]-start[r])
+			if minkept == -1 || end[r]-start[r] < minkept {
+				minkept = end[r] - start[r]
+			}
+		}
+
+		if freqs, err = splitruns.Frequencies(start, end); err != nil {
+			io.LogError(err)
+			return
+		}
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		nsplits := 0
+		for _, sf := range freqs {
+			for _, fr := range sf.Freqs {
+				if fr >= compareRunsMinFreq {
+					nsplits++
+					break
+				}
+			}
+		}
+		asdsf, msdsf := tree.ASDSF(freqs, compareRunsMinFreq)
+		f.WriteString("runs\ttrees\tsplits\tasdsf\tmsdsf\n")
+		f.WriteString(fmt.Sprintf("%d\t%s\t%d\t%f\t%f\n", len(args), strings.Join(kept, ","), nsplits, asdsf, msdsf))
+
+		if compareRunsSplitsOut != "none" {
+			if splitsf, err = openWriteFile(compareRunsSplitsOut); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(splitsf, compareRunsSplitsOut)
+			splitsf.WriteString("id\tsize\ttips")
+			for r := range args {
+				splitsf.WriteString(fmt.Sprintf("\trun%d", r))
+			}
+			splitsf.WriteString("\tmean\tsd\n")
+			for i, sf := range freqs {
+				tips := splitruns.SplitTips(sf)
+				splitsf.WriteString(fmt.Sprintf("%d\t%d\t%s", i, len(tips), strings.Join(tips, ",")))
+				for _, fr := range sf.Freqs {
+					splitsf.WriteString(fmt.Sprintf("\t%f", fr))
+				}
+				splitsf.WriteString(fmt.Sprintf("\t%f\t%f\n", sf.Mean, sf.Sd))
+			}
+		}
+
+		if compareRunsWindow > 0 {
+			if compareRunsWindowOut == "none" {
+				err = errors.New("An output file must be given with --out-window")
+				io.LogError(err)
+				return
+			}
+			if compareRunsWindowStep <= 0 {
+				err = errors.New("Window step must be > 0")
+				io.LogError(err)
+				return
+			}
+			if windowf, err = openWriteFile(compareRunsWindowOut); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(windowf, compareRunsWindowOut)
+			windowf.WriteString("window\tstart\tend\tasdsf\tmsdsf\n")
+			wstart := make([]int, len(args))
+			wend := make([]int, len(args))
+			for w, ws := 0, 0; ws+compareRunsWindow <= minkept; w, ws = w+1, ws+compareRunsWindowStep {
+				for r := range args {
+					wstart[r] = start[r] + ws
+					wend[r] = wstart[r] + compareRunsWindow
+				}
+				if freqs, err = splitruns.Frequencies(wstart, wend); err != nil {
+					io.LogError(err)
+					return
+				}
+				asdsf, msdsf = tree.ASDSF(freqs, compareRunsMinFreq)
+				windowf.WriteString(fmt.Sprintf("%d\t%d\t%d\t%f\t%f\n", w, ws, ws+compareRunsWindow-1, asdsf, msdsf))
+			}
+		}
+		return
+	},
+}
+
+func init() {
+	compareCmd.AddCommand(compareRunsCmd)
+	compareRunsCmd.Flags().Float64Var(&compareRunsBurnin, "burnin", 0.25, "Burnin: fraction of trees (if <1) or number of trees (if >=1) to discard at the beginning of each run")
+	compareRunsCmd.Flags().Float64Var(&compareRunsMinFreq, "min-freq", 0.1, "Minimum frequency of a split in at least one run to be considered in the ASDSF")
+	compareRunsCmd.Flags().StringVar(&compareRunsSplitsOut, "out-splits", "none", "Output file with the per-split frequency table")
+	compareRunsCmd.Flags().IntVar(&compareRunsWindow, "window", 0, "Number of trees of the sliding window (0: no sliding window)")
+	compareRunsCmd.Flags().IntVar(&compareRunsWindowStep, "window-step", 1, "Number of trees by which the sliding window moves")
+	compareRunsCmd.Flags().StringVar(&compareRunsWindowOut, "out-window", "none", "Output file with the ASDSF computed on each window")
+	compareRunsCmd.Flags().StringVarP(&outtreefile, "output", "o", "stdout", "Output file")
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	goio "io"
+	"os"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var consensusNetworkGraphOut string
+
+// consensusNetworkCmd represents the consensusnetwork command
+var consensusNetworkCmd = &cobra.Command{
+	Use:   "consensusnetwork",
+	Short: "Computes the consensus network of a set of trees",
+	Long: `Computes the consensus network of a set of input trees
+Trees must have the same tip names.
+
+Contrary to the consensus command, all the splits (bipartitions) present
+in a proportion >= -f of the trees are kept, even if they are
+incompatible with each other. Conflicts between trees are then visible
+as boxes in the network.
+
+Two parameters:
+-i : Input file containing several trees
+-f : Frequency threshold to keep a split in the network
+     It must be >=0 && <=1
+
+The output (-o) is a Nexus file with a TAXA block and a SPLITS block, 
+readable by SplitsTree. In the SPLITS block:
+1) Split weights are computed as the average length of the same branch
+   over all the trees where it is present (or its frequency if trees have 
+   no branch length)
+2) Split confidences are computed as the proportion of trees in which
+   the split is present
+
+If --graph is given, the splits graph is also computed (convex hull
+algorithm), and written in Graphviz DOT format. Edges are labelled with 
+the id of their split in the Nexus SPLITS block.
+
+Example:
+
+gotree compute consensusnetwork -i trees.nw -f 0.2 -o network.nex --graph network.dot
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f, graphf *os.File
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var splits *tree.SplitSet
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if treefile, treechan, err = readTrees(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer treefile.Close()
+
+		if splits, err = tree.ConsensusSplits(treechan, cutoff); err != nil {
+			io.LogError(err)
+			return
+		}
+		f.WriteString(splits.Nexus())
+
+		if consensusNetworkGraphOut != "none" {
+			if graphf, err = openWriteFile(consensusNetworkGraphOut); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(graphf, consensusNetworkGraphOut)
+			graphf.WriteString(splits.Graph().Dot())
+		}
+		return
+	},
+}
+
+func init() {
+	computeCmd.AddCommand(consensusNetworkCmd)
+	consensusNetworkCmd.PersistentFlags().StringVarP(&intreefile, "input", "i", "stdin", "Input trees")
+	consensusNetworkCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Output Nexus splits file")
+	consensusNetworkCmd.PersistentFlags().Float64VarP(&cutoff, "freq-min", "f", 0.1, "Minimum frequency to keep the splits")
+	consensusNetworkCmd.PersistentFlags().StringVar(&consensusNetworkGraphOut, "graph", "none", "Output splits graph file (Graphviz DOT format)")
+}
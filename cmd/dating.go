@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	goio "io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/io/dates"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var datingDateFile string
+var datingDateRegexp string
+var datingDateFormats string
+var datingConstraints string
+var datingRoot string
+var datingSeqLen float64
+var datingNbSamples int
+var datingOutStats string
+var datingOutDates string
+
+// datingCmd represents the dating command
+var datingCmd = &cobra.Command{
+	Use:   "dating",
+	Short: "Least-squares dating of heterochronous trees",
+	Long: `Least-squares dating of heterochronous trees (as LSD), under a strict clock.
+
+The rate w and the dates t of all the nodes are estimated by minimizing:
+   sum over edges (p,c) of (b - w*(t_c - t_p))² / var(b)
+with var(b) = (b + 10/s)/s, s being the sequence length (--seq-len). If --seq-len is 0,
+all the variances are 1.
+
+Sampling dates of tips are given either in a tab separated file (--date-file), or in
+the tip names (--date-regexp), with the same formats as gotree rtt (--date-format).
+Tips that do not have a date in the date file have their date estimated. Partial dates
+(e.g. 2019-03) are considered as intervals in which the dates are estimated.
+
+Dates of internal nodes may be constrained with --constraints: tab separated file with
+node<tab>date or node<tab>lower<tab>upper, node being either the name of an internal
+node, or a comma separated list of tips (the constrained node being their MRCA).
+With --root ls, the MRCAs of the lists of tips are computed for each candidate root.
+
+The root of the tree is given by --root:
+- none : The input tree must be rooted;
+- rtt  : Root minimizing the residual mean square of the root-to-tip regression;
+- ls   : Root minimizing the least-squares dating criterion, searched on all edges.
+
+Temporal constraints (children after their parents) are not enforced, so some branches
+of the time tree may be negative.
+
+If --nb-samples is > 0, confidence intervals (95%) are computed by resampling branch
+lengths from a Poisson distribution of mean b*s (divided by s), and by dating each
+resampled tree (with the same root).
+
+Output (-o) is the time tree in Newick format: branch lengths are durations, and nodes
+have comments [&date=X] (or [&date=X,date_CI={lower,upper}] if computed).
+
+If --out-stats is given, a tab separated file is written with, for each tree:
+1) Tree id
+2) Rate
+3) tMRCA (date of the root)
+4) Value of the least-squares criterion
+5) Rate CI lower bound (NA if not computed)
+6) Rate CI upper bound
+7) tMRCA CI lower bound
+8) tMRCA CI upper bound
+
+If --out-dates is given, a tab separated file is written with, for each node:
+1) Tree id
+2) Node index (pre-order traversal)
+3) Node name
+4) Date
+5) Date CI lower bound (NA if not computed)
+6) Date CI upper bound
+
+Example:
+
+gotree compute dating -i tree.nw --date-file dates.txt --root ls --seq-len 1000 --nb-samples 100 --out-stats stats.txt -o timetree.nw
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f, statsf, datesf *os.File
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var filedates, internal map[string]dates.Date
+		var res *tree.LSDResult
+
+		formats := strings.Split(datingDateFormats, ",")
+		if datingRoot != "none" && datingRoot != "rtt" && datingRoot != "ls" {
+			err = fmt.Errorf("Unknown root estimation method: %s", datingRoot)
+			io.LogError(err)
+			return
+		}
+		if datingDateFile != "none" {
+			if filedates, err = dates.ReadDateFile(datingDateFile, formats); err != nil {
+				io.LogError(err)
+				return
+			}
+		}
+		if datingConstraints != "none" {
+			if internal, err = dates.ReadDateFile(datingConstraints, formats); err != nil {
+				io.LogError(err)
+				return
+			}
+		}
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if datingOutStats != "none" {
+			if statsf, err = openWriteFile(datingOutStats); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(statsf, datingOutStats)
+			statsf.WriteString("tree\trate\ttmrca\tobjective\trate_lower\trate_upper\ttmrca_lower\ttmrca_upper\n")
+		}
+
+		if datingOutDates != "none" {
+			if datesf, err = openWriteFile(datingOutDates); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(datesf, datingOutDates)
+			datesf.WriteString("tree\tnode\tname\tdate\tlower\tupper\n")
+		}
+
+		if treefile, treechan, err = readTrees(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer treefile.Close()
+
+		for t := range treechan {
+			if t.Err != nil {
+				io.LogError(t.Err)
+				return t.Err
+			}
+			tipdates := filedates
+			if tipdates == nil {
+				if tipdates, err = dates.TipDates(t.Tree.AllTipNames(), datingDateRegexp, formats); err != nil {
+					io.LogError(err)
+					return
+				}
+			}
+			constraints := make(map[*tree.Node]tree.DateConstraint)
+			for _, tip := range t.Tree.Tips() {
+				if d, ok := tipdates[tip.Name()]; ok {
+					constraints[tip] = tree.DateConstraint{Lower: d.Lower, Upper: d.Upper}
+				}
+			}
+
+			switch datingRoot {
+			case "none":
+				if !t.Tree.Rooted() {
+					err = errors.New("Tree is not rooted: give a root estimation method with --root")
+					io.LogError(err)
+					return
+				}
+			case "rtt":
+				err = t.Tree.RerootRTT(dates.Values(tipdates), tree.RTT_RMS)
+			case "ls":
+				var mrcas []tree.MRCADateConstraint
+				rerootconstraints := make(map[*tree.Node]tree.DateConstraint, len(constraints))
+				for n, c := range constraints {
+					rerootconstraints[n] = c
+				}
+				if mrcas, err = mrcaDatingConstraints(t.Tree, internal, rerootconstraints); err == nil {
+					err = t.Tree.RerootLSD(rerootconstraints, mrcas, datingSeqLen)
+				}
+			}
+			if err != nil {
+				io.LogError(err)
+				return
+			}
+
+			// Constraints on internal nodes, once the tree is rooted
+			if err = addDatingConstraints(t.Tree, internal, constraints); err != nil {
+				io.LogError(err)
+				return
+			}
+
+			if datingNbSamples > 0 {
+				res, err = t.Tree.LSDatingCI(constraints, datingSeqLen, datingNbSamples, 0.05)
+			} else {
+				res, err = t.Tree.LSDating(constraints, datingSeqLen)
+			}
+			if err != nil {
+				io.LogError(err)
+				return
+			}
+
+			nodes := t.Tree.Nodes()
+			for _, n := range nodes {
+				comment := "&date=" + strconv.FormatFloat(res.Dates[n], 'f', -1, 64)
+				if res.DatesCI != nil {
+					ci := res.DatesCI[n]
+					comment += fmt.Sprintf(",date_CI={%s,%s}", strconv.FormatFloat(ci[0], 'f', -1, 64), strconv.FormatFloat(ci[1], 'f', -1, 64))
+				}
+				n.AddComment(comment)
+			}
+			if datesf != nil {
+				for i, n := range nodes {
+					datesf.WriteString(fmt.Sprintf("%d\t%d\t%s\t%g\t%s\n", t.Id, i, n.Name(), res.Dates[n], datingCIString(res.DatesCI != nil, res.DatesCI[n])))
+				}
+			}
+			if statsf != nil {
+				statsf.WriteString(fmt.Sprintf("%d\t%g\t%g\t%g\t%s\t%s\n", t.Id, res.Rate, res.TMRCA, res.Objective,
+					datingCIString(res.DatesCI != nil, res.RateCI), datingCIString(res.DatesCI != nil, res.TMRCACI)))
+			}
+			if err = t.Tree.SetLengthsFromDates(res.Dates); err != nil {
+				io.LogError(err)
+				return
+			}
+			f.WriteString(t.Tree.Newick() + "\n")
+		}
+		return
+	},
+}
+
+// Adds the constraints on internal nodes: keys are either node names
+// or comma separated lists of tips (the constrained node is their MRCA)
+func addDatingConstraints(t *tree.Tree, internal map[string]dates.Date, constraints map[*tree.Node]tree.DateConstraint) (err error) {
+	var n *tree.Node
+	var ok bool
+
+	if len(internal) == 0 {
+		return
+	}
+	nodeindex := tree.NewAllNodeIndex(t)
+	tipindex, err := tree.NewNodeIndex(t)
+	if err != nil {
+		return
+	}
+	for key, d := range internal {
+		if n, ok = nodeindex.GetNode(key); !ok {
+			if n, _, _, err = t.LeastCommonAncestorRooted(tipindex, strings.Split(key, ",")...); err != nil {
+				return
+			}
+		}
+		constraints[n] = tree.DateConstraint{Lower: d.Lower, Upper: d.Upper}
+	}
+	return
+}
+
+// Adds the constraints on named nodes to constraints, and returns the constraints
+// on the MRCAs of comma separated lists of tips, whose node depends on the root
+func mrcaDatingConstraints(t *tree.Tree, internal map[string]dates.Date, constraints map[*tree.Node]tree.DateConstraint) (mrcas []tree.MRCADateConstraint, err error) {
+	if len(internal) == 0 {
+		return
+	}
+	nodeindex := tree.NewAllNodeIndex(t)
+	tipindex, err := tree.NewNodeIndex(t)
+	if err != nil {
+		return
+	}
+	for key, d := range internal {
+		c := tree.DateConstraint{Lower: d.Lower, Upper: d.Upper}
+		if n, ok := nodeindex.GetNode(key); ok {
+			constraints[n] = c
+			continue
+		}
+		m := tree.MRCADateConstraint{Constraint: c}
+		for _, name := range strings.Split(key, ",") {
+			n, ok := tipindex.GetNode(name)
+			if !ok {
+				return nil, fmt.Errorf("Tip %s does not exist in the tree", name)
+			}
+			m.Tips = append(m.Tips, n)
+		}
+		mrcas = append(mrcas, m)
+	}
+	return
+}
+
+func datingCIString(computed bool, ci [2]float64) string {
+	if !computed {
+		return "NA\tNA"
+	}
+	return fmt.Sprintf("%g\t%g", ci[0], ci[1])
+}
+
+func init() {
+	computeCmd.AddCommand(datingCmd)
+	datingCmd.PersistentFlags().StringVarP(&intreefile, "input", "i", "stdin", "Input tree(s)")
+	datingCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Output time tree file")
+	datingCmd.PersistentFlags().StringVar(&datingDateFile, "date-file", "none", "Tab separated file with tip dates (otherwise, dates are taken from tip names)")
+	datingCmd.PersistentFlags().StringVar(&datingDateRegexp, "date-regexp", dates.DefaultRegexp, "Regexp to extract dates from tip names (first capturing group)")
+	datingCmd.PersistentFlags().StringVar(&datingDateFormats, "date-format", strings.Join(dates.DefaultFormats, ","), "Date formats, comma separated, tried in this order (yyyy, mm, dd, or decimal)")
+	datingCmd.PersistentFlags().StringVar(&datingConstraints, "constraints", "none", "Tab separated file with date constraints on internal nodes")
+	datingCmd.PersistentFlags().StringVar(&datingRoot, "root", "none", "Root estimation: none (tree is rooted), rtt (root-to-tip regression), or ls (least-squares)")
+	datingCmd.PersistentFlags().Float64Var(&datingSeqLen, "seq-len", 1000, "Sequence length, used in the variance of branch lengths (0: all variances are 1)")
+	datingCmd.PersistentFlags().IntVar(&datingNbSamples, "nb-samples", 0, "Number of resampled trees to compute confidence intervals (0: no confidence interval)")
+	datingCmd.PersistentFlags().StringVar(&datingOutStats, "out-stats", "none", "Output file with rate and tMRCA")
+	datingCmd.PersistentFlags().StringVar(&datingOutDates, "out-dates", "none", "Output file with dates of all nodes")
+}
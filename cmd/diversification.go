@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	goio "io"
+	"os"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var diversificationSampling float64
+
+// diversificationCmd represents the diversification command
+var diversificationCmd = &cobra.Command{
+	Use:   "diversification",
+	Short: "Estimates speciation and extinction rates of ultrametric trees",
+	Long: `Estimates speciation and extinction rates of ultrametric trees.
+
+Input trees must be rooted, binary and ultrametric. Two models are fitted by
+maximum likelihood on the branching times (Stadler 2009), conditioned on the crown
+age and on the survival of the two crown lineages:
+- yule : Pure birth model, with speciation rate lambda;
+- bd   : Constant rate birth-death model, with speciation rate lambda and extinction
+         rate mu.
+
+The sampling fraction (--sampling) is the proportion of extant species present in
+the tree.
+
+Output (-o) is tab separated, with one line per tree and per model:
+1) Tree id
+2) Model (yule or bd)
+3) lambda
+4) mu
+5) Net diversification rate (lambda - mu)
+6) Turnover (mu / lambda)
+7) Log-likelihood (up to a constant that does not depend on the model)
+8) Number of parameters
+9) AIC
+
+Example:
+
+gotree compute diversification -i tree.nw --sampling 0.8
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f *os.File
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var times []float64
+		var fit *tree.DiversificationFit
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if treefile, treechan, err = readTrees(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer treefile.Close()
+
+		f.WriteString("tree\tmodel\tlambda\tmu\tnetdiv\tturnover\tloglik\tnparams\taic\n")
+		for t := range treechan {
+			if t.Err != nil {
+				io.LogError(t.Err)
+				return t.Err
+			}
+			if times, err = t.Tree.BranchingTimes(); err != nil {
+				io.LogError(err)
+				return
+			}
+			for _, model := range []int{tree.DIV_YULE, tree.DIV_BD} {
+				if fit, err = tree.FitDiversification(times, diversificationSampling, model); err != nil {
+					io.LogError(err)
+					return
+				}
+				f.WriteString(fmt.Sprintf("%d\t%s\t%g\t%g\t%g\t%g\t%g\t%d\t%g\n", t.Id, fit.ModelName(),
+					fit.Lambda, fit.Mu, fit.Lambda-fit.Mu, fit.Mu/fit.Lambda, fit.LogLikelihood, fit.NbParams, fit.AIC))
+			}
+		}
+		return
+	},
+}
+
+func init() {
+	computeCmd.AddCommand(diversificationCmd)
+	diversificationCmd.PersistentFlags().StringVarP(&intreefile, "input", "i", "stdin", "Input ultrametric tree(s)")
+	diversificationCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Output file")
+	diversificationCmd.PersistentFlags().Float64Var(&diversificationSampling, "sampling", 1.0, "Sampling fraction: proportion of extant species present in the tree")
+}
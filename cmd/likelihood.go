@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	goio "io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/goalign/io/fasta"
+	"github.com/evolbioinfo/goalign/io/phylip"
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/io/utils"
+	"github.com/evolbioinfo/gotree/models"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var likAlign string
+var likPhylip bool
+var likInputStrict bool
+var likModel string
+var likKappa float64
+var likGTRRates string
+var likFreqs string
+var likAlpha float64
+var likNbCat int
+var likPInv float64
+var likOptBrlen bool
+var likOptModel bool
+var likOutTree string
+
+// Reads an alignment in Fasta or Phylip format
+func readAlignment(file string, phy, strict bool) (al align.Alignment, err error) {
+	var fi goio.Closer
+	var r *bufio.Reader
+
+	if fi, r, err = utils.GetReader(file); err != nil {
+		return
+	}
+	defer fi.Close()
+	if phy {
+		al, err = phylip.NewParser(r, strict).Parse()
+	} else {
+		al, err = fasta.NewParser(r).Parse()
+	}
+	return
+}
+
+// Formats a float parameter of the model, NA if not applicable
+func likParamString(applicable bool, v float64) string {
+	if !applicable {
+		return "NA"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// likelihoodCmd represents the likelihood command
+var likelihoodCmd = &cobra.Command{
+	Use:   "likelihood",
+	Short: "Computes the log-likelihood of an alignment given input trees",
+	Long: `Computes the log-likelihood of an alignment given input trees.
+
+The log-likelihood of the alignment (-a, Fasta or Phylip with -p) is computed for each
+input tree (branch lengths in expected substitutions per site), using Felsenstein
+pruning algorithm, under the given substitution model (--model):
+- Nucleotides: jc69, k80 (--kappa), hky (--kappa, --freqs), gtr (--rates, --freqs);
+- Amino acids: lg, wag, jtt.
+
+--rates gives the 6 relative GTR rates (AC,AG,AT,CG,CT,GT), and --freqs the equilibrium
+frequencies of A,C,G,T (comma separated), or "empirical" to compute them from the
+alignment.
+
+Rate heterogeneity across sites may be added with a discrete gamma distribution
+(--alpha > 0, --ncat categories) and/or a proportion of invariant sites (--pinv).
+
+Ambiguous characters (IUPAC codes) and gaps are considered as missing data.
+
+If --opt-brlen is given, branch lengths are optimized by maximum likelihood (branches
+without length are initialized to 0.1). If --opt-model is given, the parameters of the
+model (kappa, GTR rates, gamma shape if --alpha > 0, proportion of invariant sites if
+--pinv > 0) are optimized as well, starting from the given values. Parameters are
+optimized independently for each tree.
+
+Output (-o) is tab separated, with one line per tree:
+1) Tree id
+2) Model
+3) Log-likelihood
+4) kappa (NA if not applicable)
+5) GTR rates, comma separated (NA if not applicable)
+6) Gamma shape parameter (NA if no gamma)
+7) Proportion of invariant sites
+
+Trees (with optimized branch lengths) may be written with --out-tree. The candidate
+topologies of a tree file may then be ranked by their log-likelihoods.
+
+Example:
+
+gotree compute likelihood -i trees.nw -a align.phy -p --model gtr --freqs empirical --alpha 1 --opt-brlen --opt-model --out-tree optimized.nw
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f, treef *os.File
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var al align.Alignment
+		var m, opt *models.Model
+		var lnl float64
+
+		if likAlign == "none" {
+			err = errors.New("Alignment file must be given with --align")
+			io.LogError(err)
+			return
+		}
+		if al, err = readAlignment(likAlign, likPhylip, likInputStrict); err != nil {
+			io.LogError(err)
+			return
+		}
+		if m, err = substitutionModel(likModel, likKappa, likGTRRates, likFreqs, al, likAlpha, likNbCat, likPInv); err != nil {
+			io.LogError(err)
+			return
+		}
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if likOutTree != "none" {
+			if treef, err = openWriteFile(likOutTree); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(treef, likOutTree)
+		}
+
+		if treefile, treechan, err = readTrees(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer treefile.Close()
+
+		f.WriteString("tree\tmodel\tloglik\tkappa\trates\talpha\tpinv\n")
+		for t := range treechan {
+			if t.Err != nil {
+				io.LogError(t.Err)
+				return t.Err
+			}
+			if likOptBrlen || likOptModel {
+				opt, lnl, err = models.OptimizeLikelihood(t.Tree, al, m, likOptBrlen, likOptModel)
+			} else {
+				opt = m
+				lnl, err = models.LogLikelihood(t.Tree, al, m)
+			}
+			if err != nil {
+				io.LogError(err)
+				return
+			}
+			rates := "NA"
+			if opt.Code() == models.MODEL_GTR {
+				r := make([]string, len(opt.GTRRates()))
+				for i, v := range opt.GTRRates() {
+					r[i] = strconv.FormatFloat(v, 'g', -1, 64)
+				}
+				rates = strings.Join(r, ",")
+			}
+			kappa := opt.Code() == models.MODEL_K80 || opt.Code() == models.MODEL_HKY
+			f.WriteString(fmt.Sprintf("%d\t%s\t%g\t%s\t%s\t%s\t%g\n", t.Id, opt.Name(), lnl,
+				likParamString(kappa, opt.Kappa()), rates,
+				likParamString(opt.NCategories() > 1, opt.Alpha()), opt.PInv()))
+			if treef != nil {
+				treef.WriteString(t.Tree.Newick() + "\n")
+			}
+		}
+		return
+	},
+}
+
+func init() {
+	computeCmd.AddCommand(likelihoodCmd)
+	likelihoodCmd.PersistentFlags().StringVarP(&intreefile, "input", "i", "stdin", "Input tree(s)")
+	likelihoodCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Output log-likelihood file")
+	likelihoodCmd.PersistentFlags().StringVarP(&likAlign, "align", "a", "none", "Alignment input file")
+	likelihoodCmd.PersistentFlags().BoolVarP(&likPhylip, "phylip", "p", false, "Alignment is in Phylip format (default: Fasta)")
+	likelihoodCmd.PersistentFlags().BoolVar(&likInputStrict, "input-strict", false, "Strict phylip input format (only used with -p)")
+	likelihoodCmd.PersistentFlags().StringVar(&likModel, "model", "jc69", "Substitution model: jc69, k80, hky, gtr, lg, wag, or jtt")
+	likelihoodCmd.PersistentFlags().Float64Var(&likKappa, "kappa", 2.0, "Transition/transversion rate ratio (k80, hky)")
+	likelihoodCmd.PersistentFlags().StringVar(&likGTRRates, "rates", "none", "Relative rates AC,AG,AT,CG,CT,GT, comma separated (gtr; none: all equal)")
+	likelihoodCmd.PersistentFlags().StringVar(&likFreqs, "freqs", "none", "Equilibrium frequencies of A,C,G,T, comma separated, or empirical (hky, gtr; none: all equal)")
+	likelihoodCmd.PersistentFlags().Float64Var(&likAlpha, "alpha", 0.0, "Shape of the gamma distribution of site rates (0: no gamma)")
+	likelihoodCmd.PersistentFlags().IntVar(&likNbCat, "ncat", 4, "Number of discrete gamma categories")
+	likelihoodCmd.PersistentFlags().Float64Var(&likPInv, "pinv", 0.0, "Proportion of invariant sites")
+	likelihoodCmd.PersistentFlags().BoolVar(&likOptBrlen, "opt-brlen", false, "Optimizes branch lengths")
+	likelihoodCmd.PersistentFlags().BoolVar(&likOptModel, "opt-model", false, "Optimizes model parameters")
+	likelihoodCmd.PersistentFlags().StringVar(&likOutTree, "out-tree", "none", "Output tree file (with optimized branch lengths)")
+}
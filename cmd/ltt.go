@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	goio "io"
+	"os"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var lttEnvelope bool
+var lttNbPoints int
+var lttGammaFile string
+
+// lttCmd represents the ltt command
+var lttCmd = &cobra.Command{
+	Use:   "ltt",
+	Short: "Computes lineage through time data of input trees",
+	Long: `Computes lineage through time data of input trees.
+
+Input trees must be rooted, with branch lengths. Times are given relative
+to the most recent tip: the most recent tip is at time 0, and the root is at
+time -(root age). At the time of an internal node, the number of lineages
+increases, and at the time of a tip sampled before the most recent tip, the
+number of lineages decreases.
+
+Output (-o) is tab separated, with one line per change in the number of lineages:
+1) Tree id
+2) Time
+3) Number of lineages (from this time to the next one)
+
+If --envelope is given, the number of lineages of all the input trees are summarized
+at --nb-points regularly spaced times, between the oldest root and 0, and the output
+is instead:
+1) Time
+2) Mean number of lineages
+3) Minimum number of lineages
+4) Maximum number of lineages
+5) 2.5% quantile of the number of lineages
+6) 97.5% quantile of the number of lineages
+
+If --gamma is given, the gamma statistic of Pybus & Harvey (2000) is computed for each
+tree (which must be binary and ultrametric), and written in a tab separated file with:
+1) Tree id
+2) Gamma
+3) Two-tailed p-value (standard normal distribution)
+
+Example of usage:
+
+gotree stats ltt -i trees.nw --gamma gamma.txt -o ltt.txt
+gotree stats ltt -i trees.nw --envelope --nb-points 200 -o envelope.txt
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f, gammaf *os.File
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var points []tree.LTTPoint
+		var envelope []tree.LTTEnvelopePoint
+		var gamma, pvalue float64
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if lttGammaFile != "none" {
+			if gammaf, err = openWriteFile(lttGammaFile); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(gammaf, lttGammaFile)
+			gammaf.WriteString("tree\tgamma\tpvalue\n")
+		}
+
+		if treefile, treechan, err = readTrees(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer treefile.Close()
+
+		if !lttEnvelope {
+			f.WriteString("tree\ttime\tlineages\n")
+		}
+		ltts := make([][]tree.LTTPoint, 0)
+		for t := range treechan {
+			if t.Err != nil {
+				io.LogError(t.Err)
+				return t.Err
+			}
+			if points, err = t.Tree.LTT(); err != nil {
+				io.LogError(err)
+				return
+			}
+			if lttEnvelope {
+				ltts = append(ltts, points)
+			} else {
+				for _, p := range points {
+					f.WriteString(fmt.Sprintf("%d\t%g\t%d\n", t.Id, p.Time, p.Lineages))
+				}
+			}
+			if gammaf != nil {
+				if gamma, pvalue, err = t.Tree.GammaStatistic(); err != nil {
+					io.LogError(err)
+					return
+				}
+				gammaf.WriteString(fmt.Sprintf("%d\t%g\t%g\n", t.Id, gamma, pvalue))
+			}
+		}
+
+		if lttEnvelope {
+			if envelope, err = tree.LTTEnvelope(ltts, lttNbPoints); err != nil {
+				io.LogError(err)
+				return
+			}
+			f.WriteString("time\tmean\tmin\tmax\tlower\tupper\n")
+			for _, p := range envelope {
+				f.WriteString(fmt.Sprintf("%g\t%g\t%d\t%d\t%g\t%g\n", p.Time, p.Mean, p.Min, p.Max, p.Lower, p.Upper))
+			}
+		}
+		return
+	},
+}
+
+func init() {
+	statsCmd.AddCommand(lttCmd)
+	lttCmd.Flags().BoolVar(&lttEnvelope, "envelope", false, "Outputs the lineage through time envelope of all input trees")
+	lttCmd.Flags().IntVar(&lttNbPoints, "nb-points", 100, "Number of time points of the envelope")
+	lttCmd.Flags().StringVar(&lttGammaFile, "gamma", "none", "Output file with the gamma statistic of each tree")
+}
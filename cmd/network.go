@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bufio"
+	goio "io"
+
+	"github.com/evolbioinfo/gotree/io/utils"
+	"github.com/evolbioinfo/gotree/network"
+	"github.com/spf13/cobra"
+)
+
+// networkCmd represents the network command
+var networkCmd = &cobra.Command{
+	Use:   "network",
+	Short: "Handles phylogenetic networks in extended Newick format",
+	Long: `Handles phylogenetic networks in extended Newick format.
+
+Networks are rooted, and hybrid (reticulation) nodes are labelled with #<type><id>
+(e.g. #H1, as in PhyloNet or SNaQ outputs). Each hybrid node appears once 
+per parent, and its children are given in only one of its occurrences.
+Branch fields are :length:support:gamma, gamma being the inheritance 
+probability of the hybrid edge.
+
+Example:
+((A:1,(B:1)#H1:1::0.3):1,(#H1:0.5::0.7,C:1):1);
+`,
+}
+
+func init() {
+	RootCmd.AddCommand(networkCmd)
+	networkCmd.PersistentFlags().StringVarP(&intreefile, "input", "i", "stdin", "Input network(s) file (extended Newick)")
+	networkCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Output file")
+}
+
+/*File in output must be closed by calling function */
+func readNetworks(infile string) (netfile goio.Closer, netChannel <-chan network.Networks, err error) {
+	var netreader *bufio.Reader
+
+	if netfile, netreader, err = utils.GetReader(infile); err == nil {
+		netChannel = network.ReadNetworks(netreader)
+	}
+	return
+}
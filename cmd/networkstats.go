@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	goio "io"
+	"os"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/network"
+	"github.com/spf13/cobra"
+)
+
+// networkStatsCmd represents the network stats command
+var networkStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Print statistics about the networks",
+	Long: `Print statistics about the networks
+
+Output is tab separated, with one line per input network:
+1) Network id
+2) Number of nodes
+3) Number of tips
+4) Number of edges
+5) Number of reticulation nodes (more than one parent)
+6) Reticulation number (sum of number of parents-1 over reticulation nodes)
+7) Number of displayed trees (not necessarily distinct)
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f *os.File
+		var netfile goio.Closer
+		var netchan <-chan network.Networks
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if netfile, netchan, err = readNetworks(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer netfile.Close()
+
+		f.WriteString("network\tnodes\ttips\tedges\treticulations\treticulationnumber\tdisplayedtrees\n")
+		for n := range netchan {
+			if n.Err != nil {
+				io.LogError(n.Err)
+				return n.Err
+			}
+			f.WriteString(fmt.Sprintf("%d\t%d\t%d\t%d\t%d\t%d\t%d\n", n.Id,
+				len(n.Network.Nodes()), len(n.Network.Tips()), len(n.Network.Edges()),
+				len(n.Network.Reticulations()), n.Network.ReticulationNumber(),
+				n.Network.NbDisplayedTrees()))
+		}
+		return
+	},
+}
+
+func init() {
+	networkCmd.AddCommand(networkStatsCmd)
+}
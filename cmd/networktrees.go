@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	goio "io"
+	"os"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/network"
+	"github.com/spf13/cobra"
+)
+
+var networkTreesWeightsOut string
+
+// networkTreesCmd represents the network trees command
+var networkTreesCmd = &cobra.Command{
+	Use:   "trees",
+	Short: "Writes all the trees displayed by the networks",
+	Long: `Writes all the trees displayed by the networks.
+
+For each input network, and for each combination of parent edges of 
+reticulation nodes (one parent per reticulation node), the other parent 
+edges are removed, and the resulting tree is written in Newick format:
+- Nodes having only one child are removed, and the lengths of their two 
+  adjacent branches are summed;
+- Internal nodes without any remaining tip below them are removed.
+
+Output trees are rooted and not necessarily distinct.
+
+If --weights is given, a tab separated file is written with, for each output tree:
+1) Network id
+2) Displayed tree id (in the network)
+3) Weight of the tree: product of the inheritance probabilities (gamma) of 
+   the kept hybrid edges (1/number of parents if gamma is not set)
+
+Example:
+
+gotree network trees -i network.nw -o trees.nw --weights weights.txt
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f, weightf *os.File
+		var netfile goio.Closer
+		var netchan <-chan network.Networks
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if networkTreesWeightsOut != "none" {
+			if weightf, err = openWriteFile(networkTreesWeightsOut); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(weightf, networkTreesWeightsOut)
+			weightf.WriteString("network\ttree\tweight\n")
+		}
+
+		if netfile, netchan, err = readNetworks(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer netfile.Close()
+
+		for n := range netchan {
+			if n.Err != nil {
+				io.LogError(n.Err)
+				return n.Err
+			}
+			for i, dt := range n.Network.DisplayedTrees() {
+				f.WriteString(dt.Tree.Newick() + "\n")
+				if weightf != nil {
+					weightf.WriteString(fmt.Sprintf("%d\t%d\t%f\n", n.Id, i, dt.Weight))
+				}
+			}
+		}
+		return
+	},
+}
+
+func init() {
+	networkCmd.AddCommand(networkTreesCmd)
+	networkTreesCmd.Flags().StringVar(&networkTreesWeightsOut, "weights", "none", "Output file with the weight of each displayed tree")
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/parsimony"
+	"github.com/spf13/cobra"
+)
+
+var parsAlign string
+var parsPhylip bool
+var parsInputStrict bool
+var parsSearch string
+var parsReplicates int
+var parsOutTree string
+
+// parsimonyCmd represents the parsimony command
+var parsimonyCmd = &cobra.Command{
+	Use:   "parsimony",
+	Short: "Searches for the most parsimonious tree of an alignment",
+	Long: `Searches for the most parsimonious tree of an alignment.
+
+The alignment (-a, Fasta or Phylip with -p) is analyzed under the Fitch parsimony
+criterion. Ambiguous characters (IUPAC codes) are considered as sets of states, and
+gaps as missing data.
+
+For each replicate, a starting tree is built by stepwise addition of the taxa in
+random order (each taxon being added on the branch that minimizes the parsimony
+score, ties being broken randomly). It is then improved by hill-climbing (--search):
+- none: No improvement;
+- nni : Nearest Neighbor Interchanges;
+- spr : Subtree Pruning and Regrafting (default).
+Moves are applied as long as they improve the parsimony score.
+
+Replicates (--replicates) are run in parallel (-t), and are reproducible given the
+seed (--seed), whatever the number of threads.
+
+Output (-o) is tab separated, with one line per replicate:
+1) Replicate
+2) Parsimony score
+3) Consistency index (CI=M/S)
+4) Retention index (RI=(G-S)/(G-M))
+M and G being the minimum and maximum possible numbers of changes on any tree
+(ambiguous characters are not considered), and S the parsimony score. Indices that
+are not defined are NA.
+
+The most parsimonious tree of all replicates (first one in case of ties) is written
+with --out-tree (unrooted, without branch lengths).
+
+Example:
+
+gotree compute parsimony -a align.phy -p --search spr --replicates 10 -t 4 --out-tree mp.nw
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f, treef *os.File
+		var al align.Alignment
+		var search int
+		var results []*parsimony.Result
+		var best *parsimony.Result
+
+		switch strings.ToLower(parsSearch) {
+		case "none":
+			search = parsimony.SEARCH_NONE
+		case "nni":
+			search = parsimony.SEARCH_NNI
+		case "spr":
+			search = parsimony.SEARCH_SPR
+		default:
+			err = fmt.Errorf("Unknown search algorithm: %s", parsSearch)
+			io.LogError(err)
+			return
+		}
+
+		if al, err = readAlignment(parsAlign, parsPhylip, parsInputStrict); err != nil {
+			io.LogError(err)
+			return
+		}
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if parsOutTree != "none" {
+			if treef, err = openWriteFile(parsOutTree); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(treef, parsOutTree)
+		}
+
+		if results, err = parsimony.Search(al, search, parsReplicates, rootCpus); err != nil {
+			io.LogError(err)
+			return
+		}
+
+		f.WriteString("replicate\tscore\tci\tri\n")
+		for _, r := range results {
+			f.WriteString(fmt.Sprintf("%d\t%d\t%s\t%s\n", r.Replicate, r.Score,
+				likParamString(!math.IsNaN(r.CI), r.CI), likParamString(!math.IsNaN(r.RI), r.RI)))
+			if best == nil || r.Score < best.Score {
+				best = r
+			}
+		}
+		if treef != nil {
+			treef.WriteString(best.Tree.Newick() + "\n")
+		}
+		return
+	},
+}
+
+func init() {
+	computeCmd.AddCommand(parsimonyCmd)
+	parsimonyCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Output parsimony score file")
+	parsimonyCmd.PersistentFlags().StringVarP(&parsAlign, "align", "a", "stdin", "Alignment input file")
+	parsimonyCmd.PersistentFlags().BoolVarP(&parsPhylip, "phylip", "p", false, "Alignment is in Phylip format (default: Fasta)")
+	parsimonyCmd.PersistentFlags().BoolVar(&parsInputStrict, "input-strict", false, "Strict phylip input format (only used with -p)")
+	parsimonyCmd.PersistentFlags().StringVar(&parsSearch, "search", "spr", "Tree search: none (stepwise addition only), nni, or spr")
+	parsimonyCmd.PersistentFlags().IntVar(&parsReplicates, "replicates", 1, "Number of random addition replicates")
+	parsimonyCmd.PersistentFlags().StringVar(&parsOutTree, "out-tree", "none", "Output most parsimonious tree file")
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	goio "io"
+	"os"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var picValues string
+
+// picCmd represents the pic command
+var picCmd = &cobra.Command{
+	Use:   "pic",
+	Short: "Computes phylogenetically independent contrasts of continuous traits",
+	Long: `Computes phylogenetically independent contrasts of continuous traits.
+
+Felsenstein's independent contrasts (Felsenstein 1985) are computed for each
+internal node: difference between the (estimated) values of its two children,
+divided by the square root of its expected variance (sum of the lengths of the two
+child branches, the branch of an internal child being lengthened to account for
+the uncertainty of its estimated value).
+
+Input trees must be rooted and binary, and all their branches must have a length.
+Values of the traits are given with --values, as a tab separated file with one line
+per tip: the tip name followed by the value of each trait. The first line may be a
+header giving the names of the traits (otherwise they are named value1, value2,
+...).
+
+Output (-o) is tab separated, with one line per tree and per internal node, in
+preorder:
+1) Tree id
+2) Node name (or id if it has no name)
+3) Expected variance of the contrast
+4) Contrast of each trait
+
+Example:
+
+gotree compute pic -i tree.nw --values traits.txt
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f *os.File
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var traits []string
+		var values map[string][]float64
+		var contrasts []*tree.Contrast
+
+		if picValues == "none" {
+			err = errors.New("Trait values must be given with --values")
+			io.LogError(err)
+			return
+		}
+		if traits, values, err = parseTipValues(picValues); err != nil {
+			io.LogError(err)
+			return
+		}
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if treefile, treechan, err = readTrees(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer treefile.Close()
+
+		f.WriteString("tree\tnode\tvariance\t" + strings.Join(traits, "\t") + "\n")
+		for t := range treechan {
+			if t.Err != nil {
+				io.LogError(t.Err)
+				return t.Err
+			}
+			for i, n := range t.Tree.Nodes() {
+				n.SetId(i)
+			}
+			if contrasts, err = t.Tree.IndependentContrasts(values, len(traits)); err != nil {
+				io.LogError(err)
+				return
+			}
+			for _, c := range contrasts {
+				f.WriteString(fmt.Sprintf("%d\t%s\t%g", t.Id, asrNodeName(c.Node), c.Variance))
+				for _, v := range c.Values {
+					f.WriteString(fmt.Sprintf("\t%g", v))
+				}
+				f.WriteString("\n")
+			}
+		}
+		return
+	},
+}
+
+func init() {
+	computeCmd.AddCommand(picCmd)
+	picCmd.PersistentFlags().StringVarP(&intreefile, "input", "i", "stdin", "Input rooted binary tree(s)")
+	picCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Output file")
+	picCmd.PersistentFlags().StringVar(&picValues, "values", "none", "Tip/value(s) file: tab separated, tip name followed by the value of each trait")
+}
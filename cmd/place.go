@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	goio "io"
+	"os"
+	"strings"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/gotree/asr"
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var placealign string
+var placequery string
+var placephylip bool
+var placeinputstrict bool
+var placeoutplacements string
+
+// placeCmd represents the place command
+var placeCmd = &cobra.Command{
+	Use:   "place",
+	Short: "Places new samples onto a reference tree by parsimony",
+	Long: `Places new samples onto a reference tree by parsimony.
+
+The reference tree (-i) and the alignment of its tips (-a) are given, as well as
+the alignment of new samples (-q, aligned with the reference alignment). Both
+alignments are in Fasta format, or in Phylip format with -p.
+
+Samples are placed sequentially, in the order of the query alignment: for each
+sample, ancestral sequences of the current tree are reconstructed by parsimony
+(--algo: acctran, deltran or downpass, see gotree asr), and the sample is grafted
+onto the branch that minimizes the added parsimony score. At each site, placing
+the sample on a branch costs 1 if its state(s) intersect neither the states of the
+upper node nor the states of the lower node of the branch (missing data has no
+cost). In case of ties, the first branch in the pre-order traversal of the tree is
+chosen. Already placed samples are thus taken into account for the next ones.
+
+If the tree has branch lengths, the grafted branch is divided in two, and the
+new tip branch has a length of score/length of the alignment.
+
+The updated trees are written to -o, and --out-placements gives, for each
+sample (tab separated):
+1) Tree id
+2) Sample name
+3) Branch on which the sample is grafted (name of its lower node)
+4) Added parsimony score
+5) Number of equally parsimonious branches
+6) Equally parsimonious branches, comma separated (names of their lower nodes)
+Nodes without name are identified by their index in the updated tree. To get
+meaningful branch identifiers, internal nodes may be named beforehand with
+gotree rename --internal -a.
+
+Example:
+
+gotree place -i reference.nw -a reference.fa -q new.fa --out-placements placements.txt -o updated.nw
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var ref, query align.Alignment
+		var algo int
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var f, placefile *os.File
+		var placements []*asr.Placement
+
+		switch strings.ToLower(parsimonyAlgo) {
+		case "acctran":
+			algo = asr.ALGO_ACCTRAN
+		case "deltran":
+			algo = asr.ALGO_DELTRAN
+		case "downpass":
+			algo = asr.ALGO_DOWNPASS
+		default:
+			err = fmt.Errorf("Unkown parsimony algorithm: %s", parsimonyAlgo)
+			io.LogError(err)
+			return
+		}
+
+		if placequery == "none" {
+			err = errors.New("Query alignment must be given with --query")
+			io.LogError(err)
+			return
+		}
+
+		if ref, err = readAlignment(placealign, placephylip, placeinputstrict); err != nil {
+			io.LogError(err)
+			return
+		}
+		if query, err = readAlignment(placequery, placephylip, placeinputstrict); err != nil {
+			io.LogError(err)
+			return
+		}
+
+		if treefile, treechan, err = readTrees(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer treefile.Close()
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if placeoutplacements != "none" {
+			if placefile, err = openWriteFile(placeoutplacements); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(placefile, placeoutplacements)
+			placefile.WriteString("tree\tsample\tbranch\tscore\tnties\tties\n")
+		}
+
+		for t := range treechan {
+			if t.Err != nil {
+				io.LogError(t.Err)
+				return t.Err
+			}
+			if placements, err = asr.ParsimonyPlacement(t.Tree, ref, query, algo); err != nil {
+				io.LogError(err)
+				return
+			}
+			if placefile != nil {
+				for _, p := range placements {
+					ties := make([]string, len(p.Ties))
+					for i, n := range p.Ties {
+						ties[i] = asrNodeName(n)
+					}
+					fmt.Fprintf(placefile, "%d\t%s\t%s\t%d\t%d\t%s\n", t.Id, p.Name, asrNodeName(p.Node),
+						p.Score, len(p.Ties), strings.Join(ties, ","))
+				}
+			}
+			f.WriteString(t.Tree.Newick() + "\n")
+		}
+		return
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(placeCmd)
+	placeCmd.PersistentFlags().StringVarP(&intreefile, "input", "i", "stdin", "Input reference tree(s)")
+	placeCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Output updated tree file")
+	placeCmd.PersistentFlags().StringVarP(&placealign, "align", "a", "stdin", "Reference alignment input file (tips of the tree)")
+	placeCmd.PersistentFlags().StringVarP(&placequery, "query", "q", "none", "Alignment of the samples to place")
+	placeCmd.PersistentFlags().BoolVarP(&placephylip, "phylip", "p", false, "Alignments are in Phylip format (default: Fasta)")
+	placeCmd.PersistentFlags().BoolVar(&placeinputstrict, "input-strict", false, "Strict phylip input format (only used with -p)")
+	placeCmd.PersistentFlags().StringVar(&parsimonyAlgo, "algo", "acctran", "Parsimony algorithm: acctran, deltran, or downpass")
+	placeCmd.PersistentFlags().StringVar(&placeoutplacements, "out-placements", "none", "Output placement file")
+}
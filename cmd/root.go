@@ -225,3 +225,77 @@ func readMapFile(file string, revert bool) (map[string]string, error) {
 
 	return outmap, nil
 }
+
+// Reads a tab separated matrix of values between states (rate or cost matrix):
+//   - First line: the state names (optionally preceded by an empty cell);
+//   - Following lines: the values from each state to the states of the first line,
+//     optionally starting with the name of the state (otherwise, lines are in the
+//     order of the first line). "-" or "*" (e.g. on the diagonal) stand for 0.
+func readStateMatrix(file string) (states []string, matrix [][]float64, err error) {
+	var f goio.Closer
+	var r *bufio.Reader
+	var l string
+	var v float64
+
+	if f, r, err = utils.GetReader(file); err != nil {
+		return
+	}
+	defer f.Close()
+
+	nbrows := 0
+	for l, err = Readln(r); err == nil; l, err = Readln(r) {
+		if l = strings.TrimRight(l, " \r"); strings.TrimSpace(l) == "" {
+			continue
+		}
+		cols := strings.Split(l, "\t")
+		if states == nil {
+			if cols[0] == "" {
+				cols = cols[1:]
+			}
+			states = cols
+			matrix = make([][]float64, len(states))
+			continue
+		}
+		i := nbrows
+		if len(cols) == len(states)+1 {
+			for i = 0; i < len(states) && states[i] != cols[0]; i++ {
+			}
+			if i == len(states) {
+				return nil, nil, fmt.Errorf("Bad format for state matrix: Unknown state %s", cols[0])
+			}
+			cols = cols[1:]
+		} else if len(cols) != len(states) {
+			return nil, nil, fmt.Errorf("Bad format for state matrix: %d columns instead of %d", len(cols), len(states))
+		}
+		if i >= len(states) {
+			return nil, nil, errors.New("Bad format for state matrix: More rows than states")
+		}
+		if matrix[i] != nil {
+			return nil, nil, fmt.Errorf("Bad format for state matrix: State %s is given several times", states[i])
+		}
+		matrix[i] = make([]float64, len(states))
+		for j, c := range cols {
+			if c == "-" || c == "*" {
+				continue
+			}
+			if v, err = strconv.ParseFloat(c, 64); err != nil {
+				return nil, nil, fmt.Errorf("Bad format for state matrix: %s is not a number", c)
+			}
+			matrix[i][j] = v
+		}
+		nbrows++
+	}
+	if err != goio.EOF {
+		return nil, nil, err
+	}
+	err = nil
+	if states == nil {
+		return nil, nil, errors.New("Bad format for state matrix: Empty file")
+	}
+	for i, row := range matrix {
+		if row == nil {
+			return nil, nil, fmt.Errorf("Bad format for state matrix: No row for state %s", states[i])
+		}
+	}
+	return
+}
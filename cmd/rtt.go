@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	goio "io"
+	"os"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/io/dates"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var rttDateFile string
+var rttDateRegexp string
+var rttDateFormats string
+var rttReroot string
+var rttOutTips string
+var rttOutTree string
+
+// rttCmd represents the rtt command
+var rttCmd = &cobra.Command{
+	Use:   "rtt",
+	Short: "Root-to-tip regression of heterochronous trees",
+	Long: `Root-to-tip regression of heterochronous trees (temporal signal, as TempEst).
+
+Sampling dates of tips are given either:
+- In a tab separated file (--date-file), with one tip per line: tipname<tab>date, or 
+  tipname<tab>lower<tab>upper for date intervals. Tips that are not in the file are
+  not taken into account;
+- Or in the tip names: the date is extracted using --date-regexp (first capturing 
+  group, default: last field after a '_' or a '|').
+
+Dates are parsed with the first matching format given in --date-format (comma separated).
+Formats are made of yyyy, mm, dd and separators (e.g. yyyy-mm-dd or dd/mm/yyyy), or
+"decimal" for decimal years. Partial dates (e.g. 2019-03 with format yyyy-mm) are
+considered as intervals, and their value is the middle of the interval.
+
+Then root-to-tip distances are regressed against dates, and for each input tree, 
+the output (-o) is tab separated with:
+1) Tree id
+2) Number of dated tips
+3) Rate (slope of the regression)
+4) tMRCA (date of the root, x-intercept)
+5) R²
+6) Residual mean square
+
+If --reroot is given, the tree is first rerooted at the position that:
+- r2  : Maximizes the R² (with a positive rate)
+- rms : Minimizes the residual mean square
+
+If --out-tips is given, a tab separated file is written with, for each dated tip:
+1) Tree id
+2) Tip name
+3) Date
+4) Root-to-tip distance
+5) Residual
+
+If --out-tree is given, the (rerooted) trees are written in Newick format.
+
+Example:
+
+gotree rtt -i tree.nw --date-format yyyy-mm-dd,yyyy-mm,yyyy --reroot r2 --out-tree rerooted.nw --out-tips residuals.txt
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f, tipsf, treef *os.File
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var filedates map[string]dates.Date
+		var reg *tree.RTTRegression
+		var criterion int
+
+		formats := strings.Split(rttDateFormats, ",")
+		switch rttReroot {
+		case "none":
+		case "r2":
+			criterion = tree.RTT_R2
+		case "rms":
+			criterion = tree.RTT_RMS
+		default:
+			err = fmt.Errorf("Unknown rerooting criterion: %s", rttReroot)
+			io.LogError(err)
+			return
+		}
+
+		if rttDateFile != "none" {
+			if filedates, err = dates.ReadDateFile(rttDateFile, formats); err != nil {
+				io.LogError(err)
+				return
+			}
+		}
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if rttOutTips != "none" {
+			if tipsf, err = openWriteFile(rttOutTips); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(tipsf, rttOutTips)
+			tipsf.WriteString("tree\ttip\tdate\tdistance\tresidual\n")
+		}
+
+		if rttOutTree != "none" {
+			if treef, err = openWriteFile(rttOutTree); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(treef, rttOutTree)
+		}
+
+		if treefile, treechan, err = readTrees(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer treefile.Close()
+
+		f.WriteString("tree\ttips\trate\ttmrca\tr2\trms\n")
+		for t := range treechan {
+			if t.Err != nil {
+				io.LogError(t.Err)
+				return t.Err
+			}
+			tipdates := filedates
+			if tipdates == nil {
+				if tipdates, err = dates.TipDates(t.Tree.AllTipNames(), rttDateRegexp, formats); err != nil {
+					io.LogError(err)
+					return
+				}
+			}
+			values := dates.Values(tipdates)
+			if rttReroot != "none" {
+				if err = t.Tree.RerootRTT(values, criterion); err != nil {
+					io.LogError(err)
+					return
+				}
+			}
+			if reg, err = t.Tree.RootToTipRegression(values); err != nil {
+				io.LogError(err)
+				return
+			}
+			f.WriteString(fmt.Sprintf("%d\t%d\t%g\t%g\t%g\t%g\n", t.Id, len(reg.Tips), reg.Rate, reg.TMRCA, reg.R2, reg.RMS))
+			if tipsf != nil {
+				for i, name := range reg.Tips {
+					tipsf.WriteString(fmt.Sprintf("%d\t%s\t%g\t%g\t%g\n", t.Id, name, reg.Dates[i], reg.Distances[i], reg.Residuals[i]))
+				}
+			}
+			if treef != nil {
+				treef.WriteString(t.Tree.Newick() + "\n")
+			}
+		}
+		return
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(rttCmd)
+	rttCmd.PersistentFlags().StringVarP(&intreefile, "input", "i", "stdin", "Input tree(s)")
+	rttCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Output regression statistics file")
+	rttCmd.PersistentFlags().StringVar(&rttDateFile, "date-file", "none", "Tab separated file with tip dates (otherwise, dates are taken from tip names)")
+	rttCmd.PersistentFlags().StringVar(&rttDateRegexp, "date-regexp", dates.DefaultRegexp, "Regexp to extract dates from tip names (first capturing group)")
+	rttCmd.PersistentFlags().StringVar(&rttDateFormats, "date-format", strings.Join(dates.DefaultFormats, ","), "Date formats, comma separated, tried in this order (yyyy, mm, dd, or decimal)")
+	rttCmd.PersistentFlags().StringVar(&rttReroot, "reroot", "none", "Reroots the tree before the regression: none, r2 (max R²), or rms (min residual mean square)")
+	rttCmd.PersistentFlags().StringVar(&rttOutTips, "out-tips", "none", "Output file with dates, distances and residuals of each tip")
+	rttCmd.PersistentFlags().StringVar(&rttOutTree, "out-tree", "none", "Output (rerooted) tree file")
+}
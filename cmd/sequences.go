@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	goio "io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/goalign/io/fasta"
+	"github.com/evolbioinfo/goalign/io/phylip"
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/models"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var generateSeqLength int
+var generateSeqModel string
+var generateKappa float64
+var generateGTRRates string
+var generateFreqs string
+var generateAlpha float64
+var generateNbCat int
+var generatePInv float64
+var generatePhylip bool
+var generateAncestral string
+var generateOutTree string
+
+// Parses a comma separated list of floats
+func parseFloatList(s string) (values []float64, err error) {
+	var v float64
+	for _, f := range strings.Split(s, ",") {
+		if v, err = strconv.ParseFloat(strings.TrimSpace(f), 64); err != nil {
+			return
+		}
+		values = append(values, v)
+	}
+	return
+}
+
+// Builds the substitution model given the command line options.
+// If freqs is "empirical", frequencies are computed from the alignment al.
+func substitutionModel(name string, kappa float64, gtrrates, freqs string, al align.Alignment, alpha float64, ncat int, pinv float64) (m *models.Model, err error) {
+	var rates, pi []float64
+	var code int
+
+	if code = models.ModelStringToInt(name); code < 0 {
+		return nil, fmt.Errorf("Unknown substitution model: %s", name)
+	}
+	if gtrrates != "none" {
+		if rates, err = parseFloatList(gtrrates); err != nil {
+			return
+		}
+	}
+	if freqs == "empirical" {
+		if al == nil {
+			return nil, errors.New("Empirical frequencies need an alignment")
+		}
+		if pi, err = models.EmpiricalFrequencies(al); err != nil {
+			return
+		}
+	} else if freqs != "none" {
+		if pi, err = parseFloatList(freqs); err != nil {
+			return
+		}
+	}
+	if m, err = models.NewModel(code, kappa, rates, pi); err != nil {
+		return
+	}
+	err = m.SetRateHeterogeneity(alpha, ncat, pinv)
+	return
+}
+
+func writeAlignment(f goio.Writer, al align.Alignment, phy bool) {
+	if phy {
+		fmt.Fprint(f, phylip.WriteAlignment(al, false, false, false))
+	} else {
+		fmt.Fprint(f, fasta.WriteAlignment(al))
+	}
+}
+
+// sequencesCmd represents the sequences command
+var sequencesCmd = &cobra.Command{
+	Use:   "sequences",
+	Short: "Simulates sequence alignments along input trees",
+	Long: `Simulates sequence alignments along input trees.
+
+Sequences evolve along the branches of the input trees (branch lengths in expected
+substitutions per site) under the given substitution model (--model):
+- Nucleotides: jc69, k80 (--kappa), hky (--kappa, --freqs), gtr (--rates, --freqs);
+- Amino acids: lg, wag, jtt.
+
+--rates gives the 6 relative GTR rates (AC,AG,AT,CG,CT,GT), and --freqs the equilibrium
+frequencies of A,C,G,T (comma separated).
+
+Rate heterogeneity across sites may be added with a discrete gamma distribution
+(--alpha > 0, --ncat categories) and/or a proportion of invariant sites (--pinv).
+
+The sequence of the root (or of the pseudo root for unrooted trees) is drawn from the
+equilibrium frequencies of the model.
+
+For each input tree, -n alignments are simulated and written in Fasta (default) or
+Phylip (-p) format. If --ancestral is given, the sequences of the internal nodes are
+written in this file, in the same format. Internal nodes without name are named
+Node<i>, and the trees with these names may be written with --out-tree.
+
+Example:
+
+gotree generate yuletree -l 20 --seed 10 | gotree generate sequences -l 500 --model gtr --rates 1,4,1,1,4,1 --freqs 0.3,0.2,0.2,0.3 --alpha 0.5 --seed 10 -p
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f, ancf, treef *os.File
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var m *models.Model
+		var tips, internals align.Alignment
+
+		if generateNbTrees < 1 {
+			err = errors.New("Number of alignments must be >= 1")
+			io.LogError(err)
+			return
+		}
+		if m, err = substitutionModel(generateSeqModel, generateKappa, generateGTRRates, generateFreqs, nil, generateAlpha, generateNbCat, generatePInv); err != nil {
+			io.LogError(err)
+			return
+		}
+
+		if f, err = openWriteFile(generateOutputfile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, generateOutputfile)
+
+		if generateAncestral != "none" {
+			if ancf, err = openWriteFile(generateAncestral); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(ancf, generateAncestral)
+		}
+
+		if generateOutTree != "none" {
+			if treef, err = openWriteFile(generateOutTree); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(treef, generateOutTree)
+		}
+
+		if treefile, treechan, err = readTrees(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer treefile.Close()
+
+		for t := range treechan {
+			if t.Err != nil {
+				io.LogError(t.Err)
+				return t.Err
+			}
+			for i := 0; i < generateNbTrees; i++ {
+				if tips, internals, err = models.SimulateSequences(t.Tree, m, generateSeqLength, generateAncestral != "none"); err != nil {
+					io.LogError(err)
+					return
+				}
+				writeAlignment(f, tips, generatePhylip)
+				if generateAncestral != "none" {
+					writeAlignment(ancf, internals, generatePhylip)
+				}
+			}
+			if generateOutTree != "none" {
+				treef.WriteString(t.Tree.Newick() + "\n")
+			}
+		}
+		return
+	},
+}
+
+func init() {
+	generateCmd.AddCommand(sequencesCmd)
+	sequencesCmd.PersistentFlags().StringVarP(&intreefile, "input", "i", "stdin", "Input tree(s)")
+	sequencesCmd.PersistentFlags().IntVarP(&generateSeqLength, "length", "l", 1000, "Length of the simulated alignments")
+	sequencesCmd.PersistentFlags().StringVar(&generateSeqModel, "model", "jc69", "Substitution model: jc69, k80, hky, gtr, lg, wag, or jtt")
+	sequencesCmd.PersistentFlags().Float64Var(&generateKappa, "kappa", 2.0, "Transition/transversion rate ratio (k80, hky)")
+	sequencesCmd.PersistentFlags().StringVar(&generateGTRRates, "rates", "none", "Relative rates AC,AG,AT,CG,CT,GT, comma separated (gtr; none: all equal)")
+	sequencesCmd.PersistentFlags().StringVar(&generateFreqs, "freqs", "none", "Equilibrium frequencies of A,C,G,T, comma separated (hky, gtr; none: all equal)")
+	sequencesCmd.PersistentFlags().Float64Var(&generateAlpha, "alpha", 0.0, "Shape of the gamma distribution of site rates (0: no gamma)")
+	sequencesCmd.PersistentFlags().IntVar(&generateNbCat, "ncat", 4, "Number of discrete gamma categories")
+	sequencesCmd.PersistentFlags().Float64Var(&generatePInv, "pinv", 0.0, "Proportion of invariant sites")
+	sequencesCmd.PersistentFlags().BoolVarP(&generatePhylip, "phylip", "p", false, "Output alignments in Phylip format (default: Fasta)")
+	sequencesCmd.PersistentFlags().StringVar(&generateAncestral, "ancestral", "none", "Output file of the simulated ancestral sequences (internal nodes)")
+	sequencesCmd.PersistentFlags().StringVar(&generateOutTree, "out-tree", "none", "Output file of the input trees, with internal node names")
+}
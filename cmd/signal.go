@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	goio "io"
+	"math"
+	"os"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var signalValues string
+var signalPermutations int
+
+// signalCmd represents the signal command
+var signalCmd = &cobra.Command{
+	Use:   "signal",
+	Short: "Measures the phylogenetic signal of continuous traits",
+	Long: `Measures the phylogenetic signal of continuous traits.
+
+Input trees must be rooted and all their branches must have a length. Values of the
+traits are given with --values, as a tab separated file with one line per tip: the
+tip name followed by the value of each trait. The first line may be a header
+giving the names of the traits (otherwise they are named value1, value2, ...).
+
+Two statistics are computed for each trait:
+- Blomberg's K (Blomberg et al. 2003): ratio of the observed and expected (under
+  Brownian motion) MSE0/MSE. K=1 under Brownian motion, K<1 if the trait is less
+  conserved than expected, and K>1 if it is more conserved. Its p-value is the
+  proportion of random permutations of the values among the tips (--permutations)
+  giving a K greater or equal to the observed one (NA if --permutations 0);
+- Pagel's lambda (Pagel 1999), estimated by maximum likelihood in [0,1]: multiplier
+  of the phylogenetic covariances between tips under Brownian motion (0: no
+  phylogenetic signal, 1: Brownian motion). Its p-value is given by the likelihood
+  ratio test of lambda=0.
+
+Output (-o) is tab separated, with one line per tree and per trait:
+1) Tree id
+2) Trait
+3) K
+4) p-value of K
+5) lambda
+6) Log-likelihood with the estimated lambda
+7) Log-likelihood with lambda=0
+8) p-value of lambda
+
+Example:
+
+gotree compute signal -i tree.nw --values traits.txt --permutations 999
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f *os.File
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var traits []string
+		var values map[string][]float64
+		var k, kpvalue, lambda, lnl, lnl0, lpvalue float64
+
+		if signalValues == "none" {
+			err = errors.New("Trait values must be given with --values")
+			io.LogError(err)
+			return
+		}
+		if traits, values, err = parseTipValues(signalValues); err != nil {
+			io.LogError(err)
+			return
+		}
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if treefile, treechan, err = readTrees(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer treefile.Close()
+
+		f.WriteString("tree\ttrait\tk\tk_pvalue\tlambda\tloglik\tloglik0\tlambda_pvalue\n")
+		for t := range treechan {
+			if t.Err != nil {
+				io.LogError(t.Err)
+				return t.Err
+			}
+			for d, trait := range traits {
+				if k, kpvalue, err = t.Tree.BlombergK(values, d, signalPermutations); err != nil {
+					io.LogError(err)
+					return
+				}
+				if lambda, lnl, lnl0, lpvalue, err = t.Tree.PagelLambda(values, d); err != nil {
+					io.LogError(err)
+					return
+				}
+				f.WriteString(fmt.Sprintf("%d\t%s\t%g\t%s\t%g\t%g\t%g\t%g\n", t.Id, trait,
+					k, likParamString(!math.IsNaN(kpvalue), kpvalue), lambda, lnl, lnl0, lpvalue))
+			}
+		}
+		return
+	},
+}
+
+func init() {
+	computeCmd.AddCommand(signalCmd)
+	signalCmd.PersistentFlags().StringVarP(&intreefile, "input", "i", "stdin", "Input rooted tree(s)")
+	signalCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Output file")
+	signalCmd.PersistentFlags().StringVar(&signalValues, "values", "none", "Tip/value(s) file: tab separated, tip name followed by the value of each trait")
+	signalCmd.PersistentFlags().IntVar(&signalPermutations, "permutations", 1000, "Number of permutations for the p-value of K (0: no p-value)")
+}
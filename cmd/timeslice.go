@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	goio "io"
+	"os"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var timesliceHeight float64
+var timesliceDepth float64
+var timesliceSubtrees bool
+
+// timesliceCmd represents the timeslice command
+var timesliceCmd = &cobra.Command{
+	Use:   "timeslice",
+	Short: "Cuts a time tree at a given height, and outputs the lineages crossing it",
+	Long: `Cuts a time tree at a given height, and outputs the lineages crossing it.
+
+The height of a node is its distance to the tip that is the farthest from the root
+(the most recent tip has height 0, and the root has the largest height: the root age).
+The input tree must be rooted. The time of the cut is given either:
+- As a height (--height), e.g. 10 for 10 time units before the most recent tip;
+- Or as a depth (--depth): distance from the root (i.e. height = root age - depth).
+
+Each branch crossing the cut defines a lineage, and a cluster made of the tips below it.
+Tips sampled before the cut (height > cut height) are not in any cluster.
+
+Output (-o) is tab separated, with one line per tip:
+1) Tree id
+2) Tip name
+3) Cluster id (NA if the tip is sampled before the cut)
+
+If --subtrees is given, the subtrees rooted at the nodes just below the cut are written
+instead, in Newick format (one per line).
+
+Example:
+
+gotree timeslice -i timetree.nw --height 5 -o clusters.txt
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f *os.File
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var edges []*tree.Edge
+		var height, age float64
+
+		if (timesliceHeight < 0) == (timesliceDepth < 0) {
+			err = errors.New("Exactly one of --height and --depth must be given")
+			io.LogError(err)
+			return
+		}
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if treefile, treechan, err = readTrees(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer treefile.Close()
+
+		if !timesliceSubtrees {
+			f.WriteString("tree\ttip\tcluster\n")
+		}
+		for t := range treechan {
+			if t.Err != nil {
+				io.LogError(t.Err)
+				return t.Err
+			}
+			if !t.Tree.Rooted() {
+				err = errors.New("Tree is not rooted")
+				io.LogError(err)
+				return
+			}
+			height = timesliceHeight
+			if timesliceDepth >= 0 {
+				if age, err = t.Tree.RootAge(); err != nil {
+					io.LogError(err)
+					return
+				}
+				height = age - timesliceDepth
+			}
+			if edges, err = t.Tree.TimeSlice(height); err != nil {
+				io.LogError(err)
+				return
+			}
+			if timesliceSubtrees {
+				for _, e := range edges {
+					f.WriteString(t.Tree.SubTree(e.Right()).Newick() + "\n")
+				}
+				continue
+			}
+			clusters := make(map[string]int)
+			for i, e := range edges {
+				for _, name := range e.TipsBelow() {
+					clusters[name] = i
+				}
+			}
+			for _, name := range t.Tree.AllTipNames() {
+				if c, ok := clusters[name]; ok {
+					f.WriteString(fmt.Sprintf("%d\t%s\t%d\n", t.Id, name, c))
+				} else {
+					f.WriteString(fmt.Sprintf("%d\t%s\tNA\n", t.Id, name))
+				}
+			}
+		}
+		return
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(timesliceCmd)
+	timesliceCmd.PersistentFlags().StringVarP(&intreefile, "input", "i", "stdin", "Input time tree(s)")
+	timesliceCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Output cluster file (or subtree file with --subtrees)")
+	timesliceCmd.PersistentFlags().Float64Var(&timesliceHeight, "height", -1, "Height of the cut (distance from the most recent tip)")
+	timesliceCmd.PersistentFlags().Float64Var(&timesliceDepth, "depth", -1, "Depth of the cut (distance from the root)")
+	timesliceCmd.PersistentFlags().BoolVar(&timesliceSubtrees, "subtrees", false, "Outputs the subtrees below the cut instead of clusters")
+}
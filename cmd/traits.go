@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	goio "io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/models"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var generateTraitModel string
+var generateTraitRoot float64
+var generateTraitSigma2 float64
+var generateTraitAlpha float64
+var generateTraitTheta float64
+var generateTraitNbStates int
+var generateTraitRate float64
+var generateTraitMatrix string
+var generateTraitRootState string
+var generateTraitInternal string
+
+// Builds the discrete trait model given the command line options
+func discreteTraitModel() (m *models.DiscreteModel, rootstate int, err error) {
+	var states []string
+	var q [][]float64
+
+	if generateTraitMatrix != "none" {
+		if states, q, err = readStateMatrix(generateTraitMatrix); err != nil {
+			return
+		}
+		if m, err = models.NewDiscreteModel(states, q); err != nil {
+			return
+		}
+	} else {
+		states = make([]string, generateTraitNbStates)
+		for i := range states {
+			states[i] = strconv.Itoa(i)
+		}
+		if m, err = models.NewMkModel(states, generateTraitRate); err != nil {
+			return
+		}
+	}
+	rootstate = -1
+	if generateTraitRootState != "none" {
+		for i, s := range m.States() {
+			if s == generateTraitRootState {
+				rootstate = i
+			}
+		}
+		if rootstate < 0 {
+			err = fmt.Errorf("Root state %s does not exist", generateTraitRootState)
+		}
+	}
+	return
+}
+
+// traitsCmd represents the traits command
+var traitsCmd = &cobra.Command{
+	Use:   "traits",
+	Short: "Simulates traits along input trees",
+	Long: `Simulates traits along input trees.
+
+Continuous traits may be simulated under (--model):
+- bm : Brownian motion of rate --sigma2, starting from --root-value at the root;
+- ou : Ornstein-Uhlenbeck process dX = alpha(theta-X)dt + sigma dW, with --alpha,
+       --theta and --sigma2, starting from --root-value at the root.
+
+Discrete traits may be simulated under (--model mk):
+- Mk model with --nstates states (named 0, 1, ...) and equal transition rates (--rate);
+- Or any rate matrix given in a file (--matrix). The first line of the file contains
+  the tab separated state names, and the following lines contain the tab separated
+  transition rates from each state (one line per state, optionally starting with the
+  state name, otherwise in the same order as the first line). "-" or "*" stand for 0,
+  and diagonal values are ignored (as gotree acr --costs).
+  The state of the root is drawn uniformly, unless --root-state is given.
+
+The root is the root of the input trees (pseudo root for unrooted trees).
+
+Output (-o) contains the state of each tip: tipname<tab>state, which is the format
+of gotree acr --states. The states of the internal nodes may be written with
+--internal (nodename<tab>state). Internal nodes without name are named Node<i>, and the
+trees with these names may be written with --out-tree.
+
+One trait is simulated per input tree.
+
+Example:
+
+gotree generate yuletree -r -l 50 --seed 10 | gotree generate traits --model mk --nstates 3 --rate 2 --seed 10 -o states.txt
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f, intf, treef *os.File
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var dmodel *models.DiscreteModel
+		var rootstate int
+		var values map[*tree.Node]float64
+		var states map[*tree.Node]int
+
+		model := strings.ToLower(generateTraitModel)
+		switch model {
+		case "bm", "ou":
+		case "mk":
+			if dmodel, rootstate, err = discreteTraitModel(); err != nil {
+				io.LogError(err)
+				return
+			}
+		default:
+			err = fmt.Errorf("Unknown trait model: %s", generateTraitModel)
+			io.LogError(err)
+			return
+		}
+		if model == "ou" && generateTraitAlpha <= 0 {
+			err = errors.New("OU model needs alpha > 0")
+			io.LogError(err)
+			return
+		}
+
+		if f, err = openWriteFile(generateOutputfile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, generateOutputfile)
+
+		if generateTraitInternal != "none" {
+			if intf, err = openWriteFile(generateTraitInternal); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(intf, generateTraitInternal)
+		}
+
+		if generateOutTree != "none" {
+			if treef, err = openWriteFile(generateOutTree); err != nil {
+				io.LogError(err)
+				return
+			}
+			defer closeWriteFile(treef, generateOutTree)
+		}
+
+		if treefile, treechan, err = readTrees(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer treefile.Close()
+
+		for t := range treechan {
+			if t.Err != nil {
+				io.LogError(t.Err)
+				return t.Err
+			}
+			switch model {
+			case "bm":
+				values, err = models.SimulateBM(t.Tree, generateTraitRoot, generateTraitSigma2)
+			case "ou":
+				values, err = models.SimulateOU(t.Tree, generateTraitRoot, generateTraitSigma2, generateTraitAlpha, generateTraitTheta)
+			default:
+				states, err = models.SimulateDiscreteTrait(t.Tree, dmodel, rootstate)
+			}
+			if err != nil {
+				io.LogError(err)
+				return
+			}
+			t.Tree.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+				var s string
+				if model == "mk" {
+					s = dmodel.States()[states[cur]]
+				} else {
+					s = strconv.FormatFloat(values[cur], 'f', -1, 64)
+				}
+				if cur.Tip() {
+					fmt.Fprintf(f, "%s\t%s\n", cur.Name(), s)
+				} else if intf != nil {
+					fmt.Fprintf(intf, "%s\t%s\n", cur.Name(), s)
+				}
+				return true
+			})
+			if treef != nil {
+				treef.WriteString(t.Tree.Newick() + "\n")
+			}
+		}
+		return
+	},
+}
+
+func init() {
+	generateCmd.AddCommand(traitsCmd)
+	traitsCmd.PersistentFlags().StringVarP(&intreefile, "input", "i", "stdin", "Input tree(s)")
+	traitsCmd.PersistentFlags().StringVar(&generateTraitModel, "model", "bm", "Trait model: bm, ou (continuous), or mk (discrete)")
+	traitsCmd.PersistentFlags().Float64Var(&generateTraitRoot, "root-value", 0.0, "Value of the continuous trait at the root (bm, ou)")
+	traitsCmd.PersistentFlags().Float64Var(&generateTraitSigma2, "sigma2", 1.0, "Rate of the Brownian motion (bm, ou)")
+	traitsCmd.PersistentFlags().Float64Var(&generateTraitAlpha, "alpha", 1.0, "Strength of selection (ou)")
+	traitsCmd.PersistentFlags().Float64Var(&generateTraitTheta, "theta", 0.0, "Optimum value (ou)")
+	traitsCmd.PersistentFlags().IntVar(&generateTraitNbStates, "nstates", 2, "Number of states (mk)")
+	traitsCmd.PersistentFlags().Float64Var(&generateTraitRate, "rate", 1.0, "Transition rate between states (mk)")
+	traitsCmd.PersistentFlags().StringVar(&generateTraitMatrix, "matrix", "none", "Rate matrix file, replaces --nstates and --rate (mk)")
+	traitsCmd.PersistentFlags().StringVar(&generateTraitRootState, "root-state", "none", "State of the root (mk; none: drawn uniformly)")
+	traitsCmd.PersistentFlags().StringVar(&generateTraitInternal, "internal", "none", "Output file of the simulated states of internal nodes")
+	traitsCmd.PersistentFlags().StringVar(&generateOutTree, "out-tree", "none", "Output file of the input trees, with internal node names")
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	goio "io"
+	"os"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/io"
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/spf13/cobra"
+)
+
+var transformModel string
+var transformParam float64
+
+// transformCmd represents the transform command
+var transformCmd = &cobra.Command{
+	Use:   "transform",
+	Short: "Transforms branch lengths with models of comparative methods",
+	Long: `Transforms branch lengths with models of comparative methods.
+
+Input trees must be rooted (except for kappa). Depths of the nodes are their
+distances from the root, the depth of the tree (T) being the largest root-to-tip
+distance, such that non-ultrametric trees keep the depths of their tips relative to
+each other. The transformation (--model) takes one parameter (--param):
+- lambda : Pagel's lambda, in [0,1]: internal branches are multiplied by lambda,
+           and terminal branches are extended such that root-to-tip distances are
+           unchanged (0: star tree, 1: unchanged tree);
+- kappa  : Pagel's kappa, >= 0: each length l is replaced by l^kappa (0: all lengths
+           are 1, 1: unchanged tree);
+- delta  : Pagel's delta, > 0: the depth d of each node is replaced by T*(d/T)^delta.
+           delta < 1 lengthens the branches near the root, delta > 1 lengthens
+           the branches near the tips;
+- grafen : Grafen's method, for trees without branch lengths: the height of each
+           internal node is ((number of tips below) - 1)/((number of tips) - 1),
+           raised to the power --param (> 0), tips having height 0;
+- ou     : Ornstein-Uhlenbeck, with strength alpha >= 0: the depth d of each node is
+           replaced by exp(-2*alpha*(T-d))*(1-exp(-2*alpha*d))/(2*alpha), such that
+           a Brownian motion on the transformed tree gives the covariances of an
+           Ornstein-Uhlenbeck process on the input tree (0: unchanged tree).
+
+Example:
+
+gotree brlen transform -i tree.nw --model lambda --param 0.5
+
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var f *os.File
+		var treefile goio.Closer
+		var treechan <-chan tree.Trees
+		var model int
+
+		switch strings.ToLower(transformModel) {
+		case "lambda":
+			model = tree.TRANSFORM_LAMBDA
+		case "kappa":
+			model = tree.TRANSFORM_KAPPA
+		case "delta":
+			model = tree.TRANSFORM_DELTA
+		case "grafen":
+			model = tree.TRANSFORM_GRAFEN
+		case "ou":
+			model = tree.TRANSFORM_OU
+		default:
+			err = fmt.Errorf("Unknown branch length transformation: %s", transformModel)
+			io.LogError(err)
+			return
+		}
+
+		if f, err = openWriteFile(outtreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer closeWriteFile(f, outtreefile)
+
+		if treefile, treechan, err = readTrees(intreefile); err != nil {
+			io.LogError(err)
+			return
+		}
+		defer treefile.Close()
+
+		for tr := range treechan {
+			if tr.Err != nil {
+				io.LogError(tr.Err)
+				return tr.Err
+			}
+			if err = tr.Tree.TransformLengths(model, transformParam); err != nil {
+				io.LogError(err)
+				return
+			}
+			f.WriteString(tr.Tree.Newick() + "\n")
+		}
+		return
+	},
+}
+
+func init() {
+	brlenCmd.AddCommand(transformCmd)
+	transformCmd.PersistentFlags().StringVar(&transformModel, "model", "lambda", "Transformation: lambda, kappa, delta, grafen, or ou")
+	transformCmd.PersistentFlags().Float64Var(&transformParam, "param", 1.0, "Parameter of the transformation (lambda, kappa, delta, Grafen's power, or OU alpha)")
+	transformCmd.PersistentFlags().StringVarP(&outtreefile, "output", "o", "stdout", "Transformed tree output file")
+}
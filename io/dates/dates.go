@@ -0,0 +1,199 @@
+// Package dates parses sampling dates of tips, from tip names
+// or from tabular files, and converts them into decimal years.
+//
+// Dates may be partial (e.g. 2019 or 2019-03), in which case they
+// are considered as intervals (e.g. [2019,2020[), and their value is
+// the middle of the interval.
+package dates
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	goio "io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evolbioinfo/gotree/io/utils"
+)
+
+// Default date formats, tried in this order
+var DefaultFormats = []string{"yyyy-mm-dd", "yyyy-mm", "yyyy", "decimal"}
+
+// Default regular expression to extract dates from tip names:
+// last field, after a '_' or a '|'
+const DefaultRegexp = `[_|]([^_|]+)$`
+
+// A sampling date, in decimal years
+type Date struct {
+	Value float64 // Value of the date (middle of the interval for partial dates)
+	Lower float64 // Lower bound of the date interval
+	Upper float64 // Upper bound of the date interval (==Lower for exact dates)
+}
+
+// Returns true if the date is an interval
+func (d Date) Partial() bool {
+	return d.Lower != d.Upper
+}
+
+// Converts a time into a decimal year: year + (day of year - 1)/(number of days in year)
+func DecimalYear(t time.Time) float64 {
+	start := time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(t.Year()+1, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return float64(t.Year()) + t.Sub(start).Hours()/end.Sub(start).Hours()
+}
+
+// Parses the given date with the first matching format.
+//
+// Formats are made of yyyy (year), mm (month), dd (day) and any
+// separator (e.g. yyyy-mm-dd, dd/mm/yyyy), or "decimal" for decimal
+// years (e.g. 2019.25). If the format does not contain day (resp. month),
+// the date is an interval over the month (resp. year).
+func ParseDate(s string, formats []string) (d Date, err error) {
+	s = strings.TrimSpace(s)
+	for _, format := range formats {
+		if d, err = parseDateFormat(s, format); err == nil {
+			return
+		}
+	}
+	err = fmt.Errorf("Cannot parse date %q with formats %s", s, strings.Join(formats, ","))
+	return
+}
+
+func parseDateFormat(s, format string) (d Date, err error) {
+	var t time.Time
+	var v float64
+
+	if format == "decimal" {
+		if v, err = strconv.ParseFloat(s, 64); err != nil {
+			return
+		}
+		d = Date{v, v, v}
+		return
+	}
+	if !strings.Contains(format, "yyyy") {
+		err = fmt.Errorf("Date format %s does not contain a year (yyyy)", format)
+		return
+	}
+	layout := strings.Replace(format, "yyyy", "2006", 1)
+	layout = strings.Replace(layout, "mm", "01", 1)
+	layout = strings.Replace(layout, "dd", "02", 1)
+	if t, err = time.Parse(layout, s); err != nil {
+		return
+	}
+	switch {
+	case strings.Contains(format, "dd"):
+		v = DecimalYear(t)
+		d = Date{v, v, v}
+	case strings.Contains(format, "mm"):
+		d.Lower = DecimalYear(t)
+		d.Upper = DecimalYear(t.AddDate(0, 1, 0))
+		d.Value = (d.Lower + d.Upper) / 2.0
+	default:
+		d.Lower = float64(t.Year())
+		d.Upper = float64(t.Year() + 1)
+		d.Value = (d.Lower + d.Upper) / 2.0
+	}
+	return
+}
+
+// Extracts dates from the given tip names, using the regular expression:
+// the date is the first capturing group of the regexp if any, or the
+// whole match otherwise.
+//
+// Returns an error if the regexp does not match a tip name, or if the
+// extracted date can not be parsed.
+func TipDates(names []string, re string, formats []string) (dates map[string]Date, err error) {
+	var r *regexp.Regexp
+	var d Date
+
+	if r, err = regexp.Compile(re); err != nil {
+		return
+	}
+	dates = make(map[string]Date, len(names))
+	for _, name := range names {
+		match := r.FindStringSubmatch(name)
+		if match == nil {
+			err = fmt.Errorf("No date found in tip name %s", name)
+			return
+		}
+		date := match[0]
+		if len(match) > 1 {
+			date = match[1]
+		}
+		if d, err = ParseDate(date, formats); err != nil {
+			return
+		}
+		dates[name] = d
+	}
+	return
+}
+
+// Reads a tab separated date file, with one tip per line:
+//	- tipname<tab>date : the date is parsed with the given formats
+//	- tipname<tab>lower<tab>upper : the date is an interval
+// between the lower bound of lower and the upper bound of upper
+//
+// Empty lines and lines starting with # are ignored.
+func ReadDateFile(file string, formats []string) (dates map[string]Date, err error) {
+	var f goio.Closer
+	var r *bufio.Reader
+	var line string
+	var d, d2 Date
+
+	if f, r, err = utils.GetReader(file); err != nil {
+		return
+	}
+	defer f.Close()
+
+	dates = make(map[string]Date)
+	nl := 0
+	for {
+		line, err = r.ReadString('\n')
+		if err != nil && err != goio.EOF {
+			return
+		}
+		nl++
+		eof := err == goio.EOF
+		err = nil
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" && !strings.HasPrefix(line, "#") {
+			cols := strings.Split(line, "\t")
+			switch len(cols) {
+			case 2:
+				if d, err = ParseDate(cols[1], formats); err != nil {
+					return
+				}
+			case 3:
+				if d, err = ParseDate(cols[1], formats); err != nil {
+					return
+				}
+				if d2, err = ParseDate(cols[2], formats); err != nil {
+					return
+				}
+				d = Date{Lower: d.Lower, Upper: math.Max(d2.Upper, d.Lower)}
+				d.Value = (d.Lower + d.Upper) / 2.0
+			default:
+				err = errors.New("Date file does not have 2 or 3 fields at line: " + fmt.Sprintf("%d", nl))
+				return
+			}
+			dates[cols[0]] = d
+		}
+		if eof {
+			break
+		}
+	}
+	return
+}
+
+// Returns the values of the dates
+func Values(dates map[string]Date) map[string]float64 {
+	values := make(map[string]float64, len(dates))
+	for name, d := range dates {
+		values[name] = d.Value
+	}
+	return values
+}
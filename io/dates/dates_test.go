@@ -0,0 +1,48 @@
+package dates
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		date         string
+		value, lower float64
+		upper        float64
+	}{
+		{"2002-03-15", 2002 + 73.0/365.0, 2002 + 73.0/365.0, 2002 + 73.0/365.0},
+		{"2001-06", 2001 + 166.0/365.0, 2001 + 151.0/365.0, 2001 + 181.0/365.0},
+		{"2004", 2004.5, 2004, 2005},
+		{"2004.25", 2004.25, 2004.25, 2004.25},
+	}
+	for _, test := range tests {
+		d, err := ParseDate(test.date, DefaultFormats)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if math.Abs(d.Value-test.value) > 1e-10 || math.Abs(d.Lower-test.lower) > 1e-10 || math.Abs(d.Upper-test.upper) > 1e-10 {
+			t.Errorf("Date %s should be %f [%f,%f] and is %f [%f,%f]", test.date, test.value, test.lower, test.upper, d.Value, d.Lower, d.Upper)
+		}
+	}
+	if d, err := ParseDate("15/03/2002", []string{"dd/mm/yyyy"}); err != nil || d.Partial() || math.Abs(d.Value-(2002+73.0/365.0)) > 1e-10 {
+		t.Errorf("Wrong date 15/03/2002: %v (%v)", d, err)
+	}
+	if _, err := ParseDate("March 2002", DefaultFormats); err == nil {
+		t.Error("Parsing date \"March 2002\" should return an error")
+	}
+}
+
+func TestTipDates(t *testing.T) {
+	dates, err := TipDates([]string{"A_2000", "B|x|2001-06", "C_x_2002.5"}, DefaultRegexp, DefaultFormats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dates["A_2000"].Value != 2000.5 || !dates["B|x|2001-06"].Partial() || dates["C_x_2002.5"].Value != 2002.5 {
+		t.Errorf("Wrong tip dates: %v", dates)
+	}
+	if _, err = TipDates([]string{"A"}, DefaultRegexp, DefaultFormats); err == nil {
+		t.Error("Tip without date should return an error")
+	}
+}
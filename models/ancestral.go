@@ -0,0 +1,124 @@
+package models
+
+import (
+	"math"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Computes the marginal posterior probabilities of the states of each site of
+// each internal node of the tree, given the alignment of the tips, the branch
+// lengths and the substitution model (empirical Bayes). Invariant sites and
+// gamma categories are integrated out.
+//
+// Returns, for each internal node, a matrix of probabilities [site][state], states
+// being in the order of m.Characters().
+//
+// Returns an error if a tip has no sequence in the alignment, if the alphabet of the
+// alignment is not the alphabet of the model, or if a branch has no length.
+func AncestralProbabilities(t *tree.Tree, al align.Alignment, m *Model) (map[*tree.Node][][]float64, error) {
+	var d *likData
+	var err error
+
+	if err = checkLikelihoodTree(t, false); err != nil {
+		return nil, err
+	}
+	if d, err = newLikData(t, al, m); err != nil {
+		return nil, err
+	}
+	// Partials of all the subtrees (post-order), and transition
+	// probabilities of all the branches, computed once
+	subtrees := make(map[*tree.Node]*partial)
+	if _, err = d.down(t.Root(), nil, m, subtrees); err != nil {
+		return nil, err
+	}
+	pijs := make(map[*tree.Edge][][][]float64)
+	for _, e := range t.Edges() {
+		if pijs[e], err = categoryPij(m, e.Length()); err != nil {
+			return nil, err
+		}
+	}
+	probas := make(map[*tree.Node][][]float64)
+	d.marginalRec(t.Root(), nil, d.initPartial(nil, m), subtrees, pijs, m, probas)
+	return probas, nil
+}
+
+// Computes the marginal probabilities of the states of cur (prev being its parent),
+// given the partial up of the rest of the tree at cur, the partials of the
+// subtrees and the transition probabilities of the branches, and goes down the tree.
+func (d *likData) marginalRec(cur, prev *tree.Node, up *partial, subtrees map[*tree.Node]*partial, pijs map[*tree.Edge][][][]float64, m *Model, probas map[*tree.Node][][]float64) {
+	// Partials of the subtrees of the children, propagated to cur
+	children := make([]*partial, len(cur.Neigh()))
+	for i, next := range cur.Neigh() {
+		if next == prev {
+			continue
+		}
+		children[i] = propagate(subtrees[next], pijs[cur.Edges()[i]])
+	}
+
+	if !cur.Tip() {
+		full := d.initPartial(cur, m)
+		full.multiply(up)
+		for _, c := range children {
+			if c != nil {
+				full.multiply(c)
+			}
+		}
+		probas[cur] = d.sitePosteriors(full, m)
+	}
+
+	for i, next := range cur.Neigh() {
+		if next == prev {
+			continue
+		}
+		rest := d.initPartial(cur, m)
+		rest.multiply(up)
+		for j, c := range children {
+			if j != i && c != nil {
+				rest.multiply(c)
+			}
+		}
+		d.marginalRec(next, cur, propagate(rest, pijs[cur.Edges()[i]]), subtrees, pijs, m, probas)
+	}
+}
+
+// Computes the posterior probabilities of the states of each site, given the
+// partial of the whole tree at a node
+func (d *likData) sitePosteriors(full *partial, m *Model) [][]float64 {
+	pi := m.Pi()
+	ncat := m.NCategories()
+	patterns := make([][]float64, len(d.weights))
+	for pat := range patterns {
+		logp := make([]float64, d.nstates)
+		max := math.Inf(-1)
+		for s := range logp {
+			sum := 0.0
+			for c := 0; c < ncat; c++ {
+				sum += full.v[pat][c][s]
+			}
+			logp[s] = math.Log(sum*pi[s]*(1.0-m.PInv())/float64(ncat)) + full.scale[pat]
+			if m.PInv() > 0 && d.constant[pat][s] {
+				inv := math.Log(m.PInv() * pi[s])
+				mx := math.Max(logp[s], inv)
+				logp[s] = mx + math.Log(math.Exp(logp[s]-mx)+math.Exp(inv-mx))
+			}
+			max = math.Max(max, logp[s])
+		}
+		post := make([]float64, d.nstates)
+		sum := 0.0
+		for s := range post {
+			post[s] = math.Exp(logp[s] - max)
+			sum += post[s]
+		}
+		for s := range post {
+			post[s] /= sum
+		}
+		patterns[pat] = post
+	}
+	sites := make([][]float64, len(d.sites))
+	for i, pat := range d.sites {
+		sites[i] = append([]float64(nil), patterns[pat]...)
+	}
+	return sites
+}
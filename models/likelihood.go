@@ -0,0 +1,587 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"unicode"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/gotree/mutils"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+const (
+	minBrLen        = 1e-8 // Minimum branch length during optimization
+	maxBrLen        = 10.0 // Maximum branch length during optimization
+	defaultBrLen    = 0.1  // Initial length of branches without length
+	likelihoodEps   = 1e-4 // Minimum log-likelihood improvement between two optimization rounds
+	maxBrLenRounds  = 20   // Maximum number of branch length optimization rounds
+	maxModelRounds  = 10   // Maximum number of model/branch length optimization rounds
+	maxNelderMeadIt = 500  // Maximum number of Nelder-Mead iterations
+	maxParam        = 10.0 // Bound of the model parameters (log scale)
+)
+
+// Alignment compressed into site patterns, with the
+// state vectors of the tips of the tree
+type likData struct {
+	nstates  int
+	weights  []float64                  // Number of sites of each pattern
+	tips     map[*tree.Node][][]float64 // [pattern][state]: 1 if the tip character is compatible with the state
+	constant [][]bool                   // [pattern][state]: true if the state is compatible with all the tips
+	sites    []int                      // Pattern of each site
+}
+
+// Conditional likelihoods of a subtree, for each pattern, gamma category
+// and state, with a scaling factor (log) for each pattern
+type partial struct {
+	v     [][][]float64
+	scale []float64
+}
+
+// Computes the log-likelihood of the alignment given the tree (with branch lengths
+// in expected substitutions per site) and the substitution model, using Felsenstein
+// pruning algorithm.
+//
+// Sequences are associated to the tips of the tree by name. Ambiguous characters
+// (IUPAC codes for nucleotides, B, Z, J for amino acids) and gaps (considered as
+// missing data) are taken into account.
+//
+// Returns an error if a tip has no sequence in the alignment, if the alphabet of the
+// alignment is not the alphabet of the model, or if a branch has no length.
+func LogLikelihood(t *tree.Tree, al align.Alignment, m *Model) (float64, error) {
+	var d *likData
+	var err error
+
+	if err = checkLikelihoodTree(t, false); err != nil {
+		return 0, err
+	}
+	if d, err = newLikData(t, al, m); err != nil {
+		return 0, err
+	}
+	return d.logLikelihood(t, m)
+}
+
+// Optimizes the branch lengths of the tree by maximum likelihood, given the
+// alignment and the substitution model. Branch lengths are modified in place.
+// Branches without length are initialized to 0.1 before optimization.
+//
+// Each branch is optimized in turn (Brent method), and rounds of optimization
+// are repeated until the log-likelihood does not improve anymore.
+//
+// Returns the optimized log-likelihood.
+func OptimizeBranchLengths(t *tree.Tree, al align.Alignment, m *Model) (float64, error) {
+	var d *likData
+	var err error
+
+	if err = checkLikelihoodTree(t, true); err != nil {
+		return 0, err
+	}
+	if d, err = newLikData(t, al, m); err != nil {
+		return 0, err
+	}
+	return d.optimizeBranchLengths(t, m)
+}
+
+// Optimizes the branch lengths of the tree (if optbrlen) and the parameters of the
+// model (if optmodel) by maximum likelihood. Branch lengths are modified in place.
+//
+// Optimized parameters are: kappa (K80, HKY), relative rates (GTR, relative to the
+// GT rate), the gamma shape parameter (if m.Alpha() > 0) and the proportion of
+// invariant sites (if m.PInv() > 0). Model parameters (Nelder-Mead) and branch lengths
+// are optimized alternatively until the log-likelihood does not improve anymore.
+//
+// The input model is not modified; returns the optimized model, and the optimized
+// log-likelihood.
+func OptimizeLikelihood(t *tree.Tree, al align.Alignment, m *Model, optbrlen, optmodel bool) (*Model, float64, error) {
+	var d *likData
+	var err error
+	var lnl, newlnl float64
+
+	if err = checkLikelihoodTree(t, optbrlen); err != nil {
+		return nil, 0, err
+	}
+	if d, err = newLikData(t, al, m); err != nil {
+		return nil, 0, err
+	}
+	if lnl, err = d.logLikelihood(t, m); err != nil {
+		return nil, 0, err
+	}
+	params := modelParameters(m)
+	if !optmodel || len(params) == 0 {
+		if optbrlen {
+			lnl, err = d.optimizeBranchLengths(t, m)
+		}
+		return m, lnl, err
+	}
+
+	for round := 0; round < maxModelRounds; round++ {
+		params, _ = mutils.NelderMead(func(x []float64) float64 {
+			var mod *Model
+			var l float64
+			var err2 error
+			if mod, err2 = modelFromParameters(m, x); err2 != nil {
+				return math.Inf(1)
+			}
+			if l, err2 = d.logLikelihood(t, mod); err2 != nil || math.IsNaN(l) {
+				return math.Inf(1)
+			}
+			return -l
+		}, params, 0.5, 1e-6, maxNelderMeadIt)
+		if m, err = modelFromParameters(m, params); err != nil {
+			return nil, 0, err
+		}
+		if optbrlen {
+			newlnl, err = d.optimizeBranchLengths(t, m)
+		} else {
+			newlnl, err = d.logLikelihood(t, m)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if !optbrlen || newlnl-lnl < likelihoodEps {
+			lnl = newlnl
+			break
+		}
+		lnl = newlnl
+	}
+	return m, lnl, nil
+}
+
+// Computes the equilibrium frequencies of the characters of the alignment
+// (in the goalign order: A, C, G, T for nucleotides). Ambiguous characters
+// and gaps are not taken into account, and a pseudo count of 1 is added to
+// each character, so that all the frequencies are > 0.
+func EmpiricalFrequencies(al align.Alignment) ([]float64, error) {
+	chars := al.AlphabetCharacters()
+	index := make(map[rune]int)
+	for i, c := range chars {
+		index[c] = i
+	}
+	counts := make([]float64, len(chars))
+	for i := range counts {
+		counts[i] = 1
+	}
+	al.IterateChar(func(name string, sequence []rune) {
+		for _, c := range sequence {
+			if i, ok := index[unicode.ToUpper(c)]; ok {
+				counts[i]++
+			}
+		}
+	})
+	return normalizeFrequencies(counts, len(chars))
+}
+
+// Checks that all the branches have a length. If setnil is true, branches
+// without length are initialized to defaultBrLen.
+func checkLikelihoodTree(t *tree.Tree, setnil bool) error {
+	for _, e := range t.Edges() {
+		if e.Length() == tree.NIL_LENGTH {
+			if !setnil {
+				return errors.New("Some branches have no length")
+			}
+			e.SetLength(defaultBrLen)
+		}
+	}
+	return nil
+}
+
+// Compresses the alignment into site patterns, and computes the state
+// vectors of the tips of the tree
+func newLikData(t *tree.Tree, al align.Alignment, m *Model) (*likData, error) {
+	if al.Alphabet() != m.Alphabet() {
+		return nil, errors.New("Alphabet of the alignment does not correspond to the alphabet of the model")
+	}
+	tips := t.Tips()
+	seqs := make([][]rune, len(tips))
+	for i, tip := range tips {
+		seq, ok := al.GetSequenceChar(tip.Name())
+		if !ok {
+			return nil, fmt.Errorf("Tip %s has no sequence in the alignment", tip.Name())
+		}
+		seqs[i] = seq
+	}
+
+	d := &likData{nstates: m.NStates(), tips: make(map[*tree.Node][][]float64)}
+	vectors := stateVectors(m)
+	patterns := make(map[string]int)
+	for _, tip := range tips {
+		d.tips[tip] = make([][]float64, 0)
+	}
+	column := make([]rune, len(tips))
+	for site := 0; site < al.Length(); site++ {
+		for i := range tips {
+			column[i] = unicode.ToUpper(seqs[i][site])
+			if _, ok := vectors[column[i]]; !ok {
+				return nil, fmt.Errorf("Unknown character %c in sequence %s", seqs[i][site], tips[i].Name())
+			}
+		}
+		key := string(column)
+		if p, ok := patterns[key]; ok {
+			d.weights[p]++
+			d.sites = append(d.sites, p)
+			continue
+		}
+		patterns[key] = len(d.weights)
+		d.sites = append(d.sites, len(d.weights))
+		d.weights = append(d.weights, 1)
+		for i, tip := range tips {
+			d.tips[tip] = append(d.tips[tip], vectors[column[i]])
+		}
+		// States that may explain the pattern for an invariant site
+		constant := make([]bool, d.nstates)
+		for s := range constant {
+			constant[s] = true
+			for i := range tips {
+				constant[s] = constant[s] && vectors[column[i]][s] > 0
+			}
+		}
+		d.constant = append(d.constant, constant)
+	}
+	return d, nil
+}
+
+// Returns the state vector of each character (IUPAC ambiguity codes for nucleotides)
+func stateVectors(m *Model) map[rune][]float64 {
+	chars := m.Characters()
+	vectors := make(map[rune][]float64)
+	vector := func(states string) []float64 {
+		v := make([]float64, len(chars))
+		for i, c := range chars {
+			for _, s := range states {
+				if c == s {
+					v[i] = 1
+				}
+			}
+		}
+		return v
+	}
+	all := string(chars)
+	for _, c := range chars {
+		vectors[c] = vector(string(c))
+	}
+	var ambiguities map[rune]string
+	if m.Alphabet() == align.NUCLEOTIDS {
+		ambiguities = map[rune]string{
+			'U': "T", 'R': "AG", 'Y': "CT", 'S': "CG", 'W': "AT", 'K': "GT", 'M': "AC",
+			'B': "CGT", 'D': "AGT", 'H': "ACT", 'V': "ACG",
+			'N': all, 'X': all, '-': all, '?': all, '.': all,
+		}
+	} else {
+		ambiguities = map[rune]string{
+			'B': "DN", 'Z': "EQ", 'J': "IL",
+			'X': all, '-': all, '?': all, '*': all, '.': all,
+		}
+	}
+	for c, states := range ambiguities {
+		vectors[c] = vector(states)
+	}
+	return vectors
+}
+
+// Computes the log-likelihood of the tree given the model
+func (d *likData) logLikelihood(t *tree.Tree, m *Model) (float64, error) {
+	root := t.Root()
+	down, err := d.down(root, nil, m, nil)
+	if err != nil {
+		return 0, err
+	}
+	return d.combine(down, nil, m), nil
+}
+
+// Computes the conditional likelihoods of the subtree rooted at cur
+// (prev being its parent), given its descendants. If subtrees is not nil,
+// the partials of all the subtrees below cur are stored in it, by node.
+func (d *likData) down(cur, prev *tree.Node, m *Model, subtrees map[*tree.Node]*partial) (*partial, error) {
+	p := d.initPartial(cur, m)
+	for i, next := range cur.Neigh() {
+		if next == prev {
+			continue
+		}
+		child, err := d.down(next, cur, m, subtrees)
+		if err != nil {
+			return nil, err
+		}
+		probas, err := categoryPij(m, cur.Edges()[i].Length())
+		if err != nil {
+			return nil, err
+		}
+		p.multiply(propagate(child, probas))
+	}
+	if subtrees != nil {
+		subtrees[cur] = p
+	}
+	return p, nil
+}
+
+// Partial of a node without its neighbors: the state vectors for tips,
+// vectors of 1 otherwise
+func (d *likData) initPartial(n *tree.Node, m *Model) *partial {
+	vec, istip := d.tips[n]
+	p := &partial{v: make([][][]float64, len(d.weights)), scale: make([]float64, len(d.weights))}
+	for pat := range p.v {
+		p.v[pat] = make([][]float64, m.NCategories())
+		for c := range p.v[pat] {
+			p.v[pat][c] = make([]float64, d.nstates)
+			for s := range p.v[pat][c] {
+				if istip {
+					p.v[pat][c][s] = vec[pat][s]
+				} else {
+					p.v[pat][c][s] = 1
+				}
+			}
+		}
+	}
+	return p
+}
+
+// Computes the log-likelihood given two partials on both sides of the same
+// point of the tree (b may be nil if a is the partial of the whole tree)
+func (d *likData) combine(a, b *partial, m *Model) float64 {
+	lnl := 0.0
+	pi := m.Pi()
+	ncat := m.NCategories()
+	for pat, w := range d.weights {
+		sum := 0.0
+		for c := 0; c < ncat; c++ {
+			for s := 0; s < d.nstates; s++ {
+				v := a.v[pat][c][s] * pi[s]
+				if b != nil {
+					v *= b.v[pat][c][s]
+				}
+				sum += v
+			}
+		}
+		scale := a.scale[pat]
+		if b != nil {
+			scale += b.scale[pat]
+		}
+		site := math.Log(sum*(1.0-m.PInv())/float64(ncat)) + scale
+		if invariant := d.invariantProba(pat, m); m.PInv() > 0 && invariant > 0 {
+			inv := math.Log(m.PInv() * invariant)
+			max := math.Max(site, inv)
+			site = max + math.Log(math.Exp(site-max)+math.Exp(inv-max))
+		}
+		lnl += w * site
+	}
+	return lnl
+}
+
+// Probability of the pattern for an invariant site
+func (d *likData) invariantProba(pat int, m *Model) float64 {
+	inv := 0.0
+	for s, c := range d.constant[pat] {
+		if c {
+			inv += m.Pi()[s]
+		}
+	}
+	return inv
+}
+
+// Optimizes the branch lengths, round after round, until the
+// log-likelihood does not improve anymore
+func (d *likData) optimizeBranchLengths(t *tree.Tree, m *Model) (lnl float64, err error) {
+	var newlnl float64
+	if lnl, err = d.logLikelihood(t, m); err != nil {
+		return
+	}
+	for round := 0; round < maxBrLenRounds; round++ {
+		// Partials of all the subtrees, computed once per round
+		root := t.Root()
+		subtrees := make(map[*tree.Node]*partial)
+		if _, err = d.down(root, nil, m, subtrees); err != nil {
+			return
+		}
+		up := d.initPartial(nil, m)
+		if _, err = d.optimizeSubtree(root, nil, up, m, subtrees); err != nil {
+			return
+		}
+		if newlnl, err = d.logLikelihood(t, m); err != nil {
+			return
+		}
+		if newlnl-lnl < likelihoodEps {
+			lnl = math.Max(lnl, newlnl)
+			break
+		}
+		lnl = newlnl
+	}
+	return
+}
+
+// Optimizes the lengths of the branches of the subtree rooted at cur (prev
+// being its parent), given the partial up of the rest of the tree at cur, and
+// the partials of the subtrees before optimization (see down). Returns the
+// (updated) partial of the subtree rooted at cur: only the partials of the
+// nodes above the optimized branches are recomputed.
+func (d *likData) optimizeSubtree(cur, prev *tree.Node, up *partial, m *Model, subtrees map[*tree.Node]*partial) (*partial, error) {
+	var err error
+	nb := len(cur.Neigh())
+	// Partials of the subtrees of the children, at the children (downs)
+	// and propagated to cur (children)
+	downs := make([]*partial, nb)
+	children := make([]*partial, nb)
+	for i, next := range cur.Neigh() {
+		if next == prev {
+			continue
+		}
+		var probas [][][]float64
+		downs[i] = subtrees[next]
+		if probas, err = categoryPij(m, cur.Edges()[i].Length()); err != nil {
+			return nil, err
+		}
+		children[i] = propagate(downs[i], probas)
+	}
+
+	for i, next := range cur.Neigh() {
+		if next == prev {
+			continue
+		}
+		e := cur.Edges()[i]
+		// Rest of the tree, seen from cur
+		rest := d.initPartial(cur, m)
+		rest.multiply(up)
+		for j := range children {
+			if j != i && children[j] != nil {
+				rest.multiply(children[j])
+			}
+		}
+		var child *partial
+		var probas [][][]float64
+		l, _ := mutils.BrentMinimize(func(x float64) float64 {
+			pr, err2 := categoryPij(m, x)
+			if err2 != nil {
+				return math.Inf(1)
+			}
+			return -d.combine(rest, propagate(downs[i], pr), m)
+		}, minBrLen, maxBrLen, 1e-6)
+		e.SetLength(l)
+		if probas, err = categoryPij(m, l); err != nil {
+			return nil, err
+		}
+		// Optimizes the subtree of next, with the rest of the tree seen from next
+		if child, err = d.optimizeSubtree(next, cur, propagate(rest, probas), m, subtrees); err != nil {
+			return nil, err
+		}
+		children[i] = propagate(child, probas)
+	}
+
+	p := d.initPartial(cur, m)
+	for j := range children {
+		if children[j] != nil {
+			p.multiply(children[j])
+		}
+	}
+	return p, nil
+}
+
+// Transition probability matrices for each gamma category
+func categoryPij(m *Model, l float64) (probas [][][]float64, err error) {
+	probas = make([][][]float64, m.NCategories())
+	for c := range probas {
+		if probas[c], err = m.Pij(l * m.CategoryRate(c)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Propagates the partial along a branch: out[i] = sum_j P[i][j] in[j]
+func propagate(in *partial, probas [][][]float64) *partial {
+	out := &partial{v: make([][][]float64, len(in.v)), scale: append([]float64(nil), in.scale...)}
+	for pat := range in.v {
+		out.v[pat] = make([][]float64, len(in.v[pat]))
+		for c := range in.v[pat] {
+			out.v[pat][c] = make([]float64, len(in.v[pat][c]))
+			for i := range out.v[pat][c] {
+				sum := 0.0
+				for j, v := range in.v[pat][c] {
+					sum += probas[c][i][j] * v
+				}
+				out.v[pat][c][i] = sum
+			}
+		}
+	}
+	return out
+}
+
+// Multiplies the partial p by the partial other, and rescales
+// the values of each pattern to avoid underflows
+func (p *partial) multiply(other *partial) {
+	for pat := range p.v {
+		max := 0.0
+		for c := range p.v[pat] {
+			for s := range p.v[pat][c] {
+				p.v[pat][c][s] *= other.v[pat][c][s]
+				max = math.Max(max, p.v[pat][c][s])
+			}
+		}
+		p.scale[pat] += other.scale[pat]
+		if max > 0 && max < 1e-50 {
+			for c := range p.v[pat] {
+				for s := range p.v[pat][c] {
+					p.v[pat][c][s] /= max
+				}
+			}
+			p.scale[pat] += math.Log(max)
+		}
+	}
+}
+
+// Free parameters of the model, on a log (logit for pinv) scale
+func modelParameters(m *Model) (params []float64) {
+	switch m.Code() {
+	case MODEL_K80, MODEL_HKY:
+		params = append(params, math.Log(m.Kappa()))
+	case MODEL_GTR:
+		rates := m.GTRRates()
+		gt := math.Max(rates[5], 1e-3)
+		for _, r := range rates[:5] {
+			params = append(params, math.Log(math.Max(r, 1e-3)/gt))
+		}
+	}
+	if m.Alpha() > 0 && m.NCategories() > 1 {
+		params = append(params, math.Log(m.Alpha()))
+	}
+	if m.PInv() > 0 {
+		params = append(params, math.Log(m.PInv()/(1-m.PInv())))
+	}
+	return
+}
+
+// Builds a new model of the same type as m, with the given parameters
+// (see modelParameters). Parameters are bounded to [-maxParam,maxParam].
+func modelFromParameters(m *Model, params []float64) (mod *Model, err error) {
+	var kappa float64
+	var rates []float64
+	i := 0
+	bounded := make([]float64, len(params))
+	for j, p := range params {
+		bounded[j] = math.Max(-maxParam, math.Min(maxParam, p))
+	}
+	params = bounded
+	switch m.Code() {
+	case MODEL_K80, MODEL_HKY:
+		kappa = math.Exp(params[i])
+		i++
+	case MODEL_GTR:
+		rates = make([]float64, 6)
+		for ; i < 5; i++ {
+			rates[i] = math.Exp(params[i])
+		}
+		rates[5] = 1.0
+	}
+	alpha := m.Alpha()
+	if alpha > 0 && m.NCategories() > 1 {
+		alpha = math.Exp(params[i])
+		i++
+	}
+	pinv := m.PInv()
+	if pinv > 0 {
+		pinv = 1.0 / (1.0 + math.Exp(-params[i]))
+	}
+	if mod, err = NewModel(m.Code(), kappa, rates, m.Pi()); err != nil {
+		return
+	}
+	err = mod.SetRateHeterogeneity(alpha, m.NCategories(), pinv)
+	return
+}
@@ -0,0 +1,322 @@
+// Package models provides evolution models (nucleotide and amino acid
+// substitution models, with among site rate heterogeneity, discrete and
+// continuous trait models), and functions to simulate data along trees
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/evolbioinfo/goalign/align"
+	gmodels "github.com/evolbioinfo/goalign/models"
+	"github.com/evolbioinfo/goalign/models/dna"
+	"github.com/evolbioinfo/goalign/models/protein"
+)
+
+// Substitution models
+const (
+	MODEL_JC69 = iota // Jukes-Cantor (nucleotides)
+	MODEL_K80         // Kimura 2 parameters (nucleotides)
+	MODEL_HKY         // Hasegawa-Kishino-Yano (nucleotides)
+	MODEL_GTR         // General time reversible (nucleotides)
+	MODEL_LG          // Le-Gascuel (amino acids)
+	MODEL_WAG         // Whelan-Goldman (amino acids)
+	MODEL_JTT         // Jones-Taylor-Thornton (amino acids)
+)
+
+// A substitution model, normalized such that the mean substitution
+// rate is 1 (branch lengths are in expected substitutions per site),
+// with optional gamma distributed rates across sites (discrete gamma)
+// and invariant sites.
+type Model struct {
+	code     int
+	alphabet int           // align.NUCLEOTIDS or align.AMINOACIDS
+	model    gmodels.Model // Underlying goalign substitution model
+	pi       []float64     // Equilibrium frequencies
+	kappa    float64       // Transition/transversion rate ratio (K80, HKY)
+	gtrrates []float64     // Relative rates AC, AG, AT, CG, CT, GT (GTR)
+	alpha    float64       // Shape of the gamma distribution (<=0: no gamma)
+	ncat     int           // Number of gamma categories
+	pinv     float64       // Proportion of invariant sites
+	rates    []float64     // Rates of the gamma categories (for variable sites)
+}
+
+// Returns the code of the model given its name
+// (jc69, k80, hky, gtr, lg, wag, or jtt).
+// Returns -1 if the model does not exist.
+func ModelStringToInt(model string) int {
+	switch strings.ToLower(model) {
+	case "jc69", "jc":
+		return MODEL_JC69
+	case "k80", "k2p":
+		return MODEL_K80
+	case "hky", "hky85":
+		return MODEL_HKY
+	case "gtr":
+		return MODEL_GTR
+	case "lg":
+		return MODEL_LG
+	case "wag":
+		return MODEL_WAG
+	case "jtt":
+		return MODEL_JTT
+	default:
+		return -1
+	}
+}
+
+// Creates a new substitution model.
+//	* code: One of the MODEL_* constants
+//	* kappa: transition/transversion rate ratio (K80 and HKY only)
+//	* rates: relative substitution rates AC, AG, AT, CG, CT, GT (GTR only).
+//	  If nil, all rates are 1
+//	* pi: Equilibrium frequencies of A, C, G, T (HKY and GTR only).
+//	  If nil, frequencies are equal
+//
+// Amino acid models use their own equilibrium frequencies.
+func NewModel(code int, kappa float64, rates []float64, pi []float64) (m *Model, err error) {
+	m = &Model{code: code, alphabet: align.NUCLEOTIDS, ncat: 1, rates: []float64{1.0}}
+
+	if pi == nil {
+		pi = []float64{0.25, 0.25, 0.25, 0.25}
+	}
+	if rates == nil {
+		rates = []float64{1, 1, 1, 1, 1, 1}
+	}
+
+	switch code {
+	case MODEL_JC69:
+		m.model = dna.NewJCModel()
+		m.pi = []float64{0.25, 0.25, 0.25, 0.25}
+	case MODEL_K80, MODEL_HKY:
+		if kappa <= 0 {
+			return nil, errors.New("Kappa must be > 0")
+		}
+		if code == MODEL_K80 {
+			pi = []float64{0.25, 0.25, 0.25, 0.25}
+		}
+		if m.pi, err = normalizeFrequencies(pi, 4); err != nil {
+			return nil, err
+		}
+		m.kappa = kappa
+		tn93 := dna.NewTN93Model()
+		if err = tn93.InitModel(kappa, kappa, m.pi[0], m.pi[1], m.pi[2], m.pi[3]); err != nil {
+			return nil, err
+		}
+		m.model = tn93
+	case MODEL_GTR:
+		if len(rates) != 6 {
+			return nil, errors.New("GTR model needs 6 relative rates")
+		}
+		for _, r := range rates {
+			if r < 0 {
+				return nil, errors.New("GTR relative rates must be >= 0")
+			}
+		}
+		if m.pi, err = normalizeFrequencies(pi, 4); err != nil {
+			return nil, err
+		}
+		m.gtrrates = append([]float64(nil), rates...)
+		gtr := dna.NewGTRModel()
+		// goalign order: d=AC, f=AG, b=AT, e=CG, a=CT, c=GT
+		if err = gtr.InitModel(rates[0], rates[1], rates[2], rates[3], rates[4], rates[5], m.pi[0], m.pi[1], m.pi[2], m.pi[3]); err != nil {
+			return nil, err
+		}
+		m.model = gtr
+	case MODEL_LG, MODEL_WAG, MODEL_JTT:
+		var prot *protein.ProtModel
+		var protcode int
+		switch code {
+		case MODEL_LG:
+			protcode = protein.MODEL_LG
+		case MODEL_WAG:
+			protcode = protein.MODEL_WAG
+		default:
+			protcode = protein.MODEL_JTT
+		}
+		if prot, err = protein.NewProtModel(protcode, false, 0); err != nil {
+			return nil, err
+		}
+		if err = prot.InitModel(nil); err != nil {
+			return nil, err
+		}
+		m.alphabet = align.AMINOACIDS
+		m.model = prot
+		freqs := make([]float64, prot.NState())
+		for i := range freqs {
+			freqs[i] = prot.Pi(i)
+		}
+		if m.pi, err = normalizeFrequencies(freqs, len(freqs)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unknown substitution model: %d", code)
+	}
+	return m, nil
+}
+
+// Sets among site rate heterogeneity:
+//	* alpha: shape of the gamma distribution of rates (<= 0: no gamma)
+//	* ncat: number of discrete gamma categories
+//	* pinv: proportion of invariant sites
+//
+// Rates of variable sites are scaled such that the mean rate over all
+// the sites is 1.
+func (m *Model) SetRateHeterogeneity(alpha float64, ncat int, pinv float64) error {
+	if pinv < 0 || pinv >= 1 {
+		return errors.New("Proportion of invariant sites must be in [0,1[")
+	}
+	if alpha > 0 && ncat < 1 {
+		return errors.New("Number of gamma categories must be >= 1")
+	}
+	m.alpha = alpha
+	m.pinv = pinv
+	if alpha <= 0 || ncat == 1 {
+		m.ncat = 1
+		m.rates = []float64{1.0}
+	} else {
+		m.ncat = ncat
+		m.rates = gmodels.DiscreteGamma(alpha, ncat)
+	}
+	for i := range m.rates {
+		m.rates[i] /= (1.0 - pinv)
+	}
+	return nil
+}
+
+// Returns the code of the model (MODEL_* constants)
+func (m *Model) Code() int {
+	return m.code
+}
+
+// Returns the alphabet of the model: align.NUCLEOTIDS or align.AMINOACIDS
+func (m *Model) Alphabet() int {
+	return m.alphabet
+}
+
+// Returns the number of states of the model (4 or 20)
+func (m *Model) NStates() int {
+	return len(m.pi)
+}
+
+// Returns the characters corresponding to the states of the model,
+// in the goalign order
+func (m *Model) Characters() []rune {
+	chars := align.NewAlign(m.alphabet).AlphabetCharacters()
+	return append([]rune(nil), chars...)
+}
+
+// Returns the equilibrium frequencies of the states
+func (m *Model) Pi() []float64 {
+	return m.pi
+}
+
+// Returns the number of gamma categories (1 if no gamma)
+func (m *Model) NCategories() int {
+	return m.ncat
+}
+
+// Returns the rate of the given gamma category (scaled by 1/(1-pinv))
+func (m *Model) CategoryRate(cat int) float64 {
+	return m.rates[cat]
+}
+
+// Returns the proportion of invariant sites
+func (m *Model) PInv() float64 {
+	return m.pinv
+}
+
+// Returns the gamma shape parameter (<= 0 if no gamma)
+func (m *Model) Alpha() float64 {
+	return m.alpha
+}
+
+// Returns the transition/transversion rate ratio (K80 and HKY only)
+func (m *Model) Kappa() float64 {
+	return m.kappa
+}
+
+// Returns the relative rates AC, AG, AT, CG, CT, GT (GTR only, nil otherwise)
+func (m *Model) GTRRates() []float64 {
+	return m.gtrrates
+}
+
+// Returns the name of the model
+func (m *Model) Name() string {
+	switch m.code {
+	case MODEL_JC69:
+		return "jc69"
+	case MODEL_K80:
+		return "k80"
+	case MODEL_HKY:
+		return "hky"
+	case MODEL_GTR:
+		return "gtr"
+	case MODEL_LG:
+		return "lg"
+	case MODEL_WAG:
+		return "wag"
+	case MODEL_JTT:
+		return "jtt"
+	default:
+		return "unknown"
+	}
+}
+
+// Returns the number of free parameters of the model (without branch lengths
+// and equilibrium frequencies)
+func (m *Model) NbParams() int {
+	nb := 0
+	switch m.code {
+	case MODEL_K80, MODEL_HKY:
+		nb = 1
+	case MODEL_GTR:
+		nb = 5
+	}
+	if m.alpha > 0 && m.ncat > 1 {
+		nb++
+	}
+	if m.pinv > 0 {
+		nb++
+	}
+	return nb
+}
+
+// Returns the matrix of transition probabilities along a branch
+// of length l: p[i][j] is the probability to be in state j after l,
+// starting from state i.
+func (m *Model) Pij(l float64) (p [][]float64, err error) {
+	var pij *gmodels.Pij
+	ns := m.NStates()
+	if pij, err = gmodels.NewPij(m.model, l); err != nil {
+		return
+	}
+	p = make([][]float64, ns)
+	for i := range p {
+		p[i] = make([]float64, ns)
+		for j := range p[i] {
+			p[i][j] = pij.Pij(i, j)
+		}
+	}
+	return
+}
+
+// Checks the number of frequencies and returns normalized frequencies
+func normalizeFrequencies(freqs []float64, nstates int) ([]float64, error) {
+	if len(freqs) != nstates {
+		return nil, fmt.Errorf("There should be %d state frequencies", nstates)
+	}
+	sum := 0.0
+	for _, f := range freqs {
+		if f <= 0 {
+			return nil, errors.New("State frequencies must be > 0")
+		}
+		sum += f
+	}
+	out := make([]float64, nstates)
+	for i, f := range freqs {
+		out[i] = f / sum
+	}
+	return out, nil
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Simulates an alignment of the given length along the tree, under the given
+// substitution model (seq-gen like).
+//
+// The sequence of the root (pseudo root for unrooted trees) is drawn from the
+// equilibrium frequencies of the model. Each site is invariant with probability
+// m.PInv(), otherwise it is assigned to a random gamma category. Branch lengths
+// are in expected substitutions per site.
+//
+// Returns the alignment of the tips, and if ancestral is true, the alignment of
+// the internal nodes (nil otherwise). In this case, internal nodes of the tree
+// without name are renamed "Node<i>", i being their index in a pre-order
+// traversal of internal nodes. Otherwise, the tree is not modified.
+//
+// Returns an error if a branch has no length or if a tip has no name.
+func SimulateSequences(t *tree.Tree, m *Model, length int, ancestral bool) (tips, internals align.Alignment, err error) {
+	if length <= 0 {
+		return nil, nil, errors.New("Length of the alignment must be > 0")
+	}
+	for _, e := range t.Edges() {
+		if e.Length() == tree.NIL_LENGTH {
+			return nil, nil, errors.New("Some branches have no length")
+		}
+	}
+
+	chars := m.Characters()
+	// Category of each site (-1: invariant)
+	categories := make([]int, length)
+	for i := range categories {
+		if m.PInv() > 0 && rand.Float64() < m.PInv() {
+			categories[i] = -1
+		} else {
+			categories[i] = rand.Intn(m.NCategories())
+		}
+	}
+
+	tips = align.NewAlign(m.Alphabet())
+	if ancestral {
+		internals = align.NewAlign(m.Alphabet())
+		nameInternalNodes(t)
+	}
+	states := make(map[*tree.Node][]int)
+	t.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		seq := make([]int, length)
+		if prev == nil {
+			for i := range seq {
+				seq[i] = sampleState(m.Pi())
+			}
+		} else {
+			// Transition probabilities for each gamma category
+			probas := make([][][]float64, m.NCategories())
+			for c := range probas {
+				if probas[c], err = m.Pij(e.Length() * m.CategoryRate(c)); err != nil {
+					return false
+				}
+			}
+			parent := states[prev]
+			for i := range seq {
+				if categories[i] < 0 {
+					seq[i] = parent[i]
+				} else {
+					seq[i] = sampleState(probas[categories[i]][parent[i]])
+				}
+			}
+		}
+		states[cur] = seq
+
+		runes := make([]rune, length)
+		for i, s := range seq {
+			runes[i] = chars[s]
+		}
+		if cur.Tip() {
+			if cur.Name() == "" {
+				err = errors.New("Some tips have no name")
+				return false
+			}
+			err = tips.AddSequenceChar(cur.Name(), runes, "")
+		} else if ancestral {
+			err = internals.AddSequenceChar(cur.Name(), runes, "")
+		}
+		return err == nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return
+}
+
+// Draws a random state given a vector of probabilities
+func sampleState(probas []float64) int {
+	u := rand.Float64()
+	sum := 0.0
+	for i, p := range probas {
+		sum += p
+		if u < sum {
+			return i
+		}
+	}
+	return len(probas) - 1
+}
+
+// Names internal nodes without name "Node<i>", i being their index
+// in a pre-order traversal of internal nodes
+func nameInternalNodes(t *tree.Tree) {
+	nb := 0
+	t.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		if !cur.Tip() {
+			if cur.Name() == "" {
+				cur.SetName(fmt.Sprintf("Node%d", nb))
+			}
+			nb++
+		}
+		return true
+	})
+}
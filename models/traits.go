@@ -0,0 +1,261 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/evolbioinfo/gotree/tree"
+	"github.com/fredericlemoine/gostats"
+)
+
+// Discrete trait model (Mk model, or more generally any
+// continuous time Markov chain given by its rate matrix).
+type DiscreteModel struct {
+	states []string    // Names of the states
+	q      [][]float64 // Instantaneous rate matrix (rows sum to 0)
+}
+
+// Creates a Mk model with the given states, where all the transition
+// rates between states are equal to rate.
+func NewMkModel(states []string, rate float64) (*DiscreteModel, error) {
+	if rate < 0 {
+		return nil, errors.New("Transition rate must be >= 0")
+	}
+	q := make([][]float64, len(states))
+	for i := range q {
+		q[i] = make([]float64, len(states))
+		for j := range q[i] {
+			if i != j {
+				q[i][j] = rate
+			}
+		}
+	}
+	return NewDiscreteModel(states, q)
+}
+
+// Creates a discrete trait model with the given states and
+// instantaneous transition rates: q[i][j] is the rate from
+// state i to state j. Diagonal values are ignored, and set such
+// that rows sum to 0.
+func NewDiscreteModel(states []string, q [][]float64) (*DiscreteModel, error) {
+	if len(states) < 2 {
+		return nil, errors.New("A discrete model needs at least 2 states")
+	}
+	if len(q) != len(states) {
+		return nil, fmt.Errorf("Rate matrix should have %d rows", len(states))
+	}
+	names := make(map[string]bool)
+	for _, s := range states {
+		if names[s] {
+			return nil, fmt.Errorf("State %s is given several times", s)
+		}
+		names[s] = true
+	}
+	m := &DiscreteModel{states: states, q: make([][]float64, len(states))}
+	for i := range q {
+		if len(q[i]) != len(states) {
+			return nil, fmt.Errorf("Rate matrix should have %d columns", len(states))
+		}
+		m.q[i] = make([]float64, len(states))
+		sum := 0.0
+		for j := range q[i] {
+			if i != j {
+				if q[i][j] < 0 {
+					return nil, errors.New("Transition rates must be >= 0")
+				}
+				m.q[i][j] = q[i][j]
+				sum += q[i][j]
+			}
+		}
+		m.q[i][i] = -sum
+	}
+	return m, nil
+}
+
+// Returns the names of the states of the model
+func (m *DiscreteModel) States() []string {
+	return m.states
+}
+
+// Returns the instantaneous rate matrix of the model
+func (m *DiscreteModel) Q() [][]float64 {
+	return m.q
+}
+
+// Returns the matrix of transition probabilities along a branch
+// of length l: p[i][j] = exp(Ql)[i][j].
+func (m *DiscreteModel) Pij(l float64) [][]float64 {
+	return matrixExp(m.q, l)
+}
+
+// Simulates a discrete trait along the tree under the given model.
+// The state of the root (pseudo root for unrooted trees) is rootstate,
+// or is drawn uniformly if rootstate < 0.
+//
+// Returns the state index (see m.States()) of every node. Internal nodes
+// without name are named "Node<i>", i being their index in a pre-order
+// traversal of internal nodes.
+func SimulateDiscreteTrait(t *tree.Tree, m *DiscreteModel, rootstate int) (map[*tree.Node]int, error) {
+	if rootstate >= len(m.states) {
+		return nil, fmt.Errorf("Root state %d does not exist", rootstate)
+	}
+	if err := checkTraitTree(t); err != nil {
+		return nil, err
+	}
+	nameInternalNodes(t)
+	states := make(map[*tree.Node]int)
+	uniform := make([]float64, len(m.states))
+	for i := range uniform {
+		uniform[i] = 1.0 / float64(len(m.states))
+	}
+	t.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		if prev == nil {
+			if rootstate < 0 {
+				states[cur] = sampleState(uniform)
+			} else {
+				states[cur] = rootstate
+			}
+		} else {
+			states[cur] = sampleState(m.Pij(e.Length())[states[prev]])
+		}
+		return true
+	})
+	return states, nil
+}
+
+// Simulates a continuous trait along the tree under a Brownian motion
+// of rate sigma2, starting from root at the root (pseudo root for
+// unrooted trees).
+//
+// Returns the value of every node. Internal nodes without name are named
+// "Node<i>", i being their index in a pre-order traversal of internal nodes.
+func SimulateBM(t *tree.Tree, root, sigma2 float64) (map[*tree.Node]float64, error) {
+	return SimulateOU(t, root, sigma2, 0, 0)
+}
+
+// Simulates a continuous trait along the tree under an Ornstein-Uhlenbeck
+// process dX = alpha(theta-X)dt + sigma dW, starting from root at the root
+// (pseudo root for unrooted trees). If alpha is 0, it is a Brownian motion.
+//
+// Returns the value of every node. Internal nodes without name are named
+// "Node<i>", i being their index in a pre-order traversal of internal nodes.
+func SimulateOU(t *tree.Tree, root, sigma2, alpha, theta float64) (map[*tree.Node]float64, error) {
+	if sigma2 < 0 {
+		return nil, errors.New("Sigma2 must be >= 0")
+	}
+	if alpha < 0 {
+		return nil, errors.New("Alpha must be >= 0")
+	}
+	if err := checkTraitTree(t); err != nil {
+		return nil, err
+	}
+	nameInternalNodes(t)
+	values := make(map[*tree.Node]float64)
+	t.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		if prev == nil {
+			values[cur] = root
+			return true
+		}
+		l := e.Length()
+		if alpha == 0 {
+			values[cur] = gostats.Normal(values[prev], math.Sqrt(sigma2*l))
+		} else {
+			mean := theta + (values[prev]-theta)*math.Exp(-alpha*l)
+			variance := sigma2 / (2.0 * alpha) * (1.0 - math.Exp(-2.0*alpha*l))
+			values[cur] = gostats.Normal(mean, math.Sqrt(variance))
+		}
+		return true
+	})
+	return values, nil
+}
+
+// Checks that all the branches have a length and all the tips have a name
+func checkTraitTree(t *tree.Tree) error {
+	for _, e := range t.Edges() {
+		if e.Length() == tree.NIL_LENGTH {
+			return errors.New("Some branches have no length")
+		}
+	}
+	for _, tip := range t.Tips() {
+		if tip.Name() == "" {
+			return errors.New("Some tips have no name")
+		}
+	}
+	return nil
+}
+
+// Computes exp(q*l) by scaling and squaring, with a Taylor expansion
+func matrixExp(q [][]float64, l float64) [][]float64 {
+	n := len(q)
+	// Scaling: ||q*l/2^s|| < 0.1
+	norm := 0.0
+	for i := range q {
+		sum := 0.0
+		for j := range q[i] {
+			sum += math.Abs(q[i][j] * l)
+		}
+		norm = math.Max(norm, sum)
+	}
+	s := 0
+	for norm > 0.1 {
+		norm /= 2
+		s++
+	}
+	scale := l / math.Pow(2, float64(s))
+
+	a := make([][]float64, n)
+	res := make([][]float64, n)
+	term := make([][]float64, n)
+	for i := range a {
+		a[i] = make([]float64, n)
+		res[i] = make([]float64, n)
+		term[i] = make([]float64, n)
+		for j := range a[i] {
+			a[i][j] = q[i][j] * scale
+		}
+		res[i][i] = 1
+		term[i][i] = 1
+	}
+	for k := 1; k <= 12; k++ {
+		term = matrixProduct(term, a)
+		for i := range term {
+			for j := range term[i] {
+				term[i][j] /= float64(k)
+				res[i][j] += term[i][j]
+			}
+		}
+	}
+	for ; s > 0; s-- {
+		res = matrixProduct(res, res)
+	}
+	// Removes rounding errors
+	for i := range res {
+		sum := 0.0
+		for j := range res[i] {
+			res[i][j] = math.Max(res[i][j], 0)
+			sum += res[i][j]
+		}
+		for j := range res[i] {
+			res[i][j] /= sum
+		}
+	}
+	return res
+}
+
+func matrixProduct(a, b [][]float64) [][]float64 {
+	n := len(a)
+	out := make([][]float64, n)
+	for i := range out {
+		out[i] = make([]float64, n)
+		for k := 0; k < n; k++ {
+			if a[i][k] == 0 {
+				continue
+			}
+			for j := 0; j < n; j++ {
+				out[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return out
+}
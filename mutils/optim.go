@@ -0,0 +1,177 @@
+package mutils
+
+import (
+	"math"
+	"sort"
+)
+
+// Minimizes the function f on the interval [a,b], using Brent's method
+// (golden section search with parabolic interpolation).
+//
+// Returns the minimum x and f(x). The search stops when the interval is
+// smaller than tol (relative to x), or after 200 iterations.
+func BrentMinimize(f func(float64) float64, a, b, tol float64) (float64, float64) {
+	const cgold = 0.3819660112501051
+	const zeps = 1e-12
+
+	if a > b {
+		a, b = b, a
+	}
+	x := a + cgold*(b-a)
+	w, v := x, x
+	fx := f(x)
+	fw, fv := fx, fx
+	d, e := 0.0, 0.0
+
+	for iter := 0; iter < 200; iter++ {
+		xm := 0.5 * (a + b)
+		tol1 := tol*math.Abs(x) + zeps
+		tol2 := 2.0 * tol1
+		if math.Abs(x-xm) <= tol2-0.5*(b-a) {
+			break
+		}
+		golden := true
+		if math.Abs(e) > tol1 {
+			// Parabolic step
+			r := (x - w) * (fx - fv)
+			q := (x - v) * (fx - fw)
+			p := (x-v)*q - (x-w)*r
+			q = 2.0 * (q - r)
+			if q > 0 {
+				p = -p
+			}
+			q = math.Abs(q)
+			etemp := e
+			e = d
+			if math.Abs(p) < math.Abs(0.5*q*etemp) && p > q*(a-x) && p < q*(b-x) {
+				d = p / q
+				u := x + d
+				if u-a < tol2 || b-u < tol2 {
+					d = math.Copysign(tol1, xm-x)
+				}
+				golden = false
+			}
+		}
+		if golden {
+			if x >= xm {
+				e = a - x
+			} else {
+				e = b - x
+			}
+			d = cgold * e
+		}
+		var u float64
+		if math.Abs(d) >= tol1 {
+			u = x + d
+		} else {
+			u = x + math.Copysign(tol1, d)
+		}
+		fu := f(u)
+		if fu <= fx {
+			if u >= x {
+				a = x
+			} else {
+				b = x
+			}
+			v, w, x = w, x, u
+			fv, fw, fx = fw, fx, fu
+		} else {
+			if u < x {
+				a = u
+			} else {
+				b = u
+			}
+			if fu <= fw || w == x {
+				v, w = w, u
+				fv, fw = fw, fu
+			} else if fu <= fv || v == x || v == w {
+				v = u
+				fv = fu
+			}
+		}
+	}
+	return x, fx
+}
+
+// Minimizes the multivariate function f, using the Nelder-Mead simplex
+// algorithm, starting at x0. The initial simplex is made of x0 and of
+// x0 + step along each dimension.
+//
+// Returns the minimum x and f(x). The search stops when the values of
+// the simplex differ by less than tol, or after maxiter iterations.
+func NelderMead(f func([]float64) float64, x0 []float64, step, tol float64, maxiter int) ([]float64, float64) {
+	n := len(x0)
+	simplex := make([][]float64, n+1)
+	values := make([]float64, n+1)
+	for i := range simplex {
+		simplex[i] = make([]float64, n)
+		copy(simplex[i], x0)
+		if i > 0 {
+			simplex[i][i-1] += step
+		}
+		values[i] = f(simplex[i])
+	}
+	order := make([]int, n+1)
+	centroid := make([]float64, n)
+	point := func(coef float64, worst []float64) []float64 {
+		p := make([]float64, n)
+		for j := range p {
+			p[j] = centroid[j] + coef*(worst[j]-centroid[j])
+		}
+		return p
+	}
+
+	for iter := 0; iter < maxiter; iter++ {
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(i, j int) bool { return values[order[i]] < values[order[j]] })
+		best, worst, second := order[0], order[n], order[n-1]
+		if math.Abs(values[worst]-values[best]) <= tol*(math.Abs(values[best])+tol) {
+			break
+		}
+		for j := range centroid {
+			centroid[j] = 0
+			for _, i := range order[:n] {
+				centroid[j] += simplex[i][j]
+			}
+			centroid[j] /= float64(n)
+		}
+		reflected := point(-1, simplex[worst])
+		fr := f(reflected)
+		switch {
+		case fr < values[best]:
+			expanded := point(-2, simplex[worst])
+			if fe := f(expanded); fe < fr {
+				simplex[worst], values[worst] = expanded, fe
+			} else {
+				simplex[worst], values[worst] = reflected, fr
+			}
+		case fr < values[second]:
+			simplex[worst], values[worst] = reflected, fr
+		default:
+			contracted := point(0.5, simplex[worst])
+			if fr < values[worst] {
+				contracted = point(-0.5, simplex[worst])
+			}
+			if fc := f(contracted); fc < math.Min(fr, values[worst]) {
+				simplex[worst], values[worst] = contracted, fc
+			} else {
+				// Shrink towards the best point
+				for _, i := range order[1:] {
+					for j := range simplex[i] {
+						simplex[i][j] = simplex[best][j] + 0.5*(simplex[i][j]-simplex[best][j])
+					}
+					values[i] = f(simplex[i])
+				}
+			}
+		}
+	}
+	best := 0
+	for i := range values {
+		if values[i] < values[best] {
+			best = i
+		}
+	}
+	return simplex[best], values[best]
+}
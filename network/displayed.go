@@ -0,0 +1,131 @@
+package network
+
+import (
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// A tree displayed by a network, with its weight: product of the
+// inheritance probabilities of the hybrid edges kept to build it
+type DisplayedTree struct {
+	Tree   *tree.Tree
+	Weight float64
+}
+
+// Returns all the trees displayed by the network: for each combination
+// of parent edges of reticulation nodes (one parent per reticulation node),
+// the other parent edges are removed, and the resulting tree is built:
+//	- Nodes having only one child are removed, and the lengths of their
+//	  two adjacent branches are summed (NIL if one of them is NIL);
+//	- Internal nodes without any remaining tip below them are removed.
+//
+// If the inheritance probability of a hybrid edge is not set, then the
+// edge is assigned probability 1/(number of parents of its child).
+//
+// The trees are rooted, and are not necessarily all distinct. Their number
+// is given by NbDisplayedTrees(), which grows exponentially with the number
+// of reticulations.
+func (n *Network) DisplayedTrees() []*DisplayedTree {
+	reticulations := n.Reticulations()
+	// Index of the kept parent edge for each reticulation node
+	choice := make([]int, len(reticulations))
+	kept := make(map[*Node]*Edge)
+	trees := make([]*DisplayedTree, 0, n.NbDisplayedTrees())
+
+	for {
+		weight := 1.0
+		for i, r := range reticulations {
+			e := r.parents[choice[i]]
+			kept[r] = e
+			if e.gamma != NIL_GAMMA {
+				weight *= e.gamma
+			} else {
+				weight *= 1.0 / float64(len(r.parents))
+			}
+		}
+		trees = append(trees, &DisplayedTree{n.displayedTree(kept), weight})
+
+		// Next combination
+		i := 0
+		for ; i < len(reticulations); i++ {
+			choice[i]++
+			if choice[i] < len(reticulations[i].parents) {
+				break
+			}
+			choice[i] = 0
+		}
+		if i == len(reticulations) {
+			break
+		}
+	}
+	return trees
+}
+
+// Builds the tree displayed by the network, keeping only the
+// given parent edge for each reticulation node
+func (n *Network) displayedTree(kept map[*Node]*Edge) *tree.Tree {
+	t := tree.NewTree()
+	root, _, _ := n.displayedSubtree(t, n.root, kept)
+	if root == nil {
+		root = t.NewNode()
+	}
+	t.SetRoot(root)
+	t.UpdateTipIndex()
+	return t
+}
+
+// Builds recursively the subtree of the displayed tree, starting at the given
+// network node. Returns the tree node corresponding to the first node having
+// more than one child (or a tip) below the network node, with the length of
+// the path from the network node to it and the support of the first edge of
+// this path.
+//
+// Returns a nil node if there is no tip below the network node.
+func (n *Network) displayedSubtree(t *tree.Tree, node *Node, kept map[*Node]*Edge) (*tree.Node, float64, float64) {
+	type displayedChild struct {
+		node    *tree.Node
+		length  float64
+		support float64
+	}
+
+	if node.Tip() {
+		tn := t.NewNode()
+		tn.SetName(node.name)
+		return tn, 0, NIL_SUPPORT
+	}
+
+	children := make([]displayedChild, 0, len(node.children))
+	for _, e := range node.children {
+		if e.child.Reticulation() && kept[e.child] != e {
+			continue
+		}
+		cn, l, s := n.displayedSubtree(t, e.child, kept)
+		if cn == nil {
+			continue
+		}
+		if e.length == NIL_LENGTH || l == NIL_LENGTH {
+			l = NIL_LENGTH
+		} else {
+			l += e.length
+		}
+		if e.support != NIL_SUPPORT {
+			s = e.support
+		}
+		children = append(children, displayedChild{cn, l, s})
+	}
+
+	switch len(children) {
+	case 0:
+		return nil, 0, NIL_SUPPORT
+	case 1:
+		return children[0].node, children[0].length, children[0].support
+	}
+
+	tn := t.NewNode()
+	tn.SetName(node.name)
+	for _, c := range children {
+		e := t.ConnectNodes(tn, c.node)
+		e.SetLength(c.length)
+		e.SetSupport(c.support)
+	}
+	return tn, 0, NIL_SUPPORT
+}
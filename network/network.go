@@ -0,0 +1,369 @@
+// Package network implements rooted phylogenetic networks, with
+// reticulation (hybrid) nodes having several parents.
+//
+// Networks are read from and written to the extended Newick format
+// (Cardona et al., 2008), as produced by PhyloNet or SNaQ:
+//	((A,(B)#H1:1::0.3),(#H1:0.5::0.7,C));
+// where each hybrid node is labelled with #<type><id> (e.g. #H1), and
+// appears once per parent. Branch fields are :length:support:gamma,
+// gamma being the inheritance probability of the hybrid edge.
+package network
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const (
+	NIL_LENGTH  = -1.0
+	NIL_SUPPORT = -1.0
+	NIL_GAMMA   = -1.0
+)
+
+// A rooted phylogenetic network
+type Network struct {
+	root  *Node
+	nodes []*Node
+	edges []*Edge
+}
+
+// A node of the network
+type Node struct {
+	id       int
+	name     string   // Name of the node (may be empty)
+	hybrid   string   // Hybrid label without # (e.g. "H1"), empty if not a hybrid node
+	comment  []string // Comments of the node
+	parents  []*Edge  // Edges to the parents of the node
+	children []*Edge  // Edges to the children of the node
+}
+
+// A directed edge of the network (from parent to child)
+type Edge struct {
+	id      int
+	parent  *Node
+	child   *Node
+	length  float64 // Length of the branch, NIL_LENGTH if not set
+	support float64 // Support of the branch, NIL_SUPPORT if not set
+	gamma   float64 // Inheritance probability of hybrid edges, NIL_GAMMA if not set
+}
+
+// Initializes a new empty network
+func NewNetwork() *Network {
+	return &Network{
+		root:  nil,
+		nodes: make([]*Node, 0, 100),
+		edges: make([]*Edge, 0, 100),
+	}
+}
+
+// Creates a new node in the network (not connected)
+func (n *Network) NewNode() *Node {
+	node := &Node{
+		id:       len(n.nodes),
+		comment:  make([]string, 0),
+		parents:  make([]*Edge, 0, 1),
+		children: make([]*Edge, 0, 2),
+	}
+	n.nodes = append(n.nodes, node)
+	return node
+}
+
+// Connects the parent node to the child node with a new edge,
+// and returns the edge.
+func (n *Network) ConnectNodes(parent, child *Node) *Edge {
+	e := &Edge{
+		id:      len(n.edges),
+		parent:  parent,
+		child:   child,
+		length:  NIL_LENGTH,
+		support: NIL_SUPPORT,
+		gamma:   NIL_GAMMA,
+	}
+	parent.children = append(parent.children, e)
+	child.parents = append(child.parents, e)
+	n.edges = append(n.edges, e)
+	return e
+}
+
+// Sets the root of the network
+func (n *Network) SetRoot(r *Node) {
+	n.root = r
+}
+
+// Returns the root of the network
+func (n *Network) Root() *Node {
+	return n.root
+}
+
+// Returns all the nodes of the network
+func (n *Network) Nodes() []*Node {
+	return n.nodes
+}
+
+// Returns all the edges of the network
+func (n *Network) Edges() []*Edge {
+	return n.edges
+}
+
+// Returns the tips of the network (nodes without children)
+func (n *Network) Tips() []*Node {
+	tips := make([]*Node, 0, len(n.nodes))
+	for _, node := range n.nodes {
+		if node.Tip() {
+			tips = append(tips, node)
+		}
+	}
+	return tips
+}
+
+// Returns the reticulation (hybrid) nodes of the network, i.e.
+// nodes having more than one parent.
+func (n *Network) Reticulations() []*Node {
+	ret := make([]*Node, 0)
+	for _, node := range n.nodes {
+		if node.Reticulation() {
+			ret = append(ret, node)
+		}
+	}
+	return ret
+}
+
+// Returns the reticulation number of the network: sum over all
+// the nodes of (number of parents - 1). It is equal to the
+// number of reticulation nodes if they all have exactly 2 parents.
+func (n *Network) ReticulationNumber() int {
+	nb := 0
+	for _, node := range n.nodes {
+		if len(node.parents) > 1 {
+			nb += len(node.parents) - 1
+		}
+	}
+	return nb
+}
+
+// Returns the number of (not necessarily distinct) trees displayed by the
+// network, i.e. the product over all reticulation nodes of their number
+// of parents.
+func (n *Network) NbDisplayedTrees() int {
+	nb := 1
+	for _, node := range n.nodes {
+		if len(node.parents) > 1 {
+			nb *= len(node.parents)
+		}
+	}
+	return nb
+}
+
+// Checks that the network is valid:
+//	- It has a root, without parent;
+//	- Every other node has at least one parent;
+//	- It is acyclic.
+func (n *Network) Check() error {
+	if n.root == nil {
+		return errors.New("The network has no root")
+	}
+	if len(n.root.parents) > 0 {
+		return errors.New("The root of the network has a parent")
+	}
+	for _, node := range n.nodes {
+		if node != n.root && len(node.parents) == 0 {
+			return fmt.Errorf("Node %s is not connected to the network", node.Label())
+		}
+	}
+	// 0: not visited, 1: being visited, 2: done
+	state := make([]int, len(n.nodes))
+	var visit func(node *Node) error
+	visit = func(node *Node) error {
+		state[node.id] = 1
+		for _, e := range node.children {
+			switch state[e.child.id] {
+			case 1:
+				return fmt.Errorf("The network has a cycle going through node %s", e.child.Label())
+			case 0:
+				if err := visit(e.child); err != nil {
+					return err
+				}
+			}
+		}
+		state[node.id] = 2
+		return nil
+	}
+	return visit(n.root)
+}
+
+// Returns the id of the node
+func (node *Node) Id() int {
+	return node.id
+}
+
+// Returns the name of the node
+func (node *Node) Name() string {
+	return node.name
+}
+
+// Sets the name of the node
+func (node *Node) SetName(name string) {
+	node.name = name
+}
+
+// Returns the hybrid label of the node (without #), empty if not set
+func (node *Node) Hybrid() string {
+	return node.hybrid
+}
+
+// Sets the hybrid label of the node (without #)
+func (node *Node) SetHybrid(hybrid string) {
+	node.hybrid = hybrid
+}
+
+// Returns the extended Newick label of the node: name#hybrid
+func (node *Node) Label() string {
+	if node.hybrid != "" {
+		return node.name + "#" + node.hybrid
+	}
+	return node.name
+}
+
+// Adds a comment to the node
+func (node *Node) AddComment(comment string) {
+	node.comment = append(node.comment, comment)
+}
+
+// Returns the comments of the node
+func (node *Node) Comments() []string {
+	return node.comment
+}
+
+// Returns the edges to the parents of the node
+func (node *Node) Parents() []*Edge {
+	return node.parents
+}
+
+// Returns the edges to the children of the node
+func (node *Node) Children() []*Edge {
+	return node.children
+}
+
+// Returns true if the node has no child
+func (node *Node) Tip() bool {
+	return len(node.children) == 0
+}
+
+// Returns true if the node has more than one parent
+func (node *Node) Reticulation() bool {
+	return len(node.parents) > 1
+}
+
+// Returns the id of the edge
+func (e *Edge) Id() int {
+	return e.id
+}
+
+// Returns the parent node of the edge
+func (e *Edge) Parent() *Node {
+	return e.parent
+}
+
+// Returns the child node of the edge
+func (e *Edge) Child() *Node {
+	return e.child
+}
+
+// Returns the length of the edge, NIL_LENGTH if not set
+func (e *Edge) Length() float64 {
+	return e.length
+}
+
+// Sets the length of the edge
+func (e *Edge) SetLength(length float64) {
+	e.length = length
+}
+
+// Returns the support of the edge, NIL_SUPPORT if not set
+func (e *Edge) Support() float64 {
+	return e.support
+}
+
+// Sets the support of the edge
+func (e *Edge) SetSupport(support float64) {
+	e.support = support
+}
+
+// Returns the inheritance probability of the edge, NIL_GAMMA if not set
+func (e *Edge) Gamma() float64 {
+	return e.gamma
+}
+
+// Sets the inheritance probability of the edge
+func (e *Edge) SetGamma(gamma float64) {
+	e.gamma = gamma
+}
+
+// Returns true if the child of the edge is a reticulation node
+func (e *Edge) Hybrid() bool {
+	return e.child.Reticulation()
+}
+
+// Returns the extended Newick representation of the network.
+//
+// The subtree of a hybrid node is written at its first occurrence
+// (depth first traversal), the other occurrences being leaves with
+// the hybrid label only. Inheritance probabilities are written in the
+// third branch field (:length:support:gamma), and so are supports of
+// these edges and of hybrid edges. Other supports are written as internal
+// node labels (as in gotree Newick output) if the node has no name.
+func (n *Network) Newick() string {
+	var buffer bytes.Buffer
+	if n.root == nil {
+		return ";"
+	}
+	visited := make([]bool, len(n.nodes))
+	n.writeNewick(n.root, nil, visited, &buffer)
+	buffer.WriteString(";")
+	return buffer.String()
+}
+
+func (n *Network) writeNewick(node *Node, parent *Edge, visited []bool, buffer *bytes.Buffer) {
+	if !visited[node.id] {
+		visited[node.id] = true
+		if len(node.children) > 0 {
+			buffer.WriteString("(")
+			for i, e := range node.children {
+				if i > 0 {
+					buffer.WriteString(",")
+				}
+				n.writeNewick(e.child, e, visited, buffer)
+			}
+			buffer.WriteString(")")
+		}
+		for _, c := range node.comment {
+			buffer.WriteString("[" + c + "]")
+		}
+	}
+	buffer.WriteString(node.Label())
+	if parent == nil {
+		return
+	}
+	extended := parent.gamma != NIL_GAMMA || (node.hybrid != "" && parent.support != NIL_SUPPORT)
+	if !extended && parent.support != NIL_SUPPORT && node.Label() == "" && len(node.children) > 0 {
+		buffer.WriteString(strconv.FormatFloat(parent.support, 'f', -1, 64))
+	}
+	if parent.length != NIL_LENGTH || extended {
+		buffer.WriteString(":")
+		if parent.length != NIL_LENGTH {
+			buffer.WriteString(strconv.FormatFloat(parent.length, 'f', -1, 64))
+		}
+	}
+	if extended {
+		buffer.WriteString(":")
+		if parent.support != NIL_SUPPORT {
+			buffer.WriteString(strconv.FormatFloat(parent.support, 'f', -1, 64))
+		}
+		buffer.WriteString(":")
+		if parent.gamma != NIL_GAMMA {
+			buffer.WriteString(strconv.FormatFloat(parent.gamma, 'f', -1, 64))
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package network
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseExtendedNewick(t *testing.T) {
+	in := "((A:1,(B:1)#H1:1::0.3):1,(#H1:0.5::0.7,C:1):1);"
+	n, err := NewParser(strings.NewReader(in)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Tips()) != 3 {
+		t.Errorf("Network should have 3 tips and has %d", len(n.Tips()))
+	}
+	if len(n.Reticulations()) != 1 || n.ReticulationNumber() != 1 {
+		t.Errorf("Network should have 1 reticulation and has %d (number %d)", len(n.Reticulations()), n.ReticulationNumber())
+	}
+	h := n.Reticulations()[0]
+	if h.Hybrid() != "H1" || len(h.Children()) != 1 || h.Children()[0].Child().Name() != "B" {
+		t.Errorf("Wrong hybrid node %s", h.Label())
+	}
+	if h.Parents()[0].Gamma() != 0.3 || h.Parents()[1].Gamma() != 0.7 || h.Parents()[1].Length() != 0.5 {
+		t.Errorf("Wrong hybrid edges: gamma=%f,%f, length=%f", h.Parents()[0].Gamma(), h.Parents()[1].Gamma(), h.Parents()[1].Length())
+	}
+	if out := n.Newick(); out != in {
+		t.Errorf("Extended Newick output should be %s and is %s", in, out)
+	}
+}
+
+func TestParseSNaQNetwork(t *testing.T) {
+	// Hybrid node referenced before its definition
+	in := "(C,D,((O,(E,#H7:::0.196):0.314):0.664,(((A1,A2),(B1,B2)):1.5)#H7:::0.804):10.0);"
+	n, err := NewParser(strings.NewReader(in)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Tips()) != 8 {
+		t.Errorf("Network should have 8 tips and has %d", len(n.Tips()))
+	}
+	if n.NbDisplayedTrees() != 2 {
+		t.Errorf("Network should display 2 trees and displays %d", n.NbDisplayedTrees())
+	}
+	// Writing and parsing again gives the same network
+	n2, err := NewParser(strings.NewReader(n.Newick())).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n2.Newick() != n.Newick() || len(n2.Edges()) != len(n.Edges()) {
+		t.Errorf("Networks should be identical: %s vs. %s", n.Newick(), n2.Newick())
+	}
+}
+
+func TestParseExtendedNewickErrors(t *testing.T) {
+	for _, in := range []string{
+		"((A,#H1),B);",             // Hybrid node with one parent
+		"((#H1,A)#H1,B);",          // Cycle
+		"(((A)#H1,B),((C)#H1,D));", // Hybrid children given twice
+		"((A,B)#,C);",              // Empty hybrid label
+		"((A,B):1:2:3:4,C);",       // Too many branch fields
+	} {
+		if _, err := NewParser(strings.NewReader(in)).Parse(); err == nil {
+			t.Errorf("Parsing %s should return an error", in)
+		}
+	}
+}
+
+func TestDisplayedTrees(t *testing.T) {
+	in := "((A:1,(B:1)#H1:1::0.3):1,(#H1:0.5::0.7,C:1):1);"
+	n, err := NewParser(strings.NewReader(in)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"((A:1,B:2):1,C:2);",
+		"(A:2,(B:1.5,C:1):1);",
+	}
+	weights := []float64{0.3, 0.7}
+	trees := n.DisplayedTrees()
+	if len(trees) != len(expected) {
+		t.Fatalf("There should be %d displayed trees and there are %d", len(expected), len(trees))
+	}
+	for i, dt := range trees {
+		if dt.Tree.Newick() != expected[i] {
+			t.Errorf("Displayed tree %d should be %s and is %s", i, expected[i], dt.Tree.Newick())
+		}
+		if dt.Weight != weights[i] {
+			t.Errorf("Weight of displayed tree %d should be %f and is %f", i, weights[i], dt.Weight)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package network
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/io/fileutils"
+	"github.com/evolbioinfo/gotree/io/newick"
+)
+
+// Type for channel of networks
+type Networks struct {
+	Network *Network
+	Id      int
+	Err     error
+}
+
+// Parser of extended Newick strings. It uses
+// the Newick scanner of gotree.
+type Parser struct {
+	s   *newick.Scanner
+	buf struct {
+		tok newick.Token // last read token
+		lit string       // last read literal
+		n   int          // buffer size (max=1)
+	}
+}
+
+// Temporary structure storing a parsed subtree, before
+// hybrid nodes are merged
+type parsedNode struct {
+	name     string
+	hybrid   string
+	comments []string
+	children []*parsedNode
+	length   float64
+	support  float64
+	gamma    float64
+}
+
+// NewParser returns a new instance of Parser.
+func NewParser(r io.Reader) *Parser {
+	return &Parser{s: newick.NewScanner(r)}
+}
+
+// scan returns the next token from the underlying scanner.
+// If a token has been unscanned then read that instead.
+func (p *Parser) scan() (tok newick.Token, lit string) {
+	if p.buf.n != 0 {
+		p.buf.n = 0
+		return p.buf.tok, p.buf.lit
+	}
+	tok, lit = p.s.Scan()
+	p.buf.tok, p.buf.lit = tok, lit
+	return
+}
+
+// unscan pushes the previously read token back onto the buffer.
+func (p *Parser) unscan() { p.buf.n = 1 }
+
+// scanIgnoreWhitespace scans the next non-whitespace token.
+func (p *Parser) scanIgnoreWhitespace() (tok newick.Token, lit string) {
+	tok, lit = p.scan()
+	if tok == newick.WS {
+		tok, lit = p.scan()
+	}
+	return
+}
+
+// Parses an extended Newick string.
+//
+// Each hybrid node may appear several times (once per parent), but its
+// children must be given in only one of its occurrences. Returns an
+// error if a hybrid node appears only once, or if the resulting network
+// is not valid (e.g. has a cycle).
+func (p *Parser) Parse() (*Network, error) {
+	var err error
+	var root *parsedNode
+
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != newick.OPENPAR {
+		return nil, fmt.Errorf("found %q, expected (", lit)
+	}
+	p.unscan()
+	if root, err = p.parseSubtree(); err != nil {
+		return nil, err
+	}
+	tok, lit = p.scanIgnoreWhitespace()
+	if tok != newick.EOT {
+		return nil, fmt.Errorf("found %q, expected ;", lit)
+	}
+
+	n := NewNetwork()
+	hybrids := make(map[string]*Node)
+	defined := make(map[string]bool)
+	var r *Node
+	if r, err = n.buildNode(root, hybrids, defined); err != nil {
+		return nil, err
+	}
+	n.SetRoot(r)
+	for h, node := range hybrids {
+		if len(node.parents) < 2 {
+			return nil, fmt.Errorf("Hybrid node #%s has only one parent", h)
+		}
+	}
+	if err = n.Check(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Parses a subtree: (children)label[comment]:length:support:gamma
+func (p *Parser) parseSubtree() (pn *parsedNode, err error) {
+	var child *parsedNode
+	var comment string
+	var val float64
+
+	pn = &parsedNode{
+		length:  NIL_LENGTH,
+		support: NIL_SUPPORT,
+		gamma:   NIL_GAMMA,
+	}
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok == newick.OPENPAR {
+		for {
+			if child, err = p.parseSubtree(); err != nil {
+				return
+			}
+			pn.children = append(pn.children, child)
+			tok, lit = p.scanIgnoreWhitespace()
+			if tok == newick.CLOSEPAR {
+				break
+			} else if tok != newick.NEWSIBLING {
+				err = fmt.Errorf("Extended Newick Error: found %q, expected , or )", lit)
+				return
+			}
+		}
+		tok, lit = p.scanIgnoreWhitespace()
+	}
+
+	if tok == newick.IDENT || tok == newick.NUMERIC {
+		label := strings.TrimSpace(lit)
+		if idx := strings.Index(label, "#"); idx >= 0 {
+			pn.name = label[:idx]
+			pn.hybrid = label[idx+1:]
+			if pn.hybrid == "" {
+				err = errors.New("Extended Newick Error: empty hybrid label: " + label)
+				return
+			}
+		} else if tok == newick.NUMERIC && len(pn.children) > 0 {
+			// Support value, as in standard Newick
+			pn.support, _ = strconv.ParseFloat(label, 64)
+		} else {
+			pn.name = label
+		}
+		tok, lit = p.scanIgnoreWhitespace()
+	}
+
+	field := 0
+	for tok == newick.OPENBRACK || tok == newick.STARTLEN {
+		if tok == newick.OPENBRACK {
+			if comment, err = p.consumeComment(tok, lit); err != nil {
+				return
+			}
+			pn.comments = append(pn.comments, comment)
+			tok, lit = p.scanIgnoreWhitespace()
+			continue
+		}
+		field++
+		if field > 3 {
+			err = errors.New("Extended Newick Error: more than 3 branch fields (length:support:gamma)")
+			return
+		}
+		tok, lit = p.scanIgnoreWhitespace()
+		if tok == newick.NUMERIC {
+			if val, err = strconv.ParseFloat(lit, 64); err != nil {
+				return
+			}
+			switch field {
+			case 1:
+				pn.length = val
+			case 2:
+				pn.support = val
+			case 3:
+				pn.gamma = val
+			}
+			tok, lit = p.scanIgnoreWhitespace()
+		} else if tok == newick.IDENT {
+			err = errors.New("Extended Newick Error: branch field is not a float value: " + lit)
+			return
+		}
+	}
+	p.unscan()
+	return
+}
+
+// Consumes comment inside brakets [comment] if the given current token is a [.
+// If the given token is not a [, then returns an error
+func (p *Parser) consumeComment(curtoken newick.Token, curlit string) (comment string, err error) {
+	if curtoken == newick.OPENBRACK {
+		commenttoken, commentlit := p.scanIgnoreWhitespace()
+		for commenttoken != newick.CLOSEBRACK {
+			if commenttoken == newick.EOF || commenttoken == newick.ILLEGAL {
+				err = fmt.Errorf("Unmatched bracket")
+				return
+			} else {
+				comment += commentlit
+			}
+			commenttoken, commentlit = p.scanIgnoreWhitespace()
+		}
+	} else {
+		err = fmt.Errorf("A comment must start with [")
+	}
+	return
+}
+
+// Builds the network nodes corresponding to the parsed subtree.
+// All the occurrences of a hybrid node are merged into the same node.
+func (n *Network) buildNode(pn *parsedNode, hybrids map[string]*Node, defined map[string]bool) (node *Node, err error) {
+	var child *Node
+	var ok bool
+
+	if pn.hybrid != "" {
+		if node, ok = hybrids[pn.hybrid]; !ok {
+			node = n.NewNode()
+			node.SetHybrid(pn.hybrid)
+			hybrids[pn.hybrid] = node
+		}
+		if pn.name != "" {
+			if node.name != "" && node.name != pn.name {
+				return nil, fmt.Errorf("Hybrid node #%s has two different names: %s and %s", pn.hybrid, node.name, pn.name)
+			}
+			node.SetName(pn.name)
+		}
+		if len(pn.children) > 0 {
+			if defined[pn.hybrid] {
+				return nil, fmt.Errorf("Children of hybrid node #%s are given twice", pn.hybrid)
+			}
+			defined[pn.hybrid] = true
+		}
+	} else {
+		node = n.NewNode()
+		node.SetName(pn.name)
+	}
+	for _, c := range pn.comments {
+		node.AddComment(c)
+	}
+
+	for _, pc := range pn.children {
+		if child, err = n.buildNode(pc, hybrids, defined); err != nil {
+			return
+		}
+		e := n.ConnectNodes(node, child)
+		e.SetLength(pc.length)
+		e.SetSupport(pc.support)
+		e.SetGamma(pc.gamma)
+	}
+	return
+}
+
+// Reads several networks in extended Newick format from the
+// given reader (separated by ;), and sends them through the channel.
+//
+// Stops at the first error.
+func ReadNetworks(reader *bufio.Reader) <-chan Networks {
+	var networks chan Networks = make(chan Networks, 10)
+
+	go func() {
+		var id int = 0
+		var net *Network
+		var err error
+
+		line, e := fileutils.ReadUntilSemiColon(reader)
+		for e == nil {
+			if net, err = NewParser(strings.NewReader(line)).Parse(); err != nil {
+				networks <- Networks{nil, id, err}
+				break
+			}
+			networks <- Networks{net, id, nil}
+			id++
+			line, e = fileutils.ReadUntilSemiColon(reader)
+		}
+		close(networks)
+	}()
+
+	return networks
+}
@@ -0,0 +1,254 @@
+// Package parsimony provides functions to score trees under the Fitch
+// parsimony criterion, and to search for maximum parsimony trees
+package parsimony
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"unicode"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Alignment data used to compute parsimony scores: each character of each
+// taxon is coded by the set of its possible states (bit i for state i).
+// Identical sites are compressed into weighted patterns, and constant sites
+// (that do not change the score of any tree) are removed.
+type data struct {
+	names   []string   // Names of the taxa
+	tips    [][]uint32 // State sets [taxon][pattern]
+	weights []int      // Number of sites of each pattern
+	nstates int        // Number of states of the alphabet
+}
+
+// Returns the state set of each character (IUPAC ambiguity codes for nucleotides,
+// B, Z, J for amino acids). Gaps and unknown characters have all states.
+func stateSets(al align.Alignment) map[rune]uint32 {
+	chars := al.AlphabetCharacters()
+	sets := make(map[rune]uint32)
+	set := func(states string) (s uint32) {
+		for i, c := range chars {
+			for _, st := range states {
+				if c == st {
+					s |= 1 << uint(i)
+				}
+			}
+		}
+		return
+	}
+	for _, c := range chars {
+		sets[c] = set(string(c))
+	}
+	var ambiguities map[rune]string
+	if al.Alphabet() == align.NUCLEOTIDS {
+		ambiguities = map[rune]string{
+			'U': "T", 'R': "AG", 'Y': "CT", 'S': "CG", 'W': "AT", 'K': "GT", 'M': "AC",
+			'B': "CGT", 'D': "AGT", 'H': "ACT", 'V': "ACG",
+		}
+	} else {
+		ambiguities = map[rune]string{'B': "DN", 'Z': "EQ", 'J': "IL"}
+	}
+	for c, states := range ambiguities {
+		sets[c] = set(states)
+	}
+	return sets
+}
+
+// Builds the parsimony data of the alignment. If t is not nil, only the
+// sequences of the tips of t are considered (patterns, constant sites, M and G).
+//
+// Returns an error if a tip of t has no sequence in the alignment.
+func newData(al align.Alignment, t *tree.Tree) (*data, error) {
+	if al.Alphabet() != align.NUCLEOTIDS && al.Alphabet() != align.AMINOACIDS {
+		return nil, errors.New("Alphabet of the alignment must be nucleotides or amino acids")
+	}
+	sets := stateSets(al)
+	nstates := len(al.AlphabetCharacters())
+	all := uint32(1)<<uint(nstates) - 1
+
+	d := &data{
+		names:   make([]string, 0, al.NbSequences()),
+		weights: make([]int, 0),
+		nstates: nstates,
+	}
+	seqs := make([][]rune, 0, al.NbSequences())
+	if t == nil {
+		al.IterateChar(func(name string, seq []rune) {
+			d.names = append(d.names, name)
+			seqs = append(seqs, seq)
+		})
+	} else {
+		for _, tip := range t.Tips() {
+			seq, ok := al.GetSequenceChar(tip.Name())
+			if !ok {
+				return nil, fmt.Errorf("Tip %s has no sequence in the alignment", tip.Name())
+			}
+			d.names = append(d.names, tip.Name())
+			seqs = append(seqs, seq)
+		}
+	}
+	if len(seqs) < 3 {
+		return nil, fmt.Errorf("At least 3 sequences are needed, %d given", len(seqs))
+	}
+	d.tips = make([][]uint32, len(seqs))
+
+	patterns := make(map[string]int)
+	column := make([]uint32, len(seqs))
+	for site := 0; site < al.Length(); site++ {
+		common := all
+		for i, seq := range seqs {
+			s, ok := sets[unicode.ToUpper(seq[site])]
+			if !ok {
+				s = all
+			}
+			column[i] = s
+			common &= s
+		}
+		if common != 0 {
+			// Constant site
+			continue
+		}
+		key := fmt.Sprint(column)
+		if p, ok := patterns[key]; ok {
+			d.weights[p]++
+			continue
+		}
+		patterns[key] = len(d.weights)
+		d.weights = append(d.weights, 1)
+		for i := range seqs {
+			d.tips[i] = append(d.tips[i], column[i])
+		}
+	}
+	return d, nil
+}
+
+// Combines two state sets (Fitch): intersection if not empty, union otherwise.
+// Returns the cost of the combination (weighted number of unions).
+func (d *data) fitch(a, b, res []uint32) (cost int) {
+	for p := range res {
+		if i := a[p] & b[p]; i != 0 {
+			res[p] = i
+		} else {
+			res[p] = a[p] | b[p]
+			cost += d.weights[p]
+		}
+	}
+	return
+}
+
+// Returns the minimum (m) and maximum (g) possible numbers of changes of the
+// data on any tree, used for consistency and retention indices. Only unambiguous
+// characters are considered.
+func (d *data) minMaxChanges() (m, g int) {
+	counts := make([]int, d.nstates)
+	for p, w := range d.weights {
+		for s := range counts {
+			counts[s] = 0
+		}
+		for _, tip := range d.tips {
+			for s := range counts {
+				if tip[p] == 1<<uint(s) {
+					counts[s]++
+				}
+			}
+		}
+		distinct, total, max := 0, 0, 0
+		for _, c := range counts {
+			if c > 0 {
+				distinct++
+			}
+			total += c
+			if c > max {
+				max = c
+			}
+		}
+		if distinct > 0 {
+			m += w * (distinct - 1)
+		}
+		g += w * (total - max)
+	}
+	return
+}
+
+// Returns the consistency index (CI=M/S) and retention index (RI=(G-S)/(G-M)) of a
+// tree of the given parsimony score (S, see Score), M and G being the minimum and
+// maximum possible numbers of changes of the sequences of the tips of the tree on
+// any tree (only unambiguous characters are considered for M and G). Indices that
+// are not defined (S=0 or G=M) are NaN.
+//
+// Returns an error if a tip has no sequence in the alignment.
+func Indices(t *tree.Tree, al align.Alignment, score int) (ci, ri float64, err error) {
+	var d *data
+	if d, err = newData(al, t); err != nil {
+		return
+	}
+	m, g := d.minMaxChanges()
+	ci, ri = indices(m, g, score)
+	return
+}
+
+// Computes consistency and retention indices given M, G and S
+func indices(m, g, score int) (ci, ri float64) {
+	ci, ri = math.NaN(), math.NaN()
+	if score > 0 {
+		ci = float64(m) / float64(score)
+	}
+	if g > m {
+		ri = float64(g-score) / float64(g-m)
+	}
+	return
+}
+
+// Computes the Fitch parsimony score of the alignment on the tree (binary, rooted
+// or unrooted). Sequences are associated to the tips of the tree by name (other
+// sequences of the alignment are ignored). Ambiguous
+// characters (IUPAC codes for nucleotides, B, Z, J for amino acids) are considered
+// as sets of states, and gaps as missing data.
+//
+// Returns an error if a tip has no sequence in the alignment, or if the tree has
+// multifurcations.
+func Score(t *tree.Tree, al align.Alignment) (int, error) {
+	var d *data
+	var err error
+
+	for _, n := range t.Nodes() {
+		if len(n.Neigh()) > 3 {
+			return 0, fmt.Errorf("The tree must be binary")
+		}
+	}
+	if d, err = newData(al, t); err != nil {
+		return 0, err
+	}
+	index := make(map[string]int)
+	for i, n := range d.names {
+		index[n] = i
+	}
+	_, score := d.scoreRec(t.Root(), nil, index)
+	return score, nil
+}
+
+// Computes the state sets and the score of the subtree rooted at cur (prev being its parent)
+func (d *data) scoreRec(cur, prev *tree.Node, index map[string]int) (sets []uint32, score int) {
+	if cur.Tip() && prev != nil {
+		return d.tips[index[cur.Name()]], 0
+	}
+	for _, next := range cur.Neigh() {
+		if next == prev {
+			continue
+		}
+		s, sc := d.scoreRec(next, cur, index)
+		score += sc
+		if sets == nil {
+			sets = append([]uint32(nil), s...)
+		} else {
+			score += d.fitch(sets, s, sets)
+		}
+	}
+	if cur.Tip() {
+		// Tip root
+		score += d.fitch(sets, d.tips[index[cur.Name()]], sets)
+	}
+	return
+}
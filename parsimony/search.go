@@ -0,0 +1,393 @@
+package parsimony
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+const (
+	SEARCH_NONE = iota // Stepwise addition only
+	SEARCH_NNI         // Stepwise addition + NNI hill-climbing
+	SEARCH_SPR         // Stepwise addition + SPR hill-climbing
+)
+
+// Result of a maximum parsimony search replicate
+type Result struct {
+	Replicate int        // Index of the replicate
+	Tree      *tree.Tree // Most parsimonious tree found (unrooted, without branch lengths)
+	Score     int        // Parsimony score of the tree
+	CI        float64    // Consistency index (NaN if not defined)
+	RI        float64    // Retention index (NaN if not defined)
+}
+
+// Unrooted binary tree used during the search. Nodes 0..ntips-1 are the tips
+// (in the order of data.names), and the next ones are internal nodes.
+// Nodes that are not (yet) in the tree have no neighbor.
+type searchTree struct {
+	d    *data
+	adj  [][]int    // Neighbors of each node
+	par  []int      // Parent of each node, from the root tip (-1 for the root tip)
+	dn   [][]uint32 // State sets of the subtree of each node (from its parent)
+	up   [][]uint32 // State sets of the rest of the tree, seen from each node
+	edge []uint32   // Temporary state sets of an edge
+	root int        // Tip from which the tree is traversed
+	rng  *rand.Rand // Random generator of the replicate
+}
+
+func newSearchTree(d *data, rng *rand.Rand) *searchTree {
+	ntips := len(d.names)
+	nnodes := 2*ntips - 2
+	t := &searchTree{
+		d:    d,
+		adj:  make([][]int, nnodes),
+		par:  make([]int, nnodes),
+		dn:   make([][]uint32, nnodes),
+		up:   make([][]uint32, nnodes),
+		edge: make([]uint32, len(d.weights)),
+		rng:  rng,
+	}
+	for i := range t.adj {
+		t.par[i] = -1
+		t.adj[i] = make([]int, 0, 3)
+		t.dn[i] = make([]uint32, len(d.weights))
+		t.up[i] = make([]uint32, len(d.weights))
+	}
+	for i, tip := range d.tips {
+		copy(t.dn[i], tip)
+	}
+	return t
+}
+
+func (t *searchTree) connect(a, b int) {
+	t.adj[a] = append(t.adj[a], b)
+	t.adj[b] = append(t.adj[b], a)
+}
+
+// Replaces neighbor old of node n by new
+func (t *searchTree) replace(n, old, new int) {
+	for i, m := range t.adj[n] {
+		if m == old {
+			t.adj[n][i] = new
+			return
+		}
+	}
+}
+
+// Computes down state sets (and parents) of the subtree rooted at cur (prev being
+// its parent), and returns its score
+func (t *searchTree) down(cur, prev int) (score int) {
+	t.par[cur] = prev
+	if len(t.adj[cur]) == 1 {
+		return 0
+	}
+	first := true
+	for _, next := range t.adj[cur] {
+		if next == prev {
+			continue
+		}
+		score += t.down(next, cur)
+		if first {
+			copy(t.dn[cur], t.dn[next])
+			first = false
+		} else {
+			score += t.d.fitch(t.dn[cur], t.dn[next], t.dn[cur])
+		}
+	}
+	return
+}
+
+// Computes up state sets of the nodes of the subtree rooted at cur (prev being its parent)
+func (t *searchTree) upRec(cur, prev int) {
+	if len(t.adj[cur]) == 1 {
+		return
+	}
+	for _, next := range t.adj[cur] {
+		if next == prev {
+			continue
+		}
+		copy(t.up[next], t.up[cur])
+		for _, other := range t.adj[cur] {
+			if other != prev && other != next {
+				t.d.fitch(t.up[next], t.dn[other], t.up[next])
+			}
+		}
+		t.upRec(next, cur)
+	}
+}
+
+// Computes the down and up state sets (and parents) of all the nodes connected to
+// the root tip, and returns the score of the tree
+func (t *searchTree) sets() int {
+	first := t.adj[t.root][0]
+	score := t.down(first, t.root)
+	copy(t.up[first], t.dn[t.root])
+	t.upRec(first, t.root)
+	return score + t.d.fitch(t.dn[first], t.dn[t.root], t.edge)
+}
+
+// Computes the score of the tree
+func (t *searchTree) score() int {
+	first := t.adj[t.root][0]
+	return t.down(first, t.root) + t.d.fitch(t.dn[first], t.dn[t.root], t.edge)
+}
+
+// Returns the edges of the tree (as [parent, child] from the root tip)
+func (t *searchTree) edges() (edges [][2]int) {
+	var rec func(cur, prev int)
+	rec = func(cur, prev int) {
+		edges = append(edges, [2]int{prev, cur})
+		for _, next := range t.adj[cur] {
+			if next != prev {
+				rec(next, cur)
+			}
+		}
+	}
+	rec(t.adj[t.root][0], t.root)
+	return
+}
+
+// Returns the cost of inserting a subtree of state sets s on the edge
+// parent->child (sets() must have been called before)
+func (t *searchTree) insertionCost(s []uint32, child int) (cost int) {
+	for p, w := range t.d.weights {
+		a, b := t.dn[child][p], t.up[child][p]
+		x := a & b
+		if x == 0 {
+			x = a | b
+		}
+		if x&s[p] == 0 {
+			cost += w
+		}
+	}
+	return
+}
+
+// Returns the edge on which the insertion of a subtree of state sets s costs the
+// least (ties are broken randomly), and its cost
+func (t *searchTree) bestInsertion(s []uint32, edges [][2]int) (best [2]int, bestcost int) {
+	nties := 0
+	bestcost = -1
+	for _, e := range edges {
+		cost := t.insertionCost(s, e[1])
+		if bestcost < 0 || cost < bestcost {
+			best, bestcost, nties = e, cost, 1
+		} else if cost == bestcost {
+			nties++
+			if t.rng.Intn(nties) == 0 {
+				best = e
+			}
+		}
+	}
+	return
+}
+
+// Inserts node n (connected to internal node k if k >= 0) on edge e,
+// through the internal node k, and updates their parents
+func (t *searchTree) insert(n, k int, e [2]int) {
+	t.replace(e[0], e[1], k)
+	t.replace(e[1], e[0], k)
+	t.adj[k] = append(t.adj[k], e[0], e[1])
+	t.par[k], t.par[e[1]] = e[0], k
+	if n >= 0 {
+		t.connect(k, n)
+		t.par[n] = k
+	}
+}
+
+// Builds the starting tree by stepwise addition of the taxa in random order
+func (t *searchTree) stepwiseAddition() {
+	ntips := len(t.d.names)
+	order := t.rng.Perm(ntips)
+	t.root = order[0]
+	k := ntips
+	t.connect(k, order[0])
+	t.connect(k, order[1])
+	t.connect(k, order[2])
+	t.par[k], t.par[order[1]], t.par[order[2]] = order[0], k, k
+	k++
+	for _, n := range order[3:] {
+		t.sets()
+		e, _ := t.bestInsertion(t.dn[n], t.edges())
+		t.insert(n, k, e)
+		k++
+	}
+}
+
+// One round of SPR moves: each subtree is pruned and regrafted on the edge that
+// minimizes the score, if it improves it. Returns true if the score has been improved.
+func (t *searchTree) sprRound() (improved bool) {
+	for u := len(t.d.names); u < len(t.adj); u++ {
+		for i := 0; i < 3; i++ {
+			s := t.adj[u][i]
+			// The subtree containing the root tip is not pruned
+			if t.par[u] == s {
+				continue
+			}
+			a, b := t.adj[u][(i+1)%3], t.adj[u][(i+2)%3]
+			// Subtree s
+			t.down(s, u)
+			// Pruning
+			t.replace(a, u, b)
+			t.replace(b, u, a)
+			t.adj[u] = t.adj[u][:0]
+			t.adj[u] = append(t.adj[u], s)
+			t.sets()
+			edges := t.edges()
+			current := [2]int{a, b}
+			if t.par[a] == b {
+				current = [2]int{b, a}
+			}
+			curcost := t.insertionCost(t.dn[s], current[1])
+			best, bestcost := t.bestInsertion(t.dn[s], edges)
+			if bestcost >= curcost {
+				best = current
+			} else {
+				improved = true
+			}
+			t.adj[u] = t.adj[u][:1]
+			t.insert(-1, u, best)
+		}
+	}
+	return
+}
+
+// One round of NNI moves: for each internal edge, the two alternative topologies
+// are evaluated. Returns true if the score has been improved.
+func (t *searchTree) nniRound() (improved bool) {
+	ntips := len(t.d.names)
+	score := t.score()
+	for u := ntips; u < len(t.adj); u++ {
+		for _, v := range t.adj[u] {
+			if v < ntips || v < u {
+				continue
+			}
+			// u: neighbors a, b (and v); v: neighbors c, d (and u)
+			var b int
+			for _, n := range t.adj[u] {
+				if n != v {
+					b = n
+				}
+			}
+			for _, c := range t.adj[v] {
+				if c == u {
+					continue
+				}
+				// Swap b and c
+				t.replace(u, b, c)
+				t.replace(c, v, u)
+				t.replace(v, c, b)
+				t.replace(b, u, v)
+				if t.score() < score {
+					return true
+				}
+				// Revert
+				t.replace(u, c, b)
+				t.replace(c, u, v)
+				t.replace(v, b, c)
+				t.replace(b, v, u)
+			}
+		}
+	}
+	return false
+}
+
+// Converts the search tree into a tree, rooted at the internal node
+// connected to the root tip
+func (t *searchTree) toTree() *tree.Tree {
+	tr := tree.NewTree()
+	nodes := make([]*tree.Node, len(t.adj))
+	var rec func(cur, prev int)
+	rec = func(cur, prev int) {
+		nodes[cur] = tr.NewNode()
+		if cur < len(t.d.names) {
+			nodes[cur].SetName(t.d.names[cur])
+		}
+		if prev >= 0 {
+			tr.ConnectNodes(nodes[prev], nodes[cur])
+		}
+		for _, next := range t.adj[cur] {
+			if next != prev {
+				rec(next, cur)
+			}
+		}
+	}
+	rec(t.adj[t.root][0], -1)
+	tr.SetRoot(nodes[t.adj[t.root][0]])
+	tr.ReinitIndexes()
+	return tr
+}
+
+// Searches for the most parsimonious tree of the alignment (Fitch parsimony, see
+// Score): for each replicate, a starting tree is built by stepwise addition of the
+// taxa in random order (each taxon being added on the branch that minimizes the
+// score, ties being broken randomly), then improved by hill-climbing with NNI or
+// SPR moves (search: SEARCH_NONE, SEARCH_NNI or SEARCH_SPR) until no move improves
+// the score.
+//
+// Replicates are run in parallel on cpus threads, and are reproducible given the
+// seed of the global random generator. Results are given in the order of the
+// replicates.
+func Search(al align.Alignment, search int, replicates int, cpus int) ([]*Result, error) {
+	var d *data
+	var err error
+	var wg sync.WaitGroup
+
+	if d, err = newData(al, nil); err != nil {
+		return nil, err
+	}
+	if replicates < 1 {
+		return nil, fmt.Errorf("The number of replicates must be >= 1")
+	}
+	switch search {
+	case SEARCH_NONE, SEARCH_NNI, SEARCH_SPR:
+	default:
+		return nil, fmt.Errorf("Unknown search algorithm %d", search)
+	}
+	if maxcpus := runtime.NumCPU(); cpus > maxcpus {
+		cpus = maxcpus
+	}
+	if cpus < 1 {
+		cpus = 1
+	}
+	m, g := d.minMaxChanges()
+
+	seeds := make([]int64, replicates)
+	for i := range seeds {
+		seeds[i] = rand.Int63()
+	}
+	results := make([]*Result, replicates)
+	reps := make(chan int, replicates)
+	for i := 0; i < replicates; i++ {
+		reps <- i
+	}
+	close(reps)
+
+	for cpu := 0; cpu < cpus; cpu++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rep := range reps {
+				t := newSearchTree(d, rand.New(rand.NewSource(seeds[rep])))
+				t.stepwiseAddition()
+				switch search {
+				case SEARCH_NNI:
+					for t.nniRound() {
+					}
+				case SEARCH_SPR:
+					for t.sprRound() {
+					}
+				}
+				res := &Result{Replicate: rep, Tree: t.toTree(), Score: t.score()}
+				res.CI, res.RI = indices(m, g, res.Score)
+				results[rep] = res
+			}
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
@@ -259,6 +259,43 @@ diff -q -b expected result
 rm -f expected result
 
 
+# gotree compare runs
+echo "->gotree compare runs"
+cat > run1 <<EOF
+((A,B),C,(D,E));
+((A,B),C,(D,E));
+((A,C),B,(D,E));
+((A,B),C,(D,E));
+EOF
+cat > run2 <<EOF
+((A,B),C,(D,E));
+((A,C),B,(D,E));
+((A,C),B,(D,E));
+(((A,B),C),(D,E));
+EOF
+cat > expected <<EOF
+runs	trees	splits	asdsf	msdsf
+2	4,4	3	0.117851	0.176777
+EOF
+cat > expected_splits <<EOF
+id	size	tips	run0	run1	mean	sd
+0	2	D,E	1.000000	1.000000	1.000000	0.000000
+1	2	A,B	0.750000	0.500000	0.625000	0.176777
+2	2	A,C	0.250000	0.500000	0.375000	0.176777
+EOF
+cat > expected_window <<EOF
+window	start	end	asdsf	msdsf
+0	0	1	0.235702	0.353553
+1	1	2	0.235702	0.353553
+2	2	3	0.000000	0.000000
+EOF
+${GOTREE} compare runs --burnin 0 --out-splits result_splits --window 2 --out-window result_window run1 run2 > result
+diff -q -b expected result
+diff -q -b expected_splits result_splits
+diff -q -b expected_window result_window
+rm -f expected expected_splits expected_window result result_splits result_window run1 run2
+
+
 # gotree compare edges
 echo "->gotree compare edges"
 cat > expected <<EOF
@@ -377,6 +414,64 @@ diff -q -b expected result
 rm -f expected result
 
 
+# gotree compute consensusnetwork
+echo "->gotree compute consensusnetwork"
+cat > expected <<EOF
+#NEXUS
+BEGIN TAXA;
+ DIMENSIONS NTAX=5;
+ TAXLABELS 'A' 'B' 'C' 'D' 'E';
+END;
+BEGIN SPLITS;
+ DIMENSIONS NTAX=5 NSPLITS=8;
+ FORMAT LABELS=NO WEIGHTS=YES CONFIDENCES=YES;
+ MATRIX
+ [1, size=4]	1	1	2 3 4 5,
+ [2, size=1]	1	1	2,
+ [3, size=1]	1	1	3,
+ [4, size=1]	1	1	4,
+ [5, size=1]	1	1	5,
+ [6, size=2]	2	1	4 5,
+ [7, size=3]	2	0.6666666666666666	3 4 5,
+ [8, size=3]	1	0.3333333333333333	2 4 5,
+ ;
+END;
+EOF
+cat > expectedgraph <<EOF
+graph splits {
+  n0 [label="",shape=point];
+  n1 [label="",shape=point];
+  n2 [label="",shape=point];
+  n3 [label="",shape=point];
+  n4 [label="",shape=point];
+  n5 [label="E"];
+  n6 [label="D"];
+  n7 [label="C"];
+  n8 [label="B"];
+  n9 [label="A"];
+  n0 -- n1 [label="8",weight="1",confidence="0.3333333333333333"];
+  n0 -- n2 [label="7",weight="2",confidence="0.6666666666666666"];
+  n0 -- n4 [label="6",weight="2",confidence="1"];
+  n1 -- n3 [label="7",weight="2",confidence="0.6666666666666666"];
+  n1 -- n7 [label="3",weight="1",confidence="1"];
+  n2 -- n3 [label="8",weight="1",confidence="0.3333333333333333"];
+  n2 -- n8 [label="2",weight="1",confidence="1"];
+  n3 -- n9 [label="1",weight="1",confidence="1"];
+  n4 -- n5 [label="5",weight="1",confidence="1"];
+  n4 -- n6 [label="4",weight="1",confidence="1"];
+}
+EOF
+cat > input <<EOF
+((A:1,B:1):1,C:1,(D:1,E:1):2);
+((A:1,C:1):1,B:1,(D:1,E:1):2);
+((A:1,B:1):3,C:1,(D:1,E:1):2);
+EOF
+${GOTREE} compute consensusnetwork -i input -f 0.3 -o result --graph resultgraph
+diff -q -b expected result
+diff -q -b expectedgraph resultgraph
+rm -f expected result expectedgraph resultgraph input
+
+
 echo "->gotree compute classical bootstrap"
 cat > expected <<EOF
 (Tip0,(Tip4,(Tip7,Tip2)1)1,((Tip9,(Tip8,Tip3)0.87)1,(Tip1,(Tip6,Tip5)0.65)0.97)0.67);
@@ -1359,3 +1454,702 @@ ${GOTREE} brlen cut -i input  -l 0.2 | sort > output
 diff -q -b expected output
 
 rm -f expected output input
+
+
+echo "->gotree network stats"
+cat > input <<EOF
+((A:1,(B:1)#H1:1::0.3):1,(#H1:0.5::0.7,C:1):1);
+(C,D,((O,(E,#H7:::0.196):0.314):0.664,(((A1,A2),(B1,B2)):1.5)#H7:::0.804):10.0);
+EOF
+cat > expected <<EOF
+network	nodes	tips	edges	reticulations	reticulationnumber	displayedtrees
+0	7	3	7	1	1	2
+1	16	8	16	1	1	2
+EOF
+${GOTREE} network stats -i input > output
+diff -q -b expected output
+rm -f expected output
+
+
+echo "->gotree network trees"
+cat > expected <<EOF
+((A:1,B:2):1,C:2);
+(A:2,(B:1.5,C:1):1);
+(C,D,(O,(E,((A1,A2),(B1,B2))):0.314):10.664);
+(C,D,((O,E):0.664,((A1,A2),(B1,B2))):10);
+EOF
+cat > expectedweights <<EOF
+network	tree	weight
+0	0	0.300000
+0	1	0.700000
+1	0	0.196000
+1	1	0.804000
+EOF
+${GOTREE} network trees -i input -o output --weights outputweights
+diff -q -b expected output
+diff -q -b expectedweights outputweights
+rm -f expected output expectedweights outputweights input
+
+
+echo "->gotree rtt"
+cat > input <<EOF
+((A_2000:1,B_2001-06:2.5):1,(C_2002-03-15:3,D_2003:4):2,E_2004.5:5);
+EOF
+cat > expected <<EOF
+tree	tips	rate	tmrca	r2	rms
+0	5	0.697938109086644	1996.0586337271748	0.9282576850852333	0.12748355515128773
+EOF
+cat > expectedtree <<EOF
+(((A_2000:1,B_2001-06:2.5):1,E_2004.5:5):0.7374429223744163,(C_2002-03-15:3,D_2003:4):1.2625570776255837);
+EOF
+${GOTREE} rtt -i input --reroot r2 --out-tree outputtree > output
+diff -q -b expected output
+diff -q -b expectedtree outputtree
+rm -f expected output expectedtree outputtree
+
+
+echo "->gotree rtt date file"
+cat > dates <<EOF
+A_2000	2000
+B_2001-06	2001-06
+C_2002-03-15	2002-03-15
+D_2003	2003-01	2003-12
+EOF
+cat > expected <<EOF
+tree	tip	date	distance	residual
+0	A_2000	2000.5	2	-0.20895351251874672
+0	B_2001-06	2001.454794520548	3.5	-0.003027545245913643
+0	C_2002-03-15	2002.2	5	0.4869634536007652
+0	D_2003	2003.5	6	-0.27498239583701434
+EOF
+${GOTREE} rtt -i input --date-file dates --out-tips output > /dev/null
+diff -q -b expected output
+rm -f expected output input dates
+
+
+echo "->gotree cluster"
+cat > expected <<EOF
+tree	tip	cluster
+0	A	1
+0	B	1
+0	C	-1
+0	D	-1
+0	E	-1
+0	F	-1
+EOF
+cat > expected.stats <<EOF
+tree	cluster	ntips	maxdist	meandist	support	tips
+0	1	4	0.09	0.0583	0.9	A,B,C,D
+EOF
+cat > expected.single <<EOF
+0	A	1
+0	B	1
+0	C	1
+0	D	-1
+0	E	-1
+0	F	-1
+EOF
+echo "(((A:0.01,B:0.02)0.95:0.01,(C:0.01,D:0.05)0.5:0.01)0.9:0.1,(E:0.2,F:0.01)1:0.05);" | ${GOTREE} cluster --method max --threshold 0.05 > result
+echo "(((A:0.01,B:0.02)0.95:0.01,(C:0.01,D:0.05)0.5:0.01)0.9:0.1,(E:0.2,F:0.01)1:0.05);" | ${GOTREE} cluster --method avg --threshold 0.06 --min-support 0.8 --out-stats stats > /dev/null
+awk -F'\t' 'NR==1{print;next}{printf "%s\t%s\t%s\t%s\t%.4f\t%s\t%s\n",$1,$2,$3,$4,$5,$6,$7}' stats > result.stats
+echo "(((A:0.01,B:0.02)0.95:0.01,(C:0.01,D:0.05)0.5:0.01)0.9:0.1,(E:0.2,F:0.01)1:0.05);" | ${GOTREE} cluster --method single --threshold 0.05 | tail -n +2 > result.single
+diff -q -b result expected
+diff -q -b result.stats expected.stats
+diff -q -b result.single expected.single
+rm -f expected expected.stats expected.single stats result result.stats result.single
+
+
+echo "->gotree brlen transform"
+cat > expected <<EOF
+((A:1.5,B:2.5):0.5,C:2.5);
+((A:1,B:1):1,C:1);
+((A:1,B:2.6667):0.3333,C:2.0833);
+((A:0.5,B:0.5):0.5,C:1);
+((A:0.2325,B:0.8647):0.0855,C:0.5567);
+EOF
+echo "((A:1,B:2):1,C:2.5);" | ${GOTREE} brlen transform --model lambda --param 0.5 > result
+echo "((A:1,B:2):1,C:2.5);" | ${GOTREE} brlen transform --model kappa --param 0 >> result
+echo "((A:1,B:2):1,C:2.5);" | ${GOTREE} brlen transform --model delta --param 2 | ${GOTREE} brlen round -p 4 >> result
+echo "((A,B),C);" | ${GOTREE} brlen transform --model grafen --param 1 >> result
+echo "((A:1,B:2):1,C:2.5);" | ${GOTREE} brlen transform --model ou --param 0.5 | ${GOTREE} brlen round -p 4 >> result
+diff -q -b result expected
+rm -f expected result
+
+
+echo "->gotree compute signal"
+cat > values <<EOF
+tip	x	y
+A	0.1	0
+B	0.3	0.2
+C	1.2	0.1
+D	1.5	10
+E	5	10.3
+F	5.2	9.8
+G	4.1	0.3
+EOF
+cat > expected <<EOF
+0	x	2.4693	NA	1.0000	-11.0050	-14.9540	0.0049
+0	y	1.1046	NA	1.0000	-19.8874	-21.0480	0.1276
+EOF
+echo "(((A:1,B:1):2,(C:2.5,D:2.5):0.5):1.5,((E:0.5,F:0.5):3,G:3.5):1);" | ${GOTREE} compute signal --values values --permutations 0 > tmp
+awk -F'\t' 'NR>1{printf "%s\t%s\t%.4f\t%s\t%.4f\t%.4f\t%.4f\t%.4f\n",$1,$2,$3,$4,$5,$6,$7,$8}' tmp > result
+diff -q -b result expected
+rm -f values expected tmp result
+
+
+echo "->gotree compute pic"
+cat > values <<EOF
+A	0	1
+B	2	1
+C	4	3
+EOF
+cat > expected <<EOF
+tree	node	variance	value1	value2
+0	root	3.5000	-1.6036	-1.0690
+0	n1	2.0000	-1.4142	0.0000
+EOF
+echo "((A:1,B:1)n1:1,C:2)root;" | ${GOTREE} compute pic --values values > tmp
+awk -F'\t' 'NR==1{print;next}{printf "%s\t%s",$1,$2; for(i=3;i<=NF;i++){printf "\t%.4f",$i}; printf "\n"}' tmp > result
+diff -q -b result expected
+rm -f values expected tmp result
+
+
+echo "->gotree acr continuous"
+cat > values <<EOF
+tip	lat	long
+A	0	10
+B	2	12
+C	4	20
+EOF
+cat > expected <<EOF
+tree	node	lat	lat_lower	lat_upper	long	long_lower	long_upper
+0	root	2.2857	0.0458	4.5257	14.8571	9.6040	20.1103
+0	n1	1.4286	-0.1553	3.0125	12.2857	8.5712	16.0003
+EOF
+cat > expected.model <<EOF
+0	lat	1.5238	-5.7845
+0	long	8.3810	-8.3416
+EOF
+cat > expected.scp <<EOF
+((A[&lat=0,long=10]:1,B[&lat=2,long=12]:1)n1[&lat=1.6,long=12.8]:1,C[&lat=4,long=20]:2)root[&lat=2.8,long=16.4];
+EOF
+echo "((A:1,B:1)n1:1,C:2)root;" | ${GOTREE} acr --states values --algo bm --out-states states --out-model model > /dev/null
+awk -F'\t' 'NR==1{print;next}{printf "%s\t%s",$1,$2; for(i=3;i<=NF;i++){printf "\t%.4f",$i}; printf "\n"}' states > result
+awk -F'\t' 'NR>1{printf "%s\t%s\t%.4f\t%.4f\n",$1,$2,$3,$4}' model > result.model
+echo "((A:1,B:1)n1:1,C:2)root;" | ${GOTREE} acr --states values --algo scp > result.scp
+diff -q -b result expected
+diff -q -b result.model expected.model
+diff -q -b result.scp expected.scp
+rm -f values expected expected.model expected.scp states model result result.model result.scp
+
+
+echo "->gotree acr traits"
+cat > traits <<EOF
+tip	loc	host
+A	X	h1
+B	X	h1
+C	Y	h1
+D	Y	h1
+E	X	h2
+EOF
+cat > expected <<EOF
+((A[&loc=X,host=h1],B[&loc=X,host=h1])n1[&loc=X,host=h1],((C[&loc=Y,host=h1],D[&loc=Y,host=h1])n3[&loc=Y,host=h1],E[&loc=X,host=h2])n2[&loc=X,host=h1])root[&loc=X,host=h1];
+EOF
+cat > expected.table <<EOF
+node	loc	host
+root	X	h1
+n1	X	h1
+A	X	h1
+B	X	h1
+n2	X	h1
+n3	Y	h1
+C	Y	h1
+D	Y	h1
+E	X	h2
+EOF
+cat > expected.transitions <<EOF
+tree	character	from	to	count
+0	loc	X	Y	1
+0	loc	Y	X	0
+0	host	h1	h2	1
+0	host	h2	h1	0
+EOF
+cat > expected.changes <<EOF
+tree	character	parent	child	from	to
+0	loc	n2	n3	X	Y
+0	host	n2	E	h1	h2
+EOF
+echo "((A,B)n1,((C,D)n3,E)n2)root;" | ${GOTREE} acr --traits traits --algo downpass --out-table result.table --out-transitions result.transitions --out-branch-changes result.changes > result
+diff -q -b result expected
+diff -q -b result.table expected.table
+diff -q -b result.transitions expected.transitions
+diff -q -b result.changes expected.changes
+rm -f traits expected expected.table expected.transitions expected.changes result result.table result.transitions result.changes
+
+
+echo "->gotree acr sankoff"
+cat > states <<EOF
+A	0
+B	0
+C	2
+D	2
+EOF
+cat > costs <<EOF
+	0	1	2
+0	0	1	2
+1	1	0	1
+2	2	1	0
+EOF
+cat > expected <<EOF
+((A[&state=0,states={0}]:1[&minchanges=0,maxchanges=0],B[&state=0,states={0}]:1[&minchanges=0,maxchanges=0])n1[&state=0,states={0}]:1[&minchanges=0,maxchanges=1],(C[&state=2,states={2}]:1[&minchanges=0,maxchanges=0],D[&state=2,states={2}]:1[&minchanges=0,maxchanges=0])n2[&state=2,states={2}]:1[&minchanges=0,maxchanges=1])root[&state=0,states={0,1,2}];
+EOF
+cat > expected.cost <<EOF
+tree	cost	ci	ri
+0	2	1	1
+EOF
+cat > expected.changes <<EOF
+tree	parent	child	minchanges	maxchanges
+0	root	n1	0	1
+0	n1	A	0	0
+0	n1	B	0	0
+0	root	n2	0	1
+0	n2	C	0	0
+0	n2	D	0	0
+EOF
+echo "((A:1,B:1)n1:1,(C:1,D:1)n2:1)root;" | ${GOTREE} acr --states states --algo sankoff --costs costs --out-cost result.cost --out-changes result.changes > result
+diff -q -b result expected
+diff -q -b result.cost expected.cost
+diff -q -b result.changes expected.changes
+rm -f states costs expected expected.cost expected.changes result result.cost result.changes
+
+
+echo "->gotree compute parsimony"
+cat > align.fa <<EOF
+>A
+AAAAAAAAGA
+>B
+AAAAAAAAAA
+>C
+CCCAAATTAA
+>D
+CCCAAATTAA
+>E
+CCCGGGAAAA
+>F
+CCCGGGAAAC
+EOF
+cat > expected <<EOF
+replicate	score	ci	ri
+0	10	1	1
+1	10	1	1
+2	10	1	1
+EOF
+cat > expected.compare <<EOF
+tree	reference	common	compared
+0	0	3	0
+EOF
+echo "((A,B),(C,D),(E,F));" > expected.tree
+${GOTREE} compute parsimony -a align.fa --search spr --replicates 3 -t 2 --seed 10 --out-tree result.tree > result
+${GOTREE} compare trees -i expected.tree -c result.tree > result.compare
+diff -q -b result expected
+diff -q -b result.compare expected.compare
+rm -f align.fa expected expected.compare expected.tree result result.compare result.tree
+
+
+echo "->gotree place"
+cat > ref.fa <<EOF
+>A
+AAAAAAAA
+>B
+AAAAAAAC
+>C
+CCAAAAAA
+>D
+CCAAGAAA
+EOF
+cat > query.fa <<EOF
+>F
+CCAAGTAA
+>G
+CCAAGTAN
+EOF
+cat > expected <<EOF
+((A:0.1,B:0.1)n1:0.2,(C:0.1,((G:0,F:0.0625):0.0625,D:0.05):0.05)n2:0.2)root;
+EOF
+cat > expected.placements <<EOF
+tree	sample	branch	score	nties	ties
+0	F	D	1	1	D
+0	G	F	0	1	F
+EOF
+echo "((A:0.1,B:0.1)n1:0.2,(C:0.1,D:0.1)n2:0.2)root;" | ${GOTREE} place -a ref.fa -q query.fa --out-placements result.placements > result
+diff -q -b result expected
+diff -q -b result.placements expected.placements
+rm -f ref.fa query.fa expected expected.placements result result.placements
+
+
+echo "->gotree asr out-align out-subs"
+cat > align.fa <<EOF
+>A
+ACGA
+>B
+ACTA
+>C
+AGTT
+>D
+TGTC
+EOF
+cat > expected <<EOF
+((A[ACGA]:1[&nmut=1,mutations={T3G}],B[ACTA]:1[&nmut=0,mutations={}])n1[ACTA]:1[&nmut=1,mutations={G2C}],C[AGTT]:1[&nmut=0,mutations={}],D[TGTC]:1[&nmut=1,mutations={A1T}])root[AGT{ACT}];
+EOF
+cat > expected.align <<EOF
+>root
+AGTH
+>n1
+ACTA
+>A
+ACGA
+>B
+ACTA
+>C
+AGTT
+>D
+TGTC
+EOF
+cat > expected.subs <<EOF
+tree	parent	child	position	ancestral	derived
+0	root	n1	2	G	C
+0	n1	A	3	T	G
+0	root	D	1	A	T
+EOF
+echo "((A:1,B:1)n1:1,C:1,D:1)root;" | ${GOTREE} asr -a align.fa --algo downpass --out-align result.align --out-subs result.subs --annotate-mutations > result
+diff -q -b result expected
+diff -q -b result.align expected.align
+diff -q -b result.subs expected.subs
+rm -f align.fa expected expected.align expected.subs result result.align result.subs
+
+
+echo "->gotree asr ml"
+cat > align.fa <<EOF
+>A
+ACGA
+>B
+ACTA
+>C
+AGTT
+>D
+AGTT
+EOF
+cat > expected <<EOF
+((A[ACGA]:0.1,B[ACTA]:0.1)n1[ACTA]:0.1,C[AGTT]:0.1,D[AGTT]:0.1)root[AGTT];
+EOF
+cat > expected.probas <<EOF
+node	site	state	proba
+root	1	A	0.9999
+root	2	G	0.9656
+root	3	T	0.9986
+root	4	T	0.9656
+n1	1	A	0.9999
+n1	2	C	0.9656
+n1	3	T	0.9633
+n1	4	A	0.9656
+EOF
+echo "((A:0.1,B:0.1)n1:0.1,C:0.1,D:0.1)root;" | ${GOTREE} asr -a align.fa --algo ml --model jc69 --out-probas probas > result
+awk -F'\t' 'NR==1{print;next}{printf "%s\t%s\t%s\t%.4f\n",$1,$2,$3,$4}' probas > result.probas
+diff -q -b result expected
+diff -q -b result.probas expected.probas
+rm -f align.fa expected expected.probas probas result result.probas
+
+
+echo "->gotree acr ml"
+cat > states <<EOF
+t1	A
+t2	A
+t3	A
+t4	A
+t5	B
+t6	B
+t7	C
+EOF
+cat > expected <<EOF
+node	A	B	C
+root	0.5739	0.2292	0.1969
+n3	0.7238	0.1473	0.1289
+n1	0.9948	0.0027	0.0025
+t1	1.0000	0.0000	0.0000
+t2	1.0000	0.0000	0.0000
+n2	0.9948	0.0027	0.0025
+t3	1.0000	0.0000	0.0000
+t4	1.0000	0.0000	0.0000
+n5	0.4349	0.3071	0.2581
+n4	0.0057	0.9899	0.0044
+t5	0.0000	1.0000	0.0000
+t6	0.0000	1.0000	0.0000
+t7	0.0000	0.0000	1.0000
+EOF
+cat > expected.states <<EOF
+n1,A
+n2,A
+n3,A
+n4,B
+n5,A
+root,A
+EOF
+cat > expected.model <<EOF
+er	-5.2554	1
+EOF
+echo "(((t1:0.1,t2:0.1)n1:0.5,(t3:0.1,t4:0.1)n2:0.5)n3:0.1,((t5:0.1,t6:0.1)n4:0.5,t7:0.6)n5:0.1)root;" | ${GOTREE} acr --states states --algo ml --model er --out-probas probas --out-model model --out-states result.states > /dev/null
+awk -F'\t' 'NR==1{print;next}{printf "%s\t%.4f\t%.4f\t%.4f\n",$1,$2,$3,$4}' probas > result
+awk -F'\t' 'NR>1{printf "%s\t%.4f\t%s\n",$2,$3,$4}' model > result.model
+sort result.states > result.sorted
+diff -q -b result expected
+diff -q -b result.sorted expected.states
+diff -q -b result.model expected.model
+rm -f states expected expected.states expected.model probas model result result.states result.sorted result.model
+
+
+echo "->gotree compute likelihood"
+cat > align.fa <<EOF
+>A
+AAAAAAAAAC
+>B
+AAAAAAAACA
+>C
+AAAAAAAAAA
+EOF
+cat > expected <<EOF
+0	-24.5329
+1	-22.5618
+EOF
+cat > expected.tree <<EOF
+((A:0.1073,B:0.1073):0,C:0);
+EOF
+echo "((A:0.1,B:0.2):0.1,C:0.1);" | ${GOTREE} compute likelihood -a align.fa | awk -F'\t' 'NR>1{printf "%s\t%.4f\n",$1,$3}' > result
+echo "((A,B),C);" | ${GOTREE} compute likelihood -a align.fa --opt-brlen --out-tree result.tree | awk -F'\t' 'NR>1{printf "1\t%.4f\n",$3}' >> result
+${GOTREE} brlen round -p 4 -i result.tree > result.rounded
+diff -q -b result expected
+diff -q -b result.rounded expected.tree
+rm -f align.fa expected expected.tree result result.tree result.rounded
+
+
+echo "->gotree generate traits"
+printf "\ta\tb\tc\na\t-\t1\t0\nb\t0.5\t-\t0.5\nc\t0\t1\t-\n" > matrix
+cat > expected <<EOF
+A	a
+B	b
+C	a
+D	b
+EOF
+cat > expected.internal <<EOF
+Node0	a
+Node1	a
+Node2	a
+EOF
+cat > expected.tree <<EOF
+((A:0.1,B:0.2)Node1:0.05,(C:0.1,D:0.3)Node2:0.1)Node0;
+EOF
+cat > expected.bm <<EOF
+A	1.8291
+B	1.4797
+C	0.8581
+D	1.7625
+EOF
+echo "((A:0.1,B:0.2):0.05,(C:0.1,D:0.3):0.1);" | ${GOTREE} generate traits --model mk --matrix matrix --root-state a --seed 10 --internal result.internal --out-tree result.tree > result
+echo "((A:0.1,B:0.2):0.05,(C:0.1,D:0.3):0.1);" | ${GOTREE} generate traits --model bm --sigma2 2 --root-value 1 --seed 10 | awk -F'\t' '{printf "%s\t%.4f\n",$1,$2}' > result.bm
+diff -q -b result expected
+diff -q -b result.internal expected.internal
+diff -q -b result.tree expected.tree
+diff -q -b result.bm expected.bm
+rm -f matrix expected expected.internal expected.tree expected.bm result result.internal result.tree result.bm
+
+
+echo "->gotree generate sequences"
+cat > expected <<EOF
+>A
+GTCGATTGCTAGGCTCCCAA
+>B
+GTCCATCGCAAAGCTCCCGA
+>C
+GTTTATTACTATACTTCGGA
+>D
+ATCAATTGTAATGCTTGGCG
+EOF
+cat > expected.anc <<EOF
+>Node0
+GTTGATTACTATGCTTCCGA
+>Node1
+GTTGATTACTAGGCTCCCGA
+>Node2
+GTTGATTACTATGCTTCCGA
+EOF
+cat > expected.tree <<EOF
+((A:0.1,B:0.2)Node1:0.05,(C:0.1,D:0.3)Node2:0.1)Node0;
+EOF
+cat > expected.phy <<EOF
+   4   30
+A  VEGDANCSLV FIEPKLYTQN APHFRNSEAW
+B  VEGSCNCGLV FPHPKLYTQN AGHVRNSEAW
+C  VYGVANLGLV FTPPKLYTQN AGHLRNSEDW
+D  VYGYANVGLV FLDPKLYTQN AMHRSNSKNW
+EOF
+echo "((A:0.1,B:0.2):0.05,(C:0.1,D:0.3):0.1);" | ${GOTREE} generate sequences -l 20 --model hky --kappa 4 --freqs 0.3,0.2,0.2,0.3 --seed 10 --ancestral result.anc --out-tree result.tree > result
+echo "((A:0.1,B:0.2):0.05,(C:0.1,D:0.3):0.1);" | ${GOTREE} generate sequences -l 30 --model wag --alpha 0.5 --pinv 0.1 --seed 10 -p > result.phy
+diff -q -b result expected
+diff -q -b result.anc expected.anc
+diff -q -b result.tree expected.tree
+diff -q -b result.phy expected.phy
+rm -f expected expected.anc expected.tree expected.phy result result.anc result.tree result.phy
+
+
+echo "->gotree brlen clock"
+cat > expected <<EOF
+((A:0.5[&rate=0.5],B:0.5[&rate=0.5]):0.5[&rate=0.5],C:1[&rate=0.5]);
+((A:2.2951,B:0.6177):0.9492,C:1.3174);
+((A:1.5638,B:0.7677):0.9746,C:1.515);
+EOF
+echo "((A:1,B:1):1,C:2);" | ${GOTREE} brlen clock --rate 0.5 > result
+echo "((A:1,B:1):1,C:2);" | ${GOTREE} brlen clock --model ucln --sigma 0.5 --seed 1 | ${GOTREE} comment clear | ${GOTREE} brlen round -p 4 >> result
+echo "((A:1,B:1):1,C:2);" | ${GOTREE} brlen clock --model acln --sigma 0.5 --seed 1 | ${GOTREE} comment clear | ${GOTREE} brlen round -p 4 >> result
+diff -q -b result expected
+rm -f expected result
+
+
+echo "->gotree generate coalescenttree"
+cat > input <<EOF
+A	2000
+B	2001.5
+C	2003
+D	2003
+E	2002
+EOF
+cat > expected <<EOF
+((((Tip1,Tip0),Tip3),Tip2),Tip4);
+(B,((E,A),(D,C)));
+EOF
+${GOTREE} generate coalescenttree -r -l 5 --popsize 2 --growth 0.5 --seed 2 | ${GOTREE} brlen clear > result
+${GOTREE} generate coalescenttree -r --sampling-file input --popsize 1 --popsize-changes 1:5,3:0.5 --seed 3 | ${GOTREE} brlen clear >> result
+diff -q -b result expected
+rm -f expected result input
+
+
+echo "->gotree generate birthdeathtree"
+cat > expected <<EOF
+((Tip0,Tip1),((Tip2,Tip3),Tip4));
+(((ExtinctTip0,(ExtinctTip1,Tip0)),(((ExtinctTip2,Tip1),ExtinctTip3),ExtinctTip4)),ExtinctTip5);
+EOF
+${GOTREE} generate birthdeathtree -r -l 5 --birth 1 --death 0.5 --seed 2 | ${GOTREE} brlen clear > result
+${GOTREE} generate birthdeathtree -r --time 3 --birth 1 --death 0.5 --complete --seed 3 | ${GOTREE} brlen clear >> result
+diff -q -b result expected
+rm -f expected result
+
+
+echo "->gotree compute diversification"
+cat > input <<EOF
+(((A:0.9,B:0.9):1.6,(I:0.4,J:0.4):2.1):1.5,(((C:0.6,D:0.6):0.7,(E:0.2,F:0.2):1.1):1.2,(G:0.8,H:0.8):1.7):1.5);
+EOF
+cat > expected <<EOF
+0	yule	0.6636	0.0000	0.6636	0.0000	-14.5260	1	31.0520
+0	bd	1.2198	0.9558	0.2640	0.7836	-14.0014	2	32.0028
+EOF
+${GOTREE} compute diversification -i input --sampling 0.5 | awk -F'\t' 'NR>1{printf "%s\t%s\t%.4f\t%.4f\t%.4f\t%.4f\t%.4f\t%s\t%.4f\n",$1,$2,$3,$4,$5,$6,$7,$8,$9}' > output
+diff -q -b expected output
+rm -f expected output input
+
+
+echo "->gotree stats ltt"
+cat > input <<EOF
+((A:1,B:1):1,C:2);
+(((A:1,B:1):1,C:2):1,D:3);
+EOF
+cat > expected <<EOF
+tree	time	lineages
+0	-2	2
+0	-1	3
+0	0	3
+1	-3	2
+1	-2	3
+1	-1	4
+1	0	4
+EOF
+cat > expectedgamma <<EOF
+tree	gamma	pvalue
+0	-0.34641016151377546	0.729034489538804
+1	-0.5443310539518174	0.58621368107314
+EOF
+cat > expectedenv <<EOF
+time	mean	min	max	lower	upper
+-3	1	0	2	0	2
+-2	2.5	2	3	2	3
+-1	3.5	3	4	3	4
+0	3.5	3	4	3	4
+EOF
+${GOTREE} stats ltt -i input --gamma outputgamma > output
+${GOTREE} stats ltt -i input --envelope --nb-points 4 > outputenv
+diff -q -b expected output
+diff -q -b expectedgamma outputgamma
+diff -q -b expectedenv outputenv
+rm -f expected output expectedgamma outputgamma expectedenv outputenv input
+
+
+echo "->gotree timeslice"
+cat > input <<EOF
+((A:1,B:2)AB:2,(C:3,D:1.5)CD:1)R;
+EOF
+cat > expected <<EOF
+tree	tip	cluster
+0	A	0
+0	B	0
+0	C	1
+0	D	2
+EOF
+cat > expectedtree <<EOF
+A;
+B;
+C;
+EOF
+${GOTREE} timeslice -i input --height 2.5 > output
+${GOTREE} timeslice -i input --depth 3 --subtrees > outputtree
+diff -q -b expected output
+diff -q -b expectedtree outputtree
+rm -f expected output expectedtree outputtree input
+
+
+echo "->gotree compute dating"
+cat > input <<EOF
+((A_2010:0.05,B_2012:0.07):0.05,(C_2015:0.07,D_2020:0.12):0.08);
+EOF
+cat > constraints <<EOF
+A_2010,B_2012	2006
+EOF
+cat > expected <<EOF
+tree	rate	tmrca	objective	rate_lower	rate_upper	tmrca_lower	tmrca_upper
+0	0.011371238851999001	2001.7339262372186	0.7258355791403905	NA	NA	NA	NA
+EOF
+cat > expectedtree <<EOF
+((A_2010[&date=2010]:4,B_2012[&date=2012]:6)[&date=2006]:4.266073762781389,(C_2015[&date=2015]:6.034303724788288,D_2020[&date=2020]:11.034303724788288)[&date=2008.9656962752117]:7.231770037993101)[&date=2001.7339262372186];
+EOF
+${GOTREE} compute dating -i input --date-format decimal --constraints constraints --out-stats output -o outputtree
+diff -q -b expected output
+diff -q -b expectedtree outputtree
+rm -f expected output expectedtree outputtree constraints
+
+echo "->gotree compute dating root rtt"
+cat > expectedtree <<EOF
+((A_2010[&date=2010]:5,B_2012[&date=2012]:7)[&date=2005]:5,(C_2015[&date=2015]:7,D_2020[&date=2020]:12)[&date=2008]:8)[&date=2000];
+EOF
+${GOTREE} unroot -i input | ${GOTREE} compute dating --date-format decimal --root rtt -o outputtree
+diff -q -b expectedtree outputtree
+rm -f expectedtree outputtree input
+
+echo "->gotree compute dating root ls constraints"
+cat > input <<EOF
+((A_2010:0.05,B_2012:0.07):0.05,(C_2015:0.07,D_2020:0.12):0.08);
+EOF
+cat > constraints <<EOF
+A_2010,C_2015	2003
+EOF
+cat > expectedtree <<EOF
+((A_2010[&date=2010]:3.7549961566076036,B_2012[&date=2012]:5.7549961566076036)[&date=2006.2450038433924]:3.2450038433923964,(C_2015[&date=2015]:5.110795765391003,D_2020[&date=2020]:10.110795765391003)[&date=2009.889204234609]:6.889204234608997)[&date=2003];
+EOF
+${GOTREE} unroot -i input | ${GOTREE} compute dating --date-format decimal --root ls --constraints constraints -o outputtree
+diff -q -b expectedtree outputtree
+rm -f expectedtree outputtree input constraints
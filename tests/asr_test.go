@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/gotree/asr"
+	"github.com/evolbioinfo/gotree/io/newick"
+)
+
+func TestAncestralAlignmentSubstitutions(t *testing.T) {
+	al := align.NewAlign(align.NUCLEOTIDS)
+	al.AddSequence("A", "ACGA", "")
+	al.AddSequence("B", "ACTA", "")
+	al.AddSequence("C", "AGTT", "")
+	al.AddSequence("D", "TGTC", "")
+	tr, _ := newick.NewParser(strings.NewReader("((A,B)n1,C,D)root;")).Parse()
+	if err := asr.ParsimonyAsr(tr, al, asr.ALGO_DOWNPASS, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Root site 4 is {ACT}: coded H
+	anc, err := asr.AncestralAlignment(tr, al)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"root": "AGTH", "n1": "ACTA", "A": "ACGA", "B": "ACTA", "C": "AGTT", "D": "TGTC"}
+	if anc.NbSequences() != len(expected) {
+		t.Errorf("Ancestral alignment should have %d sequences and has %d", len(expected), anc.NbSequences())
+	}
+	for name, seq := range expected {
+		if s, ok := anc.GetSequence(name); !ok || s != seq {
+			t.Errorf("Sequence of %s should be %s and is %s", name, seq, s)
+		}
+	}
+
+	// Ambiguous states intersecting their neighbors are not substitutions
+	subs, err := asr.Substitutions(tr, align.NUCLEOTIDS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expsubs := map[string]string{"G2C": "n1", "T3G": "A", "A1T": "D"}
+	if len(subs) != len(expsubs) {
+		t.Errorf("There should be %d substitutions and there are %d", len(expsubs), len(subs))
+	}
+	for _, s := range subs {
+		if child, ok := expsubs[s.String()]; !ok || child != s.Child.Name() {
+			t.Errorf("Unexpected substitution %s on branch to %s", s.String(), s.Child.Name())
+		}
+	}
+
+	asr.AnnotateMutations(tr, subs)
+	exptree := "((A[ACGA][&nmut=1,mutations={T3G}],B[ACTA][&nmut=0,mutations={}])n1[ACTA][&nmut=1,mutations={G2C}]," +
+		"C[AGTT][&nmut=0,mutations={}],D[TGTC][&nmut=1,mutations={A1T}])root[AGT{ACT}];"
+	if tr.Newick() != exptree {
+		t.Errorf("Mutation-annotated tree should be %s and is %s", exptree, tr.Newick())
+	}
+
+	// Tips keep their gaps
+	al = align.NewAlign(align.NUCLEOTIDS)
+	al.AddSequence("A", "AC-T", "")
+	al.AddSequence("B", "ACGT", "")
+	al.AddSequence("C", "ACGT", "")
+	al.AddSequence("D", "TCGT", "")
+	tr, _ = newick.NewParser(strings.NewReader("((A,B)n1,C,D)root;")).Parse()
+	if err = asr.ParsimonyAsr(tr, al, asr.ALGO_DOWNPASS, false); err != nil {
+		t.Fatal(err)
+	}
+	if anc, err = asr.AncestralAlignment(tr, al); err != nil {
+		t.Fatal(err)
+	}
+	for name, seq := range map[string]string{"A": "AC-T", "D": "TCGT", "n1": "ACGT"} {
+		if s, _ := anc.GetSequence(name); s != seq {
+			t.Errorf("Sequence of %s should be %s and is %s", name, seq, s)
+		}
+	}
+
+	// Amino acids: {DN} and {EQ} are coded B and Z (whatever the order of the alphabet)
+	al = align.NewAlign(align.AMINOACIDS)
+	al.AddSequence("A", "DEL", "")
+	al.AddSequence("B", "NQI", "")
+	al.AddSequence("C", "DEL", "")
+	al.AddSequence("D", "NQI", "")
+	tr, _ = newick.NewParser(strings.NewReader("((A,B)n1,C,D)root;")).Parse()
+	if err = asr.ParsimonyAsr(tr, al, asr.ALGO_DOWNPASS, false); err != nil {
+		t.Fatal(err)
+	}
+	if anc, err = asr.AncestralAlignment(tr, al); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := anc.GetSequence("n1"); s != "BZJ" {
+		t.Errorf("Sequence of n1 should be BZJ and is %s", s)
+	}
+
+	// Nodes without ancestral sequences
+	tr, _ = newick.NewParser(strings.NewReader("((A,B),C,D);")).Parse()
+	if _, err = asr.AncestralAlignment(tr, al); err == nil {
+		t.Errorf("Tree without ancestral sequences should return an error")
+	}
+}
+
+func TestParsimonyPlacement(t *testing.T) {
+	ref := align.NewAlign(align.NUCLEOTIDS)
+	ref.AddSequence("A", "AAAAAAAA", "")
+	ref.AddSequence("B", "AAAAAAAC", "")
+	ref.AddSequence("C", "CCAAAAAA", "")
+	ref.AddSequence("D", "CCAAGAAA", "")
+	query := align.NewAlign(align.NUCLEOTIDS)
+	query.AddSequence("F", "CCAAGTAA", "")
+	query.AddSequence("G", "CCAAGTAN", "")
+	tr, _ := newick.NewParser(strings.NewReader("((A:0.1,B:0.1)n1:0.2,(C:0.1,D:0.1)n2:0.2)root;")).Parse()
+
+	placements, err := asr.ParsimonyPlacement(tr, ref, query, asr.ALGO_ACCTRAN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(placements) != 2 {
+		t.Fatalf("There should be 2 placements and there are %d", len(placements))
+	}
+	// F is grafted on the branch of D, with 1 private substitution
+	if p := placements[0]; p.Name != "F" || p.Node.Name() != "D" || p.Score != 1 || len(p.Ties) != 1 {
+		t.Errorf("F should be placed on D with score 1 and no tie, and is placed on %s with score %d and %d ties", p.Node.Name(), p.Score, len(p.Ties))
+	}
+	// G is identical to F (N is missing data): grafted on the branch of F, with no cost
+	if p := placements[1]; p.Name != "G" || p.Node.Name() != "F" || p.Score != 0 {
+		t.Errorf("G should be placed on F with score 0, and is placed on %s with score %d", p.Node.Name(), p.Score)
+	}
+	exptree := "((A:0.1,B:0.1)n1:0.2,(C:0.1,((G:0,F:0.0625):0.0625,D:0.05):0.05)n2:0.2)root;"
+	if tr.Newick() != exptree {
+		t.Errorf("Updated tree should be %s and is %s", exptree, tr.Newick())
+	}
+	if ref.NbSequences() != 4 {
+		t.Errorf("Reference alignment should not be modified")
+	}
+
+	// Samples already in the tree
+	if _, err = asr.ParsimonyPlacement(tr, ref, query, asr.ALGO_ACCTRAN); err == nil {
+		t.Errorf("Placing samples already in the tree should return an error")
+	}
+}
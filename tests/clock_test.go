@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+func TestSimulateClock(t *testing.T) {
+	rand.Seed(10)
+	tr, err := newick.NewParser(strings.NewReader(diversificationTree)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lengths := make(map[*tree.Edge]float64)
+	for _, e := range tr.Edges() {
+		lengths[e] = e.Length()
+	}
+	rates, err := tr.SimulateClock(tree.CLOCK_STRICT, 0.5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range tr.Edges() {
+		if rates[e] != 0.5 || math.Abs(e.Length()-0.5*lengths[e]) > 1e-10 {
+			t.Errorf("Strict clock: rate should be 0.5 and is %f (length %f -> %f)", rates[e], lengths[e], e.Length())
+		}
+	}
+
+	for _, model := range []int{tree.CLOCK_UCLN, tree.CLOCK_UCED, tree.CLOCK_ACLN} {
+		sum := 0.0
+		nb := 0
+		for i := 0; i < 500; i++ {
+			tr, _ = newick.NewParser(strings.NewReader(diversificationTree)).Parse()
+			for _, e := range tr.Edges() {
+				lengths[e] = e.Length()
+			}
+			if rates, err = tr.SimulateClock(model, 2.0, 0.3); err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range tr.Edges() {
+				if math.Abs(e.Length()-rates[e]*lengths[e]) > 1e-10 {
+					t.Errorf("Model %d: length should be %f and is %f", model, rates[e]*lengths[e], e.Length())
+				}
+				sum += rates[e]
+				nb++
+			}
+		}
+		if mean := sum / float64(nb); math.Abs(mean-2.0) > 0.1 {
+			t.Errorf("Model %d: mean rate should be close to 2 and is %f", model, mean)
+		}
+	}
+
+	tr, _ = newick.NewParser(strings.NewReader("((A,B),C);")).Parse()
+	if _, err = tr.SimulateClock(tree.CLOCK_STRICT, 1, 0); err == nil {
+		t.Errorf("Clock on a tree without branch lengths should return an error")
+	}
+}
@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+const clusterTree = "(((A:0.01,B:0.02)0.95:0.01,(C:0.01,D:0.05)0.5:0.01)0.9:0.1,(E:0.2,F:0.01)1:0.05);"
+
+// Returns the sorted names of the tips of each cluster, joined by ","
+func clusterNames(clusters []*tree.TipCluster) []string {
+	res := make([]string, len(clusters))
+	for i, c := range clusters {
+		names := make([]string, len(c.Tips))
+		for j, tip := range c.Tips {
+			names[j] = tip.Name()
+		}
+		sort.Strings(names)
+		res[i] = strings.Join(names, ",")
+	}
+	return res
+}
+
+func TestClusterTips(t *testing.T) {
+	tests := []struct {
+		method     int
+		threshold  float64
+		minsupport float64
+		expected   []string
+	}{
+		{tree.CLUSTER_MAX_CLADE, 0.05, 0, []string{"A,B"}},
+		{tree.CLUSTER_MAX_CLADE, 0.1, 0, []string{"A,B,C,D"}},
+		{tree.CLUSTER_MAX_CLADE, 0.1, 0.95, []string{"A,B"}},
+		{tree.CLUSTER_MAX_CLADE, 0.061, 0.6, []string{"A,B"}},
+		{tree.CLUSTER_MAX_CLADE, 0.061, 0, []string{"A,B", "C,D"}},
+		{tree.CLUSTER_MAX_CLADE, 1, 0, []string{"A,B,C,D,E,F"}},
+		// Average of A,B,C,D: (0.03+0.04+0.08+0.05+0.09+0.06)/6
+		{tree.CLUSTER_AVG_CLADE, 0.06, 0, []string{"A,B,C,D"}},
+		{tree.CLUSTER_AVG_CLADE, 0.05, 0, []string{"A,B"}},
+		// B-C: 0.05, D is at 0.06 from C
+		{tree.CLUSTER_SINGLE_LINKAGE, 0.05, 0, []string{"A,B,C"}},
+		{tree.CLUSTER_SINGLE_LINKAGE, 0.061, 0, []string{"A,B,C,D"}},
+		{tree.CLUSTER_SINGLE_LINKAGE, 0.061, 0.6, []string{"A,B", "C,D"}},
+		{tree.CLUSTER_SINGLE_LINKAGE, 0.01, 0, []string{}},
+	}
+	for _, test := range tests {
+		tr, _ := newick.NewParser(strings.NewReader(clusterTree)).Parse()
+		clusters, err := tr.ClusterTips(test.method, test.threshold, test.minsupport)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := clusterNames(clusters)
+		if strings.Join(names, " ") != strings.Join(test.expected, " ") {
+			t.Errorf("Method %d (threshold %f, support %f): clusters should be %v and are %v", test.method, test.threshold, test.minsupport, test.expected, names)
+		}
+		for i, c := range clusters {
+			if c.Id != i+1 {
+				t.Errorf("Cluster %d should have id %d", c.Id, i+1)
+			}
+		}
+	}
+	tr, _ := newick.NewParser(strings.NewReader(clusterTree)).Parse()
+	clusters, _ := tr.ClusterTips(tree.CLUSTER_AVG_CLADE, 0.06, 0)
+	if c := clusters[0]; math.Abs(c.MaxDist-0.09) > 1e-10 || math.Abs(c.MeanDist-0.35/6) > 1e-10 || c.Edge.Support() != 0.9 {
+		t.Errorf("Cluster should have max distance 0.09, mean distance %f and support 0.9, and has %f, %f and %f", 0.35/6, c.MaxDist, c.MeanDist, c.Edge.Support())
+	}
+
+	tr, _ = newick.NewParser(strings.NewReader("((A,B),C);")).Parse()
+	if _, err := tr.ClusterTips(tree.CLUSTER_MAX_CLADE, 0.1, 0); err == nil {
+		t.Errorf("Branches without length should return an error")
+	}
+}
+
+// Compares clade clusters with brute force computations on the patristic distance matrix
+func TestClusterTipsRandom(t *testing.T) {
+	nbchecked := 0
+	rand.Seed(10)
+	for it := 0; it < 20; it++ {
+		tr, err := tree.RandomYuleBinaryTree(50, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matrix := tr.ToDistanceMatrix()
+		for _, method := range []int{tree.CLUSTER_MAX_CLADE, tree.CLUSTER_AVG_CLADE} {
+			clusters, err := tr.ClusterTips(method, 0.4, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Brute force: max/avg distances of every clade
+			incluster := make(map[*tree.Node]bool)
+			for _, c := range clusters {
+				for _, tip := range c.Tips {
+					if incluster[tip] {
+						t.Errorf("Tip %s is in several clusters", tip.Name())
+					}
+					incluster[tip] = true
+				}
+			}
+			for _, n := range tr.Nodes() {
+				if n.Tip() {
+					continue
+				}
+				tips := make([]*tree.Node, 0)
+				inclade := make(map[*tree.Node]bool)
+				for _, tip := range tr.Tips() {
+					for a := tip; a != tr.Root(); a, _ = a.Parent() {
+						if a == n {
+							tips = append(tips, tip)
+							break
+						}
+					}
+					if n == tr.Root() {
+						tips = append(tips, tip)
+					}
+				}
+				for _, tip := range tips {
+					inclade[tip] = true
+				}
+				max, sum := 0.0, 0.0
+				for i, a := range tips {
+					for _, b := range tips[i+1:] {
+						max = math.Max(max, matrix[a.Id()][b.Id()])
+						sum += matrix[a.Id()][b.Id()]
+					}
+				}
+				mean := sum / float64(len(tips)*(len(tips)-1)/2)
+				valid := (method == tree.CLUSTER_MAX_CLADE && max <= 0.4) || (method == tree.CLUSTER_AVG_CLADE && mean <= 0.4)
+				// Valid clades are included in clusters
+				if valid && !incluster[tips[0]] {
+					t.Errorf("Method %d: valid clade is not in a cluster (max=%f, mean=%f)", method, max, mean)
+				}
+				for _, c := range clusters {
+					same := len(c.Tips) == len(tips)
+					for _, tip := range c.Tips {
+						same = same && inclade[tip]
+					}
+					if same {
+						nbchecked++
+						if !valid || math.Abs(c.MaxDist-max) > 1e-10 || math.Abs(c.MeanDist-mean) > 1e-10 {
+							t.Errorf("Method %d: cluster %d should have max %f and mean %f, and has %f and %f", method, c.Id, max, mean, c.MaxDist, c.MeanDist)
+						}
+					}
+				}
+			}
+		}
+	}
+	if nbchecked == 0 {
+		t.Errorf("No cluster has been compared")
+	}
+}
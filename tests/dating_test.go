@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Clock-like tree: rate 0.01, root in 2000, internal nodes in 2005 and 2008
+const datingTree = "((A:0.05,B:0.07):0.05,(C:0.07,D:0.12):0.08);"
+
+var datingDates = map[string]float64{"A": 2010, "B": 2012, "C": 2015, "D": 2020}
+
+func datingConstraints(tr *tree.Tree, dates map[string]float64) map[*tree.Node]tree.DateConstraint {
+	constraints := make(map[*tree.Node]tree.DateConstraint)
+	for _, tip := range tr.Tips() {
+		if d, ok := dates[tip.Name()]; ok {
+			constraints[tip] = tree.DateConstraint{Lower: d, Upper: d}
+		}
+	}
+	return constraints
+}
+
+func TestLSDating(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader(datingTree)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// D is not dated
+	dates := map[string]float64{"A": 2010, "B": 2012, "C": 2015}
+	res, err := tr.LSDating(datingConstraints(tr, dates), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(res.Rate-0.01) > 1e-8 || math.Abs(res.TMRCA-2000) > 1e-6 || res.Objective > 1e-10 {
+		t.Errorf("Wrong dating: rate=%f, tmrca=%f, objective=%f", res.Rate, res.TMRCA, res.Objective)
+	}
+	for _, tip := range tr.Tips() {
+		if math.Abs(res.Dates[tip]-datingDates[tip.Name()]) > 1e-6 {
+			t.Errorf("Date of %s should be %f and is %f", tip.Name(), datingDates[tip.Name()], res.Dates[tip])
+		}
+	}
+	if err = tr.SetLengthsFromDates(res.Dates); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range tr.Edges() {
+		if e.Right().Name() == "D" && math.Abs(e.Length()-12) > 1e-6 {
+			t.Errorf("Duration of branch D should be 12 and is %f", e.Length())
+		}
+	}
+}
+
+func TestLSDatingInterval(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader(datingTree)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	constraints := datingConstraints(tr, datingDates)
+	// Constraint on the date of the root, incompatible with the clock
+	constraints[tr.Root()] = tree.DateConstraint{Lower: 2001, Upper: 2002}
+	res, err := tr.LSDating(constraints, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(res.TMRCA-2001) > 1e-8 {
+		t.Errorf("tMRCA should be 2001 and is %f", res.TMRCA)
+	}
+
+	// Only year dates: intervals of one year (root-to-tip distances: year-1998)
+	tr, err = newick.NewParser(strings.NewReader("((A:1,B:3):1,(C:1,D:3):2);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	constraints = make(map[*tree.Node]tree.DateConstraint)
+	for _, tip := range tr.Tips() {
+		year := map[string]float64{"A": 2000, "B": 2002, "C": 2001, "D": 2003}[tip.Name()]
+		constraints[tip] = tree.DateConstraint{Lower: year, Upper: year + 1}
+	}
+	if res, err = tr.LSDating(constraints, 0); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(res.Rate-1) > 1e-6 || res.TMRCA < 1998-1e-6 || res.TMRCA > 1999+1e-6 {
+		t.Errorf("Rate should be 1 and tMRCA in [1998,1999], and are %f and %f", res.Rate, res.TMRCA)
+	}
+	for tip, c := range constraints {
+		if d := res.Dates[tip]; d < c.Lower-1e-6 || d > c.Upper+1e-6 || math.Abs(d-res.TMRCA-(c.Lower-1998)) > 1e-6 {
+			t.Errorf("Date of %s should be in [%f,%f] and consistent with the tMRCA, and is %f", tip.Name(), c.Lower, c.Upper, d)
+		}
+	}
+}
+
+func TestRerootLSD(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader(datingTree)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.UnRoot()
+	if err = tr.RerootLSD(datingConstraints(tr, datingDates), nil, 1000); err != nil {
+		t.Fatal(err)
+	}
+	res, err := tr.LSDating(datingConstraints(tr, datingDates), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(res.Rate-0.01) > 1e-6 || math.Abs(res.TMRCA-2000) > 1e-4 {
+		t.Errorf("Wrong dating after rerooting: rate=%f, tmrca=%f", res.Rate, res.TMRCA)
+	}
+
+	// Constraints on MRCAs, resolved for each candidate root: the MRCA of A and C
+	// is the root only if the tree is rooted between (A,B) and (C,D)
+	tr.UnRoot()
+	tips := make(map[string]*tree.Node)
+	for _, tip := range tr.Tips() {
+		tips[tip.Name()] = tip
+	}
+	mrcas := []tree.MRCADateConstraint{
+		{Tips: []*tree.Node{tips["A"], tips["C"]}, Constraint: tree.DateConstraint{Lower: 2000, Upper: 2000}},
+		{Tips: []*tree.Node{tips["C"], tips["D"]}, Constraint: tree.DateConstraint{Lower: 2008, Upper: 2008}},
+	}
+	if err = tr.RerootLSD(datingConstraints(tr, datingDates), mrcas, 1000); err != nil {
+		t.Fatal(err)
+	}
+	res, err = tr.LSDating(datingConstraints(tr, datingDates), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(res.Rate-0.01) > 1e-6 || math.Abs(res.TMRCA-2000) > 1e-4 {
+		t.Errorf("Wrong dating after rerooting with MRCA constraints: rate=%f, tmrca=%f", res.Rate, res.TMRCA)
+	}
+	mrcas[1].Constraint = tree.DateConstraint{Lower: 2001, Upper: 2000}
+	if err = tr.RerootLSD(datingConstraints(tr, datingDates), mrcas, 1000); err == nil {
+		t.Errorf("Invalid MRCA constraint should return an error")
+	}
+}
+
+func TestLSDatingCI(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader(datingTree)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tr.LSDatingCI(datingConstraints(tr, datingDates), 1000, 100, 0.05)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RateCI[0] > res.RateCI[1] || res.TMRCACI[0] > res.TMRCACI[1] {
+		t.Errorf("Wrong confidence intervals: rate=%v, tmrca=%v", res.RateCI, res.TMRCACI)
+	}
+	if e := tr.Edges()[0]; e.Length() != 0.05 {
+		t.Errorf("Branch lengths should be restored after resampling")
+	}
+}
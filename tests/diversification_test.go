@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+const diversificationTree = "(((A:1,B:1):2,(C:2.5,D:2.5):0.5):1.5,((E:0.5,F:0.5):3,(G:3.2,H:3.2):0.3):1);"
+
+func TestBranchingTimes(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader(diversificationTree)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	times, err := tr.BranchingTimes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []float64{4.5, 3.5, 3.2, 3, 2.5, 1, 0.5}
+	if len(times) != len(expected) {
+		t.Fatalf("There should be %d branching times and there are %d: %v", len(expected), len(times), times)
+	}
+	for i := range times {
+		if math.Abs(times[i]-expected[i]) > 1e-10 {
+			t.Errorf("Branching time %d should be %f and is %f", i, expected[i], times[i])
+		}
+	}
+	tr, _ = newick.NewParser(strings.NewReader("((A:1,B:1):1,C:1.5);")).Parse()
+	if _, err = tr.BranchingTimes(); err == nil {
+		t.Errorf("Branching times of a non ultrametric tree should return an error")
+	}
+}
+
+func TestFitDiversification(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader(diversificationTree)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	times, err := tr.BranchingTimes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Analytical MLE of the pure birth model, with complete sampling
+	sum := 2 * times[0]
+	for _, x := range times[1:] {
+		sum += x
+	}
+	lambda := float64(len(times)-1) / sum
+	yule, err := tree.FitDiversification(times, 1.0, tree.DIV_YULE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(yule.Lambda-lambda) > 1e-6 || yule.Mu != 0 {
+		t.Errorf("Yule lambda should be %f and is %f (mu=%f)", lambda, yule.Lambda, yule.Mu)
+	}
+	if ll := tree.BirthDeathLogLikelihood(times, lambda, 0, 1.0); math.Abs(ll-yule.LogLikelihood) > 1e-8 {
+		t.Errorf("Yule log-likelihood should be %f and is %f", ll, yule.LogLikelihood)
+	}
+	if math.Abs(yule.AIC-(2-2*yule.LogLikelihood)) > 1e-10 {
+		t.Errorf("Wrong AIC: %f", yule.AIC)
+	}
+
+	for _, rho := range []float64{1.0, 0.5} {
+		bd, err := tree.FitDiversification(times, rho, tree.DIV_BD)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The maximum must be better than a grid of parameters
+		for l := 0.05; l < 3; l += 0.05 {
+			for a := 0.0; a < 1; a += 0.05 {
+				if ll := tree.BirthDeathLogLikelihood(times, l, a*l, rho); ll > bd.LogLikelihood+1e-6 {
+					t.Errorf("Birth-death fit (rho=%f) is not optimal: logl(%f,%f)=%f > logl(%f,%f)=%f", rho, l, a*l, ll, bd.Lambda, bd.Mu, bd.LogLikelihood)
+				}
+			}
+		}
+	}
+}
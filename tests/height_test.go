@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+)
+
+func TestNodeHeights(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((A:1,B:2)AB:2,(C:3,D:1.5)CD:1)R;")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	heights, err := tr.NodeHeights()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]float64{"R": 4, "AB": 2, "CD": 3, "A": 1, "B": 0, "C": 0, "D": 1.5}
+	for _, n := range tr.Nodes() {
+		if heights[n] != expected[n.Name()] {
+			t.Errorf("Height of %s should be %f and is %f", n.Name(), expected[n.Name()], heights[n])
+		}
+	}
+	if age, _ := tr.RootAge(); age != 4 {
+		t.Errorf("Root age should be 4 and is %f", age)
+	}
+	if ok, _ := tr.IsUltrametric(1e-6); ok {
+		t.Errorf("Tree should not be ultrametric")
+	}
+	if err = tr.ForceUltrametric(1.0); err == nil {
+		t.Errorf("Forcing ultrametricity with tolerance 1 should return an error")
+	}
+	if err = tr.ForceUltrametric(2.0); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := tr.IsUltrametric(1e-6); !ok {
+		t.Errorf("Tree should be ultrametric: %s", tr.Newick())
+	}
+}
+
+func TestTimeSlice(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((A:1,B:2)AB:2,(C:3,D:1.5)CD:1)R;")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		height   float64
+		clusters []string
+	}{
+		{3.5, []string{"A,B", "C,D"}},
+		{2.5, []string{"A,B", "C", "D"}},
+		{1.2, []string{"A", "B", "C"}},
+		{0, []string{"B", "C"}},
+		{4, []string{}},
+	} {
+		edges, err := tr.TimeSlice(c.height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clusters := make([]string, 0)
+		for _, e := range edges {
+			tips := e.TipsBelow()
+			sort.Strings(tips)
+			clusters = append(clusters, strings.Join(tips, ","))
+		}
+		sort.Strings(clusters)
+		if strings.Join(clusters, " ") != strings.Join(c.clusters, " ") {
+			t.Errorf("Clusters at height %f should be %v and are %v", c.height, c.clusters, clusters)
+		}
+	}
+	if _, err = tr.TimeSlice(math.Inf(1)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/gotree/asr"
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/models"
+)
+
+func TestLogLikelihood(t *testing.T) {
+	al := align.NewAlign(align.NUCLEOTIDS)
+	al.AddSequence("A", "AAAAAAAAAC", "")
+	al.AddSequence("B", "AAAAAAAACA", "")
+	tr, _ := newick.NewParser(strings.NewReader("(A:0.1,B:0.2);")).Parse()
+	m, _ := models.NewModel(models.MODEL_JC69, 0, nil, nil)
+
+	// Analytical JC69 likelihood for two sequences at distance 0.3
+	e := math.Exp(-4.0 / 3.0 * 0.3)
+	expected := 8*math.Log(0.25*(0.25+0.75*e)) + 2*math.Log(0.25*(0.25-0.25*e))
+	lnl, err := models.LogLikelihood(tr, al, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(lnl-expected) > 1e-8 {
+		t.Errorf("Log-likelihood should be %f and is %f", expected, lnl)
+	}
+
+	// Ambiguities and gaps: N and - are missing data, R is A or G
+	al2 := align.NewAlign(align.NUCLEOTIDS)
+	al2.AddSequence("A", "AN-R", "")
+	al2.AddSequence("B", "AAAA", "")
+	p, _ := m.Pij(0.3)
+	expected = math.Log(0.25*p[0][0]) + 2*math.Log(0.25) + math.Log(0.25*p[0][0]+0.25*p[2][0])
+	lnlamb, err := models.LogLikelihood(tr, al2, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(lnlamb-expected) > 1e-8 {
+		t.Errorf("Log-likelihood with ambiguities should be %f and is %f", expected, lnlamb)
+	}
+
+	// Optimized distance is the JC69 distance
+	lnl2, err := models.OptimizeBranchLengths(tr, al, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dist := -0.75 * math.Log(1-4.0/3.0*0.2)
+	if d := tr.Root().Edges()[0].Length() + tr.Root().Edges()[1].Length(); math.Abs(d-dist) > 1e-4 {
+		t.Errorf("Optimized distance should be %f and is %f", dist, d)
+	}
+	if lnl2 < lnl {
+		t.Errorf("Optimized log-likelihood %f should be >= %f", lnl2, lnl)
+	}
+
+	// Errors
+	tr, _ = newick.NewParser(strings.NewReader("(A:0.1,B:0.2,C:0.1);")).Parse()
+	if _, err = models.LogLikelihood(tr, al, m); err == nil {
+		t.Errorf("Tip without sequence should return an error")
+	}
+	tr, _ = newick.NewParser(strings.NewReader("(A,B:0.2);")).Parse()
+	if _, err = models.LogLikelihood(tr, al, m); err == nil {
+		t.Errorf("Branch without length should return an error")
+	}
+	lg, _ := models.NewModel(models.MODEL_LG, 0, nil, nil)
+	if _, err = models.LogLikelihood(tr, al, lg); err == nil {
+		t.Errorf("Nucleotide alignment with a protein model should return an error")
+	}
+}
+
+func TestOptimizeLikelihood(t *testing.T) {
+	rand.Seed(10)
+	truetree := "((A:0.1,B:0.15):0.2,(C:0.1,D:0.05):0.1,E:0.3);"
+	tr, _ := newick.NewParser(strings.NewReader(truetree)).Parse()
+	m, _ := models.NewModel(models.MODEL_HKY, 4.0, nil, []float64{0.3, 0.2, 0.2, 0.3})
+	m.SetRateHeterogeneity(1.0, 4, 0)
+	al, _, err := models.SimulateSequences(tr, m, 5000, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Likelihood does not depend on the position of the root
+	rooted, _ := newick.NewParser(strings.NewReader("(((A:0.1,B:0.15):0.2,(C:0.1,D:0.05):0.1):0.15,E:0.15);")).Parse()
+	l1, _ := models.LogLikelihood(tr, al, m)
+	l2, _ := models.LogLikelihood(rooted, al, m)
+	if math.Abs(l1-l2) > 1e-6 {
+		t.Errorf("Log-likelihoods of rooted (%f) and unrooted (%f) trees should be equal", l2, l1)
+	}
+
+	// Model parameters are estimated
+	start, _ := models.NewModel(models.MODEL_HKY, 1.0, nil, []float64{0.3, 0.2, 0.2, 0.3})
+	start.SetRateHeterogeneity(0.5, 4, 0)
+	tr, _ = newick.NewParser(strings.NewReader("((A,B),(C,D),E);")).Parse()
+	opt, lnl, err := models.OptimizeLikelihood(tr, al, start, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(opt.Kappa()-4.0) > 0.6 {
+		t.Errorf("Optimized kappa should be close to 4 and is %f", opt.Kappa())
+	}
+	if math.Abs(opt.Alpha()-1.0) > 0.3 {
+		t.Errorf("Optimized alpha should be close to 1 and is %f", opt.Alpha())
+	}
+	if start.Kappa() != 1.0 {
+		t.Errorf("Input model should not be modified")
+	}
+	if lnl < l1 {
+		t.Errorf("Optimized log-likelihood %f should be >= true log-likelihood %f", lnl, l1)
+	}
+
+	// Ranking topologies: the true topology has the best likelihood
+	wrong, _ := newick.NewParser(strings.NewReader("((A,C),(B,D),E);")).Parse()
+	_, wlnl, err := models.OptimizeLikelihood(wrong, al, opt, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wlnl >= lnl {
+		t.Errorf("Wrong topology log-likelihood (%f) should be < true topology log-likelihood (%f)", wlnl, lnl)
+	}
+}
+
+func TestAncestralProbabilities(t *testing.T) {
+	al := align.NewAlign(align.NUCLEOTIDS)
+	al.AddSequence("A", "ACGA", "")
+	al.AddSequence("B", "ACTA", "")
+	al.AddSequence("C", "AGTR", "")
+	tr, _ := newick.NewParser(strings.NewReader("(A:0.1,B:0.2,C:0.3)N;")).Parse()
+	lengths := map[string]float64{"A": 0.1, "B": 0.2, "C": 0.3}
+
+	for _, pinv := range []float64{0, 0.3} {
+		m, _ := models.NewModel(models.MODEL_JC69, 0, nil, nil)
+		m.SetRateHeterogeneity(0, 1, pinv)
+		probas, err := models.AncestralProbabilities(tr, al, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := tr.Root()
+		if len(probas) != 1 || len(probas[root]) != 4 {
+			t.Fatalf("Probabilities should be given for 1 internal node and 4 sites")
+		}
+		chars := m.Characters()
+		for site := 0; site < 4; site++ {
+			// Analytical posterior at the center of a star tree
+			expected := make([]float64, 4)
+			sum := 0.0
+			for s := range expected {
+				v := 0.25 * (1 - pinv)
+				constant := true
+				for _, tip := range tr.Tips() {
+					seq, _ := al.GetSequenceChar(tip.Name())
+					p, _ := m.Pij(lengths[tip.Name()] / (1 - pinv))
+					tipv := 0.0
+					for x, c := range chars {
+						if seq[site] == c || (seq[site] == 'R' && (c == 'A' || c == 'G')) {
+							tipv += p[s][x]
+						}
+					}
+					v *= tipv
+					constant = constant && (seq[site] == chars[s] || (seq[site] == 'R' && (chars[s] == 'A' || chars[s] == 'G')))
+				}
+				if constant {
+					v += pinv * 0.25
+				}
+				expected[s] = v
+				sum += v
+			}
+			for s := range expected {
+				if exp := expected[s] / sum; math.Abs(probas[root][site][s]-exp) > 1e-10 {
+					t.Errorf("pinv=%f: posterior of state %c at site %d should be %f and is %f", pinv, chars[s], site, exp, probas[root][site][s])
+				}
+			}
+		}
+	}
+
+	// Ancestral sequences in node comments
+	m, _ := models.NewModel(models.MODEL_JC69, 0, nil, nil)
+	tr, _ = newick.NewParser(strings.NewReader("((A:0.1,B:0.1):0.1,C:0.5);")).Parse()
+	if _, err := asr.MLAsr(tr, al, m); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range tr.Nodes() {
+		if !n.Tip() {
+			if c := n.Comments(); len(c) != 1 || !strings.HasPrefix(c[0], "AC") || len(c[0]) != 4 {
+				t.Errorf("Internal node should be annotated with a sequence starting with AC, and is %v", c)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+func TestLTT(t *testing.T) {
+	// Heterochronous tree: D is sampled 0.5 before the other tips
+	tr, err := newick.NewParser(strings.NewReader("(((A:1,B:1):1,C:2):1,D:2.5);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	points, err := tr.LTT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []tree.LTTPoint{{Time: -3, Lineages: 2}, {Time: -2, Lineages: 3}, {Time: -1, Lineages: 4}, {Time: -0.5, Lineages: 3}, {Time: 0, Lineages: 3}}
+	if len(points) != len(expected) {
+		t.Fatalf("LTT should have %d points and has %d: %v", len(expected), len(points), points)
+	}
+	for i, p := range points {
+		if math.Abs(p.Time-expected[i].Time) > 1e-10 || p.Lineages != expected[i].Lineages {
+			t.Errorf("Point %d should be %v and is %v", i, expected[i], p)
+		}
+	}
+	if l := tree.LTTLineages(points, -1.5); l != 3 {
+		t.Errorf("There should be 3 lineages at time -1.5, and there are %d", l)
+	}
+	if l := tree.LTTLineages(points, -4); l != 0 {
+		t.Errorf("There should be 0 lineages before the root, and there are %d", l)
+	}
+}
+
+func TestLTTEnvelope(t *testing.T) {
+	ltts := [][]tree.LTTPoint{
+		{{Time: -2, Lineages: 2}, {Time: -1, Lineages: 3}, {Time: 0, Lineages: 3}},
+		{{Time: -1, Lineages: 2}, {Time: -0.5, Lineages: 3}, {Time: 0, Lineages: 3}},
+	}
+	env, err := tree.LTTEnvelope(ltts, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []tree.LTTEnvelopePoint{
+		{Time: -2, Mean: 1, Min: 0, Max: 2, Lower: 0, Upper: 2},
+		{Time: -1, Mean: 2.5, Min: 2, Max: 3, Lower: 2, Upper: 3},
+		{Time: 0, Mean: 3, Min: 3, Max: 3, Lower: 3, Upper: 3},
+	}
+	for i, p := range env {
+		if p != expected[i] {
+			t.Errorf("Envelope point %d should be %v and is %v", i, expected[i], p)
+		}
+	}
+}
+
+func TestGammaStatistic(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((A:1,B:1):1,C:2);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gamma, pvalue, err := tr.GammaStatistic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// (2 - 5/2) / (5 * sqrt(1/12))
+	if expected := -0.5 / (5 * math.Sqrt(1.0/12.0)); math.Abs(gamma-expected) > 1e-10 {
+		t.Errorf("Gamma should be %f and is %f", expected, gamma)
+	}
+	if pvalue <= 0 || pvalue > 1 {
+		t.Errorf("Wrong p-value: %f", pvalue)
+	}
+	tr, _ = newick.NewParser(strings.NewReader("((A:1,B:1):1,C:1.5);")).Parse()
+	if _, _, err = tr.GammaStatistic(); err == nil {
+		t.Errorf("Gamma statistic of a non ultrametric tree should return an error")
+	}
+}
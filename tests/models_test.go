@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/models"
+)
+
+func TestModelPij(t *testing.T) {
+	for _, name := range []string{"jc69", "k80", "hky", "gtr", "lg", "wag", "jtt"} {
+		code := models.ModelStringToInt(name)
+		m, err := models.NewModel(code, 3.0, []float64{1, 2, 0.5, 1.5, 3, 1}, []float64{0.1, 0.2, 0.3, 0.4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := m.Pij(0.3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pi := m.Pi()
+		for i := range p {
+			sum := 0.0
+			for j := range p[i] {
+				sum += p[i][j]
+			}
+			if math.Abs(sum-1) > 1e-8 {
+				t.Errorf("Model %s: row %d of P should sum to 1 and sums to %f", name, i, sum)
+			}
+		}
+		// Stationarity: pi.P = pi
+		for j := range pi {
+			sum := 0.0
+			for i := range pi {
+				sum += pi[i] * p[i][j]
+			}
+			if math.Abs(sum-pi[j]) > 1e-8 {
+				t.Errorf("Model %s: pi.P should be equal to pi (state %d: %f vs. %f)", name, j, sum, pi[j])
+			}
+		}
+		// Mean substitution rate is 1: -sum pi_i Q_ii ~ (1 - sum pi_i P_ii(l)) / l for small l
+		p, _ = m.Pij(1e-6)
+		rate := 0.0
+		for i := range pi {
+			rate += pi[i] * (1 - p[i][i])
+		}
+		if rate /= 1e-6; math.Abs(rate-1) > 1e-3 {
+			t.Errorf("Model %s: mean substitution rate should be 1 and is %f", name, rate)
+		}
+	}
+
+	// K80 with kappa=1 is JC69
+	jc, _ := models.NewModel(models.MODEL_JC69, 0, nil, nil)
+	k80, _ := models.NewModel(models.MODEL_K80, 1.0, nil, nil)
+	pjc, _ := jc.Pij(0.5)
+	pk80, _ := k80.Pij(0.5)
+	for i := range pjc {
+		for j := range pjc[i] {
+			if math.Abs(pjc[i][j]-pk80[i][j]) > 1e-8 {
+				t.Errorf("K80(1) P[%d][%d] should be %f and is %f", i, j, pjc[i][j], pk80[i][j])
+			}
+		}
+	}
+
+	if _, err := models.NewModel(models.MODEL_GTR, 0, []float64{1, 1}, nil); err == nil {
+		t.Errorf("GTR model with 2 rates should return an error")
+	}
+	if models.ModelStringToInt("unknown") != -1 {
+		t.Errorf("Unknown model should return -1")
+	}
+}
+
+func TestSimulateSequences(t *testing.T) {
+	rand.Seed(10)
+	tr, err := newick.NewParser(strings.NewReader("((A:0.1,B:0.2):0.05,(C:0,D:0.3)E:0);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := models.NewModel(models.MODEL_JC69, 0, nil, nil)
+	if err = m.SetRateHeterogeneity(0.5, 4, 0.2); err != nil {
+		t.Fatal(err)
+	}
+	tips, internals, err := models.SimulateSequences(tr, m, 2000, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tips.NbSequences() != 4 || tips.Length() != 2000 || tips.Alphabet() != align.NUCLEOTIDS {
+		t.Errorf("Simulated alignment should have 4 nucleotide sequences of length 2000, and has %d of length %d", tips.NbSequences(), tips.Length())
+	}
+	if internals.NbSequences() != 3 {
+		t.Errorf("Ancestral alignment should have 3 sequences and has %d", internals.NbSequences())
+	}
+	// Zero length branches: identical sequences
+	c, _ := tips.GetSequence("C")
+	e, ok := internals.GetSequence("E")
+	if !ok || c != e {
+		t.Errorf("Sequences of C and E should be identical")
+	}
+	// Unnamed internal nodes are named
+	if _, ok = internals.GetSequence("Node0"); !ok {
+		t.Errorf("Root should be named Node0")
+	}
+
+	// Expected proportion of differences under JC69
+	tr, _ = newick.NewParser(strings.NewReader("(A:0.2,B:0.3);")).Parse()
+	m, _ = models.NewModel(models.MODEL_JC69, 0, nil, nil)
+	tips, _, err = models.SimulateSequences(tr, m, 20000, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Root().Name() != "" {
+		t.Errorf("Internal nodes should not be renamed without ancestral sequences")
+	}
+	a, _ := tips.GetSequence("A")
+	b, _ := tips.GetSequence("B")
+	diffs := 0
+	for i := range a {
+		if a[i] != b[i] {
+			diffs++
+		}
+	}
+	expected := 0.75 * (1 - math.Exp(-4.0/3.0*0.5))
+	if p := float64(diffs) / float64(len(a)); math.Abs(p-expected) > 0.015 {
+		t.Errorf("Proportion of differences should be close to %f and is %f", expected, p)
+	}
+
+	// Amino acids
+	m, _ = models.NewModel(models.MODEL_LG, 0, nil, nil)
+	if tips, _, err = models.SimulateSequences(tr, m, 100, false); err != nil {
+		t.Fatal(err)
+	}
+	if tips.Alphabet() != align.AMINOACIDS {
+		t.Errorf("LG simulated alignment should be made of amino acids")
+	}
+
+	tr, _ = newick.NewParser(strings.NewReader("(A,B);")).Parse()
+	if _, _, err = models.SimulateSequences(tr, m, 100, false); err == nil {
+		t.Errorf("Simulation on a tree without branch lengths should return an error")
+	}
+}
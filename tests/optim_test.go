@@ -0,0 +1,26 @@
+package tests
+
+import (
+	"math"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/mutils"
+)
+
+func TestBrentMinimize(t *testing.T) {
+	x, fx := mutils.BrentMinimize(func(x float64) float64 { return (x-2)*(x-2) + 1 }, -10, 10, 1e-10)
+	if math.Abs(x-2) > 1e-6 || math.Abs(fx-1) > 1e-10 {
+		t.Errorf("Minimum should be at 2 (f=1) and is at %f (f=%f)", x, fx)
+	}
+}
+
+func TestNelderMead(t *testing.T) {
+	// Rosenbrock function
+	f := func(x []float64) float64 {
+		return (1-x[0])*(1-x[0]) + 100*(x[1]-x[0]*x[0])*(x[1]-x[0]*x[0])
+	}
+	x, fx := mutils.NelderMead(f, []float64{-1.2, 1}, 0.5, 1e-15, 10000)
+	if math.Abs(x[0]-1) > 1e-4 || math.Abs(x[1]-1) > 1e-4 || fx > 1e-8 {
+		t.Errorf("Minimum should be at (1,1) and is at (%f,%f) (f=%f)", x[0], x[1], fx)
+	}
+}
@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/goalign/align"
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/models"
+	"github.com/evolbioinfo/gotree/parsimony"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+func TestParsimonyScore(t *testing.T) {
+	al := align.NewAlign(align.NUCLEOTIDS)
+	al.AddSequence("A", "AAAAC", "")
+	al.AddSequence("B", "AAACC", "")
+	al.AddSequence("C", "CCAA-", "")
+	al.AddSequence("D", "CCARA", "")
+	tr, _ := newick.NewParser(strings.NewReader("((A,B),(C,D));")).Parse()
+
+	// Sites 1,2: 1 change each; site 3: constant; site 4: 1 change (R contains A);
+	// site 5: 1 change (- is missing data)
+	score, err := parsimony.Score(tr, al)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score != 4 {
+		t.Errorf("Parsimony score should be 4 and is %d", score)
+	}
+	tr2, _ := newick.NewParser(strings.NewReader("((A,C),(B,D));")).Parse()
+	if score, _ = parsimony.Score(tr2, al); score != 6 {
+		t.Errorf("Parsimony score should be 6 and is %d", score)
+	}
+
+	// M = 4 (1 per variable site), G = 2+2+1+1 = 6
+	ci, ri, err := parsimony.Indices(tr, al, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(ci-1.0) > 1e-10 || math.Abs(ri-1.0) > 1e-10 {
+		t.Errorf("CI and RI should be 1 and are %f and %f", ci, ri)
+	}
+	if ci, ri, _ = parsimony.Indices(tr2, al, 6); math.Abs(ci-4.0/6.0) > 1e-10 || math.Abs(ri) > 1e-10 {
+		t.Errorf("CI and RI should be 0.667 and 0 and are %f and %f", ci, ri)
+	}
+
+	tr3, _ := newick.NewParser(strings.NewReader("(A,B,C,D,E);")).Parse()
+	if _, err = parsimony.Score(tr3, al); err == nil {
+		t.Errorf("Multifurcated tree should return an error")
+	}
+
+	// Sequences that are not in the tree are ignored
+	al.AddSequence("E", "GGGGG", "")
+	if score, _ = parsimony.Score(tr, al); score != 4 {
+		t.Errorf("Parsimony score should be 4 and is %d", score)
+	}
+	if ci, ri, _ = parsimony.Indices(tr, al, 4); math.Abs(ci-1.0) > 1e-10 || math.Abs(ri-1.0) > 1e-10 {
+		t.Errorf("CI and RI should be 1 and are %f and %f", ci, ri)
+	}
+	tr4, _ := newick.NewParser(strings.NewReader("((A,B),(C,F));")).Parse()
+	if _, _, err = parsimony.Indices(tr4, al, 4); err == nil {
+		t.Errorf("Tip without sequence should return an error")
+	}
+}
+
+func TestParsimonySearch(t *testing.T) {
+	rand.Seed(10)
+	truetree, _ := newick.NewParser(strings.NewReader("(((T1:0.1,T2:0.1):0.1,(T3:0.1,T4:0.1):0.05):0.1,(T5:0.1,T6:0.1):0.1,T7:0.2);")).Parse()
+	m, _ := models.NewModel(models.MODEL_JC69, 0, nil, nil)
+	al, _, err := models.SimulateSequences(truetree, m, 300, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Exhaustive search
+	trees, err := tree.AllTopologies(7, false, "T1", "T2", "T3", "T4", "T5", "T6", "T7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	best := -1
+	for _, tr := range trees {
+		score, err := parsimony.Score(tr, al)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if best < 0 || score < best {
+			best = score
+		}
+	}
+
+	for _, search := range []int{parsimony.SEARCH_NONE, parsimony.SEARCH_NNI, parsimony.SEARCH_SPR} {
+		rand.Seed(1)
+		results, err := parsimony.Search(al, search, 4, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 4 {
+			t.Fatalf("There should be 4 results and there are %d", len(results))
+		}
+		min := -1
+		for i, r := range results {
+			if r.Replicate != i {
+				t.Errorf("Results should be in the order of the replicates")
+			}
+			score, err := parsimony.Score(r.Tree, al)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if score != r.Score {
+				t.Errorf("Score of the tree (%d) should be the returned score (%d)", score, r.Score)
+			}
+			if len(r.Tree.Tips()) != 7 {
+				t.Errorf("Tree should have 7 tips and has %d", len(r.Tree.Tips()))
+			}
+			if r.CI <= 0 || r.CI > 1 || r.RI < 0 || r.RI > 1 {
+				t.Errorf("CI (%f) and RI (%f) should be in ]0,1]", r.CI, r.RI)
+			}
+			if min < 0 || r.Score < min {
+				min = r.Score
+			}
+		}
+		if search == parsimony.SEARCH_SPR && min != best {
+			t.Errorf("SPR search should find the most parsimonious score %d and found %d", best, min)
+		}
+		if min < best {
+			t.Errorf("Score %d cannot be lower than the most parsimonious score %d", min, best)
+		}
+
+		// Reproducible given the seed, whatever the number of threads
+		rand.Seed(1)
+		results2, _ := parsimony.Search(al, search, 4, 1)
+		for i, r := range results2 {
+			if r.Tree.Newick() != results[i].Tree.Newick() {
+				t.Errorf("Search should be reproducible given the seed: %s vs %s", r.Tree.Newick(), results[i].Tree.Newick())
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+func TestRTTRegression(t *testing.T) {
+	names := []string{"A", "B", "C", "D"}
+	dates := []float64{1995, 2000, 2005, 2010}
+	dists := []float64{2.5, 5, 7.5, 10}
+	reg, err := tree.FitRTTRegression(names, dates, dists)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(reg.Rate-0.5) > 1e-10 || math.Abs(reg.TMRCA-1990) > 1e-8 || math.Abs(reg.R2-1) > 1e-10 || reg.RMS > 1e-10 {
+		t.Errorf("Wrong regression: rate=%f, tmrca=%f, r2=%f, rms=%f", reg.Rate, reg.TMRCA, reg.R2, reg.RMS)
+	}
+	if _, err = tree.FitRTTRegression(names[:2], dates[:2], dists[:2]); err == nil {
+		t.Error("Regression with 2 tips should return an error")
+	}
+}
+
+// Compares the best root found by RerootRTT to a grid search
+// over all the positions of all the edges
+func TestRerootRTT(t *testing.T) {
+	nw := "((A:1,B:2.5):1,(C:3,D:4):2,(E:5,(F:1.5,G:0.5):2):0.5);"
+	dates := map[string]float64{"A": 2000, "B": 2001.5, "C": 2002.2, "D": 2003.5, "E": 2004.5, "F": 2001, "G": 2000.5}
+
+	for _, criterion := range []int{tree.RTT_R2, tree.RTT_RMS} {
+		tr, err := newick.NewParser(strings.NewReader(nw)).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = tr.RerootRTT(dates, criterion); err != nil {
+			t.Fatal(err)
+		}
+		best, err := tr.RootToTipRegression(dates)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ref, _ := newick.NewParser(strings.NewReader(nw)).Parse()
+		for ie := range ref.Edges() {
+			for step := 0; step <= 20; step++ {
+				cur, _ := newick.NewParser(strings.NewReader(nw)).Parse()
+				e := cur.Edges()[ie]
+				if err = cur.RerootEdge(e, e.Length()*float64(step)/20.0); err != nil {
+					t.Fatal(err)
+				}
+				reg, err := cur.RootToTipRegression(dates)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if criterion == tree.RTT_R2 && reg.Rate > 0 && reg.R2 > best.R2+1e-10 {
+					t.Errorf("Root on edge %d at step %d has a better R2 (%f) than the best root (%f)", ie, step, reg.R2, best.R2)
+				}
+				if criterion == tree.RTT_RMS && reg.RMS < best.RMS-1e-10 {
+					t.Errorf("Root on edge %d at step %d has a better RMS (%f) than the best root (%f)", ie, step, reg.RMS, best.RMS)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package tests
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+const signalTree = "(((A:1,B:1):2,(C:2.5,D:2.5):0.5):1.5,((E:0.5,F:0.5):3,G:3.5):1);"
+
+// Inverse and log-determinant of a symmetric positive definite matrix (Gauss-Jordan)
+func invertMatrix(m [][]float64) (inv [][]float64, logdet float64) {
+	n := len(m)
+	a := make([][]float64, n)
+	inv = make([][]float64, n)
+	for i := range m {
+		a[i] = append([]float64(nil), m[i]...)
+		inv[i] = make([]float64, n)
+		inv[i][i] = 1
+	}
+	for i := 0; i < n; i++ {
+		p := a[i][i]
+		logdet += math.Log(p)
+		for k := 0; k < n; k++ {
+			a[i][k] /= p
+			inv[i][k] /= p
+		}
+		for j := 0; j < n; j++ {
+			if j != i {
+				f := a[j][i]
+				for k := 0; k < n; k++ {
+					a[j][k] -= f * a[i][k]
+					inv[j][k] -= f * inv[i][k]
+				}
+			}
+		}
+	}
+	return
+}
+
+// Phylogenetic covariance matrix of the tips (shared path lengths from the root),
+// off-diagonal elements being multiplied by lambda
+func covarianceMatrix(tr *tree.Tree, tips []*tree.Node, lambda float64) [][]float64 {
+	ancestors := func(n *tree.Node) map[*tree.Node]float64 {
+		anc := make(map[*tree.Node]float64)
+		for n != tr.Root() {
+			p, _ := n.Parent()
+			e, _ := n.ParentEdge()
+			anc[n] = e.Length()
+			n = p
+		}
+		return anc
+	}
+	c := make([][]float64, len(tips))
+	for i, a := range tips {
+		c[i] = make([]float64, len(tips))
+		anca := ancestors(a)
+		for j, b := range tips {
+			for n, l := range ancestors(b) {
+				if _, ok := anca[n]; ok {
+					c[i][j] += l
+				}
+			}
+			if i != j {
+				c[i][j] *= lambda
+			}
+		}
+	}
+	return c
+}
+
+// GLS phylogenetic mean, and quadratic form (x-a)'C^-1(x-a)
+func glsFit(x []float64, inv [][]float64) (a, q float64) {
+	num, den := 0.0, 0.0
+	for i := range x {
+		for j := range x {
+			num += inv[i][j] * x[j]
+			den += inv[i][j]
+		}
+	}
+	a = num / den
+	for i := range x {
+		for j := range x {
+			q += (x[i] - a) * inv[i][j] * (x[j] - a)
+		}
+	}
+	return
+}
+
+func TestIndependentContrasts(t *testing.T) {
+	tr, _ := newick.NewParser(strings.NewReader("((A:1,B:1)n1:1,C:2)root;")).Parse()
+	values := map[string][]float64{"A": {0, 1}, "B": {2, 1}, "C": {4, 3}}
+	contrasts, err := tr.IndependentContrasts(values, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contrasts) != 2 {
+		t.Fatalf("There should be 2 contrasts and there are %d", len(contrasts))
+	}
+	// Root: (1-4)/sqrt(1.5+2) and (1-3)/sqrt(3.5), n1: (0-2)/sqrt(2) and 0
+	expected := []struct {
+		name     string
+		variance float64
+		values   []float64
+	}{
+		{"root", 3.5, []float64{-3 / math.Sqrt(3.5), -2 / math.Sqrt(3.5)}},
+		{"n1", 2, []float64{-2 / math.Sqrt(2), 0}},
+	}
+	for i, exp := range expected {
+		c := contrasts[i]
+		if c.Node.Name() != exp.name || math.Abs(c.Variance-exp.variance) > 1e-10 {
+			t.Errorf("Contrast %d should be on node %s with variance %f, and is on %s with variance %f", i, exp.name, exp.variance, c.Node.Name(), c.Variance)
+		}
+		for d, v := range exp.values {
+			if math.Abs(c.Values[d]-v) > 1e-10 {
+				t.Errorf("Contrast %d of trait %d should be %f and is %f", i, d, v, c.Values[d])
+			}
+		}
+	}
+
+	// Sum of squared contrasts: (x-a)'C^-1(x-a)
+	tr, _ = newick.NewParser(strings.NewReader(signalTree)).Parse()
+	rand.Seed(10)
+	values = make(map[string][]float64)
+	tips := tr.Tips()
+	x := make([]float64, len(tips))
+	for i, n := range tips {
+		x[i] = rand.NormFloat64()
+		values[n.Name()] = []float64{x[i]}
+	}
+	if contrasts, err = tr.IndependentContrasts(values, 1); err != nil {
+		t.Fatal(err)
+	}
+	sumsq := 0.0
+	for _, c := range contrasts {
+		sumsq += c.Values[0] * c.Values[0]
+	}
+	inv, _ := invertMatrix(covarianceMatrix(tr, tips, 1))
+	if _, q := glsFit(x, inv); math.Abs(q-sumsq) > 1e-10 {
+		t.Errorf("Sum of squared contrasts should be %f and is %f", q, sumsq)
+	}
+
+	tr, _ = newick.NewParser(strings.NewReader("((A:1,B:1):1,C:2,D:1);")).Parse()
+	values["A"], values["B"], values["C"], values["D"] = []float64{0}, []float64{0}, []float64{0}, []float64{0}
+	if _, err = tr.IndependentContrasts(values, 1); err == nil {
+		t.Errorf("Unrooted tree should return an error")
+	}
+}
+
+func TestPhylogeneticSignal(t *testing.T) {
+	tr, _ := newick.NewParser(strings.NewReader(signalTree)).Parse()
+	tips := tr.Tips()
+	n := float64(len(tips))
+	values := make(map[string][]float64)
+	x := make([]float64, len(tips))
+	rand.Seed(10)
+	for i, tip := range tips {
+		x[i] = rand.NormFloat64()
+		// Second trait: strongly conserved (first clade vs second clade)
+		y := 10.0
+		if strings.ContainsAny(tip.Name(), "ABCD") {
+			y = 0.0
+		}
+		values[tip.Name()] = []float64{x[i], y + 0.1*rand.NormFloat64()}
+	}
+
+	// Blomberg's K: (x-a)'(x-a)/(x-a)'C^-1(x-a) / ((tr(C)-n/(1'C^-1 1))/(n-1))
+	c := covarianceMatrix(tr, tips, 1)
+	inv, _ := invertMatrix(c)
+	a, q := glsFit(x, inv)
+	mse0, trc, sum := 0.0, 0.0, 0.0
+	for i := range x {
+		mse0 += (x[i] - a) * (x[i] - a)
+		trc += c[i][i]
+		for j := range x {
+			sum += inv[i][j]
+		}
+	}
+	expk := mse0 / q / ((trc - n/sum) / (n - 1))
+	k, p, err := tr.BlombergK(values, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(k-expk) > 1e-10 || !math.IsNaN(p) {
+		t.Errorf("K should be %f (p-value NaN) and is %f (p-value %f)", expk, k, p)
+	}
+	rand.Seed(1)
+	k, p, _ = tr.BlombergK(values, 1, 999)
+	if k <= 1 || p > 0.05 {
+		t.Errorf("Conserved trait should have K>1 and a low p-value, and has K=%f, p-value=%f", k, p)
+	}
+	rand.Seed(1)
+	if _, p2, _ := tr.BlombergK(values, 1, 999); p2 != p {
+		t.Errorf("Permutation p-value should be reproducible given the seed")
+	}
+
+	// Pagel's lambda: maximum of the likelihood with transformed covariances
+	loglik := func(lambda float64) float64 {
+		inv, logdet := invertMatrix(covarianceMatrix(tr, tips, lambda))
+		_, q := glsFit(x, inv)
+		sigma2 := q / n
+		return -0.5 * (n*math.Log(2*math.Pi*sigma2) + logdet + n)
+	}
+	lambda, lnl, lnl0, p, err := tr.PagelLambda(values, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(lnl-loglik(lambda)) > 1e-8 || math.Abs(lnl0-loglik(0)) > 1e-8 {
+		t.Errorf("Log-likelihoods should be %f and %f and are %f and %f", loglik(lambda), loglik(0), lnl, lnl0)
+	}
+	for l := 0.0; l <= 1.0; l += 0.05 {
+		if loglik(l) > lnl+1e-8 {
+			t.Errorf("Log-likelihood with lambda=%f (%f) is greater than the maximum (%f, lambda=%f)", l, loglik(l), lnl, lambda)
+		}
+	}
+	if p < 0 || p > 1 {
+		t.Errorf("P-value should be in [0,1] and is %f", p)
+	}
+	if lambda, _, _, p, _ = tr.PagelLambda(values, 1); lambda < 0.9 || p > 0.05 {
+		t.Errorf("Conserved trait should have lambda close to 1 and a low p-value, and has lambda=%f, p-value=%f", lambda, p)
+	}
+}
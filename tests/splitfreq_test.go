@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+/*
+ Function to test split frequencies and ASDSF
+ between two runs of 4 trees
+*/
+func TestSplitFrequencies(t *testing.T) {
+	runs := [][]string{
+		{
+			"((A,B),C,(D,E));",
+			"((A,B),C,(D,E));",
+			"((A,C),B,(D,E));",
+			"((A,B),C,(D,E));",
+		},
+		{
+			"((A,B),C,(D,E));",
+			"((A,C),B,(D,E));",
+			"((A,C),B,(D,E));",
+			"(((A,B),C),(D,E));",
+		},
+	}
+
+	splitruns := tree.NewSplitRuns(len(runs))
+	for r, run := range runs {
+		for _, s := range run {
+			tr, err := newick.NewParser(strings.NewReader(s)).Parse()
+			if err != nil {
+				t.Error(err)
+			}
+			if err = splitruns.AddTree(r, tr); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	if splitruns.NbTrees(0) != 4 || splitruns.NbTrees(1) != 4 {
+		t.Errorf("Wrong number of trees: %d and %d", splitruns.NbTrees(0), splitruns.NbTrees(1))
+	}
+
+	freqs, err := splitruns.Frequencies([]int{0, 0}, []int{4, 4})
+	if err != nil {
+		t.Error(err)
+	}
+	expected := map[string][]float64{
+		"D,E": {1.0, 1.0},
+		"A,B": {0.75, 0.5},
+		"A,C": {0.25, 0.5},
+	}
+	if len(freqs) != len(expected) {
+		t.Errorf("Wrong number of splits: %d instead of %d", len(freqs), len(expected))
+	}
+	for _, sf := range freqs {
+		name := strings.Join(splitruns.SplitTips(sf), ",")
+		exp, ok := expected[name]
+		if !ok {
+			t.Errorf("Split %s should not exist", name)
+			continue
+		}
+		for r, f := range sf.Freqs {
+			if f != exp[r] {
+				t.Errorf("Frequency of split %s in run %d should be %f and is %f", name, r, exp[r], f)
+			}
+		}
+	}
+
+	asdsf, msdsf := tree.ASDSF(freqs, 0.1)
+	sd := math.Sqrt(2 * 0.125 * 0.125)
+	if math.Abs(asdsf-2*sd/3) > 1e-10 {
+		t.Errorf("ASDSF should be %f and is %f", 2*sd/3, asdsf)
+	}
+	if math.Abs(msdsf-sd) > 1e-10 {
+		t.Errorf("MSDSF should be %f and is %f", sd, msdsf)
+	}
+
+	// With burnin of 2 trees
+	freqs, err = splitruns.Frequencies([]int{2, 2}, []int{4, 4})
+	if err != nil {
+		t.Error(err)
+	}
+	asdsf, _ = tree.ASDSF(freqs, 0.1)
+	if asdsf != 0 {
+		t.Errorf("ASDSF should be 0 and is %f", asdsf)
+	}
+
+	if _, err = splitruns.Frequencies([]int{4, 0}, []int{4, 4}); err == nil {
+		t.Error("An empty tree range should return an error")
+	}
+}
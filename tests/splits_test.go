@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+func splitsTestTrees(t *testing.T, newicks []string) <-chan tree.Trees {
+	treechan := make(chan tree.Trees, len(newicks))
+	for i, s := range newicks {
+		tr, err := newick.NewParser(strings.NewReader(s)).Parse()
+		if err != nil {
+			t.Error(err)
+		}
+		treechan <- tree.Trees{Tree: tr, Id: i}
+	}
+	close(treechan)
+	return treechan
+}
+
+/*
+ Function to test consensus splits and splits graph
+ with two incompatible splits (A,B vs. A,C)
+*/
+func TestConsensusSplits(t *testing.T) {
+	trees := []string{
+		"((A:1,B:1):1,C:1,(D:1,E:1):2);",
+		"((A:1,C:1):1,B:1,(D:1,E:1):2);",
+		"((A:1,B:1):3,C:1,(D:1,E:1):2);",
+	}
+
+	splits, err := tree.ConsensusSplits(splitsTestTrees(t, trees), 0.3)
+	if err != nil {
+		t.Error(err)
+	}
+	// 5 trivial splits + D,E + A,B + A,C
+	if len(splits.Splits()) != 8 {
+		t.Errorf("There should be 8 splits and there are %d", len(splits.Splits()))
+	}
+	if splits.Compatible() {
+		t.Error("Splits should not be compatible")
+	}
+	for _, s := range splits.Splits() {
+		if s.Bitset().Count() == 2 && s.Bitset().Test(3) && s.Bitset().Test(4) {
+			if s.Weight() != 2 || s.Confidence() != 1 {
+				t.Errorf("Split D,E should have weight 2 and confidence 1: %f, %f", s.Weight(), s.Confidence())
+			}
+		}
+	}
+
+	// One box: 5 tip nodes + 5 internal nodes, 10 edges
+	g := splits.Graph()
+	if len(g.Nodes()) != 10 {
+		t.Errorf("Splits graph should have 10 nodes and has %d", len(g.Nodes()))
+	}
+	if len(g.Edges()) != 10 {
+		t.Errorf("Splits graph should have 10 edges and has %d", len(g.Edges()))
+	}
+
+	// Only compatible splits: the graph is a tree
+	if splits, err = tree.ConsensusSplits(splitsTestTrees(t, trees), 0.5); err != nil {
+		t.Error(err)
+	}
+	if !splits.Compatible() {
+		t.Error("Splits should be compatible")
+	}
+	g = splits.Graph()
+	if len(g.Edges()) != len(g.Nodes())-1 {
+		t.Errorf("Splits graph should be a tree: %d nodes and %d edges", len(g.Nodes()), len(g.Edges()))
+	}
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/models"
+)
+
+func TestDiscreteModelPij(t *testing.T) {
+	m, err := models.NewMkModel([]string{"0", "1"}, 0.7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []float64{0, 0.01, 0.5, 3, 50} {
+		p := m.Pij(l)
+		expected := 0.5 + 0.5*math.Exp(-2*0.7*l)
+		if math.Abs(p[0][0]-expected) > 1e-8 || math.Abs(p[1][0]-(1-expected)) > 1e-8 {
+			t.Errorf("P(%f)[0][0] should be %f and is %f", l, expected, p[0][0])
+		}
+	}
+
+	// Asymmetric rates: stationary distribution is (b/(a+b), a/(a+b))
+	m, err = models.NewDiscreteModel([]string{"A", "B"}, [][]float64{{0, 1}, {3, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := m.Pij(100); math.Abs(p[0][0]-0.75) > 1e-8 || math.Abs(p[1][0]-0.75) > 1e-8 {
+		t.Errorf("Stationary probability of A should be 0.75 and is %f", p[0][0])
+	}
+	if _, err = models.NewDiscreteModel([]string{"A", "A"}, [][]float64{{0, 1}, {3, 0}}); err == nil {
+		t.Errorf("Discrete model with duplicated states should return an error")
+	}
+}
+
+func TestSimulateTraits(t *testing.T) {
+	rand.Seed(10)
+	tr, err := newick.NewParser(strings.NewReader("((A:1,B:2):0.5,(C:0.2,D:0.3):0.4);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nbsim := 5000
+	var sumbm, sum2bm, sumou, sum2ou float64
+	for i := 0; i < nbsim; i++ {
+		values, err := models.SimulateBM(tr, 2.0, 0.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tips, _ := tr.SelectNodes("B")
+		sumbm += values[tips[0]]
+		sum2bm += values[tips[0]] * values[tips[0]]
+
+		if values, err = models.SimulateOU(tr, 2.0, 0.5, 10, -1); err != nil {
+			t.Fatal(err)
+		}
+		sumou += values[tips[0]]
+		sum2ou += values[tips[0]] * values[tips[0]]
+	}
+	n := float64(nbsim)
+	// B is at distance 2.5 from the root
+	if mean, v := sumbm/n, sum2bm/n-sumbm*sumbm/n/n; math.Abs(mean-2.0) > 0.1 || math.Abs(v-1.25) > 0.1 {
+		t.Errorf("BM: mean and variance of B should be close to 2 and 1.25, and are %f and %f", mean, v)
+	}
+	// Stationary distribution of the OU process: N(theta, sigma2/(2alpha))
+	if mean, v := sumou/n, sum2ou/n-sumou*sumou/n/n; math.Abs(mean+1) > 0.01 || math.Abs(v-0.025) > 0.005 {
+		t.Errorf("OU: mean and variance of B should be close to -1 and 0.025, and are %f and %f", mean, v)
+	}
+
+	m, _ := models.NewMkModel([]string{"x", "y", "z"}, 0)
+	states, err := models.SimulateDiscreteTrait(tr, m, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range tr.Nodes() {
+		if states[node] != 2 {
+			t.Errorf("With a rate of 0, all the nodes should have the root state, and %s has state %d", node.Name(), states[node])
+		}
+	}
+	if _, err = tr.SelectNodes("Node0"); err != nil || tr.Root().Name() != "Node0" {
+		t.Errorf("The root should be named Node0")
+	}
+
+	tr, _ = newick.NewParser(strings.NewReader("((A,B),C);")).Parse()
+	if _, err = models.SimulateBM(tr, 0, 1); err == nil {
+		t.Errorf("Simulation on a tree without branch lengths should return an error")
+	}
+}
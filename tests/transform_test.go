@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Distances from the root of all the nodes, by name
+func transformDepths(tr *tree.Tree) map[string]float64 {
+	depths := make(map[string]float64)
+	tr.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		if prev != nil {
+			depths[cur.Name()] = depths[prev.Name()] + e.Length()
+		}
+		return true
+	})
+	return depths
+}
+
+func TestTransformLengths(t *testing.T) {
+	nw := "((A:1,B:2)n1:1,(C:0.5,D:0.5)n2:2.5)root;"
+	tests := []struct {
+		model    int
+		param    float64
+		expected map[string]float64
+	}{
+		// Root-to-tip distances are kept, internal branches are halved
+		{tree.TRANSFORM_LAMBDA, 0.5, map[string]float64{"n1": 0.5, "A": 2, "B": 3, "n2": 1.25, "C": 3, "D": 3}},
+		{tree.TRANSFORM_LAMBDA, 0, map[string]float64{"n1": 0, "A": 2, "B": 3, "n2": 0, "C": 3, "D": 3}},
+		{tree.TRANSFORM_KAPPA, 0, map[string]float64{"n1": 1, "A": 2, "B": 2, "n2": 1, "C": 2, "D": 2}},
+		{tree.TRANSFORM_KAPPA, 2, map[string]float64{"n1": 1, "A": 2, "B": 5, "n2": 6.25, "C": 6.5, "D": 6.5}},
+		// T=3, d -> 3*(d/3)^2
+		{tree.TRANSFORM_DELTA, 2, map[string]float64{"n1": 1.0 / 3, "A": 4.0 / 3, "B": 3, "n2": 6.25 / 3, "C": 3, "D": 3}},
+		{tree.TRANSFORM_DELTA, 1, map[string]float64{"n1": 1, "A": 2, "B": 3, "n2": 2.5, "C": 3, "D": 3}},
+		{tree.TRANSFORM_OU, 0, map[string]float64{"n1": 1, "A": 2, "B": 3, "n2": 2.5, "C": 3, "D": 3}},
+		// 4 tips: heights (nb tips below - 1)/3
+		{tree.TRANSFORM_GRAFEN, 1, map[string]float64{"n1": 2.0 / 3, "A": 1, "B": 1, "n2": 2.0 / 3, "C": 1, "D": 1}},
+		{tree.TRANSFORM_GRAFEN, 0.5, map[string]float64{"n1": 1 - math.Sqrt(1.0/3), "A": 1, "B": 1, "n2": 1 - math.Sqrt(1.0/3), "C": 1, "D": 1}},
+	}
+	for _, test := range tests {
+		tr, _ := newick.NewParser(strings.NewReader(nw)).Parse()
+		if err := tr.TransformLengths(test.model, test.param); err != nil {
+			t.Fatal(err)
+		}
+		depths := transformDepths(tr)
+		for name, d := range test.expected {
+			if math.Abs(depths[name]-d) > 1e-10 {
+				t.Errorf("Model %d (%f): depth of %s should be %f and is %f (%s)", test.model, test.param, name, d, depths[name], tr.Newick())
+			}
+		}
+	}
+
+	// Ornstein-Uhlenbeck: tip covariances on the transformed tree
+	alpha := 0.7
+	tr, _ := newick.NewParser(strings.NewReader(diversificationTree)).Parse()
+	shared := make(map[[2]string]float64)
+	for _, a := range tr.Tips() {
+		for _, b := range tr.Tips() {
+			shared[[2]string{a.Name(), b.Name()}] = tipSharedDepth(tr, a, b)
+		}
+	}
+	if err := tr.TransformLengths(tree.TRANSFORM_OU, alpha); err != nil {
+		t.Fatal(err)
+	}
+	T := 4.5
+	for _, a := range tr.Tips() {
+		for _, b := range tr.Tips() {
+			s := shared[[2]string{a.Name(), b.Name()}]
+			exp := math.Exp(-2*alpha*(T-s)) * (1 - math.Exp(-2*alpha*s)) / (2 * alpha)
+			if c := tipSharedDepth(tr, a, b); math.Abs(c-exp) > 1e-10 {
+				t.Errorf("OU covariance of %s and %s should be %f and is %f", a.Name(), b.Name(), exp, c)
+			}
+		}
+	}
+
+	// Errors
+	tr, _ = newick.NewParser(strings.NewReader("((A:1,B:2):1,C:1,D:1);")).Parse()
+	if err := tr.TransformLengths(tree.TRANSFORM_LAMBDA, 0.5); err == nil {
+		t.Errorf("Unrooted tree should return an error")
+	}
+	if err := tr.TransformLengths(tree.TRANSFORM_KAPPA, 0.5); err != nil {
+		t.Errorf("Kappa should be applicable to unrooted trees: %v", err)
+	}
+	tr, _ = newick.NewParser(strings.NewReader(nw)).Parse()
+	for _, test := range []struct {
+		model int
+		param float64
+	}{{tree.TRANSFORM_LAMBDA, 1.5}, {tree.TRANSFORM_KAPPA, -1}, {tree.TRANSFORM_DELTA, 0}, {tree.TRANSFORM_OU, -1}, {tree.TRANSFORM_GRAFEN, 0}} {
+		if err := tr.TransformLengths(test.model, test.param); err == nil {
+			t.Errorf("Model %d with parameter %f should return an error", test.model, test.param)
+		}
+	}
+	tr, _ = newick.NewParser(strings.NewReader("((A,B),(C,D));")).Parse()
+	if err := tr.TransformLengths(tree.TRANSFORM_DELTA, 2); err == nil {
+		t.Errorf("Branches without length should return an error")
+	}
+	if err := tr.TransformLengths(tree.TRANSFORM_GRAFEN, 1); err != nil {
+		t.Errorf("Grafen's method should not need branch lengths: %v", err)
+	}
+}
+
+// Distance from the root to the most recent common ancestor of two tips
+func tipSharedDepth(tr *tree.Tree, a, b *tree.Node) float64 {
+	depths := make(map[*tree.Node]float64)
+	tr.PreOrder(func(cur *tree.Node, prev *tree.Node, e *tree.Edge) (keep bool) {
+		if prev != nil {
+			depths[cur] = depths[prev] + e.Length()
+		}
+		return true
+	})
+	ancestors := make(map[*tree.Node]bool)
+	for n := a; ; {
+		ancestors[n] = true
+		p, err := n.Parent()
+		if err != nil {
+			break
+		}
+		n = p
+	}
+	for n := b; ; {
+		if ancestors[n] {
+			return depths[n]
+		}
+		n, _ = n.Parent()
+	}
+}
@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+func TestRandomBirthDeathTree(t *testing.T) {
+	rand.Seed(10)
+	for i := 0; i < 20; i++ {
+		tr, err := tree.RandomBirthDeathTree(50, 0, 2.0, 1.0, 0.5, false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tr.Tips()) != 50 {
+			t.Errorf("Reconstructed tree should have 50 tips and has %d", len(tr.Tips()))
+		}
+		// Reconstructed trees are binary and ultrametric
+		if _, err = tr.BranchingTimes(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	tr, err := tree.RandomBirthDeathTree(0, 3, 2.0, 1.0, 1.0, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heights, err := tr.NodeHeights()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age := heights[tr.Root()]; age-3 > 1e-8 {
+		t.Errorf("The complete tree should have a duration <= 3 and has %f", age)
+	}
+	for _, tip := range tr.Tips() {
+		extinct := strings.HasPrefix(tip.Name(), "ExtinctTip")
+		if !extinct && heights[tip] > 1e-8 {
+			t.Errorf("Extant tip %s should have height 0 and has height %f", tip.Name(), heights[tip])
+		}
+	}
+
+	if _, err = tree.RandomBirthDeathTree(10, 0, 0, 1, 1, false, true); err == nil {
+		t.Errorf("Birth-death tree with birth rate 0 should return an error")
+	}
+}
+
+func TestRandomBirthDeathTreeEstimation(t *testing.T) {
+	rand.Seed(1)
+	sum := 0.0
+	for i := 0; i < 20; i++ {
+		tr, err := tree.RandomBirthDeathTree(100, 0, 1.0, 0, 1.0, false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		times, err := tr.BranchingTimes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fit, err := tree.FitDiversification(times, 1.0, tree.DIV_YULE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum += fit.Lambda
+	}
+	if mean := sum / 20; mean < 0.9 || mean > 1.1 {
+		t.Errorf("Mean estimated birth rate of pure birth trees (rate 1) should be close to 1 and is %f", mean)
+	}
+}
+
+func TestPopulationSizes(t *testing.T) {
+	c := &tree.ConstantPopSize{N: 2}
+	if ct := c.CoalescentTime(1, 0.5); math.Abs(ct-2) > 1e-10 {
+		t.Errorf("Constant coalescent time should be 2 and is %f", ct)
+	}
+	e := &tree.ExponentialPopSize{N0: 1, Growth: 1}
+	// integral of exp(s) between 0 and log(2) is 1
+	if ct := e.CoalescentTime(0, 1); math.Abs(ct-math.Log(2)) > 1e-10 {
+		t.Errorf("Exponential coalescent time should be %f and is %f", math.Log(2), ct)
+	}
+	e = &tree.ExponentialPopSize{N0: 1, Growth: -1}
+	if ct := e.CoalescentTime(0, 2); !math.IsInf(ct, 1) {
+		t.Errorf("Coalescent time in a declining population should be infinite and is %f", ct)
+	}
+	p := &tree.PiecewisePopSize{Times: []float64{1, 3}, Sizes: []float64{1, 2, 4}}
+	tests := []struct{ from, x, expected float64 }{
+		{0, 0.5, 0.5},
+		{0, 1.5, 2},
+		{0, 3, 7},
+		{1, 1, 3},
+		{2, 0.25, 2.5},
+		{4, 1, 8},
+	}
+	for _, test := range tests {
+		if ct := p.CoalescentTime(test.from, test.x); math.Abs(ct-test.expected) > 1e-10 {
+			t.Errorf("Piecewise coalescent time from %f (x=%f) should be %f and is %f", test.from, test.x, test.expected, ct)
+		}
+	}
+}
+
+func TestRandomCoalescentTree(t *testing.T) {
+	rand.Seed(10)
+	names := []string{"A", "B", "C", "D", "E", "F", "G", "H", "I", "J"}
+	n := float64(len(names))
+	sum := 0.0
+	nbtrees := 2000
+	for i := 0; i < nbtrees; i++ {
+		tr, err := tree.RandomCoalescentTree(names, nil, &tree.ConstantPopSize{N: 2}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		times, err := tr.BranchingTimes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum += times[0]
+	}
+	// Expected TMRCA: 2N(1-1/n)
+	if mean, expected := sum/float64(nbtrees), 4*(1-1/n); math.Abs(mean-expected) > 0.2 {
+		t.Errorf("Mean TMRCA should be close to %f and is %f", expected, mean)
+	}
+
+	heights := []float64{0, 0, 1, 1, 2.5, 0, 3, 0.5, 0, 2}
+	tr, err := tree.RandomCoalescentTree(names, heights, &tree.ExponentialPopSize{N0: 5, Growth: 0.5}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeheights, err := tr.NodeHeights()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.Tips()) != len(names) {
+		t.Errorf("Tree should have %d tips and has %d", len(names), len(tr.Tips()))
+	}
+	for i, name := range names {
+		tip, err := tr.SelectNodes(name)
+		if err != nil || len(tip) != 1 {
+			t.Fatalf("Tip %s not found", name)
+		}
+		if math.Abs(nodeheights[tip[0]]-heights[i]) > 1e-8 {
+			t.Errorf("Tip %s should have height %f and has height %f", name, heights[i], nodeheights[tip[0]])
+		}
+	}
+
+	if _, err = tree.RandomCoalescentTree(names, nil, &tree.ExponentialPopSize{N0: 1, Growth: -10}, true); err == nil {
+		t.Errorf("Coalescent tree in a declining population that never coalesces should return an error")
+	}
+}
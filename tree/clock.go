@@ -0,0 +1,82 @@
+package tree
+
+import (
+	"errors"
+	"math"
+
+	"github.com/fredericlemoine/gostats"
+)
+
+// Molecular clock models used by SimulateClock
+const (
+	CLOCK_STRICT = iota // Strict clock: the same rate on every branch
+	CLOCK_UCLN          // Uncorrelated lognormal relaxed clock
+	CLOCK_UCED          // Uncorrelated exponential relaxed clock
+	CLOCK_ACLN          // Autocorrelated lognormal relaxed clock
+)
+
+// Transforms a time tree into a substitution tree: each branch length
+// (in time units) is multiplied by a substitution rate drawn according
+// to the given clock model:
+//	* CLOCK_STRICT: all the rates are equal to rate
+//	* CLOCK_UCLN: rates are drawn independently from a lognormal distribution
+//	  of mean rate, and of standard deviation sigma on the log scale
+//	* CLOCK_UCED: rates are drawn independently from an exponential distribution
+//	  of mean rate
+//	* CLOCK_ACLN: the rate of the root is rate, and the rate of a node is drawn
+//	  from a lognormal distribution whose mean is the rate of its parent, and whose
+//	  log variance is sigma^2*t (t: length of the branch). The rate of a branch
+//	  is the mean of the rates of its two nodes. The tree is considered rooted at its
+//	  root node (the pseudo root for unrooted trees).
+//
+// Returns the rates of the branches. Returns an error if a branch does not have
+// a length, or if the parameters are not valid.
+func (t *Tree) SimulateClock(model int, rate, sigma float64) (map[*Edge]float64, error) {
+	if rate <= 0 {
+		return nil, errors.New("Mean substitution rate must be > 0")
+	}
+	if sigma < 0 {
+		return nil, errors.New("Clock standard deviation must be >= 0")
+	}
+	edges := t.Edges()
+	for _, e := range edges {
+		if e.Length() == NIL_LENGTH {
+			return nil, errors.New("Some branches have no length")
+		}
+	}
+
+	rates := make(map[*Edge]float64, len(edges))
+	switch model {
+	case CLOCK_STRICT:
+		for _, e := range edges {
+			rates[e] = rate
+		}
+	case CLOCK_UCLN:
+		for _, e := range edges {
+			rates[e] = math.Exp(gostats.Normal(math.Log(rate)-sigma*sigma/2.0, sigma))
+		}
+	case CLOCK_UCED:
+		for _, e := range edges {
+			rates[e] = gostats.Exp(1.0 / rate)
+		}
+	case CLOCK_ACLN:
+		noderates := make(map[*Node]float64)
+		t.PreOrder(func(cur *Node, prev *Node, e *Edge) (keep bool) {
+			if prev == nil {
+				noderates[cur] = rate
+				return true
+			}
+			v := sigma * sigma * e.Length()
+			noderates[cur] = math.Exp(gostats.Normal(math.Log(noderates[prev])-v/2.0, math.Sqrt(v)))
+			rates[e] = (noderates[prev] + noderates[cur]) / 2.0
+			return true
+		})
+	default:
+		return nil, errors.New("Unknown clock model")
+	}
+
+	for _, e := range edges {
+		e.SetLength(e.Length() * rates[e])
+	}
+	return rates, nil
+}
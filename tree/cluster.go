@@ -0,0 +1,215 @@
+package tree
+
+import (
+	"errors"
+	"math"
+)
+
+// Tip clustering criteria used by ClusterTips
+const (
+	CLUSTER_MAX_CLADE      = iota // Clades whose maximum pairwise distance is <= threshold
+	CLUSTER_AVG_CLADE             // Clades whose average pairwise distance is <= threshold
+	CLUSTER_SINGLE_LINKAGE        // Single-linkage clusters of tips at distance <= threshold
+)
+
+// Cluster of tips given by ClusterTips
+type TipCluster struct {
+	Id       int     // Identifier of the cluster (starting at 1)
+	Tips     []*Node // Tips of the cluster
+	Edge     *Edge   // Branch above the clade of the cluster (nil for single-linkage clusters, or if the clade is the whole tree)
+	MaxDist  float64 // Maximum pairwise patristic distance between the tips
+	MeanDist float64 // Average pairwise patristic distance between the tips
+}
+
+// Pairwise distances of the tips of a clade, computed from the children clades
+type cladeDistances struct {
+	ntips  int     // Number of tips of the clade
+	depth  float64 // Largest distance from the root of the clade to its tips
+	sumtip float64 // Sum of the distances from the root of the clade to its tips
+	sum    float64 // Sum of the pairwise distances between the tips
+	max    float64 // Maximum pairwise distance between the tips
+}
+
+// Clusters the tips of the tree given pairwise patristic distances (as TreeCluster
+// or Cluster Picker), considering the tree rooted at its root node (the pseudo root
+// for unrooted trees):
+//   - CLUSTER_MAX_CLADE: clusters are the largest clades whose maximum pairwise
+//     distance between tips is <= threshold;
+//   - CLUSTER_AVG_CLADE: clusters are the largest clades whose average pairwise
+//     distance between tips is <= threshold;
+//   - CLUSTER_SINGLE_LINKAGE: two tips are in the same cluster if they are linked
+//     by a chain of tips whose successive distances are <= threshold (clusters are
+//     not necessarily clades).
+//
+// With clade criteria, a clade may be a cluster only if the support of its branch is
+// >= minsupport. With single-linkage, tips are not linked through branches having
+// a support < minsupport. Branches without support are not considered as
+// unsupported.
+//
+// Tips that are in no cluster of at least 2 tips (singletons) are not returned. With
+// clade criteria, clusters are given in the preorder traversal of the tree, and with
+// single-linkage, in the order of their first tip in t.Tips().
+//
+// Returns an error if a branch does not have a length, or if the threshold is < 0.
+func (t *Tree) ClusterTips(method int, threshold, minsupport float64) ([]*TipCluster, error) {
+	if threshold < 0 {
+		return nil, errors.New("Distance threshold must be >= 0")
+	}
+	for _, e := range t.Edges() {
+		if e.Length() == NIL_LENGTH {
+			return nil, errors.New("Some branches have no length")
+		}
+	}
+	supported := func(e *Edge) bool {
+		return e == nil || e.Support() == NIL_SUPPORT || e.Support() >= minsupport
+	}
+
+	var clusters []*TipCluster
+	switch method {
+	case CLUSTER_MAX_CLADE, CLUSTER_AVG_CLADE:
+		dists := make(map[*Node]*cladeDistances)
+		cladeDistancesRecur(t.Root(), nil, dists)
+		clusters = make([]*TipCluster, 0)
+		var recur func(cur, prev *Node, e *Edge)
+		recur = func(cur, prev *Node, e *Edge) {
+			d := dists[cur]
+			if d.ntips >= 2 && supported(e) {
+				c := &TipCluster{Edge: e, MaxDist: d.max, MeanDist: d.sum / float64(d.ntips*(d.ntips-1)/2)}
+				if (method == CLUSTER_MAX_CLADE && c.MaxDist <= threshold) || (method == CLUSTER_AVG_CLADE && c.MeanDist <= threshold) {
+					c.Id = len(clusters) + 1
+					cladeTipsRecur(cur, prev, &c.Tips)
+					clusters = append(clusters, c)
+					return
+				}
+			}
+			for i, child := range cur.neigh {
+				if child != prev {
+					recur(child, cur, cur.br[i])
+				}
+			}
+		}
+		recur(t.Root(), nil, nil)
+	case CLUSTER_SINGLE_LINKAGE:
+		clusters = t.singleLinkageClusters(threshold, supported)
+	default:
+		return nil, errors.New("Unknown clustering method")
+	}
+	return clusters, nil
+}
+
+// Computes the pairwise distances of the tips of all the clades below cur
+func cladeDistancesRecur(cur, prev *Node, dists map[*Node]*cladeDistances) *cladeDistances {
+	d := &cladeDistances{}
+	dists[cur] = d
+	if cur.Tip() {
+		d.ntips = 1
+		if prev != nil {
+			return d
+		}
+	}
+	for i, child := range cur.neigh {
+		if child == prev {
+			continue
+		}
+		c := cladeDistancesRecur(child, cur, dists)
+		l := cur.br[i].Length()
+		// Distances from cur to the tips of the child clade
+		sumtip := c.sumtip + float64(c.ntips)*l
+		depth := c.depth + l
+		d.sum += c.sum + sumtip*float64(d.ntips) + d.sumtip*float64(c.ntips)
+		d.max = math.Max(d.max, c.max)
+		if d.ntips > 0 {
+			d.max = math.Max(d.max, d.depth+depth)
+		}
+		d.depth = math.Max(d.depth, depth)
+		d.sumtip += sumtip
+		d.ntips += c.ntips
+	}
+	return d
+}
+
+// Appends the tips below cur, in preorder
+func cladeTipsRecur(cur, prev *Node, tips *[]*Node) {
+	if cur.Tip() {
+		*tips = append(*tips, cur)
+		if prev != nil {
+			return
+		}
+	}
+	for _, child := range cur.neigh {
+		if child != prev {
+			cladeTipsRecur(child, cur, tips)
+		}
+	}
+}
+
+// Single-linkage clusters of tips, tips being in different components if their
+// path crosses an unsupported branch
+func (t *Tree) singleLinkageClusters(threshold float64, supported func(e *Edge) bool) []*TipCluster {
+	tips := t.Tips()
+	matrix := t.ToDistanceMatrix()
+
+	// Components of the tree without the unsupported branches
+	component := make(map[*Node]int)
+	t.PreOrder(func(cur *Node, prev *Node, e *Edge) (keep bool) {
+		if prev == nil {
+			component[cur] = 0
+		} else if supported(e) {
+			component[cur] = component[prev]
+		} else {
+			component[cur] = len(component)
+		}
+		return true
+	})
+
+	// Union-find of the tips
+	parents := make([]int, len(tips))
+	for i := range parents {
+		parents[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parents[i] != i {
+			parents[i] = find(parents[i])
+		}
+		return parents[i]
+	}
+	for i := range tips {
+		for j := i + 1; j < len(tips); j++ {
+			if matrix[i][j] <= threshold && component[tips[i]] == component[tips[j]] {
+				if ri, rj := find(i), find(j); ri != rj {
+					parents[rj] = ri
+				}
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	order := make([]int, 0)
+	for i := range tips {
+		r := find(i)
+		if _, ok := groups[r]; !ok {
+			order = append(order, r)
+		}
+		groups[r] = append(groups[r], i)
+	}
+	clusters := make([]*TipCluster, 0)
+	for _, r := range order {
+		g := groups[r]
+		if len(g) < 2 {
+			continue
+		}
+		c := &TipCluster{Id: len(clusters) + 1}
+		sum := 0.0
+		for k, i := range g {
+			c.Tips = append(c.Tips, tips[i])
+			for _, j := range g[k+1:] {
+				sum += matrix[i][j]
+				c.MaxDist = math.Max(c.MaxDist, matrix[i][j])
+			}
+		}
+		c.MeanDist = sum / float64(len(g)*(len(g)-1)/2)
+		clusters = append(clusters, c)
+	}
+	return clusters
+}
@@ -0,0 +1,554 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/fredericlemoine/gostats"
+)
+
+// Constant c of the variance of branch lengths used in least-squares
+// dating: var(b) = (b + c/s)/s, s being the sequence length (as LSD)
+const LSD_VARIANCE_CONST = 10.0
+
+// Maximum number of iterations to estimate the dates of nodes having an interval
+// constraint in least-squares dating
+const LSD_MAX_ITER = 1000
+
+// Date constraint of a node (tip or internal node): its date, in decimal years,
+// must be in [Lower,Upper]. If Lower==Upper, the date of the node is fixed.
+type DateConstraint struct {
+	Lower float64
+	Upper float64
+}
+
+// Date constraint on the most recent common ancestor of a set of tips. The
+// constrained node depends on the position of the root (see RerootLSD).
+type MRCADateConstraint struct {
+	Tips       []*Node
+	Constraint DateConstraint
+}
+
+// Result of least-squares dating
+type LSDResult struct {
+	Rate      float64              // Substitution rate
+	TMRCA     float64              // Date of the root
+	Objective float64              // Value of the weighted least-squares criterion
+	Dates     map[*Node]float64    // Date of every node of the tree
+	RateCI    [2]float64           // Confidence interval of the rate (if computed)
+	TMRCACI   [2]float64           // Confidence interval of the date of the root (if computed)
+	DatesCI   map[*Node][2]float64 // Confidence interval of node dates (if computed)
+}
+
+// Least-squares dating (LSD, To et al. 2016) of the rooted tree, under a strict clock.
+//
+// It estimates the rate w and the dates t of all the nodes by minimizing
+//
+//	sum over edges e=(p,c) of: (b_e - w*(t_c - t_p))² / var(b_e)
+//
+// with var(b_e)=(b_e + c/s)/s, s being the sequence length (if seqlen<=0, all
+// variances are 1).
+//
+// The constraints give the dates of tips and possibly of internal nodes. Tips
+// without constraint have their date estimated. If the date of a node is an interval
+// (e.g. a year-only sampling date), it starts at the middle of the interval, and is
+// then iteratively moved to its optimal date given the dates of its neighbors and
+// the rate, staying inside the interval. Temporal constraints (dates of children
+// after dates of parents) are not enforced.
+//
+// Returns an error if a branch has no length, if there is not enough
+// date information, or if the estimated rate is not positive.
+func (t *Tree) LSDating(constraints map[*Node]DateConstraint, seqlen float64) (*LSDResult, error) {
+	s, err := newLSDSolver(constraints, nil, seqlen)
+	if err != nil {
+		return nil, err
+	}
+	return s.solve(t.Root(), nil, 0, 0, true)
+}
+
+// Reroots the tree at the position minimizing the least-squares dating
+// criterion (see LSDating), considering all the positions of all the edges
+// (golden section search on each edge).
+//
+// The tree is first unrooted. Constraints on nodes are taken into account as is,
+// whereas constraints on the most recent common ancestors of sets of tips (mrcas)
+// are applied, for each candidate root position, to the MRCA of the tips given this
+// root (as LSD), which may be the root itself.
+func (t *Tree) RerootLSD(constraints map[*Node]DateConstraint, mrcas []MRCADateConstraint, seqlen float64) error {
+	s, err := newLSDSolver(constraints, mrcas, seqlen)
+	if err != nil {
+		return err
+	}
+	t.UnRoot()
+
+	var bestedge *Edge
+	bestpos, bestobj := 0.0, math.Inf(1)
+	eval := func(e *Edge, pos float64) float64 {
+		r, err := s.solve(e.Left(), e.Right(), pos, e.Length()-pos, false)
+		if err != nil {
+			return math.Inf(1)
+		}
+		return r.Objective
+	}
+	gr := (math.Sqrt(5) - 1) / 2
+	for _, e := range t.Edges() {
+		if e.Length() == NIL_LENGTH {
+			return errors.New("Some branches have no length")
+		}
+		a, b := 0.0, e.Length()
+		x1, x2 := b-gr*(b-a), a+gr*(b-a)
+		f1, f2 := eval(e, x1), eval(e, x2)
+		for i := 0; i < 30 && b-a > 1e-8; i++ {
+			if f1 < f2 {
+				b, x2, f2 = x2, x1, f1
+				x1 = b - gr*(b-a)
+				f1 = eval(e, x1)
+			} else {
+				a, x1, f1 = x1, x2, f2
+				x2 = a + gr*(b-a)
+				f2 = eval(e, x2)
+			}
+		}
+		for _, pos := range []float64{0, e.Length(), (a + b) / 2} {
+			if f := eval(e, pos); f < bestobj {
+				bestobj, bestedge, bestpos = f, e, pos
+			}
+		}
+	}
+	if bestedge == nil {
+		return errors.New("No root position found: not enough date information?")
+	}
+	return t.RerootEdge(bestedge, bestpos)
+}
+
+// Computes least-squares dating (see LSDating) with confidence intervals:
+// branch lengths are resampled nbsamples times from a Poisson distribution
+// of mean b*s (divided by s), s being the sequence length, and the dating is
+// computed on each sample. Confidence intervals are the alpha/2 and 1-alpha/2
+// quantiles of the estimated values.
+func (t *Tree) LSDatingCI(constraints map[*Node]DateConstraint, seqlen float64, nbsamples int, alpha float64) (*LSDResult, error) {
+	var res, sample *LSDResult
+	var err error
+
+	if seqlen <= 0 {
+		return nil, errors.New("Sequence length must be > 0 to compute confidence intervals")
+	}
+	if res, err = t.LSDating(constraints, seqlen); err != nil {
+		return nil, err
+	}
+	edges := t.Edges()
+	lengths := make([]float64, len(edges))
+	for i, e := range edges {
+		lengths[i] = e.Length()
+	}
+	rates := make([]float64, 0, nbsamples)
+	dates := make(map[*Node][]float64)
+	for i := 0; i < nbsamples; i++ {
+		for j, e := range edges {
+			e.SetLength(samplePoisson(lengths[j]*seqlen) / seqlen)
+		}
+		sample, err = t.LSDating(constraints, seqlen)
+		if err != nil {
+			continue
+		}
+		rates = append(rates, sample.Rate)
+		for n, d := range sample.Dates {
+			dates[n] = append(dates[n], d)
+		}
+	}
+	for j, e := range edges {
+		e.SetLength(lengths[j])
+	}
+	if len(rates) == 0 {
+		return nil, errors.New("Dating failed on all the resampled trees")
+	}
+	res.RateCI = quantileInterval(rates, alpha)
+	res.DatesCI = make(map[*Node][2]float64, len(dates))
+	for n, d := range dates {
+		res.DatesCI[n] = quantileInterval(d, alpha)
+	}
+	res.TMRCACI = res.DatesCI[t.Root()]
+	return res, nil
+}
+
+// Sets the length of every edge as the difference between
+// the dates of its nodes (date of right node - date of left node).
+//
+// Returns an error if a node has no date.
+func (t *Tree) SetLengthsFromDates(dates map[*Node]float64) error {
+	for _, e := range t.Edges() {
+		dl, ok := dates[e.Left()]
+		dr, ok2 := dates[e.Right()]
+		if !ok || !ok2 {
+			return errors.New("Some nodes do not have a date")
+		}
+		e.SetLength(dr - dl)
+	}
+	return nil
+}
+
+// Returns a sample of a Poisson distribution of mean lambda (normal
+// approximation for large lambda)
+func samplePoisson(lambda float64) float64 {
+	if lambda <= 0 {
+		return 0
+	}
+	if lambda > 100 {
+		return math.Max(0, math.Floor(gostats.Normal(lambda, math.Sqrt(lambda))+0.5))
+	}
+	return float64(gostats.Poisson(lambda))
+}
+
+// Returns the alpha/2 and 1-alpha/2 quantiles of the values
+func quantileInterval(values []float64, alpha float64) [2]float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	lo := int(math.Floor(alpha / 2 * float64(len(sorted)-1)))
+	hi := int(math.Ceil((1 - alpha/2) * float64(len(sorted)-1)))
+	return [2]float64{sorted[lo], sorted[hi]}
+}
+
+// Least-squares dating solver. Node values are u=w*t (w: rate, t: date),
+// and are expressed as affine functions of the rate: u = alpha + beta*w.
+type lsdSolver struct {
+	constraints map[*Node]DateConstraint
+	mrcas       []MRCADateConstraint
+	seqlen      float64
+	vroot       *Node             // Virtual root, when the root is located on an edge
+	root        *Node             // Current root (node, or virtual root)
+	children    []*Node           // Children of the current root
+	prevs       []*Node           // Node excluded from the children of each child of the root
+	lengths     []float64         // Lengths of the branches between the root and its children
+	fixed       map[*Node]float64 // Nodes whose date is fixed (exact dates + current dates of intervals)
+	a           map[*Node]float64 // u_v = a_v*u_parent + k0_v + k1_v*w
+	k0          map[*Node]float64
+	k1          map[*Node]float64
+	alpha       map[*Node]float64 // u_v = alpha_v + beta_v*w
+	beta        map[*Node]float64
+	prev        map[*Node]*Node   // Node excluded from the children of v (its parent, except below a virtual root)
+	plen        map[*Node]float64 // Length of the branch between v and its parent (virtual root included)
+	palpha      map[*Node]float64 // alpha and beta of the parent of v
+	pbeta       map[*Node]float64
+}
+
+func newLSDSolver(constraints map[*Node]DateConstraint, mrcas []MRCADateConstraint, seqlen float64) (*lsdSolver, error) {
+	for n, c := range constraints {
+		if c.Lower > c.Upper {
+			return nil, fmt.Errorf("Date constraint of node %s is not valid: [%f,%f]", n.Name(), c.Lower, c.Upper)
+		}
+	}
+	for _, m := range mrcas {
+		if m.Constraint.Lower > m.Constraint.Upper || len(m.Tips) == 0 {
+			return nil, fmt.Errorf("Date constraint of MRCA is not valid: [%f,%f] on %d tips", m.Constraint.Lower, m.Constraint.Upper, len(m.Tips))
+		}
+	}
+	return &lsdSolver{
+		constraints: constraints,
+		mrcas:       mrcas,
+		seqlen:      seqlen,
+		vroot:       &Node{},
+	}, nil
+}
+
+// Sets the root: node n1 if n2 is nil, otherwise a virtual root located on edge
+// (n1,n2), at distance l1 from n1 and l2 from n2.
+func (s *lsdSolver) setRoot(n1, n2 *Node, l1, l2 float64) error {
+	s.children, s.prevs, s.lengths = nil, nil, nil
+	if n2 != nil {
+		s.root = s.vroot
+		s.children, s.prevs, s.lengths = []*Node{n1, n2}, []*Node{n2, n1}, []float64{l1, l2}
+		return nil
+	}
+	s.root = n1
+	for i, c := range n1.neigh {
+		if n1.br[i].Length() == NIL_LENGTH {
+			return errors.New("Some branches have no length")
+		}
+		s.children = append(s.children, c)
+		s.prevs = append(s.prevs, n1)
+		s.lengths = append(s.lengths, n1.br[i].Length())
+	}
+	return nil
+}
+
+// Returns the constraints of the nodes given the current root: constraints on
+// nodes, and constraints on the MRCAs of sets of tips, which are intersected if
+// they apply to the same node.
+func (s *lsdSolver) rootedConstraints() (map[*Node]DateConstraint, error) {
+	if len(s.mrcas) == 0 {
+		return s.constraints, nil
+	}
+	constraints := make(map[*Node]DateConstraint, len(s.constraints)+len(s.mrcas))
+	for n, c := range s.constraints {
+		constraints[n] = c
+	}
+	for _, m := range s.mrcas {
+		n := s.mrca(m.Tips)
+		c := m.Constraint
+		if prev, ok := constraints[n]; ok {
+			c = DateConstraint{Lower: math.Max(c.Lower, prev.Lower), Upper: math.Min(c.Upper, prev.Upper)}
+			if c.Lower > c.Upper {
+				return nil, errors.New("Date constraints of the same node are not compatible")
+			}
+		}
+		constraints[n] = c
+	}
+	return constraints, nil
+}
+
+// Returns the most recent common ancestor of the tips given the current root
+// (the root itself if the tips are in several subtrees of the root)
+func (s *lsdSolver) mrca(tips []*Node) *Node {
+	var res *Node
+	in := make(map[*Node]bool, len(tips))
+	for _, n := range tips {
+		in[n] = true
+	}
+	var count func(n, prev *Node) int
+	count = func(n, prev *Node) int {
+		nb := 0
+		if in[n] {
+			nb++
+		}
+		for _, c := range n.neigh {
+			if c != prev {
+				nb += count(c, n)
+			}
+		}
+		if nb == len(in) && res == nil {
+			res = n
+		}
+		return nb
+	}
+	for i, c := range s.children {
+		count(c, s.prevs[i])
+	}
+	if res == nil {
+		return s.root
+	}
+	return res
+}
+
+// Weight of an edge: 1/var(b)
+func (s *lsdSolver) weight(b float64) float64 {
+	if s.seqlen <= 0 {
+		return 1.0
+	}
+	return s.seqlen / (b + LSD_VARIANCE_CONST/s.seqlen)
+}
+
+// Solves the least-squares problem with the root located on edge (n1,n2), at
+// distance l1 from n1 and l2 from n2. If n2 is nil, then the root is n1.
+// Nodes having an interval constraint start at the middle of their interval, and
+// are then moved to their optimal date given the other dates and the rate, kept
+// inside their interval, until convergence.
+func (s *lsdSolver) solve(n1, n2 *Node, l1, l2 float64, dates bool) (res *LSDResult, err error) {
+	var constraints map[*Node]DateConstraint
+
+	if err = s.setRoot(n1, n2, l1, l2); err != nil {
+		return
+	}
+	if constraints, err = s.rootedConstraints(); err != nil {
+		return
+	}
+	s.fixed = make(map[*Node]float64)
+	intervals := make([]*Node, 0)
+	for n, c := range constraints {
+		if c.Lower == c.Upper {
+			s.fixed[n] = c.Lower
+		} else {
+			s.fixed[n] = (c.Lower + c.Upper) / 2
+			intervals = append(intervals, n)
+		}
+	}
+	newdates := make([]float64, len(intervals))
+	for iter := 0; iter < LSD_MAX_ITER; iter++ {
+		if res, err = s.solveOnce(); err != nil {
+			return
+		}
+		change := 0.0
+		for i, n := range intervals {
+			c := constraints[n]
+			newdates[i] = math.Max(c.Lower, math.Min(c.Upper, s.optimalDate(n, res.Rate)))
+			change = math.Max(change, math.Abs(newdates[i]-s.fixed[n]))
+		}
+		if change < 1e-9 {
+			break
+		}
+		for i, n := range intervals {
+			s.fixed[n] = newdates[i]
+		}
+	}
+	if dates {
+		res.Dates = make(map[*Node]float64, len(s.alpha))
+		for n, al := range s.alpha {
+			if n != s.vroot {
+				res.Dates[n] = al/res.Rate + s.beta[n]
+			}
+		}
+	}
+	return
+}
+
+// Returns the date of node n minimizing the least-squares criterion, given the
+// dates of its neighbors and the rate
+func (s *lsdSolver) optimalDate(n *Node, rate float64) float64 {
+	var sum, sumw float64
+	child := func(c *Node, b float64) {
+		w := s.weight(b)
+		sum += w * (s.alpha[c]/rate + s.beta[c] - b/rate)
+		sumw += w
+	}
+	if b, ok := s.plen[n]; ok {
+		w := s.weight(b)
+		sum += w * (s.palpha[n]/rate + s.pbeta[n] + b/rate)
+		sumw += w
+	}
+	if n == s.root {
+		for i, c := range s.children {
+			child(c, s.lengths[i])
+		}
+	} else {
+		for i, c := range n.neigh {
+			if c != s.prev[n] {
+				child(c, n.br[i].Length())
+			}
+		}
+	}
+	return sum / sumw
+}
+
+// Solves the least-squares problem given the current root and the fixed dates
+func (s *lsdSolver) solveOnce() (*LSDResult, error) {
+	s.a = make(map[*Node]float64)
+	s.k0 = make(map[*Node]float64)
+	s.k1 = make(map[*Node]float64)
+	s.alpha = make(map[*Node]float64)
+	s.beta = make(map[*Node]float64)
+	s.prev = make(map[*Node]*Node)
+	s.plen = make(map[*Node]float64)
+	s.palpha = make(map[*Node]float64)
+	s.pbeta = make(map[*Node]float64)
+
+	// Bottom-up: expressions of u_child as function of u_root
+	var sd, s0, s1 float64
+	for i, c := range s.children {
+		if err := s.down(c, s.prevs[i], s.lengths[i]); err != nil {
+			return nil, err
+		}
+		w := s.weight(s.lengths[i])
+		sd += w * (1 - s.a[c])
+		s0 += w * (s.k0[c] - s.lengths[i])
+		s1 += w * s.k1[c]
+	}
+	var ra, rb float64
+	if d, ok := s.fixedDate(s.root); ok {
+		ra, rb = 0, d
+	} else {
+		if sd == 0 {
+			return nil, errors.New("Not enough date information to date the tree")
+		}
+		ra, rb = s0/sd, s1/sd
+	}
+
+	// Top-down: u = alpha + beta*w, and sums for the rate
+	var num, den float64
+	for i, c := range s.children {
+		s.up(c, s.prevs[i], ra, rb, s.lengths[i], &num, &den)
+	}
+	s.alpha[s.root] = ra
+	s.beta[s.root] = rb
+	if den == 0 {
+		return nil, errors.New("Not enough date information to date the tree")
+	}
+	rate := num / den
+	if rate <= 0 {
+		return nil, errors.New("Estimated rate is not positive")
+	}
+
+	// Objective
+	obj := 0.0
+	for i, c := range s.children {
+		obj += s.objective(c, s.prevs[i], ra, rb, s.lengths[i], rate)
+	}
+	res := &LSDResult{
+		Rate:      rate,
+		TMRCA:     ra/rate + rb,
+		Objective: obj,
+	}
+	return res, nil
+}
+
+// Returns the fixed date of the node, if any
+func (s *lsdSolver) fixedDate(n *Node) (float64, bool) {
+	if n == nil {
+		return 0, false
+	}
+	d, ok := s.fixed[n]
+	return d, ok
+}
+
+// Bottom-up computation of a, k0 and k1 for node n, whose parent is prev,
+// connected by an edge of length b.
+func (s *lsdSolver) down(n, prev *Node, b float64) error {
+	w := s.weight(b)
+	d := w
+	var sk0, sk1 float64
+	sk0 = w * b
+	for i, c := range n.neigh {
+		if c == prev {
+			continue
+		}
+		e := n.br[i]
+		if e.Length() == NIL_LENGTH {
+			return errors.New("Some branches have no length")
+		}
+		if err := s.down(c, n, e.Length()); err != nil {
+			return err
+		}
+		wc := s.weight(e.Length())
+		d += wc * (1 - s.a[c])
+		sk0 += wc * (s.k0[c] - e.Length())
+		sk1 += wc * s.k1[c]
+	}
+	if fd, ok := s.fixedDate(n); ok {
+		s.a[n], s.k0[n], s.k1[n] = 0, 0, fd
+	} else {
+		s.a[n], s.k0[n], s.k1[n] = w/d, sk0/d, sk1/d
+	}
+	return nil
+}
+
+// Top-down computation of alpha and beta of node n, given alpha and beta of its parent,
+// and accumulation of the sums used to estimate the rate.
+func (s *lsdSolver) up(n, prev *Node, pa, pb, b float64, num, den *float64) {
+	s.alpha[n] = s.a[n]*pa + s.k0[n]
+	s.beta[n] = s.a[n]*pb + s.k1[n]
+	s.prev[n], s.plen[n], s.palpha[n], s.pbeta[n] = prev, b, pa, pb
+	w := s.weight(b)
+	da := s.alpha[n] - pa
+	db := s.beta[n] - pb
+	*num += w * (b - da) * db
+	*den += w * db * db
+	for i, c := range n.neigh {
+		if c != prev {
+			s.up(c, n, s.alpha[n], s.beta[n], n.br[i].Length(), num, den)
+		}
+	}
+}
+
+// Computes the weighted least-squares criterion below node n (including the edge
+// connecting n to its parent)
+func (s *lsdSolver) objective(n, prev *Node, pa, pb, b, rate float64) float64 {
+	r := b - (s.alpha[n] - pa) - (s.beta[n]-pb)*rate
+	obj := s.weight(b) * r * r
+	for i, c := range n.neigh {
+		if c != prev {
+			obj += s.objective(c, n, s.alpha[n], s.beta[n], n.br[i].Length(), rate)
+		}
+	}
+	return obj
+}
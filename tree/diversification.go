@@ -0,0 +1,174 @@
+package tree
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/evolbioinfo/gotree/mutils"
+)
+
+// Diversification models fitted by FitDiversification
+const (
+	DIV_YULE = iota // Pure birth model (1 parameter: lambda)
+	DIV_BD          // Constant rate birth-death model (2 parameters: lambda, mu)
+)
+
+// Result of the maximum likelihood fit of a diversification model
+type DiversificationFit struct {
+	Model         int     // DIV_YULE or DIV_BD
+	Lambda        float64 // Speciation (birth) rate
+	Mu            float64 // Extinction (death) rate
+	LogLikelihood float64 // Log-likelihood of the tree (up to a constant)
+	NbParams      int     // Number of free parameters
+	AIC           float64 // Akaike information criterion: 2*NbParams - 2*LogLikelihood
+}
+
+// Returns the name of the model of the fit
+func (d *DiversificationFit) ModelName() string {
+	switch d.Model {
+	case DIV_YULE:
+		return "yule"
+	case DIV_BD:
+		return "bd"
+	default:
+		return "unknown"
+	}
+}
+
+// Returns the branching times of the tree (heights of internal nodes,
+// see NodeHeights), sorted in decreasing order: the first one is the
+// crown age (height of the root).
+//
+// The tree must be rooted, binary, and ultrametric (heights of tips <=
+// LTT_EPSILON * root age), with at least 3 tips. Returns an error otherwise.
+func (t *Tree) BranchingTimes() ([]float64, error) {
+	if !t.Rooted() {
+		return nil, errors.New("The tree must be rooted")
+	}
+	heights, err := t.NodeHeights()
+	if err != nil {
+		return nil, err
+	}
+	root := t.Root()
+	eps := LTT_EPSILON * heights[root]
+	times := make([]float64, 0, len(heights)/2)
+	ntips := 0
+	for n, h := range heights {
+		if n.Tip() {
+			if h > eps {
+				return nil, errors.New("The tree must be ultrametric")
+			}
+			ntips++
+			continue
+		}
+		if n.Nneigh() != 3 && !(n == root && n.Nneigh() == 2) {
+			return nil, errors.New("The tree must be binary")
+		}
+		times = append(times, h)
+	}
+	if ntips < 3 {
+		return nil, errors.New("The tree must have at least 3 tips")
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(times)))
+	return times, nil
+}
+
+// Computes the log-likelihood of the branching times (see BranchingTimes) under
+// the constant rate birth-death model, with speciation rate lambda, extinction rate
+// mu, and sampling fraction rho (Stadler 2009), conditioned on the crown age and
+// on the survival of the two crown lineages.
+//
+// The likelihood is given up to a constant that does not depend on the parameters:
+//	L = (p1(x1)/(1-p0(x1)))² * prod_{i=2..n-1} lambda*p1(x_i)
+// x_i being the branching times. Returns -Inf if lambda <= mu, if mu < 0,
+// or if rho is not in ]0,1].
+func BirthDeathLogLikelihood(times []float64, lambda, mu, rho float64) float64 {
+	r := lambda - mu
+	if r <= 0 || mu < 0 || rho <= 0 || rho > 1 || len(times) == 0 {
+		return math.Inf(-1)
+	}
+	// log(p1(t)/(1-p0(t))) = log(r) - rt - log(D(t))
+	// log(p1(t)) = log(rho) + 2log(r) - rt - 2log(D(t))
+	// with D(t) = rho*lambda*(1-exp(-rt)) + r*exp(-rt)
+	logd := func(t float64) float64 {
+		e := math.Exp(-r * t)
+		return math.Log(rho*lambda*(1-e) + r*e)
+	}
+	logr := math.Log(r)
+	logl := 2 * (logr - r*times[0] - logd(times[0]))
+	for _, x := range times[1:] {
+		logl += math.Log(lambda) + math.Log(rho) + 2*logr - r*x - 2*logd(x)
+	}
+	return logl
+}
+
+// Fits the given diversification model (DIV_YULE or DIV_BD) by maximum likelihood
+// to the branching times (see BranchingTimes), with sampling fraction rho
+// (see BirthDeathLogLikelihood).
+//
+// Parameters are optimized on a log scale (lambda for DIV_YULE, and net
+// diversification lambda-mu and logit of turnover mu/lambda for DIV_BD).
+func FitDiversification(times []float64, rho float64, model int) (*DiversificationFit, error) {
+	if len(times) < 2 {
+		return nil, errors.New("At least 3 tips are needed to fit a diversification model")
+	}
+	if rho <= 0 || rho > 1 {
+		return nil, errors.New("Sampling fraction must be in ]0,1]")
+	}
+	negll := func(lambda, mu float64) float64 {
+		l := -BirthDeathLogLikelihood(times, lambda, mu, rho)
+		if math.IsNaN(l) {
+			return math.Inf(1)
+		}
+		return l
+	}
+
+	// Pure birth estimate, used as starting point of the birth-death model
+	sum := 2 * times[0]
+	for _, x := range times[1:] {
+		sum += x
+	}
+	yule := float64(len(times)-1) / sum
+	loglambda, nll := mutils.BrentMinimize(func(x float64) float64 {
+		return negll(math.Exp(x), 0)
+	}, math.Log(yule)-10, math.Log(yule)+10, 1e-10)
+
+	fit := &DiversificationFit{Model: model}
+	switch model {
+	case DIV_YULE:
+		fit.Lambda, fit.Mu = math.Exp(loglambda), 0
+		fit.LogLikelihood = -nll
+		fit.NbParams = 1
+	case DIV_BD:
+		// x[0]: log(lambda-mu), x[1]: logit(mu/lambda)
+		f := func(x []float64) float64 {
+			a := 1 / (1 + math.Exp(-x[1]))
+			r := math.Exp(x[0])
+			lambda := r / (1 - a)
+			return negll(lambda, lambda-r)
+		}
+		best := math.Inf(1)
+		var bestx []float64
+		for _, a := range []float64{0.01, 0.25, 0.5, 0.75, 0.95} {
+			x, v := mutils.NelderMead(f, []float64{loglambda + math.Log(1-a), math.Log(a / (1 - a))}, 0.5, 1e-12, 5000)
+			if v < best {
+				best, bestx = v, x
+			}
+		}
+		a := 1 / (1 + math.Exp(-bestx[1]))
+		r := math.Exp(bestx[0])
+		fit.Lambda = r / (1 - a)
+		fit.Mu = fit.Lambda - r
+		fit.LogLikelihood = -best
+		// Pure birth is the limit of the birth-death model when mu->0
+		if -nll > fit.LogLikelihood {
+			fit.Lambda, fit.Mu, fit.LogLikelihood = math.Exp(loglambda), 0, -nll
+		}
+		fit.NbParams = 2
+	default:
+		return nil, errors.New("Unknown diversification model")
+	}
+	fit.AIC = 2*float64(fit.NbParams) - 2*fit.LogLikelihood
+	return fit, nil
+}
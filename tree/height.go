@@ -0,0 +1,150 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Returns the height of every node of the tree: the distance between the node
+// and the tip that is the farthest from the root. The farthest (most recent)
+// tip has height 0, and the root has the largest height (the root age).
+//
+// The tree is considered rooted at its root node (the pseudo root for
+// unrooted trees).
+//
+// Returns an error if a branch does not have a length.
+func (t *Tree) NodeHeights() (map[*Node]float64, error) {
+	dists := make(map[*Node]float64)
+	if err := nodeDistancesRecur(t.Root(), nil, 0, dists); err != nil {
+		return nil, err
+	}
+	max := 0.0
+	for _, d := range dists {
+		max = math.Max(max, d)
+	}
+	for n, d := range dists {
+		dists[n] = max - d
+	}
+	return dists, nil
+}
+
+// Computes the distance from the root of every node below cur
+func nodeDistancesRecur(cur, prev *Node, curlen float64, dists map[*Node]float64) error {
+	dists[cur] = curlen
+	for i, child := range cur.neigh {
+		if child != prev {
+			e := cur.br[i]
+			if e.Length() == NIL_LENGTH {
+				return errors.New("Some branches have no length")
+			}
+			if err := nodeDistancesRecur(child, cur, curlen+e.Length(), dists); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the age of the root: the largest distance from the root to a tip.
+//
+// Returns an error if a branch does not have a length.
+func (t *Tree) RootAge() (float64, error) {
+	dists, err := t.RootToTipDistances()
+	if err != nil {
+		return 0, err
+	}
+	max := 0.0
+	for _, d := range dists {
+		max = math.Max(max, d)
+	}
+	return max, nil
+}
+
+// Returns true if all the tips are at the same distance from the root,
+// i.e. if all the tips have a height <= tolerance.
+//
+// Returns an error if a branch does not have a length.
+func (t *Tree) IsUltrametric(tolerance float64) (bool, error) {
+	heights, err := t.NodeHeights()
+	if err != nil {
+		return false, err
+	}
+	for _, tip := range t.Tips() {
+		if heights[tip] > tolerance {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Makes the tree ultrametric by extending the terminal branches, such that
+// all the tips are at the same distance from the root (the largest one).
+//
+// If tolerance >= 0 and the height of a tip is larger than tolerance, the tree
+// is not modified and an error is returned: the tree is not considered
+// nearly ultrametric.
+func (t *Tree) ForceUltrametric(tolerance float64) error {
+	heights, err := t.NodeHeights()
+	if err != nil {
+		return err
+	}
+	tips := t.Tips()
+	if tolerance >= 0 {
+		for _, tip := range tips {
+			if heights[tip] > tolerance {
+				return fmt.Errorf("Tip %s is too far from being ultrametric (height %f > %f)", tip.Name(), heights[tip], tolerance)
+			}
+		}
+	}
+	for _, tip := range tips {
+		if len(tip.br) > 0 && heights[tip] > 0 {
+			e := tip.br[0]
+			e.SetLength(e.Length() + heights[tip])
+		}
+	}
+	return nil
+}
+
+// Returns the edges crossing the given height (see NodeHeights): edges e
+// such that height(e.Right()) <= height < height(e.Left()). Each edge
+// corresponds to a lineage existing at that time, and defines a cluster
+// made of the tips below it.
+//
+// Tips whose height is larger than the given height (sampled before that
+// time) are not below any returned edge.
+//
+// Returns an error if a branch does not have a length.
+func (t *Tree) TimeSlice(height float64) ([]*Edge, error) {
+	heights, err := t.NodeHeights()
+	if err != nil {
+		return nil, err
+	}
+	edges := make([]*Edge, 0)
+	for _, e := range t.Edges() {
+		if heights[e.Right()] <= height && height < heights[e.Left()] {
+			edges = append(edges, e)
+		}
+	}
+	return edges, nil
+}
+
+// Returns the names of the tips below the given edge (considering
+// the tree rooted).
+func (e *Edge) TipsBelow() []string {
+	tips := make([]string, 0)
+	tipsBelowRecur(e.Right(), e.Left(), &tips)
+	return tips
+}
+
+func tipsBelowRecur(cur, prev *Node, tips *[]string) {
+	if cur.Tip() {
+		*tips = append(*tips, cur.Name())
+		return
+	}
+	for _, child := range cur.neigh {
+		if child != prev {
+			tipsBelowRecur(child, cur, tips)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package tree
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Relative tolerance used to consider that tips are contemporaneous
+// (height <= LTT_EPSILON * root age)
+const LTT_EPSILON = 1e-8
+
+// Point of a lineage through time plot: number of lineages
+// from Time to the time of the next point.
+// Time is negative: 0 is the time of the most recent tip, and -(root age)
+// is the time of the root.
+type LTTPoint struct {
+	Time     float64
+	Lineages int
+}
+
+// Point of a lineage through time envelope, summarizing the number
+// of lineages of a set of trees at a given time
+type LTTEnvelopePoint struct {
+	Time  float64
+	Mean  float64 // Mean number of lineages
+	Min   int     // Minimum number of lineages
+	Max   int     // Maximum number of lineages
+	Lower float64 // 2.5% quantile of the number of lineages
+	Upper float64 // 97.5% quantile of the number of lineages
+}
+
+// Computes the lineage through time coordinates of the rooted tree.
+//
+// The first point is the root, at time -(root age) (see NodeHeights), with
+// as many lineages as root children. Then, each internal node adds
+// (number of children - 1) lineages, and each tip sampled before the most
+// recent tip (heterochronous trees) removes one lineage. The last point
+// is at time 0 (time of the most recent tip).
+//
+// Returns an error if a branch does not have a length.
+func (t *Tree) LTT() ([]LTTPoint, error) {
+	heights, err := t.NodeHeights()
+	if err != nil {
+		return nil, err
+	}
+	root := t.Root()
+	age := heights[root]
+	eps := LTT_EPSILON * age
+
+	type lttEvent struct {
+		time  float64
+		delta int
+	}
+	events := make([]lttEvent, 0, len(heights))
+	for n, h := range heights {
+		if n == root {
+			continue
+		}
+		if n.Tip() {
+			if h > eps {
+				events = append(events, lttEvent{-h, -1})
+			}
+		} else if n.Nneigh() > 2 {
+			events = append(events, lttEvent{-h, n.Nneigh() - 2})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].time < events[j].time })
+
+	points := []LTTPoint{{-age, root.Nneigh()}}
+	for _, e := range events {
+		last := &points[len(points)-1]
+		if e.time <= last.Time+eps {
+			last.Lineages += e.delta
+		} else {
+			points = append(points, LTTPoint{e.time, last.Lineages + e.delta})
+		}
+	}
+	if last := points[len(points)-1]; last.Time < 0 {
+		points = append(points, LTTPoint{0, last.Lineages})
+	}
+	return points, nil
+}
+
+// Returns the number of lineages at the given time from the LTT points
+// (see LTT). Before the first point, the number of lineages is 0.
+func LTTLineages(points []LTTPoint, time float64) int {
+	i := sort.Search(len(points), func(i int) bool { return points[i].Time > time })
+	if i == 0 {
+		return 0
+	}
+	return points[i-1].Lineages
+}
+
+// Computes the lineage through time envelope of a set of trees, given their
+// LTT points (see LTT), at nbpoints regularly spaced times, between the
+// oldest root and 0.
+func LTTEnvelope(ltts [][]LTTPoint, nbpoints int) ([]LTTEnvelopePoint, error) {
+	if len(ltts) == 0 {
+		return nil, errors.New("No LTT to summarize")
+	}
+	if nbpoints < 2 {
+		return nil, errors.New("The envelope must have at least 2 points")
+	}
+	min := 0.0
+	for _, points := range ltts {
+		if len(points) > 0 {
+			min = math.Min(min, points[0].Time)
+		}
+	}
+	envelope := make([]LTTEnvelopePoint, nbpoints)
+	values := make([]float64, len(ltts))
+	for i := range envelope {
+		time := min - min*float64(i)/float64(nbpoints-1)
+		p := LTTEnvelopePoint{Time: time, Min: math.MaxInt32}
+		for j, points := range ltts {
+			l := LTTLineages(points, time)
+			values[j] = float64(l)
+			p.Mean += float64(l)
+			if l < p.Min {
+				p.Min = l
+			}
+			if l > p.Max {
+				p.Max = l
+			}
+		}
+		p.Mean /= float64(len(ltts))
+		ci := quantileInterval(values, 0.05)
+		p.Lower, p.Upper = ci[0], ci[1]
+		envelope[i] = p
+	}
+	return envelope, nil
+}
+
+// Computes the gamma statistic of Pybus & Harvey (2000), and its two-tailed
+// p-value (gamma follows a standard normal distribution under the pure birth
+// model).
+//
+// The tree must be rooted, binary, and ultrametric, with at least 3 tips.
+func (t *Tree) GammaStatistic() (gamma, pvalue float64, err error) {
+	var branching []float64
+
+	if branching, err = t.BranchingTimes(); err != nil {
+		err = errors.New("Gamma statistic: " + err.Error())
+		return
+	}
+	n := len(branching) + 1
+	branching = append(branching, 0)
+
+	// g[k] : internode interval with k lineages
+	sumT, inner, cum := 0.0, 0.0, 0.0
+	for k := 2; k <= n; k++ {
+		g := branching[k-2] - branching[k-1]
+		sumT += float64(k) * g
+		if k <= n-1 {
+			cum += float64(k) * g
+			inner += cum
+		}
+	}
+	gamma = (inner/float64(n-2) - sumT/2.0) / (sumT * math.Sqrt(1.0/(12.0*float64(n-2))))
+	pvalue = math.Erfc(math.Abs(gamma) / math.Sqrt2)
+	return
+}
@@ -0,0 +1,322 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Criteria to choose the best root with RerootRTT
+const (
+	RTT_R2  = iota // Maximizes the R² of the root-to-tip regression (with a positive rate)
+	RTT_RMS        // Minimizes the residual mean square of the root-to-tip regression
+)
+
+// Result of the regression of root-to-tip distances against sampling dates.
+// Only tips having a date are considered.
+type RTTRegression struct {
+	Tips      []string  // Names of the dated tips
+	Dates     []float64 // Dates of the tips
+	Distances []float64 // Root-to-tip distances of the tips
+	Residuals []float64 // Residuals of the regression for each tip
+	Rate      float64   // Slope of the regression (substitution rate)
+	Intercept float64   // Intercept of the regression
+	TMRCA     float64   // Date of the root: x-intercept of the regression
+	R2        float64   // Coefficient of determination
+	RMS       float64   // Residual mean square: sum of squared residuals / (n-2)
+}
+
+// Returns the distance from the root to each tip (sum of branch lengths).
+//
+// Returns an error if a branch does not have a length.
+func (t *Tree) RootToTipDistances() (map[string]float64, error) {
+	nodedists := make(map[*Node]float64)
+	if err := nodeDistancesRecur(t.Root(), nil, 0, nodedists); err != nil {
+		return nil, err
+	}
+	dists := make(map[string]float64)
+	for _, n := range t.Tips() {
+		if n != t.Root() {
+			dists[n.Name()] = nodedists[n]
+		}
+	}
+	return dists, nil
+}
+
+// Fits the least-squares regression of distances against dates.
+//
+// Returns an error if there are less than 3 points, or if all the
+// dates are identical.
+func FitRTTRegression(names []string, dates, dists []float64) (*RTTRegression, error) {
+	n := len(dates)
+	if n < 3 || len(dists) != n || len(names) != n {
+		return nil, errors.New("At least 3 dated tips are needed for the root-to-tip regression")
+	}
+	var mt, md float64
+	for i := range dates {
+		mt += dates[i]
+		md += dists[i]
+	}
+	mt /= float64(n)
+	md /= float64(n)
+	var stt, sdd, std float64
+	for i := range dates {
+		stt += (dates[i] - mt) * (dates[i] - mt)
+		sdd += (dists[i] - md) * (dists[i] - md)
+		std += (dates[i] - mt) * (dists[i] - md)
+	}
+	if stt == 0 {
+		return nil, errors.New("All the tips have the same date")
+	}
+	reg := &RTTRegression{
+		Tips:      names,
+		Dates:     dates,
+		Distances: dists,
+		Residuals: make([]float64, n),
+	}
+	reg.Rate = std / stt
+	reg.Intercept = md - reg.Rate*mt
+	reg.TMRCA = -reg.Intercept / reg.Rate
+	if sdd > 0 {
+		reg.R2 = std * std / (stt * sdd)
+	}
+	rss := 0.0
+	for i := range dates {
+		reg.Residuals[i] = dists[i] - (reg.Intercept + reg.Rate*dates[i])
+		rss += reg.Residuals[i] * reg.Residuals[i]
+	}
+	reg.RMS = rss / float64(n-2)
+	return reg, nil
+}
+
+// Computes the regression of root-to-tip distances against the given
+// tip dates (tip name => date). Tips without date are not taken
+// into account.
+func (t *Tree) RootToTipRegression(dates map[string]float64) (*RTTRegression, error) {
+	dists, err := t.RootToTipDistances()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(dists))
+	x := make([]float64, 0, len(dists))
+	y := make([]float64, 0, len(dists))
+	for _, tip := range t.Tips() {
+		if d, ok := dates[tip.Name()]; ok {
+			names = append(names, tip.Name())
+			x = append(x, d)
+			y = append(y, dists[tip.Name()])
+		}
+	}
+	return FitRTTRegression(names, x, y)
+}
+
+// Reroots the tree on the given edge, at the given distance from
+// its left node. The new root is a new node, connected to both nodes of the edge.
+//
+// Returns an error if the distance is not in [0,length of the edge].
+func (t *Tree) RerootEdge(e *Edge, dist float64) error {
+	l := e.Length()
+	if dist < 0 || (l != NIL_LENGTH && dist > l) {
+		return fmt.Errorf("Cannot reroot at distance %f of an edge of length %f", dist, l)
+	}
+	node1, node2 := e.Left(), e.Right()
+	b := e.Support()
+	newroot := t.NewNode()
+	node1.delNeighbor(node2)
+	node2.delNeighbor(node1)
+	e1 := t.ConnectNodes(newroot, node1)
+	e2 := t.ConnectNodes(newroot, node2)
+	if l != NIL_LENGTH {
+		e1.SetLength(dist)
+		e2.SetLength(l - dist)
+	}
+	e1.SetSupport(b)
+	e2.SetSupport(b)
+	if err := t.Reroot(newroot); err != nil {
+		return err
+	}
+	t.ClearBitSets()
+	t.UpdateBitSet()
+	t.ComputeDepths()
+	return nil
+}
+
+// Reroots the tree at the position that optimizes the root-to-tip
+// regression (as TempEst), using the given tip dates (tip name => date).
+// Tips without date are not taken into account.
+//
+// For every edge, the root-to-tip distances are linear functions of the
+// position of the root on the edge, and the optimal position is computed
+// analytically for the given criterion:
+//	- RTT_R2: Maximizes the correlation between dates and distances
+//	  (i.e. the R² with a positive rate);
+//	- RTT_RMS: Minimizes the residual mean square.
+//
+// The tree is first unrooted. Returns an error if a branch does not have
+// length, or if there are less than 3 dated tips.
+func (t *Tree) RerootRTT(dates map[string]float64, criterion int) error {
+	if criterion != RTT_R2 && criterion != RTT_RMS {
+		return errors.New("Unknown criterion for root-to-tip rerooting")
+	}
+	t.UnRoot()
+	t.UpdateTipIndex()
+	if err := t.ClearBitSets(); err != nil {
+		return err
+	}
+	if err := t.UpdateBitSet(); err != nil {
+		return err
+	}
+
+	dists, err := t.RootToTipDistances()
+	if err != nil {
+		return err
+	}
+	// Dated tips, with their index in the bitsets
+	index := make([]uint, 0, len(dists))
+	x := make([]float64, 0, len(dists))
+	y := make([]float64, 0, len(dists))
+	for _, tip := range t.Tips() {
+		if d, ok := dates[tip.Name()]; ok {
+			idx, err := t.TipIndex(tip.Name())
+			if err != nil {
+				return err
+			}
+			index = append(index, idx)
+			x = append(x, d)
+			y = append(y, dists[tip.Name()])
+		}
+	}
+	if len(x) < 3 {
+		return errors.New("At least 3 dated tips are needed for the root-to-tip regression")
+	}
+	mt := 0.0
+	for _, d := range x {
+		mt += d
+	}
+	mt /= float64(len(x))
+	stt := 0.0
+	for _, d := range x {
+		stt += (d - mt) * (d - mt)
+	}
+	if stt == 0 {
+		return errors.New("All the tips have the same date")
+	}
+
+	r := &rttSearch{
+		criterion: criterion,
+		index:     index,
+		dates:     x,
+		meandate:  mt,
+		stt:       stt,
+		sign:      make([]float64, len(x)),
+		bestval:   math.Inf(-1),
+	}
+	r.searchRecur(t.Root(), nil, y)
+	if r.bestedge == nil {
+		return errors.New("No edge found to reroot the tree")
+	}
+	return t.RerootEdge(r.bestedge, r.bestpos)
+}
+
+// Structure used to search the best root position
+type rttSearch struct {
+	criterion int
+	index     []uint    // Bitset index of dated tips
+	dates     []float64 // Dates of the dated tips
+	meandate  float64
+	stt       float64   // Sum of squared deviations of dates
+	sign      []float64 // Temporary vector of signs
+	bestedge  *Edge
+	bestpos   float64
+	bestval   float64 // Best value of the criterion (higher is better)
+}
+
+// Evaluates every edge below cur, y being the distances from cur
+// to the dated tips (modified and restored during the recursion).
+func (r *rttSearch) searchRecur(cur, prev *Node, y []float64) {
+	for i, child := range cur.neigh {
+		if child == prev {
+			continue
+		}
+		e := cur.br[i]
+		l := e.Length()
+		for j, idx := range r.index {
+			if e.Bitset().Test(idx) {
+				r.sign[j] = -1
+			} else {
+				r.sign[j] = 1
+			}
+		}
+		r.evaluateEdge(e, l, y)
+		for j := range y {
+			y[j] += r.sign[j] * l
+		}
+		r.searchRecur(child, cur, y)
+		// sign may have been modified by the recursion
+		for j, idx := range r.index {
+			if e.Bitset().Test(idx) {
+				y[j] += l
+			} else {
+				y[j] -= l
+			}
+		}
+	}
+}
+
+// Finds the best position on the edge, where distances are y + sign*pos
+func (r *rttSearch) evaluateEdge(e *Edge, l float64, y []float64) {
+	n := float64(len(y))
+	var my, ms float64
+	for j := range y {
+		my += y[j]
+		ms += r.sign[j]
+	}
+	my /= n
+	ms /= n
+	// cov(pos) = A + B.pos, var(pos) = C + 2D.pos + E.pos²
+	var a, b, c, d, ee float64
+	for j := range y {
+		tc := r.dates[j] - r.meandate
+		yc := y[j] - my
+		sc := r.sign[j] - ms
+		a += tc * yc
+		b += tc * sc
+		c += yc * yc
+		d += yc * sc
+		ee += sc * sc
+	}
+
+	candidates := []float64{0, l}
+	switch r.criterion {
+	case RTT_R2:
+		if den := b*d - a*ee; den != 0 {
+			candidates = append(candidates, (a*d-b*c)/den)
+		}
+	case RTT_RMS:
+		if den := ee - b*b/r.stt; den > 0 {
+			candidates = append(candidates, -(d-a*b/r.stt)/den)
+		}
+	}
+	for _, pos := range candidates {
+		if pos < 0 || pos > l || math.IsNaN(pos) {
+			continue
+		}
+		cov := a + b*pos
+		vary := c + 2*d*pos + ee*pos*pos
+		var val float64
+		switch r.criterion {
+		case RTT_R2:
+			if vary <= 0 {
+				continue
+			}
+			val = cov / math.Sqrt(r.stt*vary)
+		case RTT_RMS:
+			val = -(vary - cov*cov/r.stt)
+		}
+		if val > r.bestval {
+			r.bestval = val
+			r.bestedge = e
+			r.bestpos = pos
+		}
+	}
+}
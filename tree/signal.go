@@ -0,0 +1,270 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/evolbioinfo/gotree/mutils"
+)
+
+// Phylogenetic independent contrast of an internal node (Felsenstein 1985)
+type Contrast struct {
+	Node     *Node
+	Variance float64   // Expected variance of the contrast (sum of the corrected lengths of the two child branches)
+	Values   []float64 // Standardized contrast of each trait
+}
+
+// Result of the pruning of a continuous trait under Brownian motion
+// (contrast algorithm)
+type bmPruning struct {
+	mean   float64 // Estimated value of the node
+	vari   float64 // Variance of the estimate (relative to the rate of the Brownian motion)
+	sumsq  float64 // Sum of the squared standardized contrasts
+	logdet float64 // Sum of the log of the variances of the contrasts
+}
+
+// Prunes a continuous trait from the tips to cur, given branch lengths
+func bmPruneRecur(cur, prev *Node, length func(e *Edge, child *Node) float64, values map[*Node]float64) (res bmPruning, err error) {
+	if cur.Tip() && prev != nil {
+		res.mean = values[cur]
+		return
+	}
+	first := true
+	for i, child := range cur.neigh {
+		if child == prev {
+			continue
+		}
+		var c bmPruning
+		if c, err = bmPruneRecur(child, cur, length, values); err != nil {
+			return
+		}
+		c.vari += length(cur.br[i], child)
+		res.sumsq += c.sumsq
+		res.logdet += c.logdet
+		if first {
+			res.mean, res.vari = c.mean, c.vari
+			first = false
+			continue
+		}
+		s := res.vari + c.vari
+		if s <= 0 {
+			err = errors.New("Some tips are separated by branches of length 0")
+			return
+		}
+		diff := res.mean - c.mean
+		res.sumsq += diff * diff / s
+		res.logdet += math.Log(s)
+		res.mean = (res.mean*c.vari + c.mean*res.vari) / s
+		res.vari = res.vari * c.vari / s
+	}
+	return
+}
+
+// Checks that all tips have a value, that all branches have a length, and
+// returns the values of one trait by tip node
+func (t *Tree) traitValues(values map[string][]float64, trait int) (map[*Node]float64, error) {
+	if t.Root().Tip() {
+		return nil, errors.New("The root of the tree must not be a tip")
+	}
+	for _, e := range t.Edges() {
+		if e.Length() == NIL_LENGTH {
+			return nil, errors.New("Some branches have no length")
+		}
+	}
+	nodevalues := make(map[*Node]float64)
+	for _, n := range t.Tips() {
+		v, ok := values[n.Name()]
+		if !ok {
+			return nil, fmt.Errorf("Tip %s has no value", n.Name())
+		}
+		if trait >= len(v) {
+			return nil, fmt.Errorf("Tip %s has %d values", n.Name(), len(v))
+		}
+		nodevalues[n] = v[trait]
+	}
+	return nodevalues, nil
+}
+
+// Computes the phylogenetic independent contrasts (Felsenstein 1985) of ntraits
+// continuous traits on the rooted binary tree. values gives the values of the
+// traits of each tip, by name.
+//
+// Contrasts are given for each internal node, in the preorder traversal of the
+// tree: difference between the (estimated) values of its two children, divided by
+// the square root of its expected variance. The first child is the first in the
+// order of the neighbors of the node.
+//
+// Returns an error if the tree is not rooted and binary, if a branch has no length,
+// or if a tip has no value.
+func (t *Tree) IndependentContrasts(values map[string][]float64, ntraits int) ([]*Contrast, error) {
+	var err error
+	nodevalues := make([]map[*Node]float64, ntraits)
+	for d := range nodevalues {
+		if nodevalues[d], err = t.traitValues(values, d); err != nil {
+			return nil, err
+		}
+	}
+	for _, n := range t.Nodes() {
+		if !n.Tip() && ((n == t.Root() && n.Nneigh() != 2) || (n != t.Root() && n.Nneigh() != 3)) {
+			return nil, errors.New("Independent contrasts need a rooted binary tree")
+		}
+	}
+
+	vari := make(map[*Node]float64)
+	contrasts := make([]*Contrast, 0)
+	var pruneRecur func(cur, prev *Node) error
+	pruneRecur = func(cur, prev *Node) error {
+		if cur.Tip() {
+			return nil
+		}
+		c := &Contrast{Node: cur, Values: make([]float64, ntraits)}
+		contrasts = append(contrasts, c)
+		children := make([]*Node, 0, 2)
+		lengths := make([]float64, 0, 2)
+		for i, child := range cur.neigh {
+			if child == prev {
+				continue
+			}
+			if err := pruneRecur(child, cur); err != nil {
+				return err
+			}
+			children = append(children, child)
+			lengths = append(lengths, cur.br[i].Length()+vari[child])
+		}
+		c.Variance = lengths[0] + lengths[1]
+		if c.Variance <= 0 {
+			return errors.New("Some tips are separated by branches of length 0")
+		}
+		vari[cur] = lengths[0] * lengths[1] / c.Variance
+		for d := range nodevalues {
+			v1, v2 := nodevalues[d][children[0]], nodevalues[d][children[1]]
+			c.Values[d] = (v1 - v2) / math.Sqrt(c.Variance)
+			nodevalues[d][cur] = (v1*lengths[1] + v2*lengths[0]) / c.Variance
+		}
+		return nil
+	}
+	if err = pruneRecur(t.Root(), nil); err != nil {
+		return nil, err
+	}
+	return contrasts, nil
+}
+
+// Computes Blomberg's K statistic of phylogenetic signal (Blomberg et al. 2003) of
+// a continuous trait on the rooted tree: ratio of the observed MSE0/MSE (mean
+// squared error of the values around their phylogenetic mean, divided by the
+// mean squared error given the phylogenetic covariances) and of its expectation
+// under a Brownian motion model. K=1 under Brownian motion, K<1 if the trait is
+// less conserved than expected, and K>1 if it is more conserved.
+//
+// values gives the value of the trait of each tip, by name (index trait of each slice).
+// If permutations > 0, the p-value is the proportion of random permutations of
+// the values among the tips (global random generator) giving a K greater or
+// equal to the observed one (observed value included), otherwise it is NaN.
+func (t *Tree) BlombergK(values map[string][]float64, trait int, permutations int) (k, pvalue float64, err error) {
+	var nodevalues map[*Node]float64
+	if nodevalues, err = t.traitValues(values, trait); err != nil {
+		return
+	}
+	tips := t.Tips()
+	if len(tips) < 3 {
+		err = errors.New("Blomberg's K needs at least 3 tips")
+		return
+	}
+	// Trace of the phylogenetic covariance matrix: sum of the root-to-tip distances
+	depths := make(map[*Node]float64)
+	if err = nodeDistancesRecur(t.Root(), nil, 0, depths); err != nil {
+		return
+	}
+	tr := 0.0
+	for _, n := range tips {
+		tr += depths[n]
+	}
+	blombergK := func() (float64, error) {
+		res, err := bmPruneRecur(t.Root(), nil, func(e *Edge, child *Node) float64 { return e.Length() }, nodevalues)
+		if err != nil {
+			return 0, err
+		}
+		mse0 := 0.0
+		for _, n := range tips {
+			diff := nodevalues[n] - res.mean
+			mse0 += diff * diff
+		}
+		n := float64(len(tips))
+		return mse0 / res.sumsq / ((tr - n*res.vari) / (n - 1)), nil
+	}
+	if k, err = blombergK(); err != nil {
+		return
+	}
+	pvalue = math.NaN()
+	if permutations > 0 {
+		observed := make([]float64, len(tips))
+		for i, n := range tips {
+			observed[i] = nodevalues[n]
+		}
+		nb := 1
+		for p := 0; p < permutations; p++ {
+			for i, j := range rand.Perm(len(tips)) {
+				nodevalues[tips[i]] = observed[j]
+			}
+			kp, _ := blombergK()
+			if kp >= k {
+				nb++
+			}
+		}
+		pvalue = float64(nb) / float64(permutations+1)
+	}
+	return
+}
+
+// Computes Pagel's lambda (Pagel 1999) of a continuous trait on the rooted tree,
+// by maximum likelihood under a Brownian motion model in [0,1]: the phylogenetic
+// covariances between tips are multiplied by lambda, their variances being
+// unchanged (lambda=0: no phylogenetic signal, lambda=1: Brownian motion).
+//
+// values gives the value of the trait of each tip, by name (index trait of each slice).
+// Returns lambda, the maximum log-likelihood, the log-likelihood with lambda=0, and
+// the p-value of the likelihood ratio test of lambda=0 (chi-squared with 1 degree
+// of freedom).
+func (t *Tree) PagelLambda(values map[string][]float64, trait int) (lambda, lnl, lnl0, pvalue float64, err error) {
+	var nodevalues map[*Node]float64
+	if nodevalues, err = t.traitValues(values, trait); err != nil {
+		return
+	}
+	depths := make(map[*Node]float64)
+	if err = nodeDistancesRecur(t.Root(), nil, 0, depths); err != nil {
+		return
+	}
+	n := float64(len(t.Tips()))
+	loglik := func(l float64) (float64, error) {
+		res, err := bmPruneRecur(t.Root(), nil, func(e *Edge, child *Node) float64 {
+			return lambdaLength(e.Length(), depths[child], child.Tip(), l)
+		}, nodevalues)
+		if err != nil {
+			return 0, err
+		}
+		sigma2 := res.sumsq / n
+		return -0.5 * (n*math.Log(2*math.Pi*sigma2) + res.logdet + math.Log(res.vari) + n), nil
+	}
+	if lnl0, err = loglik(0); err != nil {
+		return
+	}
+	lambda, lnl = 0, lnl0
+	if l1, err1 := loglik(1); err1 == nil && l1 > lnl {
+		lambda, lnl = 1, l1
+	}
+	x, fx := mutils.BrentMinimize(func(l float64) float64 {
+		v, err := loglik(l)
+		if err != nil || math.IsNaN(v) {
+			return math.Inf(1)
+		}
+		return -v
+	}, 0, 1, 1e-10)
+	if -fx > lnl {
+		lambda, lnl = x, -fx
+	}
+	lr := math.Max(0, 2*(lnl-lnl0))
+	pvalue = math.Erfc(math.Sqrt(lr / 2))
+	return
+}
@@ -0,0 +1,209 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/fredericlemoine/bitset"
+)
+
+// Structure storing the splits (internal bipartitions) of
+// several sets of trees, typically several MCMC runs.
+//
+// Splits are counted using an EdgeIndex, whose value
+// (EdgeIndexInfo.Count) stores the identifier of the split.
+// For each run and each tree, the identifiers of its splits
+// are kept, so that split frequencies may be computed on any
+// range of trees of the runs (burnin, sliding windows, etc.).
+type SplitRuns struct {
+	tips   []string         // Sorted tip names: index of tips in the bitsets
+	index  *EdgeIndex       // All the splits seen so far, value=split id
+	splits []*bitset.BitSet // Splits by id
+	runs   [][][]int        // For each run, for each tree, ids of its splits
+	first  *Tree            // First tree added, to compare tip names
+}
+
+// Frequencies of a given split in several runs
+type SplitFrequency struct {
+	Split *bitset.BitSet // The split (bitset: index of tips are the ones of SplitRuns.Tips())
+	Freqs []float64      // Frequency of the split in each run
+	Mean  float64        // Mean frequency over all the runs
+	Sd    float64        // Standard deviation of the frequencies over all the runs
+}
+
+// Initializes a new SplitRuns structure with nbruns runs
+func NewSplitRuns(nbruns int) *SplitRuns {
+	return &SplitRuns{
+		tips:   nil,
+		index:  NewEdgeIndex(1024, .75),
+		splits: make([]*bitset.BitSet, 0, 1024),
+		runs:   make([][][]int, nbruns),
+		first:  nil,
+	}
+}
+
+// Adds the tree t to the given run.
+//
+// Tip index and bitsets of the tree are (re)initialized.
+// Only internal branches are taken into account, and if the
+// tree is rooted, the two branches around the root are counted once.
+//
+// Returns an error if the run does not exist or if the tree
+// does not have the same tip names as the previously added trees.
+func (sr *SplitRuns) AddTree(run int, t *Tree) error {
+	if run < 0 || run >= len(sr.runs) {
+		return fmt.Errorf("Run %d does not exist", run)
+	}
+	t.ReinitIndexes()
+	if sr.first == nil {
+		sr.first = t
+		sr.tips = t.SortedTips()
+	} else if err := sr.first.CompareTipIndexes(t); err != nil {
+		return err
+	}
+
+	ids := make([]int, 0, len(sr.tips))
+	seen := make(map[int]bool)
+	for _, e := range t.InternalEdges() {
+		if e.Bitset() == nil {
+			return errors.New("Bitset not initialized")
+		}
+		// Root edge of a rooted tree with a tip child
+		if e.Bitset().Count() <= 1 || e.Bitset().Count() >= e.Bitset().Len()-1 {
+			continue
+		}
+		v, ok := sr.index.Value(e)
+		if !ok {
+			sr.index.PutEdgeValue(e, len(sr.splits), 0)
+			v, _ = sr.index.Value(e)
+			sr.splits = append(sr.splits, e.Bitset().Clone())
+		}
+		if !seen[v.Count] {
+			ids = append(ids, v.Count)
+			seen[v.Count] = true
+		}
+	}
+	sr.runs[run] = append(sr.runs[run], ids)
+	return nil
+}
+
+// Number of runs
+func (sr *SplitRuns) NbRuns() int {
+	return len(sr.runs)
+}
+
+// Number of trees added in the given run
+func (sr *SplitRuns) NbTrees(run int) int {
+	return len(sr.runs[run])
+}
+
+// Tip names, in the order of their index in the split bitsets
+func (sr *SplitRuns) Tips() []string {
+	return sr.tips
+}
+
+// Computes the frequency of every split in each run, considering
+// trees in [start[i],end[i][ for run i.
+//
+// Splits are returned sorted by decreasing mean frequency, and
+// splits that are absent from all the considered trees are not
+// returned.
+//
+// Returns an error if the ranges are not compatible with the
+// number of trees of each run, or if a range is empty.
+func (sr *SplitRuns) Frequencies(start, end []int) ([]*SplitFrequency, error) {
+	if len(start) != len(sr.runs) || len(end) != len(sr.runs) {
+		return nil, errors.New("There must be one tree range per run")
+	}
+	counts := make([][]int, len(sr.splits))
+	for i := range counts {
+		counts[i] = make([]int, len(sr.runs))
+	}
+	for r, run := range sr.runs {
+		if start[r] < 0 || end[r] > len(run) || start[r] >= end[r] {
+			return nil, fmt.Errorf("Tree range [%d,%d[ is not valid for run %d (%d trees)", start[r], end[r], r, len(run))
+		}
+		for _, ids := range run[start[r]:end[r]] {
+			for _, id := range ids {
+				counts[id][r]++
+			}
+		}
+	}
+
+	freqs := make([]*SplitFrequency, 0, len(sr.splits))
+	for id, c := range counts {
+		sum := 0
+		for _, v := range c {
+			sum += v
+		}
+		if sum == 0 {
+			continue
+		}
+		sf := &SplitFrequency{
+			Split: sr.splits[id],
+			Freqs: make([]float64, len(sr.runs)),
+		}
+		for r, v := range c {
+			sf.Freqs[r] = float64(v) / float64(end[r]-start[r])
+			sf.Mean += sf.Freqs[r]
+		}
+		sf.Mean /= float64(len(sr.runs))
+		if len(sr.runs) > 1 {
+			for _, f := range sf.Freqs {
+				sf.Sd += (f - sf.Mean) * (f - sf.Mean)
+			}
+			sf.Sd = math.Sqrt(sf.Sd / float64(len(sr.runs)-1))
+		}
+		freqs = append(freqs, sf)
+	}
+	sort.SliceStable(freqs, func(i, j int) bool { return freqs[i].Mean > freqs[j].Mean })
+	return freqs, nil
+}
+
+// Returns the names of the tips on the lightest side of the split.
+//
+// If both sides have the same size, returns the side containing
+// the first tip (in alphabetical order).
+func (sr *SplitRuns) SplitTips(sf *SplitFrequency) []string {
+	set := sf.Split.Count() <= sf.Split.Len()-sf.Split.Count()
+	if sf.Split.Count() == sf.Split.Len()-sf.Split.Count() {
+		set = sf.Split.Test(0)
+	}
+	names := make([]string, 0, len(sr.tips))
+	for i, name := range sr.tips {
+		if sf.Split.Test(uint(i)) == set {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Computes the Average and Maximum Standard Deviation of Split
+// Frequencies (ASDSF and MSDSF) over all the splits whose frequency
+// is >= minfreq in at least one run (MrBayes uses minfreq=0.1).
+//
+// Returns NaN values if no split satisfies the condition.
+func ASDSF(freqs []*SplitFrequency, minfreq float64) (asdsf, msdsf float64) {
+	nb := 0
+	for _, sf := range freqs {
+		keep := false
+		for _, f := range sf.Freqs {
+			if f >= minfreq {
+				keep = true
+				break
+			}
+		}
+		if keep {
+			asdsf += sf.Sd
+			msdsf = math.Max(msdsf, sf.Sd)
+			nb++
+		}
+	}
+	if nb == 0 {
+		return math.NaN(), math.NaN()
+	}
+	asdsf /= float64(nb)
+	return
+}
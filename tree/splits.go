@@ -0,0 +1,419 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fredericlemoine/bitset"
+)
+
+// A weighted split (bipartition) of a set of taxa
+type Split struct {
+	bitset     *bitset.BitSet // Bit i is set if the tip i is on the right side of the split
+	weight     float64        // Weight of the split (e.g. mean branch length)
+	confidence float64        // Confidence of the split (e.g. frequency in a set of trees)
+}
+
+// A set of splits defined on the same set of taxa, possibly
+// incompatible with each other.
+type SplitSet struct {
+	tips   []string // Tip names: bit i of splits corresponds to tip i
+	splits []*Split
+}
+
+// Returns the bitset of the split
+func (s *Split) Bitset() *bitset.BitSet {
+	return s.bitset
+}
+
+// Returns the weight of the split
+func (s *Split) Weight() float64 {
+	return s.weight
+}
+
+// Returns the confidence of the split
+func (s *Split) Confidence() float64 {
+	return s.confidence
+}
+
+// Returns true if the split is trivial (one side has only one tip)
+func (s *Split) Trivial() bool {
+	return s.bitset.Count() <= 1 || s.bitset.Count() >= s.bitset.Len()-1
+}
+
+// Returns true if the two splits are compatible, i.e. if at least one of the
+// four intersections of their sides is empty
+func (s *Split) Compatible(s2 *Split) bool {
+	return s.bitset.IntersectionCardinality(s2.bitset) == 0 ||
+		s.bitset.IsSuperSet(s2.bitset) ||
+		s2.bitset.IsSuperSet(s.bitset) ||
+		s.bitset.UnionCardinality(s2.bitset) == s.bitset.Len()
+}
+
+// Initializes a new split set with the given tip names
+func NewSplitSet(tips []string) *SplitSet {
+	return &SplitSet{
+		tips:   tips,
+		splits: make([]*Split, 0, 2*len(tips)),
+	}
+}
+
+// Adds a split to the split set. The bitset must have
+// the same length as the number of tips of the split set.
+func (ss *SplitSet) AddSplit(b *bitset.BitSet, weight, confidence float64) error {
+	if b.Len() != uint(len(ss.tips)) {
+		return fmt.Errorf("Split length (%d) is different from the number of tips (%d)", b.Len(), len(ss.tips))
+	}
+	ss.splits = append(ss.splits, &Split{b, weight, confidence})
+	return nil
+}
+
+// Returns the tip names of the split set
+func (ss *SplitSet) Tips() []string {
+	return ss.tips
+}
+
+// Returns the splits of the split set
+func (ss *SplitSet) Splits() []*Split {
+	return ss.splits
+}
+
+// Returns true if all the splits of the set are pairwise compatible
+// (i.e. they can be represented by a tree).
+func (ss *SplitSet) Compatible() bool {
+	for i, s := range ss.splits {
+		for _, s2 := range ss.splits[i+1:] {
+			if !s.Compatible(s2) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Computes the set of splits present in a proportion >= cutoff of the
+// input trees (including trivial splits). Contrary to the Consensus function,
+// the cutoff may be < 0.5 so that the resulting splits may be incompatible.
+//
+// In the output split set:
+//	1) Split confidences are the proportion of trees in which they are present
+//	2) Split weights are the average length of the corresponding branches over all
+//     the trees where they are present (or their frequency if trees have no branch length)
+//
+// The tip names must be the same in all the trees, otherwise returns an error.
+func ConsensusSplits(trees <-chan Trees, cutoff float64) (*SplitSet, error) {
+	if cutoff < 0 || cutoff > 1 {
+		return nil, errors.New("Min frequency for splits must be >=0 and <=1")
+	}
+	nbtrees := 0
+	edgeindex := NewEdgeIndex(128, .75)
+	var first *Tree
+	var splits *SplitSet
+	for curtree := range trees {
+		if curtree.Err != nil {
+			/* We empty the channel if needed */
+			for _ = range trees {
+			}
+			return nil, curtree.Err
+		}
+		curtree.Tree.ReinitIndexes()
+		if first == nil {
+			first = curtree.Tree
+			splits = NewSplitSet(first.SortedTips())
+		} else if err := first.CompareTipIndexes(curtree.Tree); err != nil {
+			for _ = range trees {
+			}
+			return nil, err
+		}
+		// Both edges of a rooted tree define the same split:
+		// we take only one of them
+		var rootedge *Edge
+		if curtree.Tree.Rooted() {
+			rootedge = curtree.Tree.Root().Edges()[1]
+			if rootedge.Right().Tip() {
+				rootedge = curtree.Tree.Root().Edges()[0]
+			}
+		}
+		for _, e := range curtree.Tree.Edges() {
+			if e == rootedge {
+				continue
+			}
+			edgeindex.AddEdgeCount(e)
+		}
+		nbtrees++
+	}
+	if nbtrees == 0 {
+		return nil, errors.New("No tree given as input")
+	}
+
+	mincount := int(cutoff * float64(nbtrees))
+	if float64(mincount) < cutoff*float64(nbtrees) {
+		mincount++
+	}
+	kvs := edgeindex.BitSets(0, nbtrees)
+	sort.SliceStable(kvs, func(i, j int) bool {
+		if kvs[i].val.Count == kvs[j].val.Count {
+			return kvs[i].key.Count() < kvs[j].key.Count()
+		}
+		return kvs[i].val.Count > kvs[j].val.Count
+	})
+	for _, kv := range kvs {
+		if kv.val.Count < mincount || kv.key.None() || kv.key.All() {
+			continue
+		}
+		weight := kv.val.Len / float64(kv.val.Count)
+		if weight < 0 {
+			weight = float64(kv.val.Count) / float64(nbtrees)
+		}
+		splits.AddSplit(kv.key.Clone(), weight, float64(kv.val.Count)/float64(nbtrees))
+	}
+	return splits, nil
+}
+
+// Returns a Nexus representation of the split set, with a TAXA
+// block and a SPLITS block, readable by SplitsTree.
+//
+// For each split, the listed taxa are the ones of the side that does not
+// contain the first taxon (taxa are numbered from 1).
+func (ss *SplitSet) Nexus() string {
+	var buffer bytes.Buffer
+	buffer.WriteString("#NEXUS\n")
+	buffer.WriteString("BEGIN TAXA;\n")
+	buffer.WriteString(" DIMENSIONS NTAX=")
+	buffer.WriteString(strconv.Itoa(len(ss.tips)))
+	buffer.WriteString(";\n")
+	buffer.WriteString(" TAXLABELS")
+	for _, tip := range ss.tips {
+		buffer.WriteString(" '" + tip + "'")
+	}
+	buffer.WriteString(";\n")
+	buffer.WriteString("END;\n")
+	buffer.WriteString("BEGIN SPLITS;\n")
+	buffer.WriteString(fmt.Sprintf(" DIMENSIONS NTAX=%d NSPLITS=%d;\n", len(ss.tips), len(ss.splits)))
+	buffer.WriteString(" FORMAT LABELS=NO WEIGHTS=YES CONFIDENCES=YES;\n")
+	if ss.Compatible() {
+		buffer.WriteString(" PROPERTIES COMPATIBLE;\n")
+	}
+	buffer.WriteString(" MATRIX\n")
+	for i, s := range ss.splits {
+		side := !s.bitset.Test(0)
+		size := s.bitset.Count()
+		if !side {
+			size = s.bitset.Len() - size
+		}
+		buffer.WriteString(fmt.Sprintf(" [%d, size=%d]\t%s\t%s\t", i+1, size,
+			strconv.FormatFloat(s.weight, 'f', -1, 64),
+			strconv.FormatFloat(s.confidence, 'f', -1, 64)))
+		nb := 0
+		for t := range ss.tips {
+			if s.bitset.Test(uint(t)) == side {
+				if nb > 0 {
+					buffer.WriteRune(' ')
+				}
+				buffer.WriteString(strconv.Itoa(t + 1))
+				nb++
+			}
+		}
+		buffer.WriteString(",\n")
+	}
+	buffer.WriteString(" ;\n")
+	buffer.WriteString("END;\n")
+	return buffer.String()
+}
+
+// A node of a splits graph
+type SplitGraphNode struct {
+	id   int
+	sign *bitset.BitSet // Side of the node for each split (same convention as split bitsets)
+	tips []string       // Tips carried by the node (may be empty)
+}
+
+// An edge of a splits graph, corresponding to a split of the SplitSet
+type SplitGraphEdge struct {
+	left, right *SplitGraphNode
+	split       int // Index of the split in the SplitSet
+}
+
+// A splits graph: each split of the split set is represented by
+// a set of parallel edges. If all the splits are compatible, it is a tree.
+type SplitGraph struct {
+	splits *SplitSet
+	nodes  []*SplitGraphNode
+	edges  []*SplitGraphEdge
+}
+
+// Returns the id of the node
+func (n *SplitGraphNode) Id() int {
+	return n.id
+}
+
+// Returns the tips carried by the node
+func (n *SplitGraphNode) Tips() []string {
+	return n.tips
+}
+
+// Returns the left node of the edge
+func (e *SplitGraphEdge) Left() *SplitGraphNode {
+	return e.left
+}
+
+// Returns the right node of the edge
+func (e *SplitGraphEdge) Right() *SplitGraphNode {
+	return e.right
+}
+
+// Returns the index of the split represented by the edge
+func (e *SplitGraphEdge) Split() int {
+	return e.split
+}
+
+// Returns the nodes of the splits graph
+func (g *SplitGraph) Nodes() []*SplitGraphNode {
+	return g.nodes
+}
+
+// Returns the edges of the splits graph
+func (g *SplitGraph) Edges() []*SplitGraphEdge {
+	return g.edges
+}
+
+// Builds the splits graph of the split set, using the convex hull
+// algorithm (Dress & Huson, 2004).
+//
+// Splits are inserted one after the other. For split A|B, the nodes
+// in the convex hulls of both A and B are duplicated and connected by
+// an edge corresponding to the split. The convex hull of a set of tips X
+// is computed as the intersection of the half-spaces (sides of already
+// inserted splits) containing X.
+//
+// The graph being an isometric subgraph of a hypercube, two nodes are
+// connected iff their sides differ for exactly one split.
+func (ss *SplitSet) Graph() *SplitGraph {
+	nsplits := uint(len(ss.splits))
+	root := &SplitGraphNode{
+		sign: bitset.New(nsplits),
+		tips: make([]string, len(ss.tips)),
+	}
+	copy(root.tips, ss.tips)
+	tipindex := make(map[string]uint)
+	for i, t := range ss.tips {
+		tipindex[t] = uint(i)
+	}
+	nodes := []*SplitGraphNode{root}
+
+	for k, s := range ss.splits {
+		// For each already inserted split, the side containing all
+		// tips of A (resp. B), or -1 if A (resp. B) is on both sides
+		sidesA := make([]int, k)
+		sidesB := make([]int, k)
+		for j, s2 := range ss.splits[:k] {
+			sidesA[j] = hullSide(s.bitset, false, s2.bitset)
+			sidesB[j] = hullSide(s.bitset, true, s2.bitset)
+		}
+		newnodes := make([]*SplitGraphNode, 0, 2*len(nodes))
+		for _, n := range nodes {
+			inA := inHull(n, sidesA)
+			inB := inHull(n, sidesB)
+			if inA && inB {
+				dup := &SplitGraphNode{sign: n.sign.Clone()}
+				dup.sign.Set(uint(k))
+				tipsA := make([]string, 0, len(n.tips))
+				for _, t := range n.tips {
+					if s.bitset.Test(tipindex[t]) {
+						dup.tips = append(dup.tips, t)
+					} else {
+						tipsA = append(tipsA, t)
+					}
+				}
+				n.tips = tipsA
+				newnodes = append(newnodes, n, dup)
+			} else {
+				if inB {
+					n.sign.Set(uint(k))
+				}
+				newnodes = append(newnodes, n)
+			}
+		}
+		nodes = newnodes
+	}
+
+	g := &SplitGraph{
+		splits: ss,
+		nodes:  nodes,
+		edges:  make([]*SplitGraphEdge, 0, len(nodes)),
+	}
+	for i, n := range nodes {
+		n.id = i
+	}
+	for i, n := range nodes {
+		for _, n2 := range nodes[i+1:] {
+			if n.sign.SymmetricDifferenceCardinality(n2.sign) == 1 {
+				diff := n.sign.SymmetricDifference(n2.sign)
+				idx, _ := diff.NextSet(0)
+				g.edges = append(g.edges, &SplitGraphEdge{n, n2, int(idx)})
+			}
+		}
+	}
+	return g
+}
+
+// Returns the side (0 or 1) of split s2 containing all the tips of
+// the side of split s given by "side", or -1 if these tips are on both sides of s2
+func hullSide(s *bitset.BitSet, side bool, s2 *bitset.BitSet) int {
+	in1, in0 := false, false
+	for i := uint(0); i < s.Len(); i++ {
+		if s.Test(i) == side {
+			if s2.Test(i) {
+				in1 = true
+			} else {
+				in0 = true
+			}
+		}
+	}
+	if in1 && in0 {
+		return -1
+	} else if in1 {
+		return 1
+	}
+	return 0
+}
+
+// Returns true if the node is in all the given half-spaces
+func inHull(n *SplitGraphNode, sides []int) bool {
+	for j, side := range sides {
+		if side != -1 && n.sign.Test(uint(j)) != (side == 1) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns a Graphviz DOT representation of the splits graph.
+//
+// Nodes carrying tips are labelled with the tip names, and edges are
+// labelled with the id of their split (starting at 1, as in the Nexus output),
+// and have attributes "weight" and "confidence" of their split.
+func (g *SplitGraph) Dot() string {
+	var buffer bytes.Buffer
+	buffer.WriteString("graph splits {\n")
+	for _, n := range g.nodes {
+		if len(n.tips) > 0 {
+			buffer.WriteString(fmt.Sprintf("  n%d [label=\"%s\"];\n", n.id, strings.Join(n.tips, ",")))
+		} else {
+			buffer.WriteString(fmt.Sprintf("  n%d [label=\"\",shape=point];\n", n.id))
+		}
+	}
+	for _, e := range g.edges {
+		s := g.splits.splits[e.split]
+		buffer.WriteString(fmt.Sprintf("  n%d -- n%d [label=\"%d\",weight=\"%s\",confidence=\"%s\"];\n",
+			e.left.id, e.right.id, e.split+1,
+			strconv.FormatFloat(s.weight, 'f', -1, 64),
+			strconv.FormatFloat(s.confidence, 'f', -1, 64)))
+	}
+	buffer.WriteString("}\n")
+	return buffer.String()
+}
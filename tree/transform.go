@@ -0,0 +1,147 @@
+package tree
+
+import (
+	"errors"
+	"math"
+)
+
+// Branch length transformations used by TransformLengths
+const (
+	TRANSFORM_LAMBDA = iota // Pagel's lambda: scales internal branches
+	TRANSFORM_KAPPA         // Pagel's kappa: raises branch lengths to a power
+	TRANSFORM_DELTA         // Pagel's delta: raises node depths to a power
+	TRANSFORM_GRAFEN        // Grafen's method: lengths from the number of tips below nodes
+	TRANSFORM_OU            // Ornstein-Uhlenbeck: covariances under an OU process
+)
+
+// Transforms the branch lengths of the tree with one of the standard models of
+// comparative methods. Depths are distances from the root, the depth of the tree
+// (T) being the largest root-to-tip distance, such that non-ultrametric trees keep
+// the depths of their tips relative to each other:
+//   - TRANSFORM_LAMBDA (Pagel 1999): internal branches are multiplied by param (in
+//     [0,1]), and terminal branches are extended such that root-to-tip distances
+//     are unchanged (0: star tree, 1: unchanged tree)
+//   - TRANSFORM_KAPPA (Pagel 1999): each length l is replaced by l^param (param >= 0,
+//     0: all lengths are 1, 1: unchanged tree)
+//   - TRANSFORM_DELTA (Pagel 1999): the depth d of each node is replaced by
+//     T*(d/T)^param (param > 0): param < 1 lengthens the branches near the root,
+//     and param > 1 lengthens the branches near the tips
+//   - TRANSFORM_GRAFEN (Grafen 1989): branch lengths are not needed. The height of
+//     each internal node is ((number of tips below) - 1)/((number of tips) - 1),
+//     raised to the power param (param > 0), tips having height 0
+//   - TRANSFORM_OU: the depth d of each node is replaced by
+//     exp(-2*alpha*(T-d))*(1-exp(-2*alpha*d))/(2*alpha), alpha being param (>=0),
+//     such that the covariances of the tips under a Brownian motion on the
+//     transformed tree are those of an Ornstein-Uhlenbeck process with strength
+//     alpha on the original tree (alpha=0: unchanged tree)
+//
+// All the transformations except TRANSFORM_KAPPA need a rooted tree. Returns an
+// error if the tree is not rooted, if a branch does not have a length (except
+// for TRANSFORM_GRAFEN), or if the parameter is not valid.
+func (t *Tree) TransformLengths(model int, param float64) error {
+	switch model {
+	case TRANSFORM_LAMBDA:
+		if param < 0 || param > 1 {
+			return errors.New("Lambda must be in [0,1]")
+		}
+	case TRANSFORM_KAPPA, TRANSFORM_OU:
+		if param < 0 {
+			return errors.New("Kappa and alpha must be >= 0")
+		}
+	case TRANSFORM_DELTA, TRANSFORM_GRAFEN:
+		if param <= 0 {
+			return errors.New("Delta and Grafen's power must be > 0")
+		}
+	default:
+		return errors.New("Unknown branch length transformation")
+	}
+	if model != TRANSFORM_KAPPA && !t.Rooted() {
+		return errors.New("The tree must be rooted")
+	}
+	if model == TRANSFORM_GRAFEN {
+		t.grafenLengths(param)
+		return nil
+	}
+
+	heights, err := t.NodeHeights()
+	if err != nil {
+		return err
+	}
+	depth := heights[t.Root()]
+	// Depths of the nodes: distances from the root
+	depths := make(map[*Node]float64, len(heights))
+	for n, h := range heights {
+		depths[n] = depth - h
+	}
+	newdepth := func(d float64) float64 {
+		switch model {
+		case TRANSFORM_DELTA:
+			return depth * math.Pow(d/depth, param)
+		case TRANSFORM_OU:
+			if param == 0 {
+				return d
+			}
+			return math.Exp(-2*param*(depth-d)) * (1 - math.Exp(-2*param*d)) / (2 * param)
+		}
+		return d
+	}
+
+	t.PreOrder(func(cur *Node, prev *Node, e *Edge) (keep bool) {
+		if prev == nil {
+			return true
+		}
+		switch model {
+		case TRANSFORM_LAMBDA:
+			e.SetLength(lambdaLength(e.Length(), depths[cur], cur.Tip(), param))
+		case TRANSFORM_KAPPA:
+			e.SetLength(math.Pow(e.Length(), param))
+		default:
+			if depth > 0 {
+				e.SetLength(newdepth(depths[cur]) - newdepth(depths[prev]))
+			}
+		}
+		return true
+	})
+	return nil
+}
+
+// Length of a branch transformed by Pagel's lambda: internal branches are
+// multiplied by lambda, and terminal branches are extended such that the
+// distance from the root to their tip (tipdepth) is unchanged
+func lambdaLength(length, tipdepth float64, tip bool, lambda float64) float64 {
+	if tip {
+		return lambda*length + (1-lambda)*tipdepth
+	}
+	return lambda * length
+}
+
+// Sets branch lengths with Grafen's method
+func (t *Tree) grafenLengths(power float64) {
+	ntips := float64(len(t.Tips()))
+	heights := make(map[*Node]float64)
+	var recur func(cur, prev *Node) int
+	recur = func(cur, prev *Node) int {
+		if cur.Tip() && prev != nil {
+			heights[cur] = 0
+			return 1
+		}
+		nb := 0
+		for _, child := range cur.neigh {
+			if child != prev {
+				nb += recur(child, cur)
+			}
+		}
+		heights[cur] = 0
+		if ntips > 1 {
+			heights[cur] = math.Pow(float64(nb-1)/(ntips-1), power)
+		}
+		return nb
+	}
+	recur(t.Root(), nil)
+	t.PreOrder(func(cur *Node, prev *Node, e *Edge) (keep bool) {
+		if prev != nil {
+			e.SetLength(heights[prev] - heights[cur])
+		}
+		return true
+	})
+}
@@ -3,7 +3,9 @@ package tree
 import (
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
+	"sort"
 	"strconv"
 
 	"github.com/fredericlemoine/gostats"
@@ -482,3 +484,338 @@ func allTopologies_recur(t *Tree, nbTips, total int, trees *[]*Tree, tipNames ..
 	}
 	return nil
 }
+
+// Node of a simulated birth-death process
+type bdNode struct {
+	time     float64 // Time of the event (speciation, extinction or end of the process)
+	children []*bdNode
+	extinct  bool
+	sampled  bool
+}
+
+// Creates a random birth-death tree by simulating forward in time a constant rate
+// birth-death process, starting with two lineages at time 0 (crown).
+//	* nbtips : If > 0, the process stops when the number of extant lineages reaches
+//	  round(nbtips/sampling), just before the next event, and nbtips of them are sampled
+//	* maxtime: If nbtips <= 0, the process stops at time maxtime, and each extant
+//	  lineage is sampled with probability sampling
+//	* birth, death: speciation and extinction rates
+//	* sampling: Sampling fraction of extant lineages, in ]0,1]
+//	* complete: if true, the complete tree is returned, with extinct (named ExtinctTip<i>)
+//	  and unsampled (named UnsampledTip<i>) lineages. Otherwise, the reconstructed tree
+//	  is returned: only sampled lineages are kept, and internal nodes having only one
+//	  remaining child are removed
+//	* rooted: if false, the tree is unrooted
+//	* branch lengths: durations of the lineages
+//
+// Simulations in which less than 2 lineages are sampled are discarded, and the process is
+// simulated again (at most 10000 times).
+func RandomBirthDeathTree(nbtips int, maxtime, birth, death, sampling float64, complete, rooted bool) (*Tree, error) {
+	if birth <= 0 || death < 0 {
+		return nil, errors.New("Birth rate must be > 0 and death rate must be >= 0")
+	}
+	if sampling <= 0 || sampling > 1 {
+		return nil, errors.New("Sampling fraction must be in ]0,1]")
+	}
+	if nbtips <= 0 && maxtime <= 0 {
+		return nil, errors.New("Either a number of tips or a maximum time must be given")
+	}
+	if nbtips > 0 && nbtips < 2 {
+		return nil, errors.New("Cannot create a birth-death tree with less than 2 tips")
+	}
+	target := 0
+	if nbtips > 0 {
+		target = int(float64(nbtips)/sampling + 0.5)
+	}
+
+	for try := 0; try < 10000; try++ {
+		root, extant := simulateBirthDeath(target, maxtime, birth, death)
+		if len(extant) == 0 {
+			continue
+		}
+		nsampled := 0
+		if nbtips > 0 {
+			for _, i := range rand.Perm(len(extant))[:nbtips] {
+				extant[i].sampled = true
+			}
+			nsampled = nbtips
+		} else {
+			for _, n := range extant {
+				if rand.Float64() < sampling {
+					n.sampled = true
+					nsampled++
+				}
+			}
+		}
+		if nsampled < 2 {
+			continue
+		}
+
+		t := NewTree()
+		counts := make([]int, 3)
+		var r *Node
+		if complete {
+			r = completeBirthDeathTree(t, root, counts)
+		} else {
+			r, _ = reconstructedBirthDeathTree(t, root, counts)
+		}
+		t.SetRoot(r)
+		t.UpdateTipIndex()
+		if !rooted {
+			t.UnRoot()
+		}
+		return t, nil
+	}
+	return nil, errors.New("The birth-death process did not produce at least 2 sampled lineages in 10000 simulations")
+}
+
+// Simulates the birth-death process with the Gillespie algorithm, and returns the
+// root and the extant lineages at the end of the process
+func simulateBirthDeath(target int, maxtime, birth, death float64) (root *bdNode, active []*bdNode) {
+	var end float64
+
+	root = &bdNode{time: 0}
+	root.children = []*bdNode{{}, {}}
+	active = []*bdNode{root.children[0], root.children[1]}
+	time := 0.0
+	for len(active) > 0 {
+		n := len(active)
+		w := gostats.Exp(float64(n) * (birth + death))
+		if target > 0 && n >= target {
+			// Stops just before the next event
+			end = time + w
+			break
+		}
+		if target <= 0 && time+w >= maxtime {
+			end = maxtime
+			break
+		}
+		time += w
+		i := rand.Intn(n)
+		l := active[i]
+		l.time = time
+		if rand.Float64() < birth/(birth+death) {
+			l.children = []*bdNode{{}, {}}
+			active[i] = l.children[0]
+			active = append(active, l.children[1])
+		} else {
+			l.extinct = true
+			active[i] = active[n-1]
+			active = active[:n-1]
+		}
+	}
+	for _, l := range active {
+		l.time = end
+	}
+	return
+}
+
+// Builds the complete tree below the given simulated node. counts are the numbers
+// of sampled, extinct and unsampled tips already named.
+func completeBirthDeathTree(t *Tree, n *bdNode, counts []int) *Node {
+	node := t.NewNode()
+	switch {
+	case len(n.children) > 0:
+		for _, c := range n.children {
+			child := completeBirthDeathTree(t, c, counts)
+			e := t.ConnectNodes(node, child)
+			e.SetLength(c.time - n.time)
+		}
+	case n.extinct:
+		node.SetName(fmt.Sprintf("ExtinctTip%d", counts[1]))
+		counts[1]++
+	case n.sampled:
+		node.SetName(fmt.Sprintf("Tip%d", counts[0]))
+		counts[0]++
+	default:
+		node.SetName(fmt.Sprintf("UnsampledTip%d", counts[2]))
+		counts[2]++
+	}
+	return node
+}
+
+// Builds the reconstructed tree below the given simulated node: Returns the
+// first node below n having two sampled subtrees (or a sampled tip), with its
+// time, or nil if there is no sampled tip below n.
+func reconstructedBirthDeathTree(t *Tree, n *bdNode, counts []int) (*Node, float64) {
+	if len(n.children) == 0 {
+		if n.extinct || !n.sampled {
+			return nil, 0
+		}
+		node := t.NewNode()
+		node.SetName(fmt.Sprintf("Tip%d", counts[0]))
+		counts[0]++
+		return node, n.time
+	}
+	nodes := make([]*Node, 0, 2)
+	times := make([]float64, 0, 2)
+	for _, c := range n.children {
+		if child, time := reconstructedBirthDeathTree(t, c, counts); child != nil {
+			nodes = append(nodes, child)
+			times = append(times, time)
+		}
+	}
+	switch len(nodes) {
+	case 0:
+		return nil, 0
+	case 1:
+		return nodes[0], times[0]
+	}
+	node := t.NewNode()
+	for i, child := range nodes {
+		e := t.ConnectNodes(node, child)
+		e.SetLength(times[i] - n.time)
+	}
+	return node, n.time
+}
+
+// Effective population size through time, used to simulate coalescent trees.
+// Times are given backward: 0 is the present, and t > 0 is t time units before.
+type PopulationSize interface {
+	// Returns the time t >= from such that the integral of 1/N(s) between from
+	// and t is equal to x (+Inf if this never happens)
+	CoalescentTime(from, x float64) float64
+}
+
+// Constant population size N
+type ConstantPopSize struct {
+	N float64
+}
+
+func (p *ConstantPopSize) CoalescentTime(from, x float64) float64 {
+	return from + x*p.N
+}
+
+// Exponentially growing population: N(t) = N0*exp(-Growth*t)
+// (N0 is the present size, and Growth is the growth rate forward in time)
+type ExponentialPopSize struct {
+	N0     float64
+	Growth float64
+}
+
+func (p *ExponentialPopSize) CoalescentTime(from, x float64) float64 {
+	if p.Growth == 0 {
+		return from + x*p.N0
+	}
+	// integral = (exp(g*t) - exp(g*from))/(g*N0)
+	v := math.Exp(p.Growth*from) + x*p.Growth*p.N0
+	if v <= 0 {
+		return math.Inf(1)
+	}
+	return math.Log(v) / p.Growth
+}
+
+// Piecewise constant population size: Sizes[0] between 0 and Times[0],
+// Sizes[i] between Times[i-1] and Times[i], and Sizes[len(Times)] after
+// the last time. Times must be sorted in increasing order.
+type PiecewisePopSize struct {
+	Times []float64
+	Sizes []float64
+}
+
+func (p *PiecewisePopSize) CoalescentTime(from, x float64) float64 {
+	i := sort.SearchFloat64s(p.Times, from)
+	if i < len(p.Times) && p.Times[i] == from {
+		i++
+	}
+	cur := from
+	for ; i < len(p.Times); i++ {
+		// Integral until the end of the current interval
+		d := (p.Times[i] - cur) / p.Sizes[i]
+		if d >= x {
+			return cur + x*p.Sizes[i]
+		}
+		x -= d
+		cur = p.Times[i]
+	}
+	return cur + x*p.Sizes[len(p.Times)]
+}
+
+// Creates a random coalescent tree (Kingman coalescent) with the given
+// population size function.
+//	* names: Names of the tips
+//	* heights: Sampling times of the tips (backward in time: 0 is the present),
+//	  all 0 for isochronous sampling. If nil, all the tips are sampled at time 0
+//	* popsize: Population size function. With k lineages at time t, two random lineages
+//	  coalesce at rate k(k-1)/2/N(t)
+//	* rooted: if false, the tree is unrooted
+//	* branch lengths: in time units
+func RandomCoalescentTree(names []string, heights []float64, popsize PopulationSize, rooted bool) (*Tree, error) {
+	if len(names) < 2 {
+		return nil, errors.New("Cannot create a coalescent tree with less than 2 tips")
+	}
+	if heights != nil && len(heights) != len(names) {
+		return nil, errors.New("There should be as many sampling times as tips")
+	}
+
+	t := NewTree()
+	type sample struct {
+		node   *Node
+		height float64
+	}
+	samples := make([]sample, len(names))
+	for i, name := range names {
+		n := t.NewNode()
+		n.SetName(name)
+		samples[i].node = n
+		if heights != nil {
+			if heights[i] < 0 {
+				return nil, fmt.Errorf("Sampling time of tip %s is negative", name)
+			}
+			samples[i].height = heights[i]
+		}
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].height < samples[j].height })
+
+	lineages := make([]*Node, 0, len(names))
+	nodeheights := make(map[*Node]float64, 2*len(names))
+	next := 0
+	time := samples[0].height
+	for next < len(samples) || len(lineages) > 1 {
+		// Adds the lineages sampled at the current time
+		for next < len(samples) && samples[next].height <= time {
+			lineages = append(lineages, samples[next].node)
+			nodeheights[samples[next].node] = samples[next].height
+			next++
+		}
+		k := len(lineages)
+		if k < 2 {
+			time = samples[next].height
+			continue
+		}
+		ctime := popsize.CoalescentTime(time, gostats.Exp(float64(k*(k-1))/2.0))
+		if next < len(samples) && samples[next].height < ctime {
+			// Next sample before the coalescence: as the process is memoryless,
+			// the waiting time is drawn again after the new sample
+			time = samples[next].height
+			continue
+		}
+		if math.IsInf(ctime, 1) || math.IsNaN(ctime) {
+			return nil, errors.New("Lineages never coalesce with the given population sizes")
+		}
+		i := rand.Intn(k)
+		j := rand.Intn(k - 1)
+		if j >= i {
+			j++
+		}
+		n := t.NewNode()
+		for _, c := range []*Node{lineages[i], lineages[j]} {
+			e := t.ConnectNodes(n, c)
+			e.SetLength(ctime - nodeheights[c])
+		}
+		nodeheights[n] = ctime
+		if i > j {
+			i, j = j, i
+		}
+		lineages[i] = n
+		lineages[j] = lineages[k-1]
+		lineages = lineages[:k-1]
+		time = ctime
+	}
+	t.SetRoot(lineages[0])
+	t.UpdateTipIndex()
+	if !rooted {
+		t.UnRoot()
+	}
+	return t, nil
+}
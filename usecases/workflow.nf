@@ -54,7 +54,7 @@ process simulAlign {
 	shell:
 	'''
 	#!/usr/bin/env bash
-	seq-gen -l 50 -mLG -z !{seed} !{tree}  > align.phy
+	gotree generate sequences -i !{tree} -l 50 --model lg --seed !{seed} -p -o align.phy
 	'''
 }
 
@@ -68,7 +68,7 @@ process reformatPhylip {
 	shell:
 	'''
 	#!/usr/bin/env bash
-	goalign reformat phylip -p --input-strict -i !{align} > align_clean.phy
+	goalign reformat phylip -p -i !{align} > align_clean.phy
 	'''
 }
 